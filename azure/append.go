@@ -0,0 +1,116 @@
+package azure
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxAppendAttempts is how often AppendToFile retries when someone else
+// changed the file at the same time.
+const maxAppendAttempts = 5
+
+// errAppendConflict marks a concurrent modification of the appended file.
+var errAppendConflict = errors.New("file was modified concurrently")
+
+// AppendToFile appends data to a small text file on the remote, creating it if
+// it doesn't exist. OneDrive can't append, so the file is downloaded, extended
+// and uploaded again with its eTag as precondition. Concurrent appends from
+// other clients are detected and retried, so no line is lost.
+//
+// Parameters:
+//   - httpClient: An *http.Client to make the HTTP requests
+//   - remotePath: The path of the file in OneDrive, including the remote's root folder
+//   - data: The data to append, usually a single line including its newline
+//
+// Returns:
+//   - error: Any error encountered, after retrying concurrent modifications
+func (client *AzureClient) AppendToFile(httpClient *http.Client, remotePath string, data []byte) error {
+	var err error
+	for attempt := 0; attempt < maxAppendAttempts; attempt++ {
+		if attempt > 0 {
+			client.Backoff.Sleep(attempt - 1)
+		}
+
+		err = client.appendOnce(httpClient, remotePath, data)
+		if !errors.Is(err, errAppendConflict) {
+			return err
+		}
+	}
+	return fmt.Errorf("failed to append to %s after %d attempts: %w", remotePath, maxAppendAttempts, err)
+}
+
+func (client *AzureClient) appendOnce(httpClient *http.Client, remotePath string, data []byte) error {
+	item, err := client.GetItem(httpClient, remotePath)
+	if errors.Is(err, ErrItemNotFound) {
+		// Nobody wrote the file yet, fail instead of replacing it if someone beats us to it
+		_, err := client.UploadSmall(httpClient, remotePath, data, ConflictFail)
+		if errors.Is(err, ErrAlreadyExists) {
+			return errAppendConflict
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	content, err := client.downloadContent(httpClient, item.ID)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("PUT", client.driveURL("/items/"+url.PathEscape(item.ID)+"/content"), bytes.NewReader(append(content, data...)))
+	if err != nil {
+		return fmt.Errorf("failed to create upload request: %v", err)
+	}
+	req.Header.Set("Authorization", client.bearer())
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("If-Match", item.ETag)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload file: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return nil
+	case http.StatusPreconditionFailed:
+		return errAppendConflict
+	default:
+		return fmt.Errorf("failed to upload file: %w", newGraphError(resp))
+	}
+}
+
+// downloadContent downloads the content of a small file by its ID.
+func (client *AzureClient) downloadContent(httpClient *http.Client, itemID string) ([]byte, error) {
+	req, err := http.NewRequest("GET", client.driveURL("/items/"+url.PathEscape(itemID)+"/content"), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create download request: %v", err)
+	}
+	req.Header.Set("Authorization", client.bearer())
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download file: %w", newGraphError(resp))
+	}
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %v", err)
+	}
+	if len(content) > 0 && !strings.HasSuffix(string(content), "\n") {
+		content = append(content, '\n')
+	}
+	return content, nil
+}
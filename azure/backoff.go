@@ -0,0 +1,134 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"time"
+)
+
+// Default values used when a Backoff is left (partially) unset.
+const (
+	DefaultBackoffBase       = 2 * time.Second
+	DefaultBackoffCap        = 60 * time.Second
+	DefaultBackoffMultiplier = 2.0
+	DefaultMaxRetries        = 3
+)
+
+// Backoff describes an exponential backoff policy with jitter that is used by
+// every retry path in this package (chunk uploads, token refresh, quota queries)
+// and by callers that retry on their own, like hash fetches.
+//
+// Fields:
+//   - Base: Delay before the first retry
+//   - Cap: Upper bound of any single delay
+//   - Multiplier: Growth factor applied to the delay after each attempt
+//
+// Zero fields fall back to the package defaults.
+type Backoff struct {
+	Base       time.Duration
+	Cap        time.Duration
+	Multiplier float64
+}
+
+// DefaultBackoff returns the backoff policy used when none is configured.
+func DefaultBackoff() Backoff {
+	return Backoff{
+		Base:       DefaultBackoffBase,
+		Cap:        DefaultBackoffCap,
+		Multiplier: DefaultBackoffMultiplier,
+	}
+}
+
+// Delay returns how long to wait before retry number attempt (starting at 0).
+//
+// The delay grows as Base * Multiplier^attempt, is capped at Cap, and then
+// "equal jitter" is applied: half of the delay is fixed and the other half is
+// random. This keeps a guaranteed minimum wait while still spreading out
+// retries of concurrent workers hitting the same throttled endpoint.
+func (b Backoff) Delay(attempt int) time.Duration {
+	def := DefaultBackoff()
+	if b.Base <= 0 {
+		b.Base = def.Base
+	}
+	if b.Cap <= 0 {
+		b.Cap = def.Cap
+	}
+	if b.Multiplier < 1 {
+		b.Multiplier = def.Multiplier
+	}
+	if attempt < 0 {
+		attempt = 0
+	}
+
+	delay := float64(b.Base) * math.Pow(b.Multiplier, float64(attempt))
+	if delay > float64(b.Cap) || math.IsInf(delay, 0) {
+		delay = float64(b.Cap)
+	}
+
+	half := delay / 2
+	return time.Duration(half + rand.Float64()*half)
+}
+
+// Sleep blocks for Delay(attempt).
+func (b Backoff) Sleep(attempt int) {
+	time.Sleep(b.Delay(attempt))
+}
+
+// retry calls fn until it succeeds, fails in a way retrying can't fix, or
+// maxRetries attempts have been made, sleeping according to the client's
+// backoff policy in between. A Retry-After hint from a throttled response
+// takes precedence over the computed delay, up to the policy's cap. The error
+// of the last attempt is returned.
+func (client *AzureClient) retry(fn func() error) error {
+	maxRetries := client.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = DefaultMaxRetries
+	}
+
+	var err error
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		if err = fn(); err == nil || !isTransient(err) {
+			return err
+		}
+		if attempt < maxRetries-1 {
+			var graphErr *GraphError
+			if errors.As(err, &graphErr) && graphErr.RetryAfter > 0 {
+				time.Sleep(min(graphErr.RetryAfter, client.Backoff.maxDelay()))
+				continue
+			}
+			client.Backoff.Sleep(attempt)
+		}
+	}
+	return err
+}
+
+// maxDelay returns Cap, or its default if it's unset.
+func (b Backoff) maxDelay() time.Duration {
+	if b.Cap <= 0 {
+		return DefaultBackoffCap
+	}
+	return b.Cap
+}
+
+// isTransient reports whether a failed request may succeed when it's sent
+// again: when it was throttled, failed on the server or on the network, or
+// stalled. Rejected credentials, denied access, refused writes of dry runs and
+// other client errors fail the same way every time.
+func isTransient(err error) bool {
+	if errors.Is(err, ErrReadOnly) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, ErrStalled) {
+		return true
+	}
+	var graphErr *GraphError
+	if errors.As(err, &graphErr) {
+		return errors.Is(graphErr, ErrThrottled) || graphErr.StatusCode >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,74 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	tests := []struct {
+		backoff Backoff
+		attempt int
+		full    time.Duration // the delay before jitter
+	}{
+		{Backoff{Base: time.Second, Cap: time.Minute, Multiplier: 2}, 0, time.Second},
+		{Backoff{Base: time.Second, Cap: time.Minute, Multiplier: 2}, 3, 8 * time.Second},
+		{Backoff{Base: time.Second, Cap: time.Minute, Multiplier: 2}, 10, time.Minute},
+		{Backoff{Base: time.Second, Cap: time.Minute, Multiplier: 2}, 5000, time.Minute},
+		{Backoff{Base: time.Second, Cap: time.Minute, Multiplier: 2}, -1, time.Second},
+		{Backoff{Base: time.Second, Cap: time.Minute, Multiplier: 1}, 7, time.Second},
+		{Backoff{Base: 10 * time.Second, Cap: 5 * time.Second, Multiplier: 2}, 0, 5 * time.Second},
+		{Backoff{}, 0, DefaultBackoffBase},
+		{Backoff{}, 1, 2 * DefaultBackoffBase},
+		{Backoff{}, 100, DefaultBackoffCap},
+		{Backoff{Multiplier: 0.5}, 1, 2 * DefaultBackoffBase},
+	}
+	for _, tc := range tests {
+		for range 100 {
+			got := tc.backoff.Delay(tc.attempt)
+			if got < tc.full/2 || got > tc.full {
+				t.Errorf("%+v.Delay(%d) = %s, want between %s and %s", tc.backoff, tc.attempt, got, tc.full/2, tc.full)
+				break
+			}
+		}
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"throttled", &GraphError{StatusCode: 429}, true},
+		{"throttled by code", &GraphError{StatusCode: 400, Code: "activityLimitReached"}, true},
+		{"unavailable", &GraphError{StatusCode: 503}, true},
+		{"server error", fmt.Errorf("upload failed: %w", &GraphError{StatusCode: 500}), true},
+		{"bad gateway", &GraphError{StatusCode: 502}, true},
+		{"connection reset", &url.Error{Op: "Put", URL: "https://graph", Err: &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}}, true},
+		{"timeout", fmt.Errorf("failed to upload chunk: %w", &url.Error{Op: "Put", URL: "https://graph", Err: context.DeadlineExceeded}), true},
+		{"unexpected EOF", fmt.Errorf("read body: %w", io.ErrUnexpectedEOF), true},
+		{"stalled", fmt.Errorf("failed to upload chunk: %w: no data sent for 1m0s", ErrStalled), true},
+		{"unauthorized", &GraphError{StatusCode: 401, Code: "InvalidAuthenticationToken"}, false},
+		{"forbidden", &GraphError{StatusCode: 403}, false},
+		{"not found", &GraphError{StatusCode: 404, Code: "itemNotFound"}, false},
+		{"conflict", &GraphError{StatusCode: 409, Code: "nameAlreadyExists"}, false},
+		{"bad request", &GraphError{StatusCode: 400, Code: "invalidRequest"}, false},
+		{"revoked refresh token", &GraphError{StatusCode: 400, Code: "invalid_grant"}, false},
+		{"read-only", fmt.Errorf("upload failed: %w", ErrReadOnly), false},
+		{"canceled", &url.Error{Op: "Put", URL: "https://graph", Err: context.Canceled}, false},
+		{"local", errors.New("chunk size mismatch"), false},
+	}
+	for _, tc := range tests {
+		if got := isTransient(tc.err); got != tc.want {
+			t.Errorf("isTransient(%s: %v) = %v, want %v", tc.name, tc.err, got, tc.want)
+		}
+	}
+}
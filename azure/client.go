@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"golang.org/x/sync/singleflight"
 )
 
 // AzureClient represents a client for interacting with Microsoft Azure services.
@@ -16,20 +19,50 @@ import (
 // Fields:
 //   - ClientID: The application (client) ID registered in Azure Active Directory
 //   - ClientSecret: The client secret key for authentication
+//   - Tenant: The Azure AD tenant the app is registered in, empty for multi-tenant apps
+//   - Endpoints: The Graph and login endpoints of the cloud the remote lives on
 //   - AccessToken: The current OAuth access token for API requests
 //   - RefreshToken: Token used to obtain a new access token when expired
+//   - AppOnly: Whether the client authenticates as the application itself (client credentials)
 //   - Expiration: Timestamp indicating when the current access token expires
 //   - DriveID: The identifier for the specific OneDrive instance
 //   - DriveType: The type of drive (personal, business, sharepoint)
+//   - SharePointSite: URL of the site whose library is the drive, if DriveID isn't configured
+//   - SharePointLibrary: Name of that library, empty for the site's default one
+//   - Backoff: Retry policy for token refresh and other API requests
+//   - MaxRetries: Maximum number of attempts for retried API requests
+//   - ConflictBehavior: Default conflict behavior for uploads to this remote, empty for ConflictReplace
+//   - ProtectedPaths: Path prefixes that destructive commands refuse to touch by default
+//   - ReceiptsLog: Path of the log on the drive that uploads append a receipt to, empty for none
+//   - MaxTransfers: Maximum number of files uploaded to this remote at the same time, 0 for no limit
+//   - RemoteName: Name of the remote in the config
+//   - TokenStore: Where the tokens are kept outside of the config, nil if they are in the config
+//   - RefreshMargin: How long before its expiry the access token is already refreshed
+//   - ClockSkew: Offset of the server clock from the local clock, learned from token responses
+//   - Logger: Receives status messages of operations, DefaultLogger when nil
 //   - mu: Mutex for handling concurrent access to client fields
+//   - siteMu: Mutex serializing the lookup of SharePointSite
 type AzureClient struct {
 	ClientID     string
 	ClientSecret string
+	Tenant       string
+	Endpoints    Endpoints
 	AccessToken  string
 	RefreshToken string
 	Expiration   time.Time
-	DriveID      string
-	DriveType    string
+
+	// Remotes with a client secret and tenant but no token authenticate as
+	// the application with the client credentials grant. Their tokens aren't
+	// bound to a user, so the drive is addressed by DriveID.
+	AppOnly bool
+
+	DriveID   string
+	DriveType string
+
+	// SharePoint remotes can name their site instead of the drive ID, which
+	// is hard to find out. The drive is looked up on first use.
+	SharePointSite    string
+	SharePointLibrary string
 
 	// Root folder of the remote. Sometimes a remote may not want the tool from
 	// uploading directly to the root folder, but instead into a custom folder.
@@ -38,7 +71,62 @@ type AzureClient struct {
 	// Base url from which user can download the file.
 	RemoteBaseUrl string
 
-	mu sync.Mutex
+	Backoff    Backoff
+	MaxRetries int
+
+	// Default conflict behavior for uploads, from the conflict_behavior key.
+	// Shared remotes use ConflictRename to avoid clobbering others' files.
+	ConflictBehavior string
+
+	// Path prefixes from the comma separated protected_paths key, e.g.
+	// "/Public", which rm and similar commands refuse to delete.
+	ProtectedPaths []string
+
+	// Path of the shared receipts log from the receipts_log key, relative to
+	// the drive root. Uploads append an audit line to it when set.
+	ReceiptsLog string
+
+	// Cap on concurrent file uploads from the max_transfers key, so commands
+	// uploading many files don't get the remote throttled. 0 for no cap.
+	MaxTransfers int
+
+	// Name of the remote and, for remotes with a token_store key, the store
+	// their tokens are loaded from and refreshed tokens are saved to.
+	RemoteName string
+	TokenStore TokenStore
+
+	// Tokens are refreshed RefreshMargin before they expire, so a token that
+	// passed the check can't expire while a request or chunk is in flight.
+	// ClockSkew is added to the local clock when comparing with Expiration.
+	RefreshMargin time.Duration
+	ClockSkew     time.Duration
+
+	Logger Logger
+
+	mu        sync.Mutex
+	siteMu    sync.Mutex
+	refreshes singleflight.Group
+}
+
+// DefaultRefreshMargin is how early tokens are refreshed unless the remote
+// sets token_refresh_margin.
+const DefaultRefreshMargin = 5 * time.Minute
+
+// ParseRefreshMargin parses a token_refresh_margin value, a whole number of
+// minutes.
+//
+// Parameters:
+//   - value: string - The value of the key
+//
+// Returns:
+//   - time.Duration: The margin
+//   - error: Error if the value is not a non-negative number of minutes
+func ParseRefreshMargin(value string) (time.Duration, error) {
+	minutes, err := strconv.Atoi(value)
+	if err != nil || minutes < 0 {
+		return 0, fmt.Errorf("invalid token_refresh_margin %q, must be a number of minutes", value)
+	}
+	return time.Duration(minutes) * time.Minute, nil
 }
 
 // NewAzureClientFromRcloneConfigData creates a new AzureClient instance using rclone configuration data.
@@ -48,7 +136,9 @@ type AzureClient struct {
 // - Client ID and Secret
 // - Access and Refresh tokens
 // - Token expiration time
-// - Drive ID and Drive type
+// - Drive ID and Drive type, or the sharepoint_site to look them up from on first use
+//
+// It makes no requests, so it only checks that the remote's settings are valid.
 //
 // Parameters:
 //   - configData: []byte containing the rclone configuration data
@@ -75,31 +165,88 @@ func NewAzureClientFromRcloneConfigData(configData []byte, remoteConfig string)
 
 	client.ClientID = configMap["client_id"]
 	client.ClientSecret = configMap["client_secret"]
+	client.Tenant = configMap["tenant"]
+	client.Endpoints, err = EndpointsFromConfig(configMap)
+	if err != nil {
+		return nil, err
+	}
 	client.RemoteRootFolder = configMap["root_folder"]
 	client.RemoteBaseUrl = configMap["base_url"]
 
-	// Extract token information
-	var tokenData struct {
-		AccessToken  string `json:"access_token"`
-		RefreshToken string `json:"refresh_token"`
-		Expiry       string `json:"expiry"`
-	}
-	err = json.Unmarshal([]byte(configMap["token"]), &tokenData)
+	client.RemoteName = remoteConfig
+	client.TokenStore, err = NewTokenStore(configMap["token_store"])
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse token JSON: %v", err)
+		return nil, err
 	}
 
-	client.AccessToken = tokenData.AccessToken
-	client.RefreshToken = tokenData.RefreshToken
+	if client.TokenStore != nil {
+		token, err := client.TokenStore.Load(remoteConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load token of %s from %s: %w", remoteConfig, configMap["token_store"], err)
+		}
+		client.AccessToken = token.AccessToken
+		client.RefreshToken = token.RefreshToken
+		client.Expiration = token.Expiry
+	} else if configMap["token"] == "" && client.ClientSecret != "" && client.Tenant != "" {
+		// Tokens are requested on first use
+		client.AppOnly = true
+		if configMap["drive_id"] == "" && configMap["sharepoint_site"] == "" {
+			return nil, fmt.Errorf("remote %s uses app-only authentication and needs a drive_id or sharepoint_site", remoteConfig)
+		}
+	} else {
+		// Extract token information
+		var tokenData struct {
+			AccessToken  string `json:"access_token"`
+			RefreshToken string `json:"refresh_token"`
+			Expiry       string `json:"expiry"`
+		}
+		err = json.Unmarshal([]byte(configMap["token"]), &tokenData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse token JSON: %v", err)
+		}
 
-	expiration, err := time.Parse(time.RFC3339, tokenData.Expiry)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse token expiration time: %v", err)
+		client.AccessToken = tokenData.AccessToken
+		client.RefreshToken = tokenData.RefreshToken
+
+		expiration, err := time.Parse(time.RFC3339, tokenData.Expiry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse token expiration time: %v", err)
+		}
+		client.Expiration = expiration
 	}
-	client.Expiration = expiration
 
 	client.DriveID = configMap["drive_id"]
 	client.DriveType = configMap["drive_type"]
+	if client.DriveID == "" {
+		// An explicit drive_id wins over the site
+		client.SharePointSite = configMap["sharepoint_site"]
+		client.SharePointLibrary = configMap["sharepoint_library"]
+	}
+	for _, protected := range strings.Split(configMap["protected_paths"], ",") {
+		if protected = strings.TrimSpace(protected); protected != "" {
+			client.ProtectedPaths = append(client.ProtectedPaths, protected)
+		}
+	}
+	client.ReceiptsLog = configMap["receipts_log"]
+	if value := configMap["max_transfers"]; value != "" {
+		client.MaxTransfers, err = strconv.Atoi(value)
+		if err != nil || client.MaxTransfers < 1 {
+			return nil, fmt.Errorf("invalid max_transfers %q, must be a positive number", value)
+		}
+	}
+	client.ConflictBehavior = configMap["conflict_behavior"]
+	if client.ConflictBehavior != "" && !IsValidConflictBehavior(client.ConflictBehavior) {
+		return nil, fmt.Errorf("invalid conflict_behavior %q, must be %s, %s or %s", client.ConflictBehavior, ConflictReplace, ConflictRename, ConflictFail)
+	}
+	client.RefreshMargin = DefaultRefreshMargin
+	if value := configMap["token_refresh_margin"]; value != "" {
+		client.RefreshMargin, err = ParseRefreshMargin(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	client.Backoff = DefaultBackoff()
+	client.MaxRetries = DefaultMaxRetries
 
 	return &client, nil
 }
@@ -108,9 +255,12 @@ func NewAzureClientFromRcloneConfigData(configData []byte, remoteConfig string)
 // and refreshing it if necessary. It uses a mutex to ensure thread-safe token updates.
 //
 // The function performs the following steps:
-// 1. Checks if the current token is still valid
-// 2. If expired, requests a new token using the refresh token
-// 3. Updates the client's access token, refresh token, and expiration time
+//  1. Checks if the current token is still valid for at least RefreshMargin,
+//     measured on the server clock (local clock plus ClockSkew)
+//  2. If expired, requests a new token using the refresh token (retried with
+//     backoff if the failure is transient)
+//  3. Updates the client's access token, refresh token, and expiration time
+//  4. Looks up the drive of the SharePointSite, if the drive isn't known yet
 //
 // Parameters:
 //   - httpClient: *http.Client - The HTTP client used to make the token refresh request
@@ -118,23 +268,100 @@ func NewAzureClientFromRcloneConfigData(configData []byte, remoteConfig string)
 // Returns:
 //   - error: Returns nil if token is valid or successfully refreshed, error otherwise
 //
-// Thread-safety: This method is thread-safe as it uses a mutex to protect token updates.
+// Thread-safety: Concurrent callers share a single refresh. The mutex is only
+// held for the refresh requests themselves, not while waiting to retry.
 func (client *AzureClient) EnsureTokenValid(httpClient *http.Client) error {
+	if !client.tokenValid() {
+		_, err, _ := client.refreshes.Do("token", func() (any, error) {
+			return nil, client.retry(func() error {
+				client.mu.Lock()
+				defer client.mu.Unlock()
+				if client.serverNow().Add(client.RefreshMargin).Before(client.Expiration) {
+					return nil
+				}
+				return client.refreshToken(httpClient)
+			})
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if client.SharePointSite != "" {
+		return client.resolveSiteDrive(httpClient)
+	}
+	return nil
+}
+
+// bearer returns the Authorization header value of the current access token.
+// Requests read it through here as refreshes replace it under client.mu.
+func (client *AzureClient) bearer() string {
 	client.mu.Lock()
 	defer client.mu.Unlock()
+	return "Bearer " + client.AccessToken
+}
+
+// tokenValid reports whether the access token is valid for at least
+// RefreshMargin.
+func (client *AzureClient) tokenValid() bool {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	return client.serverNow().Add(client.RefreshMargin).Before(client.Expiration)
+}
 
-	if time.Now().Before(client.Expiration) {
-		return nil
+// SyncClock measures how far the local clock is off from the Graph servers and
+// stores it in ClockSkew, so the expiry of tokens read from the config is
+// judged correctly before the first refresh.
+//
+// Parameters:
+//   - httpClient: *http.Client - The HTTP client used to ask for the server time
+//
+// Returns:
+//   - error: Error if the server time couldn't be determined, ClockSkew is unchanged then
+func (client *AzureClient) SyncClock(httpClient *http.Client) error {
+	serverTime, err := ServerTime(httpClient, client.Endpoints)
+	if err != nil {
+		return err
 	}
 
-	tokenURL := "https://login.microsoftonline.com/common/oauth2/v2.0/token"
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.ClockSkew = time.Until(serverTime)
+	return nil
+}
+
+// DefaultTenant is the token endpoint tenant of multi-tenant app registrations.
+const DefaultTenant = "common"
+
+// serverNow returns the current time on the server clock as far as known.
+func (client *AzureClient) serverNow() time.Time {
+	return time.Now().Add(client.ClockSkew)
+}
+
+// AppOnlyScope is requested by app-only clients: every application permission
+// granted to the app on Microsoft Graph.
+const AppOnlyScope = "/.default"
+
+// refreshToken exchanges the refresh token for a new access token, or for
+// app-only clients requests one with the client credentials.
+// The caller must hold client.mu.
+func (client *AzureClient) refreshToken(httpClient *http.Client) error {
 	data := url.Values{}
 	data.Set("client_id", client.ClientID)
 	data.Set("client_secret", client.ClientSecret)
-	data.Set("refresh_token", client.RefreshToken)
-	data.Set("grant_type", "refresh_token")
+	if client.AppOnly {
+		graph := client.Endpoints.Graph
+		if graph == "" {
+			graph = DefaultGraphEndpoint
+		}
+		data.Set("scope", strings.TrimRight(graph, "/")+AppOnlyScope)
+		data.Set("grant_type", "client_credentials")
+	} else {
+		data.Set("refresh_token", client.RefreshToken)
+		data.Set("grant_type", "refresh_token")
+	}
 
-	req, err := http.NewRequest("POST", tokenURL, strings.NewReader(data.Encode()))
+	req, err := http.NewRequest("POST", client.Endpoints.OAuthURL(client.Tenant, "token"), strings.NewReader(data.Encode()))
 	if err != nil {
 		return err
 	}
@@ -147,7 +374,7 @@ func (client *AzureClient) EnsureTokenValid(httpClient *http.Client) error {
 	defer res.Body.Close()
 
 	if res.StatusCode < 200 || res.StatusCode > 299 {
-		return fmt.Errorf("failed to refresh token, status code: %v", res.StatusCode)
+		return fmt.Errorf("failed to refresh token: %w", newTokenError(res))
 	}
 
 	var responseData struct {
@@ -160,9 +387,28 @@ func (client *AzureClient) EnsureTokenValid(httpClient *http.Client) error {
 		return err
 	}
 
+	// The Date header tells how far off the local clock is. The expiry is
+	// kept on the server clock, like the expiry rclone writes into the config.
+	if serverTime, err := http.ParseTime(res.Header.Get("Date")); err == nil {
+		client.ClockSkew = time.Until(serverTime)
+	}
+
 	client.AccessToken = responseData.AccessToken
-	client.RefreshToken = responseData.RefreshToken
-	client.Expiration = time.Now().Add(time.Duration(responseData.ExpiresIn) * time.Second)
+	if !client.AppOnly {
+		client.RefreshToken = responseData.RefreshToken
+	}
+	client.Expiration = client.serverNow().Add(time.Duration(responseData.ExpiresIn) * time.Second)
+
+	// Unlike the config, a token store can keep the refreshed tokens. Failing
+	// to do so isn't fatal, the old refresh token stays usable.
+	if client.TokenStore != nil {
+		client.TokenStore.Save(client.RemoteName, &Token{
+			AccessToken:  client.AccessToken,
+			TokenType:    "Bearer",
+			RefreshToken: client.RefreshToken,
+			Expiry:       client.Expiration,
+		})
+	}
 
 	return nil
 }
@@ -112,3 +112,178 @@ func GetRemoteConfig(parsedRcloneConfig *[]map[string]string, remoteConfig strin
 
 	return nil, fmt.Errorf("this shouldn't be reachable(?)")
 }
+
+// GetRemotesInGroup returns the names of the remotes that belong to the given group.
+// A remote joins groups through a comma separated "groups" key in its section, e.g.:
+//
+//	[oned]
+//	groups = public, archive
+//
+// Parameters:
+//   - parsedRcloneConfig: Pointer to slice of maps containing parsed rclone configurations
+//   - group: Name of the group
+//
+// Returns:
+//   - []string: Names of the remotes in the group, empty if the group doesn't exist
+func GetRemotesInGroup(parsedRcloneConfig *[]map[string]string, group string) []string {
+	var remotes []string
+	for _, elem := range *parsedRcloneConfig {
+		for _, name := range strings.Split(elem["groups"], ",") {
+			if strings.TrimSpace(name) == group {
+				remotes = append(remotes, elem["remote_name"])
+				break
+			}
+		}
+	}
+
+	return remotes
+}
+
+// rcloneKeyOrder is the order in which FormatRcloneConfigSection writes the
+// known keys, the same order rclone itself uses.
+var rcloneKeyOrder = []string{"type", "client_id", "client_secret", "tenant", "region", "graph_endpoint", "auth_endpoint", "token", "drive_id", "drive_type", "sharepoint_site", "sharepoint_library", "root_folder", "base_url", "token_store", "token_refresh_margin", "conflict_behavior", "protected_paths", "receipts_log", "max_transfers", "groups"}
+
+// FormatRcloneConfigSection renders a remote as an rclone config section.
+// Known keys come first in rclone's order, any other keys follow sorted by
+// name. The special "remote_name" key of parsed configs is skipped.
+//
+// Parameters:
+//   - name: Name of the remote, used as the section header
+//   - values: The settings of the remote
+//
+// Returns:
+//   - string: The section, including the header and a trailing blank line
+func FormatRcloneConfigSection(name string, values map[string]string) string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "[%s]\n", name)
+
+	for _, key := range rcloneKeyOrder {
+		if value, ok := values[key]; ok {
+			fmt.Fprintf(&builder, "%s = %s\n", key, value)
+		}
+	}
+
+	var rest []string
+	for key := range values {
+		if key != "remote_name" && !slices.Contains(rcloneKeyOrder, key) {
+			rest = append(rest, key)
+		}
+	}
+	slices.Sort(rest)
+	for _, key := range rest {
+		fmt.Fprintf(&builder, "%s = %s\n", key, values[key])
+	}
+
+	builder.WriteString("\n")
+	return builder.String()
+}
+
+// RemoveRcloneConfigSection removes a remote's section from rclone config data,
+// leaving everything else, including comments, untouched.
+//
+// Parameters:
+//   - configData: []byte containing the rclone configuration data
+//   - name: Name of the remote to remove
+//
+// Returns:
+//   - []byte: The configuration data without the remote
+//   - error: Error if the remote doesn't exist
+func RemoveRcloneConfigSection(configData []byte, name string) ([]byte, error) {
+	lines := strings.Split(string(configData), "\n")
+	var kept []string
+	found, inSection := false, false
+	for _, line := range lines {
+		if section, ok := sectionName(line); ok {
+			inSection = section == name
+			found = found || inSection
+		}
+		if !inSection {
+			kept = append(kept, line)
+		}
+	}
+
+	if !found {
+		return nil, fmt.Errorf("remote %s does not exist", name)
+	}
+	return []byte(strings.Join(kept, "\n")), nil
+}
+
+// RenameRcloneConfigSection renames a remote in rclone config data, leaving
+// everything else untouched.
+//
+// Parameters:
+//   - configData: []byte containing the rclone configuration data
+//   - oldName: Current name of the remote
+//   - newName: New name of the remote
+//
+// Returns:
+//   - []byte: The configuration data with the remote renamed
+//   - error: Error if oldName doesn't exist or newName already does
+func RenameRcloneConfigSection(configData []byte, oldName string, newName string) ([]byte, error) {
+	lines := strings.Split(string(configData), "\n")
+	index := -1
+	for i, line := range lines {
+		section, ok := sectionName(line)
+		if !ok {
+			continue
+		}
+		if section == newName {
+			return nil, fmt.Errorf("remote %s already exists", newName)
+		}
+		if section == oldName {
+			index = i
+		}
+	}
+
+	if index < 0 {
+		return nil, fmt.Errorf("remote %s does not exist", oldName)
+	}
+	lines[index] = "[" + newName + "]"
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// ReplaceRcloneConfigSection replaces the settings of a remote in rclone
+// config data with values, formatted by FormatRcloneConfigSection. The section
+// keeps its place, everything outside of it is left untouched.
+//
+// Parameters:
+//   - configData: []byte containing the rclone configuration data
+//   - name: Name of the remote to replace
+//   - values: The new settings of the remote
+//
+// Returns:
+//   - []byte: The configuration data with the remote replaced
+//   - error: Error if the remote doesn't exist
+func ReplaceRcloneConfigSection(configData []byte, name string, values map[string]string) ([]byte, error) {
+	lines := strings.Split(string(configData), "\n")
+	var kept []string
+	found, inSection := false, false
+	for _, line := range lines {
+		if section, ok := sectionName(line); ok {
+			inSection = section == name
+			if inSection && !found {
+				found = true
+				kept = append(kept, strings.Split(FormatRcloneConfigSection(name, values), "\n")...)
+				// The formatted section ends with a blank line already
+				kept = kept[:len(kept)-1]
+			}
+		}
+		if !inSection {
+			kept = append(kept, line)
+		}
+	}
+
+	if !found {
+		return nil, fmt.Errorf("remote %s does not exist", name)
+	}
+	return []byte(strings.Join(kept, "\n")), nil
+}
+
+// sectionName returns the remote name if line is a section header.
+func sectionName(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+		return strings.Trim(line, "[]"), true
+	}
+	return "", false
+}
@@ -0,0 +1,119 @@
+package azure
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/global-index-source/ksau-go/redact"
+)
+
+// DebugOptions controls what NewDebugTransport logs besides the request line.
+//
+// Fields:
+//   - Headers: Also log the request and response headers
+//   - Unredacted: Log URLs and headers as they are, including tokens and upload URLs
+type DebugOptions struct {
+	Headers    bool
+	Unredacted bool
+}
+
+// debugTransport logs every request that passes through it.
+type debugTransport struct {
+	base    http.RoundTripper
+	out     io.Writer
+	options DebugOptions
+
+	mu       sync.Mutex
+	attempts map[string]int
+}
+
+// NewDebugTransport wraps base, http.DefaultTransport when nil, so that every
+// request is logged to out with its method, URL, status, latency and, for
+// repeated requests, the attempt number. Secrets are redacted unless
+// options.Unredacted is set.
+//
+// Parameters:
+//   - base: The transport that sends the requests
+//   - out: Where the log lines are written to
+//   - options: What to log besides the request line
+//
+// Returns:
+//   - http.RoundTripper: The wrapping transport
+func NewDebugTransport(base http.RoundTripper, out io.Writer, options DebugOptions) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &debugTransport{base: base, out: out, options: options, attempts: make(map[string]int)}
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Retries send the same request again, chunks are told apart by their range
+	key := req.Method + " " + req.URL.String() + " " + req.Header.Get("Content-Range")
+	t.mu.Lock()
+	t.attempts[key]++
+	attempt := t.attempts[key]
+	t.mu.Unlock()
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	latency := time.Since(start).Round(time.Millisecond)
+
+	var result string
+	if err != nil {
+		result = "error: " + t.redact(err.Error())
+	} else {
+		result = resp.Status
+	}
+	line := fmt.Sprintf("%s http: %s %s -> %s (%s", start.Format(time.RFC3339), req.Method, t.redact(req.URL.String()), result, latency)
+	if attempt > 1 {
+		line += fmt.Sprintf(", attempt %d", attempt)
+	}
+	line += ")\n"
+
+	if t.options.Headers {
+		line += t.formatHeaders(">", req.Header)
+		if resp != nil {
+			line += t.formatHeaders("<", resp.Header)
+		}
+	}
+
+	// Keep the lines of concurrent requests together
+	t.mu.Lock()
+	io.WriteString(t.out, line)
+	t.mu.Unlock()
+
+	return resp, err
+}
+
+// formatHeaders renders headers one per line, sorted by name and prefixed
+// with the direction.
+func (t *debugTransport) formatHeaders(direction string, header http.Header) string {
+	if !t.options.Unredacted {
+		header = redact.Header(header)
+	}
+
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var lines string
+	for _, name := range names {
+		for _, value := range header[name] {
+			lines += fmt.Sprintf("  %s %s: %s\n", direction, name, value)
+		}
+	}
+	return lines
+}
+
+func (t *debugTransport) redact(s string) string {
+	if t.options.Unredacted {
+		return s
+	}
+	return redact.String(s)
+}
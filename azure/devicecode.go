@@ -0,0 +1,228 @@
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultScope is the OAuth scope requested for new remotes: full access to the
+// user's files, plus a refresh token.
+const DefaultScope = "Files.ReadWrite.All offline_access"
+
+// DeviceCode is the response to a device authorization request. The user has to
+// open VerificationURI and enter UserCode to approve the login.
+//
+// Fields:
+//   - DeviceCode: Code identifying this login, used when polling for the token
+//   - UserCode: Short code the user enters on the verification page
+//   - VerificationURI: Page where the user enters the code
+//   - ExpiresIn: Seconds until the codes expire
+//   - Interval: Minimum number of seconds between polls
+//   - Message: Human readable instructions for the user
+type DeviceCode struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
+	Message         string `json:"message"`
+}
+
+// Token holds the OAuth tokens of a remote, as stored in the token field of
+// the rclone config.
+type Token struct {
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type"`
+	RefreshToken string    `json:"refresh_token"`
+	Expiry       time.Time `json:"expiry"`
+}
+
+// RequestDeviceCode starts the OAuth device code flow for the given application.
+//
+// Parameters:
+//   - httpClient: The HTTP client to use for the request
+//   - endpoints: The cloud the application is registered in
+//   - tenant: The tenant the application is registered in, empty for common
+//   - clientID: The application (client) ID registered in Azure
+//   - scope: The space separated scopes to request, DefaultScope when empty
+//
+// Returns:
+//   - *DeviceCode: The codes to show to the user and to poll with
+//   - error: Any error encountered during the request
+func RequestDeviceCode(httpClient *http.Client, endpoints Endpoints, tenant string, clientID string, scope string) (*DeviceCode, error) {
+	if scope == "" {
+		scope = DefaultScope
+	}
+
+	data := url.Values{}
+	data.Set("client_id", clientID)
+	data.Set("scope", scope)
+
+	resp, err := httpClient.PostForm(endpoints.OAuthURL(tenant, "devicecode"), data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request device code: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to request device code: %w", newGraphError(resp))
+	}
+
+	var code DeviceCode
+	if err := json.NewDecoder(resp.Body).Decode(&code); err != nil {
+		return nil, fmt.Errorf("failed to parse device code response: %v", err)
+	}
+	return &code, nil
+}
+
+// PollDeviceCodeToken waits until the user approved (or declined) the login
+// started by RequestDeviceCode and returns the issued tokens.
+//
+// Parameters:
+//   - httpClient: The HTTP client to use for the requests
+//   - endpoints: The cloud the device code was requested from
+//   - tenant: The tenant the device code was requested from
+//   - clientID: The application (client) ID the device code was requested for
+//   - clientSecret: The application secret, empty for public clients
+//   - code: The device code returned by RequestDeviceCode
+//
+// Returns:
+//   - *Token: The access and refresh tokens
+//   - error: An error if the login was declined, expired or failed otherwise
+func PollDeviceCodeToken(httpClient *http.Client, endpoints Endpoints, tenant string, clientID string, clientSecret string, code *DeviceCode) (*Token, error) {
+	interval := time.Duration(code.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	deadline := time.Now().Add(time.Duration(code.ExpiresIn) * time.Second)
+
+	data := url.Values{}
+	data.Set("grant_type", "urn:ietf:params:oauth:grant-type:device_code")
+	data.Set("client_id", clientID)
+	data.Set("device_code", code.DeviceCode)
+	if clientSecret != "" {
+		data.Set("client_secret", clientSecret)
+	}
+
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+
+		resp, err := httpClient.PostForm(endpoints.OAuthURL(tenant, "token"), data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to poll for token: %v", err)
+		}
+
+		var response struct {
+			AccessToken  string `json:"access_token"`
+			TokenType    string `json:"token_type"`
+			RefreshToken string `json:"refresh_token"`
+			ExpiresIn    int    `json:"expires_in"`
+			Error        string `json:"error"`
+			Description  string `json:"error_description"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse token response: %v", err)
+		}
+
+		switch response.Error {
+		case "":
+			return &Token{
+				AccessToken:  response.AccessToken,
+				TokenType:    response.TokenType,
+				RefreshToken: response.RefreshToken,
+				Expiry:       time.Now().Add(time.Duration(response.ExpiresIn) * time.Second),
+			}, nil
+		case "authorization_pending":
+			continue
+		case "slow_down":
+			interval += 5 * time.Second
+		case "authorization_declined":
+			return nil, fmt.Errorf("login was declined")
+		case "expired_token":
+			return nil, fmt.Errorf("login code expired, please try again")
+		default:
+			return nil, fmt.Errorf("login failed: %s: %s", response.Error, firstLine(response.Description))
+		}
+	}
+	return nil, fmt.Errorf("login code expired, please try again")
+}
+
+// NewAzureClientFromToken creates a client for freshly issued tokens, e.g. from
+// PollDeviceCodeToken, that aren't part of any config yet.
+//
+// Parameters:
+//   - endpoints: The cloud the token was issued by
+//   - tenant: The tenant the token was issued by, empty for common
+//   - clientID: The application (client) ID the token was issued to
+//   - clientSecret: The application secret, empty for public clients
+//   - token: The OAuth tokens
+//
+// Returns:
+//   - *AzureClient: A client using the tokens
+func NewAzureClientFromToken(endpoints Endpoints, tenant string, clientID string, clientSecret string, token *Token) *AzureClient {
+	return &AzureClient{
+		ClientID:      clientID,
+		ClientSecret:  clientSecret,
+		Tenant:        tenant,
+		AccessToken:   token.AccessToken,
+		RefreshToken:  token.RefreshToken,
+		Expiration:    token.Expiry,
+		Backoff:       DefaultBackoff(),
+		MaxRetries:    DefaultMaxRetries,
+		RefreshMargin: DefaultRefreshMargin,
+	}
+}
+
+// ListDrives returns the drives the signed in user can access, e.g. their
+// OneDrive and document libraries they follow.
+//
+// Parameters:
+//   - httpClient: The HTTP client to use for the request
+//
+// Returns:
+//   - []Drive: The accessible drives
+//   - error: Any error encountered during the process
+func (client *AzureClient) ListDrives(httpClient *http.Client) ([]Drive, error) {
+	if err := client.EnsureTokenValid(httpClient); err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Value []struct {
+			Drive
+			Name  string `json:"name"`
+			Owner struct {
+				User struct {
+					DisplayName string `json:"displayName"`
+				} `json:"user"`
+			} `json:"owner"`
+		} `json:"value"`
+	}
+	if err := client.getJSON(httpClient, client.Endpoints.GraphURL("/me/drives"), &response); err != nil {
+		return nil, fmt.Errorf("failed to list drives: %w", err)
+	}
+
+	drives := make([]Drive, 0, len(response.Value))
+	for _, value := range response.Value {
+		drive := value.Drive
+		drive.Owner = value.Owner.User.DisplayName
+		if drive.Owner == "" {
+			drive.Owner = value.Name
+		}
+		drives = append(drives, drive)
+	}
+	return drives, nil
+}
+
+// firstLine returns the first line of s, Azure error descriptions carry trace
+// and correlation IDs on the following lines.
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return strings.TrimSpace(strings.TrimSuffix(line, "\r"))
+}
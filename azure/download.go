@@ -0,0 +1,76 @@
+package azure
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// ErrRangeNotSupported is returned by DownloadRange when the server sends the
+// whole file instead of the requested range.
+var ErrRangeNotSupported = errors.New("the server ignored the range request")
+
+// Download opens the content of a file for reading. Graph answers with a
+// redirect to a pre-authenticated URL, which the HTTP client follows.
+//
+// Parameters:
+//   - httpClient: An *http.Client to make the HTTP request
+//   - itemID: The unique identifier of the file
+//
+// Returns:
+//   - io.ReadCloser: The content of the file, to be closed by the caller
+//   - error: Any error encountered while starting the download
+func (client *AzureClient) Download(httpClient *http.Client, itemID string) (io.ReadCloser, error) {
+	return client.DownloadRange(httpClient, itemID, 0, -1)
+}
+
+// DownloadRange opens a part of the content of a file for reading, using an
+// HTTP Range request. The Range header is kept when the HTTP client follows
+// the redirect to the download URL.
+//
+// Parameters:
+//   - httpClient: An *http.Client to make the HTTP request
+//   - itemID: The unique identifier of the file
+//   - offset: The first byte to read
+//   - length: The number of bytes to read, or -1 to read until the end
+//
+// Returns:
+//   - io.ReadCloser: The requested bytes, to be closed by the caller
+//   - error: Any error encountered while starting the download, wrapping
+//     ErrRangeNotSupported if the server ignored the range
+func (client *AzureClient) DownloadRange(httpClient *http.Client, itemID string, offset int64, length int64) (io.ReadCloser, error) {
+	if err := client.EnsureTokenValid(httpClient); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", client.driveURL("/items/"+url.PathEscape(itemID)+"/content"), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create download request: %v", err)
+	}
+	req.Header.Set("Authorization", client.bearer())
+	partial := offset > 0 || length >= 0
+	if length >= 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	} else if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %v", err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && partial:
+		return resp.Body, nil
+	case resp.StatusCode == http.StatusOK && !partial:
+		return resp.Body, nil
+	case resp.StatusCode == http.StatusOK:
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to download file: %w", ErrRangeNotSupported)
+	default:
+		defer resp.Body.Close()
+		return nil, fmt.Errorf("failed to download file: %w", newGraphError(resp))
+	}
+}
@@ -0,0 +1,104 @@
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Drive represents the metadata of the drive a remote points to.
+//
+// Fields:
+//   - ID: The identifier of the drive
+//   - DriveType: The type of drive (personal, business, documentLibrary)
+//   - Owner: Display name of the user or group owning the drive
+//   - Quota: Storage quota information of the drive
+type Drive struct {
+	ID        string     `json:"id"`
+	DriveType string     `json:"driveType"`
+	Owner     string     `json:"-"`
+	Quota     DriveQuota `json:"quota"`
+}
+
+// GetDrive retrieves the metadata of the remote's drive using the Microsoft Graph API.
+//
+// Parameters:
+//   - httpClient: *http.Client - The HTTP client to use for making the request
+//
+// Returns:
+//   - *Drive: The drive metadata
+//   - error: Any error encountered during the process
+func (client *AzureClient) GetDrive(httpClient *http.Client) (*Drive, error) {
+	if err := client.EnsureTokenValid(httpClient); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", client.driveURL(""), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create drive request: %v", err)
+	}
+	req.Header.Set("Authorization", client.bearer())
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch drive: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch drive: %w", newGraphError(resp))
+	}
+
+	var response struct {
+		Drive
+		Owner struct {
+			User struct {
+				DisplayName string `json:"displayName"`
+			} `json:"user"`
+			Group struct {
+				DisplayName string `json:"displayName"`
+			} `json:"group"`
+		} `json:"owner"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to parse drive response: %v", err)
+	}
+
+	drive := response.Drive
+	drive.Owner = response.Owner.User.DisplayName
+	if drive.Owner == "" {
+		drive.Owner = response.Owner.Group.DisplayName
+	}
+	return &drive, nil
+}
+
+// ServerTime returns the current time according to the Microsoft Graph servers,
+// taken from the Date header of an unauthenticated request. It is used to detect
+// skewed local clocks, which make tokens look valid when they are not.
+//
+// Parameters:
+//   - httpClient: *http.Client - The HTTP client to use for making the request
+//   - endpoints: Endpoints - The cloud to ask, the zero value for the global one
+//
+// Returns:
+//   - time.Time: The server time
+//   - error: Any error encountered during the request or when parsing the header
+func ServerTime(httpClient *http.Client, endpoints Endpoints) (time.Time, error) {
+	req, err := http.NewRequest("HEAD", endpoints.GraphURL("/"), nil)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to reach Microsoft Graph: %v", err)
+	}
+	defer resp.Body.Close()
+
+	serverTime, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse server date: %v", err)
+	}
+	return serverTime, nil
+}
@@ -0,0 +1,154 @@
+package azure
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Endpoints of the global Microsoft cloud, used unless a remote overrides them.
+const (
+	DefaultGraphEndpoint = "https://graph.microsoft.com"
+	DefaultAuthEndpoint  = "https://login.microsoftonline.com"
+)
+
+// Endpoints holds the base URLs of the Microsoft Graph API and of the Azure AD
+// login service a remote lives on. National clouds (US Government, 21Vianet,
+// Germany) use their own hosts for both.
+//
+// Fields:
+//   - Graph: Base URL of Microsoft Graph, without the API version
+//   - Auth: Base URL of the OAuth authority, without the tenant
+//
+// Empty fields fall back to the global cloud.
+type Endpoints struct {
+	Graph string
+	Auth  string
+}
+
+// regionEndpoints maps the region values of rclone's onedrive backend to the
+// endpoints of the respective cloud.
+var regionEndpoints = map[string]Endpoints{
+	"global": {Graph: DefaultGraphEndpoint, Auth: DefaultAuthEndpoint},
+	"us":     {Graph: "https://graph.microsoft.us", Auth: "https://login.microsoftonline.us"},
+	"dod":    {Graph: "https://dod-graph.microsoft.us", Auth: "https://login.microsoftonline.us"},
+	"de":     {Graph: "https://graph.microsoft.de", Auth: "https://login.microsoftonline.de"},
+	"cn":     {Graph: "https://microsoftgraph.chinacloudapi.cn", Auth: "https://login.chinacloudapi.cn"},
+}
+
+// EndpointsFromConfig resolves the endpoints of a remote from its config
+// section. The rclone region key selects a national cloud, the graph_endpoint
+// and auth_endpoint keys override single endpoints, e.g. for proxies.
+//
+// Parameters:
+//   - configMap: map[string]string - The settings of the remote
+//
+// Returns:
+//   - Endpoints: The endpoints of the remote
+//   - error: Error if the region is unknown or an endpoint is not an absolute URL
+func EndpointsFromConfig(configMap map[string]string) (Endpoints, error) {
+	var endpoints Endpoints
+	if region := configMap["region"]; region != "" {
+		var ok bool
+		endpoints, ok = regionEndpoints[region]
+		if !ok {
+			return Endpoints{}, fmt.Errorf("unknown region %q, must be one of global, us, dod, de or cn", region)
+		}
+	}
+
+	for key, endpoint := range map[string]*string{"graph_endpoint": &endpoints.Graph, "auth_endpoint": &endpoints.Auth} {
+		value := configMap[key]
+		if value == "" {
+			continue
+		}
+		if err := ValidateEndpoint(value); err != nil {
+			return Endpoints{}, fmt.Errorf("invalid %s: %v", key, err)
+		}
+		*endpoint = value
+	}
+	return endpoints, nil
+}
+
+// ValidateEndpoint checks that an endpoint override is an absolute http(s) URL.
+//
+// Parameters:
+//   - value: string - The endpoint
+//
+// Returns:
+//   - error: Error describing what is wrong with the endpoint, nil if it is usable
+func ValidateEndpoint(value string) error {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return fmt.Errorf("%q is not an absolute http(s) URL", value)
+	}
+	return nil
+}
+
+// GraphURL returns the URL of a Microsoft Graph v1.0 resource, path starts
+// with a slash, e.g. "/me/drive".
+func (endpoints Endpoints) GraphURL(path string) string {
+	base := endpoints.Graph
+	if base == "" {
+		base = DefaultGraphEndpoint
+	}
+	return strings.TrimRight(base, "/") + "/v1.0" + path
+}
+
+// OAuthURL returns the URL of an OAuth endpoint ("token", "devicecode") of
+// the given tenant. Single-tenant app registrations must use their own tenant
+// instead of common.
+func (endpoints Endpoints) OAuthURL(tenant string, endpoint string) string {
+	base := endpoints.Auth
+	if base == "" {
+		base = DefaultAuthEndpoint
+	}
+	if tenant == "" {
+		tenant = DefaultTenant
+	}
+	return strings.TrimRight(base, "/") + "/" + url.PathEscape(tenant) + "/oauth2/v2.0/" + endpoint
+}
+
+// driveURL returns the URL of a resource of the client's drive, path is
+// relative to the drive and starts with a slash, e.g. "/root". The drive is
+// addressed by its ID whenever the remote has one: /me/drive is only the
+// user's own OneDrive, not a SharePoint document library or a shared
+// business drive, and app-only clients have no signed in user at all.
+func (client *AzureClient) driveURL(path string) string {
+	if client.DriveID != "" {
+		return client.Endpoints.GraphURL("/drives/" + url.PathEscape(client.DriveID) + path)
+	}
+	return client.Endpoints.GraphURL("/me/drive" + path)
+}
+
+// itemURL returns the URL of the item at remotePath, relative to the drive's
+// root, followed by suffix, e.g. ":/children" or ":/content". The path is
+// escaped, so names with #, ?, %, + or non-ASCII characters address the right
+// item.
+func (client *AzureClient) itemURL(remotePath string, suffix string) string {
+	remotePath = strings.Trim(strings.ReplaceAll(remotePath, "\\", "/"), "/")
+	if remotePath == "" {
+		// The root has no path to address it by, "/root:" is invalid
+		return client.driveURL("/root" + strings.TrimPrefix(suffix, ":"))
+	}
+	return client.driveURL("/root:/" + EscapePath(remotePath) + suffix)
+}
+
+// EscapePath escapes every segment of a slash separated path for use in a
+// URL, keeping the slashes between them. Unlike url.PathEscape alone, it also
+// escapes "+", which some servers decode to a space.
+//
+// Parameters:
+//   - path: The path, e.g. "Music/AC+DC/#1 hits.mp3"
+//
+// Returns:
+//   - string: The escaped path, e.g. "Music/AC%2BDC/%231%20hits.mp3"
+func EscapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = strings.ReplaceAll(url.PathEscape(segment), "+", "%2B")
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,93 @@
+package azure
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// trickyNames are file and folder names that break naive URL building.
+var trickyNames = []struct {
+	name    string
+	escaped string
+}{
+	{"plain.zip", "plain.zip"},
+	{"with space.zip", "with%20space.zip"},
+	{"#1 hits.mp3", "%231%20hits.mp3"},
+	{"what?.txt", "what%3F.txt"},
+	{"100%.txt", "100%25.txt"},
+	{"100%20.txt", "100%2520.txt"},
+	{"AC+DC.flac", "AC%2BDC.flac"},
+	{"a&b=c;d.txt", "a&b=c%3Bd.txt"},
+	{`back\slash.txt`, "back%5Cslash.txt"},
+	{"ünïcödé.txt", "%C3%BCn%C3%AFc%C3%B6d%C3%A9.txt"},
+	{"日本語.zip", "%E6%97%A5%E6%9C%AC%E8%AA%9E.zip"},
+	{"caf\u00e9.txt", "caf%C3%A9.txt"},   // NFC, é as one code point
+	{"cafe\u0301.txt", "cafe%CC%81.txt"}, // NFD, e and a combining accent
+	{"emoji 🚀.txt", "emoji%20%F0%9F%9A%80.txt"},
+}
+
+func TestEscapePath(t *testing.T) {
+	for _, tc := range trickyNames {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := EscapePath(tc.name); got != tc.escaped {
+				t.Errorf("EscapePath(%q) = %q, want %q", tc.name, got, tc.escaped)
+			}
+		})
+	}
+}
+
+func TestEscapePathKeepsSlashes(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"", ""},
+		{"Music/AC+DC/#1 hits.mp3", "Music/AC%2BDC/%231%20hits.mp3"},
+		{"a?b/c#d/e%f", "a%3Fb/c%23d/e%25f"},
+		{"Builds/ROMs v2/rom (1).zip", "Builds/ROMs%20v2/rom%20%281%29.zip"},
+	}
+	for _, tc := range tests {
+		if got := EscapePath(tc.path); got != tc.want {
+			t.Errorf("EscapePath(%q) = %q, want %q", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestEscapePathRoundTrips(t *testing.T) {
+	for _, tc := range trickyNames {
+		path := "Folder " + tc.name + "/" + tc.name
+		escaped := EscapePath(path)
+		if strings.ContainsAny(escaped, "?#+ ") {
+			t.Errorf("EscapePath(%q) = %q contains characters with a meaning in URLs", path, escaped)
+		}
+		parsed, err := url.Parse("https://example.com/" + escaped)
+		if err != nil {
+			t.Fatalf("EscapePath(%q) = %q is not a valid URL path: %v", path, escaped, err)
+		}
+		// NFC and NFD names stay what they are, OneDrive keeps both apart
+		if parsed.Path != "/"+path {
+			t.Errorf("EscapePath(%q) decodes to %q", path, parsed.Path)
+		}
+	}
+}
+
+func TestItemURL(t *testing.T) {
+	client := &AzureClient{DriveID: "b!abc", Endpoints: Endpoints{Graph: DefaultGraphEndpoint}}
+	drive := client.driveURL("")
+	tests := []struct {
+		path   string
+		suffix string
+		want   string
+	}{
+		{"", ":/children", drive + "/root/children"},
+		{"/", "", drive + "/root"},
+		{"/Public/#1 hits.mp3", ":/content", drive + "/root:/Public/%231%20hits.mp3:/content"},
+		{`Public\AC+DC\what?.txt`, "", drive + "/root:/Public/AC%2BDC/what%3F.txt"},
+	}
+	for _, tc := range tests {
+		if got := client.itemURL(tc.path, tc.suffix); got != tc.want {
+			t.Errorf("itemURL(%q, %q) = %q, want %q", tc.path, tc.suffix, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package azure
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error kinds returned (wrapped in a *GraphError) by API calls in this package.
+// Use errors.Is to branch on them instead of matching error strings.
+var (
+	ErrItemNotFound     = errors.New("item not found")
+	ErrQuotaExceeded    = errors.New("quota exceeded")
+	ErrThrottled        = errors.New("request throttled")
+	ErrAccessDenied     = errors.New("access denied")
+	ErrResourceModified = errors.New("resource modified")
+	ErrInvalidRange     = errors.New("invalid range")
+	ErrAlreadyExists    = errors.New("item already exists")
+)
+
+// GraphError is the decoded form of a Microsoft Graph error response:
+//
+//	{"error": {"code": "...", "message": "...", "innerError": {...}}}
+//
+// Fields:
+//   - StatusCode: HTTP status code of the response
+//   - Code: Graph error code such as "itemNotFound" or "quotaLimitReached"
+//   - Message: Human-readable error message returned by Graph
+//   - InnerError: Additional details such as request-id and date
+//   - RetryAfter: Value of the Retry-After header, if any
+//   - Body: Raw response body, kept for payloads that aren't Graph errors
+//   - RequestID: The request-id response header, quoted when contacting Microsoft support
+//   - ClientRequestID: The client-request-id response header, the ID sent with the request
+type GraphError struct {
+	StatusCode      int
+	Code            string
+	Message         string
+	InnerError      map[string]interface{}
+	RetryAfter      time.Duration
+	Body            string
+	RequestID       string
+	ClientRequestID string
+}
+
+func (e *GraphError) Error() string {
+	var msg string
+	if e.Code == "" && e.Message == "" {
+		msg = fmt.Sprintf("status: %d, response: %s", e.StatusCode, e.Body)
+	} else {
+		msg = fmt.Sprintf("status: %d, code: %s, message: %s", e.StatusCode, e.Code, e.Message)
+	}
+	return msg + formatRequestIDs(e.RequestID, e.ClientRequestID)
+}
+
+// formatRequestIDs renders the request IDs of a failed response for error
+// messages, empty if there are none.
+func formatRequestIDs(requestID string, clientRequestID string) string {
+	switch {
+	case requestID != "" && clientRequestID != "":
+		return fmt.Sprintf(" (request-id: %s, client-request-id: %s)", requestID, clientRequestID)
+	case requestID != "":
+		return fmt.Sprintf(" (request-id: %s)", requestID)
+	case clientRequestID != "":
+		return fmt.Sprintf(" (client-request-id: %s)", clientRequestID)
+	}
+	return ""
+}
+
+// Unwrap maps the Graph error code and HTTP status to one of the error kinds
+// above, so that errors.Is(err, ErrThrottled) and friends work.
+func (e *GraphError) Unwrap() error {
+	switch e.Code {
+	case "itemNotFound":
+		return ErrItemNotFound
+	case "quotaLimitReached", "insufficientStorage":
+		return ErrQuotaExceeded
+	case "activityLimitReached", "tooManyRequests", "serviceNotAvailable":
+		return ErrThrottled
+	case "accessDenied", "unauthenticated", "InvalidAuthenticationToken":
+		return ErrAccessDenied
+	// Errors of the login endpoint, e.g. for a revoked refresh token
+	case "invalid_grant", "invalid_client", "unauthorized_client", "interaction_required":
+		return ErrAccessDenied
+	case "resourceModified":
+		return ErrResourceModified
+	case "invalidRange":
+		return ErrInvalidRange
+	case "nameAlreadyExists":
+		return ErrAlreadyExists
+	}
+
+	switch e.StatusCode {
+	case http.StatusNotFound:
+		return ErrItemNotFound
+	case http.StatusInsufficientStorage:
+		return ErrQuotaExceeded
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return ErrThrottled
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrAccessDenied
+	case http.StatusRequestedRangeNotSatisfiable:
+		return ErrInvalidRange
+	case http.StatusConflict:
+		return ErrAlreadyExists
+	}
+	return nil
+}
+
+// newGraphError builds a *GraphError from a non-successful response,
+// consuming its body.
+func newGraphError(resp *http.Response) *GraphError {
+	body, _ := io.ReadAll(resp.Body)
+	graphErr := &GraphError{
+		StatusCode:      resp.StatusCode,
+		Body:            string(body),
+		RequestID:       resp.Header.Get("request-id"),
+		ClientRequestID: resp.Header.Get("client-request-id"),
+	}
+
+	var payload struct {
+		Error struct {
+			Code       string                 `json:"code"`
+			Message    string                 `json:"message"`
+			InnerError map[string]interface{} `json:"innerError"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &payload) == nil {
+		graphErr.Code = payload.Error.Code
+		graphErr.Message = payload.Error.Message
+		graphErr.InnerError = payload.Error.InnerError
+	}
+
+	graphErr.RetryAfter = retryAfter(resp)
+	return graphErr
+}
+
+// newTokenError builds a *GraphError from a non-successful response of the
+// login endpoint, consuming its body. Its errors look like
+// {"error": "invalid_grant", "error_description": "..."}.
+func newTokenError(resp *http.Response) *GraphError {
+	body, _ := io.ReadAll(resp.Body)
+	tokenErr := &GraphError{
+		StatusCode:      resp.StatusCode,
+		Body:            string(body),
+		RequestID:       resp.Header.Get("x-ms-request-id"),
+		ClientRequestID: resp.Header.Get("client-request-id"),
+		RetryAfter:      retryAfter(resp),
+	}
+
+	var payload struct {
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	if json.Unmarshal(body, &payload) == nil {
+		tokenErr.Code = payload.Error
+		// The description repeats the trace and correlation IDs over lines
+		tokenErr.Message, _, _ = strings.Cut(payload.Description, "\r\n")
+	}
+	return tokenErr
+}
+
+// retryAfter returns the delay the Retry-After header of resp asks for, 0 if
+// there is none.
+func retryAfter(resp *http.Response) time.Duration {
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return 0
+}
@@ -0,0 +1,168 @@
+package azure
+
+import (
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Fault kinds FaultTransport can inject.
+const (
+	FaultThrottle    = "429"     // a 429 tooManyRequests response with Retry-After
+	FaultUnavailable = "503"     // a 503 serviceNotAvailable response
+	FaultTimeout     = "timeout" // a network timeout before the request is sent
+	FaultReset       = "reset"   // a connection reset before the request is sent
+)
+
+var faultKinds = []string{FaultThrottle, FaultUnavailable, FaultTimeout, FaultReset}
+
+// FaultConfig describes which failures FaultTransport injects and how often.
+//
+// Fields:
+//   - Probability: Chance (0 to 1) that a request fails
+//   - Kinds: Fault kinds to pick from at random, all of them when empty
+//   - OnFault: Optional hook called for every injected fault, e.g. for logging
+type FaultConfig struct {
+	Probability float64
+	Kinds       []string
+	OnFault     func(req *http.Request, kind string)
+}
+
+// ParseFaultSpec parses a fault injection spec such as
+// "p=0.05,types=429,timeout,reset". Values following "types=" that don't
+// contain "=" are further kinds.
+//
+// Parameters:
+//   - spec: The spec to parse
+//
+// Returns:
+//   - *FaultConfig: The parsed configuration
+//   - error: Error if the spec is malformed or names an unknown kind
+func ParseFaultSpec(spec string) (*FaultConfig, error) {
+	config := &FaultConfig{}
+	inKinds := false
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		key, value, hasValue := strings.Cut(part, "=")
+		switch {
+		case hasValue && key == "p":
+			p, err := strconv.ParseFloat(value, 64)
+			if err != nil || !(p >= 0 && p <= 1) { // NaN fails both
+				return nil, fmt.Errorf("invalid fault probability %q, must be between 0 and 1", value)
+			}
+			config.Probability = p
+			inKinds = false
+		case hasValue && key == "types":
+			inKinds = true
+			part = value
+			fallthrough
+		case !hasValue && inKinds:
+			if !isFaultKind(part) {
+				return nil, fmt.Errorf("unknown fault type %q, valid types are: %s", part, strings.Join(faultKinds, ", "))
+			}
+			config.Kinds = append(config.Kinds, part)
+		default:
+			return nil, fmt.Errorf("invalid fault spec element %q", part)
+		}
+	}
+
+	if config.Probability == 0 {
+		return nil, fmt.Errorf("fault spec needs a probability, e.g. p=0.05")
+	}
+	return config, nil
+}
+
+func isFaultKind(kind string) bool {
+	for _, valid := range faultKinds {
+		if kind == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// FaultTransport is an http.RoundTripper that randomly fails requests instead
+// of passing them on to Base. It is meant for testing that retries, session
+// resumption and failover hold up under errors.
+type FaultTransport struct {
+	Base   http.RoundTripper
+	Config FaultConfig
+}
+
+// NewFaultTransport wraps base, http.DefaultTransport when nil, so that
+// requests fail as described by config.
+//
+// Parameters:
+//   - base: The transport that carries requests that aren't failed
+//   - config: Which faults to inject and how often
+//
+// Returns:
+//   - *FaultTransport: The wrapping transport
+func NewFaultTransport(base http.RoundTripper, config FaultConfig) *FaultTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if len(config.Kinds) == 0 {
+		config.Kinds = faultKinds
+	}
+	return &FaultTransport{Base: base, Config: config}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *FaultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if rand.Float64() >= t.Config.Probability {
+		return t.Base.RoundTrip(req)
+	}
+
+	kind := t.Config.Kinds[rand.IntN(len(t.Config.Kinds))]
+	if t.Config.OnFault != nil {
+		t.Config.OnFault(req, kind)
+	}
+
+	// A RoundTripper must always close the request body
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	switch kind {
+	case FaultThrottle:
+		return faultResponse(req, http.StatusTooManyRequests, "tooManyRequests"), nil
+	case FaultUnavailable:
+		return faultResponse(req, http.StatusServiceUnavailable, "serviceNotAvailable"), nil
+	case FaultTimeout:
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: faultTimeoutError{}}
+	default:
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+	}
+}
+
+// faultResponse builds a Graph error response with the given status and code.
+func faultResponse(req *http.Request, status int, code string) *http.Response {
+	body := fmt.Sprintf(`{"error":{"code":%q,"message":"injected fault"}}`, code)
+	header := make(http.Header)
+	header.Set("Content-Type", "application/json")
+	header.Set("Retry-After", "1")
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// faultTimeoutError is the net.Error of an injected timeout.
+type faultTimeoutError struct{}
+
+func (faultTimeoutError) Error() string   { return "i/o timeout (injected)" }
+func (faultTimeoutError) Timeout() bool   { return true }
+func (faultTimeoutError) Temporary() bool { return true }
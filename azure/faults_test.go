@@ -0,0 +1,96 @@
+package azure
+
+import (
+	"bytes"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseFaultSpec(t *testing.T) {
+	tests := []struct {
+		spec        string
+		probability float64
+		kinds       []string
+	}{
+		{"p=0.05", 0.05, nil},
+		{"p=1", 1, nil},
+		{"p=0.05,types=429,timeout,reset", 0.05, []string{"429", "timeout", "reset"}},
+		{"types=503,p=0.5", 0.5, []string{"503"}},
+		{" p=0.5 , types=reset , 429", 0.5, []string{"reset", "429"}},
+	}
+	for _, tc := range tests {
+		config, err := ParseFaultSpec(tc.spec)
+		if err != nil {
+			t.Errorf("ParseFaultSpec(%q) failed: %v", tc.spec, err)
+			continue
+		}
+		if config.Probability != tc.probability || !slices.Equal(config.Kinds, tc.kinds) {
+			t.Errorf("ParseFaultSpec(%q) = p=%v types=%v, want p=%v types=%v", tc.spec, config.Probability, config.Kinds, tc.probability, tc.kinds)
+		}
+	}
+}
+
+func TestParseFaultSpecRejectsBadSpecs(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"p=0",
+		"p=",
+		"p=abc",
+		"p=-0.1",
+		"p=1.5",
+		"p=NaN",
+		"types=429",
+		"p=0.1,types=",
+		"p=0.1,types=404",
+		"p=0.1,types=429,bogus",
+		"p=0.1,429",
+		"p=0.1,q=2",
+	} {
+		if config, err := ParseFaultSpec(spec); err == nil {
+			t.Errorf("ParseFaultSpec(%q) = %+v, want an error", spec, config)
+		}
+	}
+}
+
+// TestUploadSurvivesFaults uploads a file while half of the chunk requests
+// fail with every kind of fault. Only chunk requests fail: those are what
+// Upload retries, a failed upload session is up to the caller.
+func TestUploadSurvivesFaults(t *testing.T) {
+	graph := newFakeGraph(t)
+	injected := map[string]int{}
+	faults := NewFaultTransport(graph.Client().Transport, FaultConfig{
+		Probability: 0.5,
+		OnFault:     func(req *http.Request, kind string) { injected[kind]++ },
+	})
+	httpClient := &http.Client{Transport: roundTripper(func(r *http.Request) (*http.Response, error) {
+		if strings.HasPrefix(r.URL.Path, "/sessions/") {
+			return faults.RoundTrip(r)
+		}
+		return graph.Client().Transport.RoundTrip(r)
+	})}
+
+	localPath, content := writeRandomFile(t, 100*1000)
+	_, err := graph.client().Upload(httpClient, UploadParams{
+		FilePath:       localPath,
+		RemoteFilePath: "/faulty",
+		ChunkSize:      1000,
+		MaxRetries:     30,
+		Backoff:        Backoff{Base: time.Microsecond, Cap: time.Microsecond},
+	})
+	if err != nil {
+		t.Fatalf("upload failed after faults %v: %v", injected, err)
+	}
+
+	got, ok := graph.file("/faulty")
+	if !ok || !bytes.Equal(got, content) {
+		t.Errorf("uploaded file has %d bytes and differs from the %d bytes sent", len(got), len(content))
+	}
+	for _, kind := range faultKinds {
+		if injected[kind] == 0 {
+			t.Errorf("no %s fault was injected, got %v", kind, injected)
+		}
+	}
+}
@@ -3,8 +3,8 @@ package azure
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
+	"net/url"
 )
 
 // GetQuickXorHash retrieves the QuickXorHash value for a specified file from Microsoft Graph API.
@@ -35,14 +35,14 @@ func (client *AzureClient) GetQuickXorHash(httpClient *http.Client, fileID strin
 	}
 
 	// Construct the URL to get the file's metadata
-	url := fmt.Sprintf("https://graph.microsoft.com/v1.0/me/drive/items/%s", fileID)
+	url := client.driveURL("/items/" + url.PathEscape(fileID))
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %v", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+client.AccessToken)
+	req.Header.Set("Authorization", client.bearer())
 
 	resp, err := httpClient.Do(req)
 	if err != nil {
@@ -51,8 +51,7 @@ func (client *AzureClient) GetQuickXorHash(httpClient *http.Client, fileID strin
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		responseBody, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("failed to fetch file metadata, status: %d, response: %s", resp.StatusCode, responseBody)
+		return "", fmt.Errorf("failed to fetch file metadata: %w", newGraphError(resp))
 	}
 
 	// Parse the response to extract the quickXorHash
@@ -2,9 +2,10 @@ package azure
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
+	"net/url"
 )
 
 // itemByPath retrieves a DriveItem from Microsoft OneDrive by its file path.
@@ -23,9 +24,9 @@ import (
 //   - The HTTP request fails
 //   - The response status code is not in the 2xx range
 //   - The response body cannot be decoded into a DriveItem
-func itemByPath(httpClient *http.Client, accessToken, path string) (*DriveItem, error) {
-	fmt.Println("Retrieving item by path:", path)
-	url := fmt.Sprintf("https://graph.microsoft.com/v1.0/me/drive/root:/%s", path)
+func (client *AzureClient) itemByPath(httpClient *http.Client, accessToken, path string) (*DriveItem, error) {
+	client.log().Debugf("Retrieving item by path: %s", path)
+	url := client.itemURL(path, "")
 	req, _ := http.NewRequest("GET", url, nil)
 	req.Header.Set("Authorization", "Bearer "+accessToken)
 
@@ -35,11 +36,10 @@ func itemByPath(httpClient *http.Client, accessToken, path string) (*DriveItem,
 	}
 	defer res.Body.Close()
 
-	fmt.Println("Item by path response status code:", res.StatusCode)
+	client.log().Debugf("Item by path response status code: %d", res.StatusCode)
 
 	if res.StatusCode < 200 || res.StatusCode > 299 {
-		responseBody, _ := ioutil.ReadAll(res.Body)
-		return nil, fmt.Errorf("failed to retrieve item, status code: %v, response: %s", res.StatusCode, string(responseBody))
+		return nil, fmt.Errorf("failed to retrieve item: %w", newGraphError(res))
 	}
 
 	var item DriveItem
@@ -50,3 +50,112 @@ func itemByPath(httpClient *http.Client, accessToken, path string) (*DriveItem,
 
 	return &item, nil
 }
+
+// ItemExists reports whether an item exists at the given remote path.
+//
+// Parameters:
+//   - httpClient: An *http.Client to make the HTTP request
+//   - remotePath: The path in OneDrive to check, including the remote's root folder
+//
+// Returns:
+//   - bool: true if an item (file or folder) exists at the path
+//   - error: Any error other than the item not being found
+func (client *AzureClient) ItemExists(httpClient *http.Client, remotePath string) (bool, error) {
+	if err := client.EnsureTokenValid(httpClient); err != nil {
+		return false, err
+	}
+
+	_, err := client.getFileID(httpClient, remotePath)
+	if errors.Is(err, ErrItemNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DeleteItem deletes a file or folder from the remote by its ID.
+// Deleted items are moved to the recycle bin of the drive. Items at one of the
+// remote's protected paths are only deleted if allowProtected is set.
+//
+// Parameters:
+//   - httpClient: An *http.Client to make the HTTP request
+//   - itemID: The unique identifier of the item to delete
+//   - remotePath: The path of the item, including the remote's root folder
+//   - allowProtected: Whether the user explicitly allowed touching protected paths
+//
+// Returns:
+//   - error: Any error encountered during the request, wrapping ErrProtectedPath
+//     if the item is protected
+func (client *AzureClient) DeleteItem(httpClient *http.Client, itemID string, remotePath string, allowProtected bool) error {
+	if err := client.CheckDeletable(remotePath, allowProtected); err != nil {
+		return err
+	}
+	if err := client.EnsureTokenValid(httpClient); err != nil {
+		return err
+	}
+
+	url := client.driveURL("/items/" + url.PathEscape(itemID))
+	req, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create delete request: %v", err)
+	}
+	req.Header.Set("Authorization", client.bearer())
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to delete item: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to delete item: %w", newGraphError(res))
+	}
+	return nil
+}
+
+// GetItem retrieves the metadata of the item at the given remote path.
+//
+// Parameters:
+//   - httpClient: An *http.Client to make the HTTP request
+//   - remotePath: The path in OneDrive, including the remote's root folder
+//
+// Returns:
+//   - *DriveItem: The item's metadata, including hashes for files
+//   - error: Any error encountered, wrapping ErrItemNotFound if there is no such item
+func (client *AzureClient) GetItem(httpClient *http.Client, remotePath string) (*DriveItem, error) {
+	if err := client.EnsureTokenValid(httpClient); err != nil {
+		return nil, err
+	}
+
+	url := client.itemURL(remotePath, "")
+
+	var item DriveItem
+	if err := client.getJSON(httpClient, url, &item); err != nil {
+		return nil, fmt.Errorf("failed to retrieve item: %w", err)
+	}
+	return &item, nil
+}
+
+// GetItemByID retrieves the metadata of an item by its ID, e.g. to learn the
+// name a file was given after uploading it with ConflictRename.
+//
+// Parameters:
+//   - httpClient: An *http.Client to make the HTTP request
+//   - itemID: The unique identifier of the item
+//
+// Returns:
+//   - *DriveItem: The item's metadata
+//   - error: Any error encountered, wrapping ErrItemNotFound if there is no such item
+func (client *AzureClient) GetItemByID(httpClient *http.Client, itemID string) (*DriveItem, error) {
+	if err := client.EnsureTokenValid(httpClient); err != nil {
+		return nil, err
+	}
+
+	var item DriveItem
+	if err := client.getJSON(httpClient, client.driveURL("/items/"+url.PathEscape(itemID)), &item); err != nil {
+		return nil, fmt.Errorf("failed to retrieve item: %w", err)
+	}
+	return &item, nil
+}
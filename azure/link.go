@@ -0,0 +1,67 @@
+package azure
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// Sharing link types and scopes accepted by CreateShareLink.
+const (
+	LinkView = "view"
+	LinkEdit = "edit"
+
+	LinkScopeAnonymous    = "anonymous"
+	LinkScopeOrganization = "organization"
+)
+
+// CreateShareLink creates a sharing link for an item, or returns the existing
+// one of the same type and scope.
+//
+// Parameters:
+//   - httpClient: *http.Client - The HTTP client used to make the request
+//   - itemID: string - The unique identifier of the item
+//   - linkType: string - LinkView or LinkEdit
+//   - scope: string - LinkScopeAnonymous or LinkScopeOrganization
+//
+// Returns:
+//   - string: The URL of the sharing link
+//   - error: Any error encountered, e.g. wrapping ErrAccessDenied if anonymous links are disabled
+func (client *AzureClient) CreateShareLink(httpClient *http.Client, itemID string, linkType string, scope string) (string, error) {
+	if err := client.EnsureTokenValid(httpClient); err != nil {
+		return "", err
+	}
+
+	body, err := json.Marshal(map[string]string{"type": linkType, "scope": scope})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode request: %v", err)
+	}
+	req, err := http.NewRequest("POST", client.driveURL("/items/"+url.PathEscape(itemID)+"/createLink"), bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", client.bearer())
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to create sharing link: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("failed to create sharing link: %w", newGraphError(resp))
+	}
+
+	var permission struct {
+		Link struct {
+			WebURL string `json:"webUrl"`
+		} `json:"link"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&permission); err != nil {
+		return "", fmt.Errorf("failed to parse sharing link: %v", err)
+	}
+	return permission.Link.WebURL, nil
+}
@@ -0,0 +1,90 @@
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// listSelect is the set of DriveItem fields requested when listing folders.
+// Asking only for what is needed keeps responses small for huge folders.
+const listSelect = "id,name,eTag,size,file,folder,lastModifiedDateTime"
+
+// listPageSize is the number of items requested per page.
+const listPageSize = 1000
+
+// ListChildren lists the items in a remote folder, calling fn for every item as
+// soon as its page arrives instead of accumulating the whole listing in memory.
+//
+// Parameters:
+//   - httpClient: *http.Client - The HTTP client used to make the requests
+//   - remotePath: string - The folder path in OneDrive, including the remote's root folder
+//   - fn: func(DriveItem) error - Called for each item, returning an error stops the listing
+//
+// Returns:
+//   - error: Any error from the requests or returned by fn
+//
+// The function requests only the fields in listSelect, uses the largest page
+// size and follows @odata.nextLink until every page has been read.
+func (client *AzureClient) ListChildren(httpClient *http.Client, remotePath string, fn func(DriveItem) error) error {
+	// The drive of SharePoint remotes is only known with a valid token
+	if err := client.EnsureTokenValid(httpClient); err != nil {
+		return err
+	}
+	remotePath = strings.Trim(remotePath, "/")
+	url := client.itemURL(remotePath, ":/children")
+	url += fmt.Sprintf("?$select=%s&$top=%d", listSelect, listPageSize)
+
+	for url != "" {
+		// Pages of big folders can take a while, keep the token fresh
+		if err := client.EnsureTokenValid(httpClient); err != nil {
+			return err
+		}
+
+		var page struct {
+			Value    []DriveItem `json:"value"`
+			NextLink string      `json:"@odata.nextLink"`
+		}
+		err := client.retry(func() error {
+			page.Value, page.NextLink = nil, ""
+			return client.getJSON(httpClient, url, &page)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list children: %w", err)
+		}
+
+		for _, item := range page.Value {
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+		url = page.NextLink
+	}
+
+	return nil
+}
+
+// getJSON performs an authenticated GET request and decodes the JSON response into v.
+func (client *AzureClient) getJSON(httpClient *http.Client, url string, v interface{}) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", client.bearer())
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return newGraphError(resp)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to parse response: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package azure
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// LogLevel is the severity of a message passed to a Logger.
+type LogLevel int
+
+// Log levels, in increasing severity.
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// Logger receives the status messages of AzureClient operations, like the
+// progress of upload sessions and chunk retries. Failures are returned as
+// errors, messages are purely informational.
+type Logger interface {
+	Debugf(format string, args ...any)
+	Infof(format string, args ...any)
+	Warnf(format string, args ...any)
+	Errorf(format string, args ...any)
+}
+
+// DefaultLogger is used by clients without a Logger. It prints informational
+// messages and above to stdout, as command line tools expect.
+var DefaultLogger Logger = NewWriterLogger(os.Stdout, LevelInfo)
+
+// writerLogger writes messages of at least its level to a writer, one per line.
+type writerLogger struct {
+	mu    sync.Mutex
+	out   io.Writer
+	level LogLevel
+}
+
+// NewWriterLogger creates a Logger that writes messages of at least level to
+// out, one per line.
+//
+// Parameters:
+//   - out: Where the messages are written to
+//   - level: The least severe level that is written
+//
+// Returns:
+//   - Logger: The logger
+func NewWriterLogger(out io.Writer, level LogLevel) Logger {
+	return &writerLogger{out: out, level: level}
+}
+
+func (l *writerLogger) logf(level LogLevel, format string, args ...any) {
+	if level < l.level {
+		return
+	}
+	message := fmt.Sprintf(format, args...)
+	if !strings.HasSuffix(message, "\n") {
+		message += "\n"
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	io.WriteString(l.out, message)
+}
+
+func (l *writerLogger) Debugf(format string, args ...any) { l.logf(LevelDebug, format, args...) }
+func (l *writerLogger) Infof(format string, args ...any)  { l.logf(LevelInfo, format, args...) }
+func (l *writerLogger) Warnf(format string, args ...any)  { l.logf(LevelWarn, format, args...) }
+func (l *writerLogger) Errorf(format string, args ...any) { l.logf(LevelError, format, args...) }
+
+// nopLogger discards every message.
+type nopLogger struct{}
+
+// NopLogger discards every message, for library users that report progress
+// on their own and for quiet operation.
+var NopLogger Logger = nopLogger{}
+
+func (nopLogger) Debugf(string, ...any) {}
+func (nopLogger) Infof(string, ...any)  {}
+func (nopLogger) Warnf(string, ...any)  {}
+func (nopLogger) Errorf(string, ...any) {}
+
+// log returns the client's Logger, DefaultLogger if none is set.
+func (client *AzureClient) log() Logger {
+	if client.Logger != nil {
+		return client.Logger
+	}
+	return DefaultLogger
+}
+
+// slogLogger passes messages on to a slog.Logger.
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger creates a Logger that passes messages on to logger at the
+// matching slog level.
+//
+// Parameters:
+//   - logger: The structured logger to use, slog.Default() when nil
+//
+// Returns:
+//   - Logger: The logger
+func NewSlogLogger(logger *slog.Logger) Logger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &slogLogger{logger: logger}
+}
+
+func (l *slogLogger) Debugf(format string, args ...any) { l.logger.Debug(fmt.Sprintf(format, args...)) }
+func (l *slogLogger) Infof(format string, args ...any)  { l.logger.Info(fmt.Sprintf(format, args...)) }
+func (l *slogLogger) Warnf(format string, args ...any)  { l.logger.Warn(fmt.Sprintf(format, args...)) }
+func (l *slogLogger) Errorf(format string, args ...any) { l.logger.Error(fmt.Sprintf(format, args...)) }
@@ -0,0 +1,46 @@
+package azure
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+// ErrPanic is the error kind of a *PanicError, use errors.Is to detect it.
+var ErrPanic = errors.New("unexpected panic")
+
+// PanicError is a panic in an upload worker, recovered and turned into an
+// error so it fails that one upload instead of crashing the whole process.
+//
+// Fields:
+//   - Value: The value the worker panicked with
+//   - Stack: Stack trace of the panicking goroutine
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("internal error: %v", e.Value)
+}
+
+// Unwrap returns ErrPanic, so that errors.Is(err, ErrPanic) works.
+func (e *PanicError) Unwrap() error {
+	return ErrPanic
+}
+
+// RecoverPanic turns a panic of the calling function into a *PanicError
+// stored in err. It must be deferred directly:
+//
+//	func work() (err error) {
+//		defer azure.RecoverPanic(&err)
+//		...
+//	}
+//
+// Parameters:
+//   - err: Where to store the error, left alone if there was no panic
+func RecoverPanic(err *error) {
+	if r := recover(); r != nil {
+		*err = &PanicError{Value: r, Stack: debug.Stack()}
+	}
+}
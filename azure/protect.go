@@ -0,0 +1,61 @@
+package azure
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ErrProtectedPath is returned when a destructive operation targets a
+// protected path without explicitly allowing it.
+var ErrProtectedPath = errors.New("protected path")
+
+// IsProtectedPath reports whether deleting remotePath would touch one of the
+// remote's protected paths, either because it lies inside one or because it
+// contains one. Paths are compared ignoring case, like OneDrive does.
+//
+// Parameters:
+//   - remotePath: The path in OneDrive, including the remote's root folder
+//
+// Returns:
+//   - bool: true if the path is protected
+func (client *AzureClient) IsProtectedPath(remotePath string) bool {
+	target := strings.ToLower(cleanRemotePath(remotePath))
+	for _, protected := range client.ProtectedPaths {
+		prefix := strings.ToLower(cleanRemotePath(protected))
+		if isSubPath(target, prefix) || isSubPath(prefix, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckDeletable returns an error wrapping ErrProtectedPath if remotePath is
+// protected and allowProtected isn't set. DeleteItem calls it, commands call
+// it themselves to refuse before any request is made.
+//
+// Parameters:
+//   - remotePath: The path in OneDrive, including the remote's root folder
+//   - allowProtected: Whether the user explicitly allowed touching protected paths
+//
+// Returns:
+//   - error: nil if the path may be deleted
+func (client *AzureClient) CheckDeletable(remotePath string, allowProtected bool) error {
+	if allowProtected || !client.IsProtectedPath(remotePath) {
+		return nil
+	}
+	return fmt.Errorf("refusing to delete /%s: %w", cleanRemotePath(remotePath), ErrProtectedPath)
+}
+
+// cleanRemotePath normalizes a remote path to the form "a/b", without leading
+// or trailing slashes, with "" being the drive root.
+func cleanRemotePath(remotePath string) string {
+	remotePath = strings.ReplaceAll(remotePath, "\\", "/")
+	return strings.Trim(path.Clean("/"+remotePath), "/")
+}
+
+// isSubPath reports whether child is parent or lies inside it.
+func isSubPath(child, parent string) bool {
+	return parent == "" || child == parent || strings.HasPrefix(child, parent+"/")
+}
@@ -0,0 +1,69 @@
+package azure
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestIsProtectedPath(t *testing.T) {
+	tests := []struct {
+		protected  []string
+		remotePath string
+		want       bool
+	}{
+		{[]string{"/Public"}, "/Public", true},
+		{[]string{"/Public"}, "/Public/", true},
+		{[]string{"/Public/"}, "/Public", true},
+		{[]string{"/Public"}, "/Public/rom.zip", true},
+		{[]string{"/Public"}, "/Public/Builds/rom.zip", true},
+		{[]string{"/Public"}, "Public/rom.zip", true},
+		{[]string{"/Public"}, `\Public\rom.zip`, true},
+		{[]string{"/Public"}, "/Public/../Public/rom.zip", true},
+		{[]string{"/Public"}, "/public/rom.zip", true},
+		{[]string{"/public"}, "/PUBLIC", true},
+		{[]string{"/Public"}, "/PublicX", false},
+		{[]string{"/Public"}, "/PublicX/rom.zip", false},
+		{[]string{"/Public"}, "/Pub", false},
+		{[]string{"/Public"}, "/Private/rom.zip", false},
+		{[]string{"/Public/Builds"}, "/Public", true},
+		{[]string{"/Public/Builds"}, "/", true},
+		{[]string{"/Public/Builds"}, "/Public/Docs", false},
+		{[]string{"/Private", "/Public"}, "/Public/rom.zip", true},
+		{[]string{"/"}, "/anything", true},
+		{nil, "/Public", false},
+	}
+	for _, tc := range tests {
+		client := &AzureClient{ProtectedPaths: tc.protected}
+		if got := client.IsProtectedPath(tc.remotePath); got != tc.want {
+			t.Errorf("IsProtectedPath(%q) with protected_paths %q = %v, want %v", tc.remotePath, tc.protected, got, tc.want)
+		}
+	}
+}
+
+func TestDeleteItemRefusesProtectedPaths(t *testing.T) {
+	graph := newFakeGraph(t)
+	client := graph.client()
+	client.ProtectedPaths = []string{"/Public"}
+
+	if err := client.DeleteItem(graph.Client(), "item", "/public/rom.zip", false); !errors.Is(err, ErrProtectedPath) {
+		t.Errorf("deleting a protected item failed with %v, want ErrProtectedPath", err)
+	}
+	if graph.tokens != 0 {
+		t.Error("refusing to delete a protected item made requests")
+	}
+	for _, tc := range []struct {
+		remotePath     string
+		allowProtected bool
+	}{
+		{"/Public/rom.zip", true},
+		{"/PublicX/rom.zip", false},
+	} {
+		if err := client.DeleteItem(graph.Client(), "item", tc.remotePath, tc.allowProtected); err != nil {
+			t.Errorf("DeleteItem(%q, allowProtected %v) failed: %v", tc.remotePath, tc.allowProtected, err)
+		}
+	}
+	if !slices.Equal(graph.deleted, []string{"item", "item"}) {
+		t.Errorf("deleted %q, want the item twice", graph.deleted)
+	}
+}
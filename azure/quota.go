@@ -3,7 +3,6 @@ package azure
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 )
 
@@ -20,7 +19,8 @@ type DriveQuota struct {
 // GetDriveQuota retrieves the quota information for the user's OneDrive storage using the Microsoft Graph API.
 // It returns a DriveQuota struct containing total storage space, used space, remaining space and deleted space in bytes.
 //
-// The function automatically ensures the access token is valid before making the request.
+// The function automatically ensures the access token is valid before making the request,
+// and retries failed requests according to the client's backoff policy.
 // If any error occurs during the process (token validation, HTTP request, response parsing),
 // it returns nil for DriveQuota and the corresponding error.
 //
@@ -36,25 +36,39 @@ func (client *AzureClient) GetDriveQuota(httpClient *http.Client) (*DriveQuota,
 		return nil, err
 	}
 
+	var quota *DriveQuota
+	err := client.retry(func() error {
+		var err error
+		quota, err = client.fetchDriveQuota(httpClient)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return quota, nil
+}
+
+// fetchDriveQuota performs a single quota request without any retries.
+func (client *AzureClient) fetchDriveQuota(httpClient *http.Client) (*DriveQuota, error) {
 	// Construct the URL to get the drive's quota information
-	url := fmt.Sprintf("https://graph.microsoft.com/v1.0/me/drive/quota")
+	url := client.driveURL("/quota")
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create quota request: %v", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+client.AccessToken)
+	req.Header.Set("Authorization", client.bearer())
 
 	resp, err := httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch quota information: %v", err)
+		return nil, fmt.Errorf("failed to fetch quota information: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		responseBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("failed to fetch quota information, status: %d, response: %s", resp.StatusCode, responseBody)
+		return nil, fmt.Errorf("failed to fetch quota information: %w", newGraphError(resp))
 	}
 
 	var quotaResponse struct {
@@ -76,7 +90,7 @@ func (client *AzureClient) GetDriveQuota(httpClient *http.Client) (*DriveQuota,
 	}, nil
 }
 
-// formatBytes converts a size in bytes to a human-readable string representation.
+// FormatBytes converts a size in bytes to a human-readable string representation.
 // It automatically chooses the appropriate unit (B, KiB, MiB, GiB, TiB, PiB, or EiB)
 // and formats the number with three decimal places.
 //
@@ -89,7 +103,7 @@ func (client *AzureClient) GetDriveQuota(httpClient *http.Client) (*DriveQuota,
 //   - 1024 bytes -> "1.000 KiB"
 //   - 1048576 bytes -> "1.000 MiB"
 //   - 2000000000 bytes -> "1.863 GiB"
-func formatBytes(bytes int64) string {
+func FormatBytes(bytes int64) string {
 	const unit = 1024
 	if bytes < unit {
 		return fmt.Sprintf("%d B", bytes)
@@ -117,9 +131,9 @@ func formatBytes(bytes int64) string {
 //   - Trashed: <formatted deleted space>
 func DisplayQuotaInfo(remote string, quota *DriveQuota) {
 	fmt.Printf("Remote: %s\n", remote)
-	fmt.Printf("Total:   %s\n", formatBytes(quota.Total))
-	fmt.Printf("Used:    %s\n", formatBytes(quota.Used))
-	fmt.Printf("Free:    %s\n", formatBytes(quota.Remaining))
-	fmt.Printf("Trashed: %s\n", formatBytes(quota.Deleted))
+	fmt.Printf("Total:   %s\n", FormatBytes(quota.Total))
+	fmt.Printf("Used:    %s\n", FormatBytes(quota.Used))
+	fmt.Printf("Free:    %s\n", FormatBytes(quota.Remaining))
+	fmt.Printf("Trashed: %s\n", FormatBytes(quota.Deleted))
 	fmt.Println()
 }
@@ -0,0 +1,48 @@
+package azure
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrReadOnly is returned for requests a read-only transport refuses to send.
+var ErrReadOnly = errors.New("refused to change anything in read-only mode")
+
+// readOnlyTransport refuses requests that could change anything.
+type readOnlyTransport struct {
+	base http.RoundTripper
+}
+
+// NewReadOnlyTransport wraps base, http.DefaultTransport when nil, so that only
+// requests reading data are sent: GET, HEAD and OPTIONS, plus token requests
+// to the login endpoint, which reads need as well. Everything else fails with
+// ErrReadOnly without reaching the server. It backs dry runs, in case a code
+// path misses its own check.
+//
+// Parameters:
+//   - base: The transport that sends the allowed requests
+//
+// Returns:
+//   - http.RoundTripper: The wrapping transport
+func NewReadOnlyTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &readOnlyTransport{base: base}
+}
+
+func (t *readOnlyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return t.base.RoundTrip(req)
+	}
+	if strings.Contains(req.URL.Path, "/oauth2/") {
+		return t.base.RoundTrip(req)
+	}
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	return nil, fmt.Errorf("%w: %s %s", ErrReadOnly, req.Method, req.URL.Host)
+}
@@ -0,0 +1,185 @@
+package azure
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// resolvedSiteDrives caches the drives sites were resolved to, by Graph
+// endpoint, site URL and library, so a process creating many clients of a
+// remote looks the site up only once.
+var resolvedSiteDrives sync.Map
+
+// SiteDrive is a document library of a SharePoint site.
+//
+// Fields:
+//   - Drive: The drive of the library, its Owner is the library's name
+//   - WebURL: The URL of the library in the browser
+//   - Default: Whether it is the site's default library ("Documents")
+type SiteDrive struct {
+	Drive
+	WebURL  string
+	Default bool
+}
+
+// ListSiteDrives returns the document libraries of the SharePoint site at
+// siteURL, e.g. "https://contoso.sharepoint.com/sites/Team".
+//
+// Parameters:
+//   - httpClient: The HTTP client used to make the requests
+//   - siteURL: The URL of the site as shown in the browser
+//
+// Returns:
+//   - []SiteDrive: The libraries of the site
+//   - error: Any error encountered, e.g. if the site doesn't exist
+func (client *AzureClient) ListSiteDrives(httpClient *http.Client, siteURL string) ([]SiteDrive, error) {
+	if err := client.EnsureTokenValid(httpClient); err != nil {
+		return nil, err
+	}
+	return client.listSiteDrives(httpClient, siteURL)
+}
+
+// listSiteDrives is ListSiteDrives without the token check, the caller must
+// have a valid token.
+func (client *AzureClient) listSiteDrives(httpClient *http.Client, siteURL string) ([]SiteDrive, error) {
+	sitePath, err := sitePath(siteURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var site struct {
+		ID string `json:"id"`
+	}
+	if err := client.getJSON(httpClient, client.Endpoints.GraphURL(sitePath), &site); err != nil {
+		return nil, fmt.Errorf("failed to look up site %s: %w", siteURL, err)
+	}
+
+	var response struct {
+		Value []struct {
+			Drive
+			Name   string `json:"name"`
+			WebURL string `json:"webUrl"`
+		} `json:"value"`
+	}
+	siteAPI := client.Endpoints.GraphURL("/sites/" + url.PathEscape(site.ID))
+	if err := client.getJSON(httpClient, siteAPI+"/drives", &response); err != nil {
+		return nil, fmt.Errorf("failed to list the libraries of %s: %w", siteURL, err)
+	}
+	// The default library's name depends on the site's language
+	var defaultDrive struct {
+		ID string `json:"id"`
+	}
+	if err := client.getJSON(httpClient, siteAPI+"/drive?$select=id", &defaultDrive); err != nil {
+		return nil, fmt.Errorf("failed to look up the default library of %s: %w", siteURL, err)
+	}
+
+	drives := make([]SiteDrive, 0, len(response.Value))
+	for _, value := range response.Value {
+		drive := SiteDrive{Drive: value.Drive, WebURL: value.WebURL, Default: value.ID == defaultDrive.ID}
+		drive.Owner = value.Name
+		drives = append(drives, drive)
+	}
+	return drives, nil
+}
+
+// FindSiteDrive returns the document library of a site called library, by
+// its display name ("Documents") or the last part of its URL
+// ("Shared Documents"), ignoring case. An empty library selects the site's
+// default library.
+//
+// Parameters:
+//   - drives: The libraries of the site, from ListSiteDrives
+//   - library: The name of the library, empty for the default one
+//
+// Returns:
+//   - *SiteDrive: The library
+//   - error: An error naming the available libraries if there is no such one
+func FindSiteDrive(drives []SiteDrive, library string) (*SiteDrive, error) {
+	if len(drives) == 0 {
+		return nil, fmt.Errorf("the site has no document libraries")
+	}
+
+	var names []string
+	for i, drive := range drives {
+		if library == "" {
+			if drive.Default {
+				return &drives[i], nil
+			}
+			continue
+		}
+		urlName := ""
+		if parsed, err := url.Parse(drive.WebURL); err == nil {
+			urlName = parsed.Path[strings.LastIndex(parsed.Path, "/")+1:]
+		}
+		if strings.EqualFold(drive.Owner, library) || strings.EqualFold(urlName, library) {
+			return &drives[i], nil
+		}
+		names = append(names, drive.Owner)
+	}
+	if library == "" {
+		return nil, fmt.Errorf("the site has no default library")
+	}
+	return nil, fmt.Errorf("the site has no library %q, it has: %s", library, strings.Join(names, ", "))
+}
+
+// resolveSiteDrive sets the client's drive to the library of its SharePoint
+// site, for remotes configured with sharepoint_site instead of a drive_id.
+// It is called by EnsureTokenValid once the token is valid, so the site is
+// only looked up when the remote is used.
+func (client *AzureClient) resolveSiteDrive(httpClient *http.Client) error {
+	client.siteMu.Lock()
+	defer client.siteMu.Unlock()
+	if client.DriveID != "" {
+		return nil
+	}
+
+	key := client.Endpoints.Graph + "\x00" + client.SharePointSite + "\x00" + client.SharePointLibrary
+	if drive, ok := resolvedSiteDrives.Load(key); ok {
+		client.DriveID = drive.(*SiteDrive).ID
+		client.DriveType = drive.(*SiteDrive).DriveType
+		return nil
+	}
+
+	drives, err := client.listSiteDrives(httpClient, client.SharePointSite)
+	if err != nil {
+		return fmt.Errorf("failed to resolve the SharePoint site of %s: %w", client.RemoteName, err)
+	}
+	drive, err := FindSiteDrive(drives, client.SharePointLibrary)
+	if err != nil {
+		return fmt.Errorf("failed to resolve the SharePoint site of %s: %w", client.RemoteName, err)
+	}
+	resolvedSiteDrives.Store(key, drive)
+	client.DriveID = drive.ID
+	client.DriveType = drive.DriveType
+	return nil
+}
+
+// ValidateSiteURL checks that a sharepoint_site value is a site URL.
+//
+// Parameters:
+//   - siteURL: The value to check
+//
+// Returns:
+//   - error: Why the value isn't a site URL, nil if it is one
+func ValidateSiteURL(siteURL string) error {
+	_, err := sitePath(siteURL)
+	return err
+}
+
+// sitePath returns the Graph path of the site at siteURL, addressed by host
+// name and server relative path.
+func sitePath(siteURL string) (string, error) {
+	parsed, err := url.Parse(siteURL)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return "", fmt.Errorf("%q is not a SharePoint site URL like https://contoso.sharepoint.com/sites/Team", siteURL)
+	}
+	relPath := strings.Trim(parsed.Path, "/")
+	if relPath == "" {
+		// The root site of the tenant
+		return "/sites/" + url.PathEscape(parsed.Hostname()), nil
+	}
+	return "/sites/" + url.PathEscape(parsed.Hostname()) + ":/" + EscapePath(relPath), nil
+}
@@ -0,0 +1,135 @@
+package azure
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSitePath(t *testing.T) {
+	tests := []struct {
+		siteURL string
+		want    string
+	}{
+		{"https://contoso.sharepoint.com", "/sites/contoso.sharepoint.com"},
+		{"https://contoso.sharepoint.com/", "/sites/contoso.sharepoint.com"},
+		{"https://contoso.sharepoint.com/sites/Team", "/sites/contoso.sharepoint.com:/sites/Team"},
+		{"https://contoso.sharepoint.com/sites/Team/", "/sites/contoso.sharepoint.com:/sites/Team"},
+		{"https://contoso.sharepoint.com:443/sites/Team", "/sites/contoso.sharepoint.com:/sites/Team"},
+		{"https://contoso.sharepoint.com/sites/Team%20Site", "/sites/contoso.sharepoint.com:/sites/Team%20Site"},
+		{"https://contoso.sharepoint.com/sites/AC+DC", "/sites/contoso.sharepoint.com:/sites/AC%2BDC"},
+		{"https://contoso.sharepoint.com/sites/%231%20Team", "/sites/contoso.sharepoint.com:/sites/%231%20Team"},
+		{"https://contoso.sharepoint.com/sites/100%25", "/sites/contoso.sharepoint.com:/sites/100%25"},
+		{"https://contoso.sharepoint.com/sites/%C3%89quipe", "/sites/contoso.sharepoint.com:/sites/%C3%89quipe"},
+		{"https://contoso.sharepoint.com/sites/\u00c9quipe", "/sites/contoso.sharepoint.com:/sites/%C3%89quipe"},
+		{"https://contoso.sharepoint.com/sites/E\u0301quipe", "/sites/contoso.sharepoint.com:/sites/E%CC%81quipe"},
+		{"https://contoso.sharepoint.com/sites/Team?web=1#docs", "/sites/contoso.sharepoint.com:/sites/Team"},
+		{"https://contoso.sharepoint.cn/teams/Ops", "/sites/contoso.sharepoint.cn:/teams/Ops"},
+	}
+	for _, tc := range tests {
+		got, err := sitePath(tc.siteURL)
+		if err != nil {
+			t.Errorf("sitePath(%q) failed: %v", tc.siteURL, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("sitePath(%q) = %q, want %q", tc.siteURL, got, tc.want)
+		}
+	}
+}
+
+func TestSitePathRejectsNonSiteURLs(t *testing.T) {
+	for _, siteURL := range []string{
+		"",
+		"contoso.sharepoint.com/sites/Team",
+		"/sites/Team",
+		"ftp://contoso.sharepoint.com/sites/Team",
+		"https:///sites/Team",
+		"https://contoso.sharepoint.com/sites/%zz",
+	} {
+		if got, err := sitePath(siteURL); err == nil {
+			t.Errorf("sitePath(%q) = %q, want an error", siteURL, got)
+		}
+	}
+}
+
+func TestFindSiteDrive(t *testing.T) {
+	drives := []SiteDrive{
+		{Drive: Drive{ID: "b!docs", Owner: "Documents"}, WebURL: "https://contoso.sharepoint.com/sites/Team/Shared%20Documents", Default: true},
+		{Drive: Drive{ID: "b!arch", Owner: "Archive 2024"}, WebURL: "https://contoso.sharepoint.com/sites/Team/Archive%202024"},
+		{Drive: Drive{ID: "b!rel", Owner: "Releases"}, WebURL: "https://contoso.sharepoint.com/sites/Team/Rel"},
+	}
+	tests := []struct {
+		library string
+		want    string
+	}{
+		{"", "b!docs"},
+		{"Documents", "b!docs"},
+		{"shared documents", "b!docs"},
+		{"Archive 2024", "b!arch"},
+		{"releases", "b!rel"},
+		{"Rel", "b!rel"},
+	}
+	for _, tc := range tests {
+		drive, err := FindSiteDrive(drives, tc.library)
+		if err != nil {
+			t.Errorf("FindSiteDrive(%q) failed: %v", tc.library, err)
+			continue
+		}
+		if drive.ID != tc.want {
+			t.Errorf("FindSiteDrive(%q) = %s, want %s", tc.library, drive.ID, tc.want)
+		}
+	}
+	if _, err := FindSiteDrive(drives, "Missing"); err == nil {
+		t.Error("FindSiteDrive found a library that doesn't exist")
+	}
+}
+
+func TestSiteDriveResolvedOnFirstUse(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/drives"):
+			w.Write([]byte(`{"value":[{"id":"docs","driveType":"documentLibrary","name":"Documents","webUrl":"https://contoso.sharepoint.com/sites/Team/Shared%20Documents"},{"id":"releases","driveType":"documentLibrary","name":"Releases","webUrl":"https://contoso.sharepoint.com/sites/Team/Releases"}]}`))
+		case strings.HasSuffix(r.URL.Path, "/drive"):
+			w.Write([]byte(`{"id":"docs"}`))
+		default:
+			w.Write([]byte(`{"id":"contoso.sharepoint.com,site"}`))
+		}
+	}))
+	defer server.Close()
+
+	expiry := time.Now().Add(time.Hour).Format(time.RFC3339)
+	configData := []byte("[team]\ntype = onedrive\nclient_id = id\ngraph_endpoint = " + server.URL +
+		"\ntoken = {\"access_token\":\"a\",\"refresh_token\":\"r\",\"expiry\":\"" + expiry + "\"}" +
+		"\nsharepoint_site = https://contoso.sharepoint.com/sites/Team-" + t.Name() + "\nsharepoint_library = Releases\n")
+
+	client, err := NewAzureClientFromRcloneConfigData(configData, "team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests != 0 || client.DriveID != "" {
+		t.Fatalf("creating the client made %d requests, drive %q", requests, client.DriveID)
+	}
+
+	if err := client.EnsureTokenValid(server.Client()); err != nil {
+		t.Fatal(err)
+	}
+	if client.DriveID != "releases" || client.DriveType != "documentLibrary" {
+		t.Errorf("drive = %q (%s), want releases (documentLibrary)", client.DriveID, client.DriveType)
+	}
+	if want := "/drives/releases/root"; !strings.HasSuffix(client.itemURL("", ""), want) {
+		t.Errorf("itemURL = %q, want suffix %q", client.itemURL("", ""), want)
+	}
+
+	before := requests
+	if err := client.EnsureTokenValid(server.Client()); err != nil {
+		t.Fatal(err)
+	}
+	if requests != before {
+		t.Errorf("the site was looked up again, %d more requests", requests-before)
+	}
+}
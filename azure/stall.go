@@ -0,0 +1,63 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultStallTimeout is how long a chunk may send no data at all before it is
+// aborted and retried.
+const DefaultStallTimeout = time.Minute
+
+// ErrStalled is the cause of chunk requests aborted by the stall detector.
+var ErrStalled = errors.New("transfer stalled")
+
+// stallReader counts the bytes read through it and when the last read was, so
+// a stalled request body can be told apart from a slow one.
+type stallReader struct {
+	reader   io.Reader
+	size     int64
+	read     atomic.Int64
+	lastRead atomic.Int64
+}
+
+func newStallReader(reader io.Reader, size int64) *stallReader {
+	stall := &stallReader{reader: reader, size: size}
+	stall.lastRead.Store(time.Now().UnixNano())
+	return stall
+}
+
+func (r *stallReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.read.Add(int64(n))
+		r.lastRead.Store(time.Now().UnixNano())
+	}
+	return n, err
+}
+
+// watchStall cancels the request with ErrStalled once the body has sent
+// nothing for timeout. It stops once the whole body was sent, waiting for the
+// response is bounded by the transport's response header timeout instead.
+func watchStall(ctx context.Context, cancel context.CancelCauseFunc, body *stallReader, timeout time.Duration) {
+	ticker := time.NewTicker(max(timeout/4, time.Second))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if body.read.Load() >= body.size {
+				return
+			}
+			if time.Since(time.Unix(0, body.lastRead.Load())) >= timeout {
+				cancel(ErrStalled)
+				return
+			}
+		}
+	}
+}
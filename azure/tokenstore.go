@@ -0,0 +1,92 @@
+package azure
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/zalando/go-keyring"
+)
+
+// TokenStoreKeyring is the token_store value that keeps a remote's tokens in
+// the OS keyring (Keychain, Secret Service or Windows Credential Manager)
+// instead of the token key of the config.
+const TokenStoreKeyring = "keyring"
+
+// KeyringService is the service name the tokens are filed under in the keyring.
+const KeyringService = "ksau-go"
+
+// ErrTokenNotFound is returned by a TokenStore that has no token for a remote.
+var ErrTokenNotFound = errors.New("token not found")
+
+// TokenStore keeps the OAuth tokens of remotes outside of the config. Clients
+// of remotes with a token_store key load their tokens from it and save
+// refreshed tokens back.
+type TokenStore interface {
+	// Load returns the tokens of a remote, ErrTokenNotFound if there are none.
+	Load(remote string) (*Token, error)
+	// Save stores the tokens of a remote, replacing any previous ones.
+	Save(remote string, token *Token) error
+	// Delete removes the tokens of a remote, it is not an error if there are none.
+	Delete(remote string) error
+}
+
+// KeyringTokenStore is a TokenStore backed by the OS keyring. Tokens are
+// stored as JSON under KeyringService with the remote name as the user.
+type KeyringTokenStore struct{}
+
+// Load implements TokenStore.
+func (KeyringTokenStore) Load(remote string) (*Token, error) {
+	value, err := keyring.Get(KeyringService, remote)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the keyring: %v", err)
+	}
+
+	var token Token
+	if err := json.Unmarshal([]byte(value), &token); err != nil {
+		return nil, fmt.Errorf("failed to parse token from the keyring: %v", err)
+	}
+	return &token, nil
+}
+
+// Save implements TokenStore.
+func (KeyringTokenStore) Save(remote string, token *Token) error {
+	value, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	if err := keyring.Set(KeyringService, remote, string(value)); err != nil {
+		return fmt.Errorf("failed to write the keyring: %v", err)
+	}
+	return nil
+}
+
+// Delete implements TokenStore.
+func (KeyringTokenStore) Delete(remote string) error {
+	err := keyring.Delete(KeyringService, remote)
+	if err != nil && !errors.Is(err, keyring.ErrNotFound) {
+		return fmt.Errorf("failed to delete from the keyring: %v", err)
+	}
+	return nil
+}
+
+// NewTokenStore returns the TokenStore for a token_store value.
+//
+// Parameters:
+//   - name: The token_store value, e.g. TokenStoreKeyring
+//
+// Returns:
+//   - TokenStore: The store, nil for an empty name (tokens are kept in the config)
+//   - error: Error if the store is unknown
+func NewTokenStore(name string) (TokenStore, error) {
+	switch name {
+	case "":
+		return nil, nil
+	case TokenStoreKeyring:
+		return KeyringTokenStore{}, nil
+	}
+	return nil, fmt.Errorf("unknown token_store %q, must be %s or empty", name, TokenStoreKeyring)
+}
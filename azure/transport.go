@@ -0,0 +1,129 @@
+package azure
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Default transport settings. The timeouts only bound establishing
+// connections and waiting for responses, how long a transfer may take is
+// limited separately per chunk (UploadParams.StallTimeout and ChunkTimeout)
+// and per upload (UploadParams.Timeout).
+const (
+	DefaultConnectTimeout        = 30 * time.Second
+	DefaultTLSHandshakeTimeout   = 30 * time.Second
+	DefaultResponseHeaderTimeout = 2 * time.Minute
+	DefaultIdleConnTimeout       = 90 * time.Second
+	DefaultMaxIdleConnsPerHost   = 16
+)
+
+// TransportOptions tunes the transport created by NewTransport.
+//
+// Fields:
+//   - ConnectTimeout: Maximum time for dialing and the TLS handshake
+//   - ResponseHeaderTimeout: Maximum time to wait for the response headers once a request is sent
+//   - IdleConnTimeout: How long unused connections are kept open for reuse
+//   - MaxIdleConnsPerHost: Connections kept open per host, parallel chunk uploads reuse them
+//   - MaxConnsPerHost: Upper bound of connections per host, 0 for no limit
+//
+// Zero fields fall back to the package defaults.
+type TransportOptions struct {
+	ConnectTimeout        time.Duration
+	ResponseHeaderTimeout time.Duration
+	IdleConnTimeout       time.Duration
+	MaxIdleConnsPerHost   int
+	MaxConnsPerHost       int
+}
+
+// NewTransport creates an HTTP transport suited for both API calls and large
+// chunk uploads: connections are pooled and kept alive, TLS 1.2 is the minimum
+// and, unlike http.Client.Timeout, nothing limits how long a request body may
+// take to send.
+//
+// Parameters:
+//   - options: TransportOptions - Timeouts and connection pool limits
+//
+// Returns:
+//   - *http.Transport: A transport based on http.DefaultTransport with the options applied
+func NewTransport(options TransportOptions) *http.Transport {
+	connectTimeout := options.ConnectTimeout
+	if connectTimeout <= 0 {
+		connectTimeout = DefaultConnectTimeout
+	}
+	responseHeaderTimeout := options.ResponseHeaderTimeout
+	if responseHeaderTimeout <= 0 {
+		responseHeaderTimeout = DefaultResponseHeaderTimeout
+	}
+	idleConnTimeout := options.IdleConnTimeout
+	if idleConnTimeout <= 0 {
+		idleConnTimeout = DefaultIdleConnTimeout
+	}
+	maxIdleConnsPerHost := options.MaxIdleConnsPerHost
+	if maxIdleConnsPerHost <= 0 {
+		maxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   connectTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = min(connectTimeout, DefaultTLSHandshakeTimeout)
+	transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	transport.ForceAttemptHTTP2 = true
+	transport.ResponseHeaderTimeout = responseHeaderTimeout
+	transport.IdleConnTimeout = idleConnTimeout
+	transport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	transport.MaxConnsPerHost = options.MaxConnsPerHost
+	return transport
+}
+
+// UserAgent is sent with every request made through NewUserAgentTransport,
+// callers set it to include their version, e.g. "ksau-go/1.2.0".
+var UserAgent = "ksau-go"
+
+// userAgentTransport sets the User-Agent and a client-request-id on requests.
+type userAgentTransport struct {
+	base http.RoundTripper
+}
+
+// NewUserAgentTransport wraps base, http.DefaultTransport when nil, so that
+// requests identify as UserAgent and carry a unique client-request-id. Graph
+// echoes the ID back, which lets Microsoft support find failed requests.
+//
+// Parameters:
+//   - base: The transport that sends the requests
+//
+// Returns:
+//   - http.RoundTripper: The wrapping transport
+func NewUserAgentTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &userAgentTransport{base: base}
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the caller's request
+	req = req.Clone(req.Context())
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", UserAgent)
+	}
+	if req.Header.Get("client-request-id") == "" {
+		req.Header.Set("client-request-id", newRequestID())
+	}
+	return t.base.RoundTrip(req)
+}
+
+// newRequestID returns a random (version 4) UUID.
+func newRequestID() string {
+	var id [16]byte
+	rand.Read(id[:])
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:])
+}
@@ -1,32 +1,84 @@
 package azure
 
-import "time"
+import (
+	"io"
+	"time"
+)
 
 // DriveItem represents an item in a Microsoft OneDrive or SharePoint drive.
 // It contains basic properties such as the unique identifier and name of the item.
+// File is set for files and Folder for folders.
 type DriveItem struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID                   string       `json:"id"`
+	Name                 string       `json:"name"`
+	ETag                 string       `json:"eTag,omitempty"`
+	Size                 int64        `json:"size"`
+	LastModifiedDateTime time.Time    `json:"lastModifiedDateTime"`
+	File                 *FileFacet   `json:"file,omitempty"`
+	Folder               *FolderFacet `json:"folder,omitempty"`
 }
 
+// FileFacet holds the file specific properties of a DriveItem.
+type FileFacet struct {
+	MimeType string `json:"mimeType"`
+	Hashes   struct {
+		QuickXorHash string `json:"quickXorHash"`
+	} `json:"hashes"`
+}
+
+// FolderFacet holds the folder specific properties of a DriveItem.
+type FolderFacet struct {
+	ChildCount int `json:"childCount"`
+}
+
+// Conflict behaviors accepted by Graph when the destination file already exists.
+const (
+	ConflictReplace = "replace"
+	ConflictRename  = "rename"
+	ConflictFail    = "fail"
+)
+
+// IsValidConflictBehavior reports whether behavior is one of the conflict
+// behaviors accepted by Graph.
+func IsValidConflictBehavior(behavior string) bool {
+	return behavior == ConflictReplace || behavior == ConflictRename || behavior == ConflictFail
+}
+
+// MaxFileSize is the largest file OneDrive and SharePoint accept, 250 GB.
+const MaxFileSize int64 = 250 * 1024 * 1024 * 1024
+
 // ProgressCallback is a function that gets called with progress updates
 type ProgressCallback func(uploadedBytes int64)
 
 // UploadParams contains configuration parameters for file upload operations to Azure Blob Storage.
 //
 // Fields:
-//   - FilePath: Local path of the file to be uploaded
+//   - FilePath: Local path of the file to be uploaded, ignored if Reader is set
+//   - Reader: Stream to upload instead of a file, read once from start to end
+//   - Size: Exact number of bytes Reader yields, Graph needs it up front
 //   - RemoteFilePath: Destination path in Azure Blob Storage
 //   - ChunkSize: Size of each upload chunk in bytes
 //   - MaxRetries: Maximum number of retry attempts for failed uploads
-//   - RetryDelay: Duration to wait between retry attempts
-//   - AccessToken: Azure authentication token for the upload operation
+//   - Backoff: Exponential backoff policy applied between retry attempts
+//   - AccessToken: Unused, requests carry the client's current token so refreshes apply mid-upload
+//   - ConflictBehavior: What to do if the remote file exists (ConflictReplace when empty)
+//   - BufferLimit: Maximum bytes of chunk data held in memory at once, 0 for no limit
+//   - ChunkTimeout: Maximum time for sending a single chunk before it is aborted and retried, 0 for no limit
+//   - StallTimeout: Maximum time a chunk may send no data before it is aborted and retried, 0 to never
+//   - Timeout: Total time budget for the whole upload including retries, 0 for no limit
 type UploadParams struct {
 	FilePath         string
+	Reader           io.Reader
+	Size             int64
 	RemoteFilePath   string
 	ChunkSize        int64
 	MaxRetries       int
-	RetryDelay       time.Duration
+	Backoff          Backoff
 	AccessToken      string
 	ProgressCallback ProgressCallback
+	ConflictBehavior string
+	BufferLimit      int64
+	ChunkTimeout     time.Duration
+	StallTimeout     time.Duration
+	Timeout          time.Duration
 }
@@ -19,10 +19,13 @@
 //
 // DriveQuota: Represents storage quota information including total, used, and remaining space.
 //
+// Logger: Receives the status messages of operations. Clients print them to stdout
+// unless another Logger, e.g. NopLogger, is set.
+//
 // Key Features:
 //   - Automatic token refresh and management
 //   - Parallel chunk upload with configurable workers
-//   - Retry mechanism for failed operations
+//   - Retry mechanism with exponential backoff and jitter for failed operations
 //   - Progress tracking and error handling
 //   - Storage quota management
 //   - QuickXorHash verification
@@ -39,7 +42,7 @@
 //	    RemoteFilePath: "remote/path/file.txt",
 //	    ChunkSize: 10 * 1024 * 1024, // 10MB chunks
 //	    MaxRetries: 3,
-//	    RetryDelay: time.Second * 5,
+//	    Backoff: Backoff{Base: 2 * time.Second, Cap: time.Minute, Multiplier: 2},
 //	}
 //
 //	fileID, err := client.Upload(httpClient, params)
@@ -50,14 +53,18 @@ package azure
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
-	"strings"
+	"runtime/trace"
 	"sync"
 	"time"
+
+	"github.com/global-index-source/ksau-go/redact"
 )
 
 // Upload performs a large file upload to Azure storage using chunked upload with parallel processing.
@@ -70,7 +77,7 @@ import (
 //   - ChunkSize: Size of each upload chunk in bytes
 //   - ParallelChunks: Number of chunks to upload in parallel
 //   - MaxRetries: Maximum number of retry attempts per chunk
-//   - RetryDelay: Delay between retry attempts
+//   - Backoff: Exponential backoff policy between retry attempts
 //
 // Returns:
 //   - string: The file ID of the uploaded file
@@ -80,10 +87,25 @@ import (
 //   - Automatic token refresh
 //   - Parallel chunk upload using worker pools
 //   - Configurable chunk size and parallel upload count
+//   - Optional memory cap, streaming chunks from disk instead of buffering them
+//   - Stall detection and an optional per-chunk timeout, so a stalled chunk is retried instead of hanging the upload
+//   - Optional time budget for the whole upload
 //   - Retry mechanism for failed chunk uploads
+//   - Immediate abort (and session cancellation) when the remote runs out of space
+//   - Panics in the worker are returned as a *PanicError instead of crashing
 //   - Progress tracking and error handling
 func (client *AzureClient) Upload(httpClient *http.Client, params UploadParams) (string, error) {
-	fmt.Println("Starting file upload with upload session...")
+	client.log().Infof("Starting file upload with upload session...")
+
+	// The budget covers everything from here on, including retries
+	ctx := context.Background()
+	if params.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, params.Timeout)
+		defer cancel()
+	}
+	ctx, task := trace.NewTask(ctx, "upload")
+	defer task.End()
 
 	// Ensure the access token is valid
 	if err := client.EnsureTokenValid(httpClient); err != nil {
@@ -91,26 +113,32 @@ func (client *AzureClient) Upload(httpClient *http.Client, params UploadParams)
 	}
 
 	// Create an upload session
-	uploadURL, err := client.createUploadSession(httpClient, params.RemoteFilePath, client.AccessToken)
+	uploadURL, err := client.createUploadSession(httpClient, params.RemoteFilePath, params.ConflictBehavior)
 	if err != nil {
 		return "", fmt.Errorf("failed to create upload session: %v", err)
 	}
-	fmt.Println("Upload session created successfully.")
-
-	// Open the file to upload
-	file, err := os.Open(params.FilePath)
-	if err != nil {
-		return "", fmt.Errorf("failed to open file: %v", err)
-	}
-	defer file.Close()
+	client.log().Infof("Upload session created successfully.")
+
+	// Open the file to upload, unless a stream is uploaded
+	var file *os.File
+	var fileSize int64
+	if params.Reader != nil {
+		fileSize = params.Size
+	} else {
+		file, err = os.Open(params.FilePath)
+		if err != nil {
+			return "", fmt.Errorf("failed to open file: %v", err)
+		}
+		defer file.Close()
 
-	// Get file information
-	fileInfo, err := file.Stat()
-	if err != nil {
-		return "", fmt.Errorf("failed to get file info: %v", err)
+		// Get file information
+		fileInfo, err := file.Stat()
+		if err != nil {
+			return "", fmt.Errorf("failed to get file info: %v", err)
+		}
+		fileSize = fileInfo.Size()
 	}
-	fileSize := fileInfo.Size()
-	fmt.Printf("File size: %d bytes\n", fileSize)
+	client.log().Infof("File size: %d bytes", fileSize)
 
 	// Define chunk size and calculate the number of chunks
 	chunkSize := params.ChunkSize
@@ -119,7 +147,11 @@ func (client *AzureClient) Upload(httpClient *http.Client, params UploadParams)
 	// Set up channels for upload management
 	var wg sync.WaitGroup
 	chunkChan := make(chan int64, numChunks)
-	errChan := make(chan error, numChunks)
+	// One more than the chunks, a panic can follow a chunk's error
+	errChan := make(chan error, numChunks+1)
+
+	// The response to the last chunk describes the uploaded file
+	var uploadedItem *DriveItem
 
 	// Track total uploaded bytes with thread-safety
 	var totalUploaded int64
@@ -129,25 +161,63 @@ func (client *AzureClient) Upload(httpClient *http.Client, params UploadParams)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
+		// A panic fails the upload (and cancels the session) like any error
+		// instead of taking down the process, including parallel uploads
+		var panicErr error
+		defer func() {
+			if panicErr != nil {
+				errChan <- panicErr
+			}
+		}()
+		defer RecoverPanic(&panicErr)
+
+		aborted := false
 		for start := range chunkChan {
+			if aborted {
+				continue // drain the remaining chunks
+			}
+
 			end := start + chunkSize - 1
 			if end >= fileSize {
 				end = fileSize - 1
 			}
 			actualChunkSize := end - start + 1
-
-			// Read the current chunk from the file
-			chunk := make([]byte, actualChunkSize)
-			_, err := file.ReadAt(chunk, start)
-			if err != nil && err != io.EOF {
-				errChan <- fmt.Errorf("failed to read chunk %d-%d: %v", start, end, err)
-				continue
+			trace.Logf(ctx, "chunk", "%d-%d", start, end)
+
+			// Read the current chunk into memory, unless that would exceed the
+			// buffer limit, in which case it is streamed from the file instead.
+			// Streams can't be read twice, their chunks are always buffered
+			var chunk *io.SectionReader
+			if file != nil {
+				chunk = io.NewSectionReader(file, start, actualChunkSize)
+			}
+			if file == nil || params.BufferLimit <= 0 || actualChunkSize <= params.BufferLimit {
+				buffer := make([]byte, actualChunkSize)
+				region := trace.StartRegion(ctx, "readChunk")
+				var err error
+				if file != nil {
+					_, err = file.ReadAt(buffer, start)
+				} else if _, err = io.ReadFull(params.Reader, buffer); err == io.ErrUnexpectedEOF || err == io.EOF {
+					err = fmt.Errorf("stream ended before its size of %d bytes", fileSize)
+				}
+				region.End()
+				if err != nil && err != io.EOF {
+					errChan <- fmt.Errorf("failed to read chunk %d-%d: %w", start, end, err)
+					aborted = true
+					continue
+				}
+				chunk = io.NewSectionReader(bytes.NewReader(buffer), 0, actualChunkSize)
 			}
 
 			// Retry logic for chunk upload with session refresh
 			for retry := 0; retry < params.MaxRetries; retry++ {
-				uploadSuccess, err := client.uploadChunk(httpClient, uploadURL, chunk, start, end, fileSize)
+				region := trace.StartRegion(ctx, "uploadChunk")
+				uploadSuccess, item, err := client.uploadChunk(ctx, httpClient, uploadURL, chunk, start, end, fileSize, params.ChunkTimeout, params.StallTimeout)
+				region.End()
 				if uploadSuccess {
+					if item != nil {
+						uploadedItem = item
+					}
 					// Update progress
 					progressMu.Lock()
 					totalUploaded += actualChunkSize
@@ -158,23 +228,46 @@ func (client *AzureClient) Upload(httpClient *http.Client, params UploadParams)
 					break
 				}
 
+				if ctx.Err() != nil {
+					errChan <- fmt.Errorf("upload exceeded its time budget of %s at chunk %d-%d: %w", params.Timeout, start, end, err)
+					aborted = true
+					break
+				}
+
+				// Retrying won't free up any space on the remote
+				if errors.Is(err, ErrQuotaExceeded) {
+					errChan <- fmt.Errorf("failed to upload chunk %d-%d: %w", start, end, err)
+					aborted = true
+					break
+				}
+
+				// An expired or out of sync session is replaced, other errors
+				// are only retried if sending the chunk again may succeed
+				sessionLost := errors.Is(err, ErrResourceModified) || errors.Is(err, ErrInvalidRange)
+				if !sessionLost && !isTransient(err) {
+					errChan <- fmt.Errorf("failed to upload chunk %d-%d: %w", start, end, err)
+					aborted = true
+					break
+				}
+
 				if retry < params.MaxRetries-1 {
-					if strings.Contains(err.Error(), "resourceModified") || strings.Contains(err.Error(), "invalidRange") {
+					if sessionLost {
 						// Session expired or range error, create new session
-						newUploadURL, sessionErr := client.createUploadSession(httpClient, params.RemoteFilePath, client.AccessToken)
+						newUploadURL, sessionErr := client.createUploadSession(httpClient, params.RemoteFilePath, params.ConflictBehavior)
 						if sessionErr != nil {
-							fmt.Printf("Failed to create new upload session: %v\n", sessionErr)
+							client.log().Warnf("Failed to create new upload session: %v", sessionErr)
 							continue
 						}
 						uploadURL = newUploadURL
-						fmt.Println("Created new upload session after error")
+						client.log().Infof("Created new upload session after error")
 					}
 
-					fmt.Printf("Error uploading chunk %d-%d: %v\n", start, end, err)
-					fmt.Printf("Retrying chunk upload (attempt %d/%d)...\n", retry+1, params.MaxRetries)
-					time.Sleep(params.RetryDelay)
+					client.log().Warnf("Error uploading chunk %d-%d: %s", start, end, redact.Error(err))
+					client.log().Infof("Retrying chunk upload (attempt %d/%d)...", retry+1, params.MaxRetries)
+					params.Backoff.Sleep(retry)
 				} else {
-					errChan <- fmt.Errorf("failed to upload chunk after %d retries: %v", params.MaxRetries, err)
+					errChan <- fmt.Errorf("failed to upload chunk after %d retries: %w", params.MaxRetries, err)
+					aborted = true
 				}
 			}
 		}
@@ -192,8 +285,16 @@ func (client *AzureClient) Upload(httpClient *http.Client, params UploadParams)
 	// Check for errors
 	select {
 	case err := <-errChan:
-		return "", fmt.Errorf("failed to upload file: %v", err)
+		// Don't leave a half-written file behind on the remote
+		client.cancelUploadSession(httpClient, uploadURL)
+		return "", fmt.Errorf("failed to upload file: %w", err)
 	default:
+		// With ConflictRename the file may have ended up under another name,
+		// so prefer the ID from the upload over looking up the path
+		if uploadedItem != nil && uploadedItem.ID != "" {
+			return uploadedItem.ID, nil
+		}
+
 		fileID, err := client.getFileID(httpClient, params.RemoteFilePath)
 		if err != nil {
 			return "", fmt.Errorf("failed to fetch file ID: %v", err)
@@ -219,13 +320,13 @@ func (client *AzureClient) Upload(httpClient *http.Client, params UploadParams)
 // It expects a JSON response containing the file's metadata, from which it extracts the ID.
 // If the file is not found or any other error occurs during the process, it returns an appropriate error.
 func (client *AzureClient) getFileID(httpClient *http.Client, remotePath string) (string, error) {
-	url := fmt.Sprintf("https://graph.microsoft.com/v1.0/me/drive/root:/%s", remotePath)
+	url := client.itemURL(remotePath, "")
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %v", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+client.AccessToken)
+	req.Header.Set("Authorization", client.bearer())
 
 	resp, err := httpClient.Do(req)
 	if err != nil {
@@ -234,8 +335,7 @@ func (client *AzureClient) getFileID(httpClient *http.Client, remotePath string)
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		responseBody, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("failed to fetch file metadata, status: %d, response: %s", resp.StatusCode, responseBody)
+		return "", fmt.Errorf("failed to fetch file metadata: %w", newGraphError(resp))
 	}
 
 	var metadata struct {
@@ -254,25 +354,29 @@ func (client *AzureClient) getFileID(httpClient *http.Client, remotePath string)
 }
 
 // createUploadSession creates an upload session for a large file upload to OneDrive/SharePoint through Microsoft Graph API.
-// It takes an HTTP client, the remote path where the file will be stored, and an access token for authentication.
+// It takes an HTTP client and the remote path where the file will be stored.
 //
 // Parameters:
 //   - httpClient: *http.Client - The HTTP client to make the request
 //   - remotePath: string - The destination path in OneDrive where the file will be uploaded
-//   - accessToken: string - OAuth2 access token for Microsoft Graph API authentication
+//   - conflictBehavior: string - What to do if the file exists: "replace" (default when empty), "rename" or "fail"
 //
 // Returns:
 //   - string: The upload URL to be used for subsequent chunk uploads
 //   - error: An error object if the operation fails, nil otherwise
 //
 // The function implements Microsoft Graph API's large file upload protocol by creating
-// an upload session with conflict behavior set to "rename" if a file with the same name exists.
+// an upload session with the requested conflict behavior for when a file with the same name exists.
 // It returns an upload URL that can be used to upload the file in chunks.
-func (client *AzureClient) createUploadSession(httpClient *http.Client, remotePath string, accessToken string) (string, error) {
-	url := fmt.Sprintf("https://graph.microsoft.com/v1.0/me/drive/root:/%s:/createUploadSession", remotePath)
+func (client *AzureClient) createUploadSession(httpClient *http.Client, remotePath string, conflictBehavior string) (string, error) {
+	if conflictBehavior == "" {
+		conflictBehavior = ConflictReplace
+	}
+
+	url := client.itemURL(remotePath, ":/createUploadSession")
 	requestBody := map[string]interface{}{
 		"item": map[string]string{
-			"@microsoft.graph.conflictBehavior": "replace",
+			"@microsoft.graph.conflictBehavior": conflictBehavior,
 		},
 	}
 	body, _ := json.Marshal(requestBody)
@@ -282,7 +386,7 @@ func (client *AzureClient) createUploadSession(httpClient *http.Client, remotePa
 		return "", fmt.Errorf("failed to create upload session request: %v", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Authorization", client.bearer())
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := httpClient.Do(req)
@@ -292,8 +396,7 @@ func (client *AzureClient) createUploadSession(httpClient *http.Client, remotePa
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		responseBody, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("failed to create upload session, status: %d, response: %s", resp.StatusCode, responseBody)
+		return "", fmt.Errorf("failed to create upload session: %w", newGraphError(resp))
 	}
 
 	var response struct {
@@ -306,40 +409,77 @@ func (client *AzureClient) createUploadSession(httpClient *http.Client, remotePa
 	return response.UploadUrl, nil
 }
 
+// cancelUploadSession deletes an upload session so that the partially uploaded
+// data is discarded by the server. Errors are ignored since this is only used
+// for cleaning up after a failed upload.
+func (client *AzureClient) cancelUploadSession(httpClient *http.Client, uploadURL string) {
+	req, err := http.NewRequest("DELETE", uploadURL, nil)
+	if err != nil {
+		return
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+}
+
 // uploadChunk uploads a single chunk of data to Azure Blob Storage using the provided URL.
 // It takes an HTTP client, the upload URL, the chunk data, start and end byte positions,
 // and the total file size.
 //
 // Parameters:
+//   - ctx: Context bounding the request, e.g. the time budget of the upload
 //   - httpClient: The HTTP client to use for the request
 //   - uploadURL: The URL to upload the chunk to
-//   - chunk: The byte slice containing the chunk data
+//   - chunk: The chunk data, either buffered in memory or backed by the file
 //   - start: The starting byte position of this chunk
 //   - end: The ending byte position of this chunk
 //   - totalSize: The total size of the complete file
+//   - timeout: Maximum time for the whole request, 0 for no limit besides ctx
+//   - stallTimeout: Abort the request once the body sent nothing for this long, 0 to never
 //
 // Returns:
 //   - bool: true if upload was successful (status 201 Created or 202 Accepted)
-//   - error: nil if successful, otherwise contains the error details with response body
+//   - *DriveItem: The uploaded file once the last chunk completed the upload, nil otherwise
+//   - error: nil if successful, otherwise wraps a *GraphError describing the failure
 //
 // The function sets the Content-Range header according to Azure Blob Storage requirements
 // and performs the upload using a PUT request.
-func (client *AzureClient) uploadChunk(httpClient *http.Client, uploadURL string, chunk []byte, start, end, totalSize int64) (bool, error) {
+func (client *AzureClient) uploadChunk(ctx context.Context, httpClient *http.Client, uploadURL string, chunk *io.SectionReader, start, end, totalSize int64, timeout time.Duration, stallTimeout time.Duration) (bool, *DriveItem, error) {
 	// Validate chunk parameters
 	if start < 0 || end < start || end >= totalSize {
-		return false, fmt.Errorf("invalid chunk range: start=%d, end=%d, total=%d", start, end, totalSize)
+		return false, nil, fmt.Errorf("invalid chunk range: start=%d, end=%d, total=%d", start, end, totalSize)
 	}
 
 	expectedSize := end - start + 1
-	if int64(len(chunk)) != expectedSize {
-		return false, fmt.Errorf("chunk size mismatch: got %d bytes, expected %d bytes", len(chunk), expectedSize)
+	if chunk.Size() != expectedSize {
+		return false, nil, fmt.Errorf("chunk size mismatch: got %d bytes, expected %d bytes", chunk.Size(), expectedSize)
 	}
 
-	// Create request with validated chunk
-	req, err := http.NewRequest("PUT", uploadURL, bytes.NewReader(chunk))
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// A slow connection may take long for a chunk, as long as data keeps
+	// flowing. Only a chunk that sends nothing for stallTimeout is aborted.
+	body := newStallReader(io.NewSectionReader(chunk, 0, expectedSize), expectedSize)
+	if stallTimeout > 0 {
+		var cancel context.CancelCauseFunc
+		ctx, cancel = context.WithCancelCause(ctx)
+		defer cancel(nil)
+		go watchStall(ctx, cancel, body, stallTimeout)
+	}
+
+	// Create request with validated chunk, reading it from the beginning on every attempt
+	req, err := http.NewRequestWithContext(ctx, "PUT", uploadURL, body)
 	if err != nil {
-		return false, fmt.Errorf("failed to create chunk upload request: %v", err)
+		return false, nil, fmt.Errorf("failed to create chunk upload request: %v", err)
 	}
+	req.ContentLength = expectedSize
 
 	// Set required headers for chunk upload
 	rangeHeader := fmt.Sprintf("bytes %d-%d/%d", start, end, totalSize)
@@ -350,25 +490,72 @@ func (client *AzureClient) uploadChunk(httpClient *http.Client, uploadURL string
 	// Perform upload
 	resp, err := httpClient.Do(req)
 	if err != nil {
-		return false, fmt.Errorf("failed to upload chunk: %v", err)
+		if errors.Is(context.Cause(ctx), ErrStalled) {
+			return false, nil, fmt.Errorf("failed to upload chunk: %w: no data sent for %s", ErrStalled, stallTimeout)
+		}
+		return false, nil, fmt.Errorf("failed to upload chunk: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// Handle response based on status code
 	switch resp.StatusCode {
-	case http.StatusCreated, http.StatusAccepted, http.StatusOK:
-		return true, nil
-	case http.StatusRequestedRangeNotSatisfiable:
-		responseBody, _ := io.ReadAll(resp.Body)
-		return false, fmt.Errorf("invalidRange: status %d, response: %s", resp.StatusCode, responseBody)
-	case http.StatusConflict:
-		responseBody, _ := io.ReadAll(resp.Body)
-		if strings.Contains(string(responseBody), "resourceModified") {
-			return false, fmt.Errorf("resourceModified: session expired")
+	case http.StatusAccepted:
+		return true, nil, nil
+	case http.StatusCreated, http.StatusOK:
+		var item DriveItem
+		if err := json.NewDecoder(resp.Body).Decode(&item); err != nil {
+			// The upload still completed, the caller falls back to looking up the path
+			return true, nil, nil
 		}
-		return false, fmt.Errorf("conflict error: status %d, response: %s", resp.StatusCode, responseBody)
+		return true, &item, nil
 	default:
-		responseBody, _ := io.ReadAll(resp.Body)
-		return false, fmt.Errorf("upload failed: status %d, response: %s", resp.StatusCode, responseBody)
+		return false, nil, fmt.Errorf("upload failed: %w", newGraphError(resp))
+	}
+}
+
+// UploadSmall uploads a small file (up to 4MB) in a single request, without
+// creating an upload session. It is meant for tiny files like health check
+// probes and sidecar metadata, use Upload for everything else.
+//
+// Parameters:
+//   - httpClient: The HTTP client to use for the request
+//   - remotePath: Destination path in OneDrive, including the remote's root folder
+//   - data: The content of the file
+//   - conflictBehavior: What to do if the file exists (ConflictReplace when empty)
+//
+// Returns:
+//   - string: The file ID of the uploaded file
+//   - error: Any error that occurred during upload
+func (client *AzureClient) UploadSmall(httpClient *http.Client, remotePath string, data []byte, conflictBehavior string) (string, error) {
+	if err := client.EnsureTokenValid(httpClient); err != nil {
+		return "", err
+	}
+
+	if conflictBehavior == "" {
+		conflictBehavior = ConflictReplace
+	}
+
+	url := client.itemURL(remotePath, ":/content") + "?@microsoft.graph.conflictBehavior=" + conflictBehavior
+	req, err := http.NewRequest("PUT", url, bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to create upload request: %v", err)
+	}
+	req.Header.Set("Authorization", client.bearer())
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload file: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("failed to upload file: %w", newGraphError(resp))
+	}
+
+	var item DriveItem
+	if err := json.NewDecoder(resp.Body).Decode(&item); err != nil {
+		return "", fmt.Errorf("failed to parse upload response: %v", err)
 	}
+	return item.ID, nil
 }
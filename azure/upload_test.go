@@ -0,0 +1,281 @@
+package azure
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeGraph is a Microsoft Graph server that supports just enough for Upload:
+// token refreshes, upload sessions, chunk uploads and deleting items. Every
+// issued token expires immediately, so every Upload refreshes it.
+type fakeGraph struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	tokens   int
+	sessions map[string]*fakeSession
+	files    map[string][]byte // completed uploads by remote path
+	badAuth  []string          // Authorization headers without an issued token
+	deleted  []string          // IDs of deleted items
+
+	sessionDelay time.Duration // how long creating an upload session takes
+
+	// chunkStatus, if set, picks the status of the nth chunk request, 0 to
+	// accept the chunk
+	chunkStatus func(n int) int
+	chunks      int
+}
+
+type fakeSession struct {
+	path string
+	data []byte
+}
+
+func newFakeGraph(t *testing.T) *fakeGraph {
+	graph := &fakeGraph{sessions: map[string]*fakeSession{}, files: map[string][]byte{}}
+	graph.Server = httptest.NewServer(http.HandlerFunc(graph.serve))
+	t.Cleanup(graph.Close)
+	return graph
+}
+
+// client returns a client of the fake server whose token has expired.
+func (graph *fakeGraph) client() *AzureClient {
+	return &AzureClient{
+		Endpoints:    Endpoints{Graph: graph.URL, Auth: graph.URL},
+		RefreshToken: "refresh",
+		Backoff:      Backoff{Base: 1, Cap: 1, Multiplier: 1},
+		Logger:       NopLogger,
+	}
+}
+
+func (graph *fakeGraph) serve(w http.ResponseWriter, r *http.Request) {
+	graph.mu.Lock()
+	defer graph.mu.Unlock()
+
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/oauth2/v2.0/token"):
+		graph.tokens++
+		fmt.Fprintf(w, `{"access_token":"token-%d","refresh_token":"refresh","expires_in":0}`, graph.tokens)
+
+	case strings.HasSuffix(r.URL.Path, ":/createUploadSession"):
+		time.Sleep(graph.sessionDelay)
+		graph.checkAuth(r)
+		remotePath := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1.0/me/drive/root:"), ":/createUploadSession")
+		id := fmt.Sprint(len(graph.sessions))
+		graph.sessions[id] = &fakeSession{path: remotePath}
+		fmt.Fprintf(w, `{"uploadUrl":%q}`, graph.URL+"/sessions/"+id)
+
+	case strings.HasPrefix(r.URL.Path, "/sessions/"):
+		session := graph.sessions[strings.TrimPrefix(r.URL.Path, "/sessions/")]
+		if session == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		graph.chunks++
+		if graph.chunkStatus != nil {
+			if status := graph.chunkStatus(graph.chunks); status != 0 {
+				w.WriteHeader(status)
+				return
+			}
+		}
+		var start, end, total int
+		if _, err := fmt.Sscanf(r.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &total); err != nil || start > len(session.data) {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		chunk, err := io.ReadAll(r.Body)
+		if err != nil || len(chunk) != end-start+1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		// A chunk may be sent again if its response was lost
+		session.data = append(session.data[:start], chunk...)
+		if len(session.data) < total {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		graph.files[session.path] = session.data
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"id":%q}`, "item"+session.path)
+
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/v1.0/me/drive/items/"):
+		graph.checkAuth(r)
+		graph.deleted = append(graph.deleted, strings.TrimPrefix(r.URL.Path, "/v1.0/me/drive/items/"))
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// checkAuth records requests without a token issued by a fakeGraph. The
+// caller holds graph.mu.
+func (graph *fakeGraph) checkAuth(r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	var n int
+	if _, err := fmt.Sscanf(auth, "Bearer token-%d", &n); err != nil || n < 1 {
+		graph.badAuth = append(graph.badAuth, auth)
+	}
+}
+
+// transport passes requests straight to the handler of graph, whatever host
+// they are for. Unlike an http.Transport, it shares no connection pools or
+// buffers with other clients.
+func (graph *fakeGraph) transport() http.RoundTripper {
+	return roundTripper(func(r *http.Request) (*http.Response, error) {
+		recorder := httptest.NewRecorder()
+		graph.serve(recorder, r)
+		return recorder.Result(), nil
+	})
+}
+
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (fn roundTripper) RoundTrip(r *http.Request) (*http.Response, error) { return fn(r) }
+
+// file returns what was uploaded to remotePath.
+func (graph *fakeGraph) file(remotePath string) ([]byte, bool) {
+	graph.mu.Lock()
+	defer graph.mu.Unlock()
+	data, ok := graph.files[remotePath]
+	return data, ok
+}
+
+// writeRandomFile writes size random bytes to a temporary file.
+func writeRandomFile(t *testing.T, size int) (string, []byte) {
+	t.Helper()
+	content := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(content)
+	localPath := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(localPath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return localPath, content
+}
+
+// TestConcurrentUploadsRefreshingTheToken runs uploads in parallel while each
+// of them refreshes the short-lived token, for go test -race to check that
+// requests read the token safely. Each goroutine talks to a fake server of
+// its own, so that nothing but the client orders their requests, and the
+// staggered starts make one upload refresh the token while the other waits
+// for its upload session. That request is the only window in which no pooled
+// fmt or encoding/json state, which the race detector treats as a sync
+// point, orders the two.
+func TestConcurrentUploadsRefreshingTheToken(t *testing.T) {
+	graphs := []*fakeGraph{newFakeGraph(t), newFakeGraph(t)}
+	for _, graph := range graphs {
+		graph.sessionDelay = 10 * time.Millisecond
+	}
+	client := graphs[0].client()
+	localPath, content := writeRandomFile(t, 10000)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(graphs))
+	for n, graph := range graphs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			time.Sleep(time.Duration(n) * 5 * time.Millisecond)
+			httpClient := &http.Client{Transport: graph.transport()}
+			for i := range 5 {
+				_, err := client.Upload(httpClient, UploadParams{
+					FilePath:       localPath,
+					RemoteFilePath: fmt.Sprintf("/upload-%d", i),
+					ChunkSize:      1000,
+					MaxRetries:     3,
+				})
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	for n, graph := range graphs {
+		for i := range 5 {
+			remotePath := fmt.Sprintf("/upload-%d", i)
+			if got, ok := graph.file(remotePath); !ok || !bytes.Equal(got, content) {
+				t.Errorf("server %d: %s has %d bytes, want the %d uploaded", n, remotePath, len(got), len(content))
+			}
+		}
+		if graph.tokens == 0 {
+			t.Errorf("server %d issued no tokens, want a refresh per upload", n)
+		}
+		if len(graph.badAuth) > 0 {
+			t.Errorf("server %d got requests without an issued token: %q", n, graph.badAuth)
+		}
+	}
+}
+
+func TestUploadRetriesOnlyTransientErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int // of the first chunk request
+		sessions int
+		fails    bool
+	}{
+		{"throttled", http.StatusTooManyRequests, 1, false},
+		{"unavailable", http.StatusServiceUnavailable, 1, false},
+		{"range lost", http.StatusRequestedRangeNotSatisfiable, 2, false},
+		{"forbidden", http.StatusForbidden, 1, true},
+		{"not found", http.StatusNotFound, 1, true},
+		{"bad request", http.StatusBadRequest, 1, true},
+	}
+	localPath, content := writeRandomFile(t, 100)
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			graph := newFakeGraph(t)
+			graph.chunkStatus = func(n int) int {
+				if n == 1 {
+					return tc.status
+				}
+				return 0
+			}
+			_, err := graph.client().Upload(graph.Client(), UploadParams{
+				FilePath:       localPath,
+				RemoteFilePath: "/file",
+				ChunkSize:      100,
+				MaxRetries:     3,
+				Backoff:        Backoff{Base: time.Millisecond, Cap: time.Millisecond},
+			})
+			if tc.fails {
+				if err == nil {
+					t.Fatal("the upload succeeded")
+				}
+				if graph.chunks != 1 {
+					t.Errorf("the chunk was sent %d times, want once", graph.chunks)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := graph.file("/file"); !bytes.Equal(got, content) {
+				t.Errorf("uploaded %d bytes, want %d", len(got), len(content))
+			}
+			if len(graph.sessions) != tc.sessions {
+				t.Errorf("created %d upload sessions, want %d", len(graph.sessions), tc.sessions)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/global-index-source/ksau-go/azure"
+)
+
+const (
+	// annotationSuffix is inserted before the extension of the annotation file,
+	// e.g. build.zip gets build.zip.notes.md.
+	annotationSuffix = ".notes"
+
+	// maxAnnotationSize keeps annotations within what a single request can upload.
+	maxAnnotationSize = 4 * 1024 * 1024
+)
+
+// annotation is the content of the --annotate file, read before the upload.
+var annotation []byte
+
+// readAnnotation reads the --annotate file, so problems show up before the upload.
+func readAnnotation() ([]byte, error) {
+	if annotateFile == "" {
+		return nil, nil
+	}
+
+	info, err := os.Stat(annotateFile)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > maxAnnotationSize {
+		return nil, fmt.Errorf("%s is larger than %s", annotateFile, azure.FormatBytes(maxAnnotationSize))
+	}
+	return os.ReadFile(annotateFile)
+}
+
+// publishAnnotation uploads the annotation next to the uploaded file and
+// prints its URL. Failures only produce a warning, the upload itself already
+// succeeded.
+func publishAnnotation(result *uploadResult, httpClient *http.Client) {
+	if annotation == nil {
+		return
+	}
+
+	suffix := annotationSuffix + filepath.Ext(annotateFile)
+	if _, err := result.client.UploadSmall(httpClient, result.remotePath+suffix, annotation, azure.ConflictReplace); err != nil {
+		fmt.Printf("%sWarning: could not upload annotation: %v%s\n", ColorYellow, err, ColorReset)
+		return
+	}
+	fmt.Printf("%sNotes:%s %s%s\n", ColorGreen, ColorReset, result.downloadURL, suffix)
+}
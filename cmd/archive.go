@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Archive formats of upload --archive.
+const (
+	ArchiveZip = "zip"
+	ArchiveTar = "tar"
+)
+
+// defaultArchiveName is the remote name template of archives, see archiveName.
+const defaultArchiveName = "{name}-{date}-{time}.{ext}"
+
+// archiveFile is a file or directory to put into an archive.
+type archiveFile struct {
+	path string // slash separated, relative to the archived directory
+	info fs.FileInfo
+}
+
+func isValidArchiveFormat(format string) bool {
+	return format == ArchiveZip || format == ArchiveTar
+}
+
+// archiveName expands the placeholders {name} (the directory's name), {date},
+// {time} and {ext} (the archive format) of a remote name template.
+func archiveName(template string, dir string, format string) string {
+	if template == "" {
+		template = defaultArchiveName
+	}
+	now := time.Now()
+	return strings.NewReplacer(
+		"{name}", filepath.Base(filepath.Clean(dir)),
+		"{date}", now.Format("20060102"),
+		"{time}", now.Format("150405"),
+		"{ext}", format,
+	).Replace(template)
+}
+
+// listArchiveFiles returns the files and directories below dir that filter
+// doesn't skip, in the order they are archived.
+func listArchiveFiles(dir string, filter *fileFilter) ([]archiveFile, error) {
+	var files []archiveFile
+	err := filepath.WalkDir(dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if skip, err := filter.visit(dir, filePath, entry); skip || err != nil {
+			return err
+		}
+		if filePath == dir || (!entry.IsDir() && !entry.Type().IsRegular()) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+		files = append(files, archiveFile{path: filepath.ToSlash(relPath), info: info})
+		return nil
+	})
+	return files, err
+}
+
+// writeArchive writes an archive of files below dir to w. Without content,
+// zeros take the place of the file data.
+func writeArchive(w io.Writer, format string, dir string, files []archiveFile, content bool) error {
+	switch format {
+	case ArchiveZip:
+		return writeZip(w, dir, files, content)
+	case ArchiveTar:
+		return writeTar(w, dir, files, content)
+	default:
+		return fmt.Errorf("unknown archive format: %s", format)
+	}
+}
+
+func writeZip(w io.Writer, dir string, files []archiveFile, content bool) error {
+	archive := zip.NewWriter(w)
+	for _, file := range files {
+		header, err := zip.FileInfoHeader(file.info)
+		if err != nil {
+			return err
+		}
+		header.Name = file.path
+		if file.info.IsDir() {
+			header.Name += "/"
+		}
+		header.Method = zip.Store
+
+		writer, err := archive.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if file.info.IsDir() {
+			continue
+		}
+		if err := copyFileContent(writer, filepath.Join(dir, filepath.FromSlash(file.path)), file.info.Size(), content); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+func writeTar(w io.Writer, dir string, files []archiveFile, content bool) error {
+	archive := tar.NewWriter(w)
+	for _, file := range files {
+		header, err := tar.FileInfoHeader(file.info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = file.path
+		if file.info.IsDir() {
+			header.Name += "/"
+		}
+
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+		if file.info.IsDir() {
+			continue
+		}
+		if err := copyFileContent(archive, filepath.Join(dir, filepath.FromSlash(file.path)), file.info.Size(), content); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// copyFileContent copies exactly size bytes of a file, the size it had when
+// it was listed, to w. Without content, zeros are written instead.
+func copyFileContent(w io.Writer, filePath string, size int64, content bool) error {
+	if !content {
+		_, err := io.CopyN(w, zeroReader{}, size)
+		return err
+	}
+
+	source, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	if _, err := io.CopyN(w, source, size); err != nil {
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("%s shrank while it was read", filePath)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,506 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/global-index-source/ksau-go/azure"
+	"github.com/global-index-source/ksau-go/cmd/history"
+	"github.com/global-index-source/ksau-go/cmd/naming"
+	"github.com/global-index-source/ksau-go/redact"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+)
+
+// backupManifestName is the name of the manifest uploaded into the backup prefix.
+const backupManifestName = ".ksau-backup.json"
+
+// Actions of a backup's change plan.
+const (
+	backupUpload = "upload"
+	backupSkip   = "skip"
+	backupFailed = "failed"
+)
+
+var (
+	backupDir       string
+	backupPrefix    string
+	backupRetries   int
+	backupChecksums string
+	backupOutput    string
+)
+
+// backupMessages receives the human readable output of backup, stderr when
+// the change plan is printed as JSON or CSV.
+var backupMessages io.Writer = os.Stdout
+
+// backupChange is what a backup did, or would do with --dry-run, with a file
+// of the directory or one of the files it publishes next to them.
+type backupChange struct {
+	Path       string `json:"path"` // slash separated, relative to the directory and the remote folder
+	Action     string `json:"action"`
+	Reason     string `json:"reason,omitempty"`
+	Size       int64  `json:"size"`
+	RemotePath string `json:"remotePath,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Incrementally back up a directory",
+	Long: `Upload the files of a local directory below a remote folder, skipping
+files that were already uploaded and didn't change since. What was uploaded
+is tracked in a manifest (path, size, modification time and QuickXorHash),
+kept next to the config and uploaded as ` + backupManifestName + ` into the
+remote folder. With --checksums, a SHA256SUMS or QUICKXORSUMS file of all
+backed up files is uploaded next to them, so downloaders can verify them.
+With --name-strategy, uploaded files are renamed like with upload, keeping
+their folder; the manifest records the names and the copies of changed files
+uploaded before under another name are kept.
+
+With --output json or csv, the change plan is printed instead of the usual
+output: every file with its action (upload, skip or failed) and the reason,
+e.g. to review and archive what a run did to a shared index. Together with
+--dry-run it shows what a run would do.`,
+	Run: runBackup,
+}
+
+func init() {
+	rootCmd.AddCommand(backupCmd)
+
+	backupCmd.Flags().StringVarP(&backupDir, "dir", "d", "", "Local directory to back up (required)")
+	backupCmd.Flags().StringVarP(&backupPrefix, "remote", "r", "", "Remote folder to back up into (required)")
+	backupCmd.Flags().IntVar(&backupRetries, "retries", 3, "Maximum number of retries for uploading chunks")
+	backupCmd.Flags().IntVar(&transfers, "transfers", defaultTransfers, "Number of files uploaded at the same time")
+	backupCmd.Flags().StringVar(&backupChecksums, "checksums", "", "Also upload a checksum manifest of all files: sha256 (SHA256SUMS) or quickxor (QUICKXORSUMS)")
+	backupCmd.Flags().StringVarP(&backupOutput, "output", "o", outputTable, "Output format: table, or json or csv for the change plan")
+	backupCmd.Flags().StringVar(&nameStrategy, "name-strategy", string(naming.StrategyKeep), "How to name the uploaded files: keep, random, hash, uuid or datetime")
+	backupCmd.Flags().StringVar(&uploaderNick, "nick", "", "Uploader name recorded in the receipts log of shared remotes (default: your user name)")
+	backupCmd.Flags().BoolVar(&noReceipt, "no-receipt", false, "Don't append to the remote's receipts log")
+	addFilterFlags(backupCmd)
+	backupCmd.MarkFlagRequired("dir")
+	backupCmd.MarkFlagRequired("remote")
+}
+
+// backupManifest records the files of a backup as they were when uploaded.
+type backupManifest struct {
+	Remote  string                        `json:"remote"`
+	Prefix  string                        `json:"prefix"`
+	Updated time.Time                     `json:"updated"`
+	Files   map[string]backupManifestFile `json:"files"` // keyed by slash separated relative path
+
+	mutex sync.Mutex // guards Files while files are uploaded concurrently
+}
+
+type backupManifestFile struct {
+	Name     string    `json:"name,omitempty"` // remote path relative to the prefix, if --name-strategy changed it
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mtime"`
+	Hash     string    `json:"hash"` // QuickXorHash
+	SHA256   string    `json:"sha256,omitempty"`
+	Uploaded time.Time `json:"uploaded"`
+}
+
+// remotePath returns the path of the file relative to the backup prefix.
+func (file backupManifestFile) remotePath(relPath string) string {
+	if file.Name != "" {
+		return file.Name
+	}
+	return relPath
+}
+
+func runBackup(cmd *cobra.Command, args []string) {
+	if backupOutput != outputTable && backupOutput != outputJSON && backupOutput != outputCSV {
+		fmt.Printf("invalid --output value %q, must be %s, %s or %s\n", backupOutput, outputTable, outputJSON, outputCSV)
+		os.Exit(1)
+	}
+	if backupOutput != outputTable {
+		backupMessages = os.Stderr
+	}
+	remoteConfig, _ := cmd.Flags().GetString("remote-config")
+	if remoteConfig == "" {
+		fmt.Println("please select a remote with --remote-config")
+		os.Exit(1)
+	}
+	if info, err := os.Stat(backupDir); err != nil || !info.IsDir() {
+		fmt.Printf("%s is not a directory\n", backupDir)
+		os.Exit(1)
+	}
+	if transfers < 1 {
+		fmt.Println("--transfers must be at least 1")
+		os.Exit(1)
+	}
+	if backupChecksums != "" && !isValidChecksumFormat(backupChecksums) {
+		fmt.Printf("Invalid checksum format: %s\nValid formats are: %s, %s\n", backupChecksums, ChecksumSHA256, ChecksumQuickXor)
+		os.Exit(1)
+	}
+	if !naming.IsValid(naming.Strategy(nameStrategy)) {
+		fmt.Printf("Invalid name strategy: %s\nValid strategies are: keep, random, hash, uuid, datetime\n", nameStrategy)
+		os.Exit(1)
+	}
+
+	requireNetwork("")
+
+	configData, err := getConfigData()
+	if err != nil {
+		fmt.Println("failed to get configuration file data:", err.Error())
+		os.Exit(1)
+	}
+	client, err := azure.NewAzureClientFromRcloneConfigData(configData, remoteConfig)
+	if err != nil {
+		fmt.Println("failed to initialize client:", err.Error())
+		os.Exit(1)
+	}
+	client.Backoff = uploadBackoff(retryDelay)
+	client.MaxRetries = backupRetries
+
+	manifestPath, err := backupManifestPath(remoteConfig, backupPrefix)
+	if err != nil {
+		fmt.Println("failed to locate the backup manifest:", err.Error())
+		os.Exit(1)
+	}
+	manifest, err := loadBackupManifest(manifestPath)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	manifest.Remote = remoteConfig
+	manifest.Prefix = backupPrefix
+
+	filter, err := newFileFilter()
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	files, err := backupFiles(backupDir, filter)
+	if err != nil {
+		fmt.Println("failed to list the directory:", err.Error())
+		os.Exit(1)
+	}
+
+	httpClient := sharedHTTPClient()
+	changes := make([]backupChange, len(files))
+	var uploaded, unchanged, failed int
+	var countMutex sync.Mutex
+	var group errgroup.Group
+	group.SetLimit(transfers)
+	for i, relPath := range files {
+		group.Go(func() error {
+			change, err := backupFile(client, httpClient, manifest, relPath)
+			changes[i] = change
+			countMutex.Lock()
+			defer countMutex.Unlock()
+			switch change.Action {
+			case backupFailed:
+				failed++
+				fmt.Fprintf(backupMessages, "%sfailed  %s: %s%s\n", ColorRed, relPath, err, ColorReset)
+				if backupOutput == outputTable {
+					printErrorHint(err)
+				}
+			case backupUpload:
+				uploaded++
+				if !dryRun {
+					fmt.Fprintf(backupMessages, "%suploaded%s %s\n", ColorGreen, ColorReset, relPath)
+				}
+			default:
+				unchanged++
+			}
+			return nil
+		})
+	}
+	group.Wait()
+
+	remoteDir := path.Join(client.RemoteRootFolder, backupPrefix)
+	if dryRun {
+		// Neither the local nor the remote manifest change
+		if backupChecksums != "" && len(manifest.Files) > 0 {
+			name := checksumFileNames[backupChecksums]
+			changes = append(changes, backupChange{Path: name, Action: backupUpload, Reason: "checksums", RemotePath: path.Join(remoteDir, name)})
+			if backupOutput == outputTable {
+				printDryRun("upload %s", path.Join(remoteDir, name))
+			}
+		}
+		if uploaded > 0 {
+			changes = append(changes, backupChange{Path: backupManifestName, Action: backupUpload, Reason: "manifest", RemotePath: path.Join(remoteDir, backupManifestName)})
+			if backupOutput == outputTable {
+				printDryRun("upload %s", path.Join(remoteDir, backupManifestName))
+			}
+		}
+		printBackupChanges(os.Stdout, changes)
+		fmt.Fprintf(backupMessages, "\n%d to upload, %d unchanged, %d failed\n", uploaded, unchanged, failed)
+		if failed > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// The checksums can fill in SHA-256 sums of the manifest, so they come first
+	published := uploaded > 0
+	if backupChecksums != "" && len(manifest.Files) > 0 {
+		name, err := publishChecksums(client, httpClient, manifest, backupChecksums)
+		change := backupChange{Path: name, Action: backupUpload, Reason: "checksums", RemotePath: path.Join(remoteDir, name)}
+		if err != nil {
+			fmt.Fprintf(backupMessages, "%sWarning: cannot upload the checksum manifest: %v%s\n", ColorYellow, err, ColorReset)
+			change.Path, change.Action, change.Error = checksumFileNames[backupChecksums], backupFailed, redact.Error(err)
+			change.RemotePath = path.Join(remoteDir, change.Path)
+		} else {
+			fmt.Fprintf(backupMessages, "%sChecksums:%s %s\n", ColorGreen, ColorReset, indexURL(client, path.Join(backupPrefix, name)))
+			published = true
+		}
+		changes = append(changes, change)
+	}
+
+	// Whatever was uploaded is recorded, even if other files failed
+	manifest.Updated = time.Now()
+	if err := saveBackupManifest(manifestPath, manifest); err != nil {
+		fmt.Fprintf(backupMessages, "%sWarning: cannot save the backup manifest: %v%s\n", ColorYellow, err, ColorReset)
+	} else if published {
+		change := backupChange{Path: backupManifestName, Action: backupUpload, Reason: "manifest", RemotePath: path.Join(remoteDir, backupManifestName)}
+		if err := publishBackupManifest(client, httpClient, manifestPath); err != nil {
+			fmt.Fprintf(backupMessages, "%sWarning: cannot upload the backup manifest: %v%s\n", ColorYellow, err, ColorReset)
+			change.Action, change.Error = backupFailed, redact.Error(err)
+		}
+		changes = append(changes, change)
+	}
+	if published {
+		invalidateListCache(remoteConfig, remoteDir)
+	}
+
+	printBackupChanges(os.Stdout, changes)
+	fmt.Fprintf(backupMessages, "\n%d uploaded, %d unchanged, %d failed\n", uploaded, unchanged, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// printBackupChanges prints the change plan to w if --output asks for JSON or
+// CSV. The table output reports the changes as they happen instead.
+func printBackupChanges(w io.Writer, changes []backupChange) {
+	switch backupOutput {
+	case outputJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(changes)
+
+	case outputCSV:
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"path", "action", "reason", "size", "remote_path", "error"})
+		for _, c := range changes {
+			writer.Write([]string{c.Path, c.Action, c.Reason, strconv.FormatInt(c.Size, 10), c.RemotePath, c.Error})
+		}
+		writer.Flush()
+	}
+}
+
+// backupFiles returns the slash separated paths of the regular files below
+// dir that filter doesn't skip, relative to it and sorted.
+func backupFiles(dir string, filter *fileFilter) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if skip, err := filter.visit(dir, filePath, entry); skip || err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		relPath, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(relPath))
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// backupFile uploads a file unless the manifest shows it didn't change and
+// returns what it did with it. Files whose size and modification time match
+// the manifest aren't even read; touched files with the same content only get
+// their manifest entry updated. With --dry-run, the upload is only printed.
+// The error of failed files is returned as well.
+func backupFile(client *azure.AzureClient, httpClient *http.Client, manifest *backupManifest, relPath string) (backupChange, error) {
+	change := backupChange{Path: relPath, Action: backupFailed}
+	fail := func(err error) (backupChange, error) {
+		change.Error = redact.Error(err)
+		return change, err
+	}
+
+	localPath := filepath.Join(backupDir, filepath.FromSlash(relPath))
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return fail(err)
+	}
+	change.Size = info.Size()
+
+	manifest.mutex.Lock()
+	previous, known := manifest.Files[relPath]
+	manifest.mutex.Unlock()
+	if known && previous.Size == info.Size() && previous.ModTime.Equal(info.ModTime()) {
+		change.Action, change.Reason = backupSkip, "unchanged"
+		return change, nil
+	}
+
+	hash, sum, err := hashLocalFile(localPath, backupChecksums == ChecksumSHA256)
+	if err != nil {
+		return fail(fmt.Errorf("failed to hash file: %w", err))
+	}
+	if known && previous.Size == info.Size() && previous.Hash == hash {
+		previous.ModTime = info.ModTime()
+		if sum != "" {
+			previous.SHA256 = sum
+		}
+		manifest.mutex.Lock()
+		manifest.Files[relPath] = previous
+		manifest.mutex.Unlock()
+		change.Action, change.Reason = backupSkip, "same content"
+		return change, nil
+	}
+
+	name, err := naming.Generate(naming.Strategy(nameStrategy), path.Base(relPath), localPath)
+	if err != nil {
+		return fail(err)
+	}
+	remoteRelPath := path.Join(path.Dir(relPath), name)
+	remotePath := path.Join(client.RemoteRootFolder, backupPrefix, remoteRelPath)
+	change.RemotePath = remotePath
+	change.Reason = "new"
+	if known {
+		change.Reason = "changed"
+	}
+	if dryRun {
+		if backupOutput == outputTable {
+			printDryRun("upload %s (%s) to %s:%s", relPath, azure.FormatBytes(info.Size()), manifest.Remote, remotePath)
+		}
+		change.Action = backupUpload
+		return change, nil
+	}
+	release := remoteSlots.acquire(client)
+	start := time.Now()
+	_, err = client.Upload(httpClient, azure.UploadParams{
+		FilePath:         localPath,
+		RemoteFilePath:   remotePath,
+		ChunkSize:        getChunkSize(info.Size()),
+		MaxRetries:       backupRetries,
+		Backoff:          client.Backoff,
+		ConflictBehavior: azure.ConflictReplace,
+		StallTimeout:     azure.DefaultStallTimeout,
+	})
+	elapsed := time.Since(start)
+	release()
+	if err != nil {
+		recordTransfer(history.Entry{Remote: manifest.Remote, Duration: elapsed})
+		return fail(err)
+	}
+
+	absPath, _ := filepath.Abs(localPath)
+	recordTransfer(history.Entry{
+		Remote:     manifest.Remote,
+		Bytes:      info.Size(),
+		Success:    true,
+		Duration:   elapsed,
+		LocalPath:  absPath,
+		RemotePath: remotePath,
+		Size:       info.Size(),
+		Hash:       hash,
+		Link:       indexURL(client, path.Join(backupPrefix, remoteRelPath)),
+	})
+	appendReceipt(backupMessages, &uploadResult{remote: manifest.Remote, client: client, remotePath: remotePath, hash: hash}, localPath, info.Size(), httpClient)
+
+	file := backupManifestFile{
+		Size:     info.Size(),
+		ModTime:  info.ModTime(),
+		Hash:     hash,
+		SHA256:   sum,
+		Uploaded: time.Now(),
+	}
+	if remoteRelPath != relPath {
+		file.Name = remoteRelPath
+	}
+	manifest.mutex.Lock()
+	manifest.Files[relPath] = file
+	manifest.mutex.Unlock()
+	change.Action = backupUpload
+	return change, nil
+}
+
+// backupManifestPath returns where the local manifest of a backup of prefix
+// on remote is kept.
+func backupManifestPath(remote string, prefix string) (string, error) {
+	backupsDir, err := getStatePath("backups")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(backupsDir, 0755); err != nil {
+		return "", err
+	}
+
+	prefix = path.Clean("/" + filepath.ToSlash(prefix))
+	sum := sha256.Sum256([]byte(remote + ":" + prefix))
+	return filepath.Join(backupsDir, "backup-"+hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+// loadBackupManifest reads a local manifest, an empty one if there is none yet.
+func loadBackupManifest(manifestPath string) (*backupManifest, error) {
+	manifest := &backupManifest{Files: make(map[string]backupManifestFile)}
+	data, err := os.ReadFile(manifestPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup manifest: %w", err)
+	}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse backup manifest %s: %w", manifestPath, err)
+	}
+	if manifest.Files == nil {
+		manifest.Files = make(map[string]backupManifestFile)
+	}
+	return manifest, nil
+}
+
+func saveBackupManifest(manifestPath string, manifest *backupManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(manifestPath, data, 0644)
+}
+
+// publishBackupManifest uploads the saved local manifest into the backup
+// prefix, so the state of the backup can be seen without this machine. Large
+// trees can exceed the limit of a single request, so it goes through an
+// upload session like any other file.
+func publishBackupManifest(client *azure.AzureClient, httpClient *http.Client, manifestPath string) error {
+	info, err := os.Stat(manifestPath)
+	if err != nil {
+		return err
+	}
+	_, err = client.Upload(httpClient, azure.UploadParams{
+		FilePath:         manifestPath,
+		RemoteFilePath:   path.Join(client.RemoteRootFolder, backupPrefix, backupManifestName),
+		ChunkSize:        getChunkSize(info.Size()),
+		MaxRetries:       backupRetries,
+		Backoff:          client.Backoff,
+		ConflictBehavior: azure.ConflictReplace,
+		StallTimeout:     azure.DefaultStallTimeout,
+	})
+	return err
+}
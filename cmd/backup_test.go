@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/global-index-source/ksau-go/azure"
+)
+
+// backupChangesOf runs backupFile with --dry-run over a directory holding an
+// unchanged, a touched, a changed and a new file, plus one that vanished.
+func backupChangesOf(t *testing.T) []backupChange {
+	t.Helper()
+	dir := t.TempDir()
+	write := func(name, content string) os.FileInfo {
+		localPath := filepath.Join(dir, name)
+		if err := os.WriteFile(localPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(localPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info
+	}
+
+	manifest := &backupManifest{Remote: "oned", Files: map[string]backupManifestFile{}}
+	unchanged := write("unchanged.txt", "unchanged")
+	manifest.Files["unchanged.txt"] = backupManifestFile{Size: unchanged.Size(), ModTime: unchanged.ModTime()}
+	touched := write("touched.txt", "touched")
+	hash, _, err := hashLocalFile(filepath.Join(dir, "touched.txt"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest.Files["touched.txt"] = backupManifestFile{Size: touched.Size(), ModTime: touched.ModTime().Add(-time.Hour), Hash: hash}
+	manifest.Files["changed.txt"] = backupManifestFile{Size: 1, ModTime: time.Now().Add(-time.Hour)}
+	write("changed.txt", "changed")
+	write("new.txt", "new")
+
+	savedDir, savedDryRun, savedOutput := backupDir, dryRun, backupOutput
+	t.Cleanup(func() { backupDir, dryRun, backupOutput = savedDir, savedDryRun, savedOutput })
+	backupDir, dryRun, backupOutput = dir, true, outputJSON
+
+	client := &azure.AzureClient{RemoteRootFolder: "/Backups"}
+	var changes []backupChange
+	for _, relPath := range []string{"unchanged.txt", "touched.txt", "changed.txt", "new.txt", "vanished.txt"} {
+		change, _ := backupFile(client, nil, manifest, relPath)
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+var wantBackupChanges = [][]string{
+	{"unchanged.txt", backupSkip, "unchanged", ""},
+	{"touched.txt", backupSkip, "same content", ""},
+	{"changed.txt", backupUpload, "changed", "/Backups/changed.txt"},
+	{"new.txt", backupUpload, "new", "/Backups/new.txt"},
+	{"vanished.txt", backupFailed, "", ""},
+}
+
+func TestBackupChangePlanJSON(t *testing.T) {
+	changes := backupChangesOf(t)
+	var out bytes.Buffer
+	printBackupChanges(&out, changes)
+
+	var got []backupChange
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("change plan isn't JSON: %v\n%s", err, out.String())
+	}
+	if len(got) != len(wantBackupChanges) {
+		t.Fatalf("change plan has %d rows, want %d", len(got), len(wantBackupChanges))
+	}
+	for i, want := range wantBackupChanges {
+		c := got[i]
+		if c.Path != want[0] || c.Action != want[1] || c.Reason != want[2] || c.RemotePath != want[3] {
+			t.Errorf("row %d = %+v, want %v", i, c, want)
+		}
+	}
+	if got[4].Error == "" {
+		t.Error("the failed row has no error")
+	}
+	if got[1].Size != int64(len("touched")) {
+		t.Errorf("touched.txt has size %d, want %d", got[1].Size, len("touched"))
+	}
+}
+
+func TestBackupChangePlanCSV(t *testing.T) {
+	changes := backupChangesOf(t)
+	backupOutput = outputCSV
+	var out bytes.Buffer
+	printBackupChanges(&out, changes)
+
+	rows, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatalf("change plan isn't CSV: %v", err)
+	}
+	if len(rows) != len(wantBackupChanges)+1 {
+		t.Fatalf("change plan has %d rows, want a header and %d", len(rows), len(wantBackupChanges))
+	}
+	if header := rows[0]; header[0] != "path" || header[1] != "action" || header[2] != "reason" {
+		t.Errorf("header = %v", header)
+	}
+	for i, want := range wantBackupChanges {
+		row := rows[i+1]
+		if row[0] != want[0] || row[1] != want[1] || row[2] != want[2] || row[4] != want[3] {
+			t.Errorf("row %d = %v, want %v", i, row, want)
+		}
+	}
+	if rows[5][5] == "" {
+		t.Error("the failed row has no error")
+	}
+}
@@ -0,0 +1,256 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/global-index-source/ksau-go/azure"
+	"github.com/spf13/cobra"
+)
+
+// benchLatencySamples is how many quota requests the latency is the best of.
+const benchLatencySamples = 3
+
+var (
+	benchRemotes    []string
+	benchSize       int64
+	benchChunkSizes []int64
+	benchStreams    int
+)
+
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Measure the latency and throughput of the remotes",
+	Long: `Upload a file of random data to every remote (or the ones given with
+--remote-config) once per chunk size and then with several uploads at once,
+deleting it again after each upload. Prints the latency and throughput per
+remote and recommends a chunk size and the number of concurrent uploads.`,
+	Run: runBench,
+}
+
+func init() {
+	rootCmd.AddCommand(benchCmd)
+
+	benchCmd.Flags().Int64Var(&benchSize, "size", 20*1024*1024, "Size of the test file in bytes")
+	benchCmd.Flags().Int64SliceVar(&benchChunkSizes, "chunk-sizes", []int64{5 * 1024 * 1024, 10 * 1024 * 1024}, "Chunk sizes to compare, in bytes (comma separated)")
+	benchCmd.Flags().IntVar(&benchStreams, "streams", 2, "Number of concurrent uploads to compare against a single one (1 to skip)")
+	// Shadows the persistent --remote-config so it can be repeated or given a comma list
+	benchCmd.Flags().StringSliceVarP(&benchRemotes, "remote-config", "c", nil, "Only benchmark these remotes (repeatable or comma separated)")
+}
+
+// benchResult holds the measurements of one remote.
+type benchResult struct {
+	remote     string
+	latency    time.Duration
+	throughput map[int64]float64 // bytes per second per chunk size
+	bestChunk  int64
+	parallel   float64 // combined bytes per second of benchStreams uploads
+	err        error
+}
+
+func runBench(cmd *cobra.Command, args []string) {
+	if benchSize <= 0 {
+		fmt.Println("--size must be positive")
+		os.Exit(1)
+	}
+	for _, size := range benchChunkSizes {
+		// Graph requires chunk sizes in multiples of 320 KiB
+		if size <= 0 || size%(320*1024) != 0 {
+			fmt.Printf("invalid chunk size %d, must be a positive multiple of 327680 (320 KiB)\n", size)
+			os.Exit(1)
+		}
+	}
+
+	requireNetwork("")
+
+	configData, err := getConfigData()
+	if err != nil {
+		fmt.Println("failed to get configuration file data:", err.Error())
+		os.Exit(1)
+	}
+	parsedConfigData, err := azure.ParseRcloneConfigData(configData)
+	if err != nil {
+		fmt.Println("failed to parse configuration file data:", err.Error())
+		os.Exit(1)
+	}
+	remotes := azure.GetAvailableRemotes(&parsedConfigData)
+	if len(benchRemotes) > 0 {
+		remotes, err = selectRemotes(remotes, benchRemotes)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	}
+
+	testFile, err := createBenchFile(benchSize)
+	if err != nil {
+		fmt.Println("failed to create the test file:", err.Error())
+		os.Exit(1)
+	}
+	defer os.Remove(testFile)
+
+	httpClient := sharedHTTPClient()
+	results := make([]benchResult, 0, len(remotes))
+	for _, remote := range remotes {
+		fmt.Printf("benchmarking %s...\n", remote)
+		results = append(results, benchRemote(configData, remote, testFile, httpClient))
+	}
+	fmt.Println()
+
+	printBenchResults(results)
+}
+
+// createBenchFile writes size bytes of random data, which can't be
+// compressed along the way, to a temporary file and returns its path.
+func createBenchFile(size int64) (string, error) {
+	file, err := os.CreateTemp("", "ksau-bench-*.bin")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	random := rand.NewChaCha8([32]byte{})
+	if _, err := io.CopyN(file, random, size); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// benchRemote measures the latency of a remote, the throughput of an upload
+// per chunk size and of benchStreams concurrent uploads with the best one.
+func benchRemote(configData []byte, remote string, testFile string, httpClient *http.Client) benchResult {
+	result := benchResult{remote: remote, throughput: make(map[int64]float64)}
+
+	client, err := azure.NewAzureClientFromRcloneConfigData(configData, remote)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	client.Logger = azure.NopLogger
+	if err := client.EnsureTokenValid(httpClient); err != nil {
+		result.err = err
+		return result
+	}
+
+	for i := 0; i < benchLatencySamples; i++ {
+		start := time.Now()
+		if _, err := client.GetDriveQuota(httpClient); err != nil {
+			result.err = err
+			return result
+		}
+		if latency := time.Since(start); result.latency == 0 || latency < result.latency {
+			result.latency = latency
+		}
+	}
+
+	for _, chunkSize := range benchChunkSizes {
+		elapsed, err := benchUpload(client, httpClient, testFile, chunkSize, 0)
+		if err != nil {
+			result.err = err
+			return result
+		}
+		result.throughput[chunkSize] = float64(benchSize) / elapsed.Seconds()
+		if result.bestChunk == 0 || result.throughput[chunkSize] > result.throughput[result.bestChunk] {
+			result.bestChunk = chunkSize
+		}
+	}
+
+	if benchStreams > 1 {
+		var wg sync.WaitGroup
+		errs := make([]error, benchStreams)
+		start := time.Now()
+		for i := 0; i < benchStreams; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, errs[i] = benchUpload(client, httpClient, testFile, result.bestChunk, i+1)
+			}(i)
+		}
+		wg.Wait()
+		for _, err := range errs {
+			if err != nil {
+				result.err = err
+				return result
+			}
+		}
+		result.parallel = float64(benchSize) * float64(benchStreams) / time.Since(start).Seconds()
+	}
+	return result
+}
+
+// benchUpload uploads the test file under a unique name, deletes it again and
+// returns how long the upload took.
+func benchUpload(client *azure.AzureClient, httpClient *http.Client, testFile string, chunkSize int64, stream int) (time.Duration, error) {
+	remotePath := path.Join(client.RemoteRootFolder, fmt.Sprintf(".ksau-bench-%d-%d-%d.bin", time.Now().UnixNano(), chunkSize, stream))
+
+	start := time.Now()
+	fileID, err := client.Upload(httpClient, azure.UploadParams{
+		FilePath:         testFile,
+		RemoteFilePath:   remotePath,
+		ChunkSize:        chunkSize,
+		MaxRetries:       1,
+		Backoff:          client.Backoff,
+		ConflictBehavior: azure.ConflictFail,
+		StallTimeout:     azure.DefaultStallTimeout,
+	})
+	elapsed := time.Since(start)
+	if err != nil {
+		return 0, fmt.Errorf("upload with %s chunks failed: %w", azure.FormatBytes(chunkSize), err)
+	}
+
+	if err := client.DeleteItem(httpClient, fileID, remotePath, false); err != nil {
+		return 0, fmt.Errorf("failed to delete test file %s: %w", remotePath, err)
+	}
+	return elapsed, nil
+}
+
+func printBenchResults(results []benchResult) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprint(writer, "Remote\tLatency")
+	for _, chunkSize := range benchChunkSizes {
+		fmt.Fprintf(writer, "\t%s chunks", azure.FormatBytes(chunkSize))
+	}
+	if benchStreams > 1 {
+		fmt.Fprintf(writer, "\t%d uploads", benchStreams)
+	}
+	fmt.Fprintln(writer)
+
+	for _, result := range results {
+		if result.err != nil {
+			fmt.Fprintf(writer, "%s\t%sfailed: %v%s\n", result.remote, ColorRed, result.err, ColorReset)
+			continue
+		}
+		fmt.Fprintf(writer, "%s\t%s", result.remote, result.latency.Round(time.Millisecond))
+		for _, chunkSize := range benchChunkSizes {
+			fmt.Fprintf(writer, "\t%s/s", azure.FormatBytes(int64(result.throughput[chunkSize])))
+		}
+		if benchStreams > 1 {
+			fmt.Fprintf(writer, "\t%s/s", azure.FormatBytes(int64(result.parallel)))
+		}
+		fmt.Fprintln(writer)
+	}
+	writer.Flush()
+
+	fmt.Println("\nRecommendations:")
+	for _, result := range results {
+		if result.err != nil {
+			continue
+		}
+		advice := fmt.Sprintf("--chunk-size %d", result.bestChunk)
+		// Concurrent uploads only pay off if they add noticeably to a single one
+		if benchStreams > 1 && result.parallel > 1.2*result.throughput[result.bestChunk] {
+			advice += fmt.Sprintf(", up to %d uploads at once", benchStreams)
+		} else if benchStreams > 1 {
+			advice += ", one upload at a time (a single upload saturates the connection)"
+		}
+		fmt.Printf("  %s: %s\n", result.remote, advice)
+	}
+}
@@ -0,0 +1,263 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/global-index-source/ksau-go/azure"
+	"github.com/spf13/cobra"
+)
+
+// Results of comparing a file in check.
+const (
+	checkMatch   = "match"
+	checkDiffer  = "differ"
+	checkMissing = "missing" // only local, missing on the remote
+	checkExtra   = "extra"   // only on the remote
+)
+
+var (
+	checkDir      string
+	checkFolder   string
+	checkSizeOnly bool
+	checkOutput   string
+	checkAll      bool
+)
+
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Compare a local directory with a remote folder",
+	Long: `Walk a local directory and a remote folder and compare the files by size
+and QuickXorHash, reporting files missing on the remote, extra files on the
+remote and files that differ. Nothing is transferred. Exits with status 1 if
+the trees don't match.`,
+	Run: runCheck,
+}
+
+func init() {
+	rootCmd.AddCommand(checkCmd)
+
+	checkCmd.Flags().StringVarP(&checkDir, "dir", "d", "", "Local directory to compare (required)")
+	checkCmd.Flags().StringVarP(&checkFolder, "remote", "r", "", "Remote folder to compare with (required)")
+	checkCmd.Flags().BoolVar(&checkSizeOnly, "size-only", false, "Only compare sizes, without hashing the local files")
+	checkCmd.Flags().StringVarP(&checkOutput, "output", "o", outputTable, "Output format: table, json or csv")
+	checkCmd.Flags().BoolVar(&checkAll, "all", false, "Also list matching files")
+	addFilterFlags(checkCmd)
+	checkCmd.MarkFlagRequired("dir")
+	checkCmd.MarkFlagRequired("remote")
+}
+
+// checkEntry is the result of comparing one file.
+type checkEntry struct {
+	Path       string `json:"path"` // slash separated, relative to both trees
+	Status     string `json:"status"`
+	LocalSize  int64  `json:"localSize,omitempty"`
+	RemoteSize int64  `json:"remoteSize,omitempty"`
+	LocalHash  string `json:"localHash,omitempty"`
+	RemoteHash string `json:"remoteHash,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+func runCheck(cmd *cobra.Command, args []string) {
+	if checkOutput != outputTable && checkOutput != outputJSON && checkOutput != outputCSV {
+		fmt.Printf("invalid --output value %q, must be %s, %s or %s\n", checkOutput, outputTable, outputJSON, outputCSV)
+		os.Exit(1)
+	}
+	remoteConfig, _ := cmd.Flags().GetString("remote-config")
+	if remoteConfig == "" {
+		fmt.Println("please select a remote with --remote-config")
+		os.Exit(1)
+	}
+	if info, err := os.Stat(checkDir); err != nil || !info.IsDir() {
+		fmt.Printf("%s is not a directory\n", checkDir)
+		os.Exit(1)
+	}
+
+	requireNetwork("")
+
+	configData, err := getConfigData()
+	if err != nil {
+		fmt.Println("failed to get configuration file data:", err.Error())
+		os.Exit(1)
+	}
+	client, err := azure.NewAzureClientFromRcloneConfigData(configData, remoteConfig)
+	if err != nil {
+		fmt.Println("failed to initialize client:", err.Error())
+		os.Exit(1)
+	}
+
+	filter, err := newFileFilter()
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	localFiles, err := backupFiles(checkDir, filter)
+	if err != nil {
+		fmt.Println("failed to list the directory:", err.Error())
+		os.Exit(1)
+	}
+
+	// The listing must be current, so the list cache isn't used
+	httpClient := sharedHTTPClient()
+	remoteFiles := make(map[string]azure.DriveItem)
+	if err := listRemoteTree(client, httpClient, path.Join(client.RemoteRootFolder, checkFolder), "", remoteFiles); err != nil {
+		fmt.Println("failed to list the remote folder:", err.Error())
+		printErrorHint(err)
+		os.Exit(1)
+	}
+	// Skipped files aren't expected on the remote either, the age of remote
+	// files is the time they were last uploaded
+	for relPath, item := range remoteFiles {
+		if filter.excluded(relPath, false) || filter.outside(item.Size, item.LastModifiedDateTime) {
+			delete(remoteFiles, relPath)
+		}
+	}
+
+	entries := compareTrees(localFiles, remoteFiles)
+	counts := make(map[string]int)
+	reported := entries[:0]
+	for _, entry := range entries {
+		counts[entry.Status]++
+		if checkAll || entry.Status != checkMatch {
+			reported = append(reported, entry)
+		}
+	}
+	printCheckEntries(reported)
+
+	if checkOutput == outputTable {
+		fmt.Printf("\n%d matching, %d differing, %d missing on the remote, %d extra on the remote\n",
+			counts[checkMatch], counts[checkDiffer], counts[checkMissing], counts[checkExtra])
+	}
+	if len(entries) != counts[checkMatch] {
+		os.Exit(1)
+	}
+}
+
+// listRemoteTree adds the files below the remote folder dir to files, keyed
+// by their slash separated path below the top folder, prefixed by relDir.
+func listRemoteTree(client *azure.AzureClient, httpClient *http.Client, dir string, relDir string, files map[string]azure.DriveItem) error {
+	var folders []string
+	err := client.ListChildren(httpClient, dir, func(item azure.DriveItem) error {
+		switch {
+		case item.Folder != nil:
+			folders = append(folders, item.Name)
+		case item.File != nil:
+			files[path.Join(relDir, item.Name)] = item
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, folder := range folders {
+		if err := listRemoteTree(client, httpClient, path.Join(dir, folder), path.Join(relDir, folder), files); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compareTrees compares the local files below checkDir with the remote files
+// and returns the result for every file of either side, sorted by path. Local
+// files are only hashed if their size matches the remote file.
+func compareTrees(localFiles []string, remoteFiles map[string]azure.DriveItem) []checkEntry {
+	var entries []checkEntry
+	for _, relPath := range localFiles {
+		entry := checkEntry{Path: relPath}
+		info, err := os.Stat(filepath.Join(checkDir, filepath.FromSlash(relPath)))
+		if err != nil {
+			entry.Status = checkDiffer
+			entry.Error = err.Error()
+			entries = append(entries, entry)
+			continue
+		}
+		entry.LocalSize = info.Size()
+
+		item, ok := remoteFiles[relPath]
+		if !ok {
+			entry.Status = checkMissing
+			entries = append(entries, entry)
+			continue
+		}
+		delete(remoteFiles, relPath)
+		entry.RemoteSize = item.Size
+		entry.RemoteHash = item.File.Hashes.QuickXorHash
+
+		entry.Status = checkMatch
+		if entry.LocalSize != entry.RemoteSize {
+			entry.Status = checkDiffer
+		} else if !checkSizeOnly && entry.RemoteHash != "" {
+			hash, err := localQuickXorHash(filepath.Join(checkDir, filepath.FromSlash(relPath)))
+			entry.LocalHash = hash
+			if err != nil {
+				entry.Status = checkDiffer
+				entry.Error = err.Error()
+			} else if hash != entry.RemoteHash {
+				entry.Status = checkDiffer
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	for relPath, item := range remoteFiles {
+		entries = append(entries, checkEntry{
+			Path:       relPath,
+			Status:     checkExtra,
+			RemoteSize: item.Size,
+			RemoteHash: item.File.Hashes.QuickXorHash,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries
+}
+
+// printCheckEntries prints the compared files in the --output format.
+func printCheckEntries(entries []checkEntry) {
+	switch checkOutput {
+	case outputJSON:
+		if entries == nil {
+			entries = []checkEntry{}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(entries)
+
+	case outputCSV:
+		writer := csv.NewWriter(os.Stdout)
+		writer.Write([]string{"path", "status", "local_size", "remote_size", "local_hash", "remote_hash", "error"})
+		for _, e := range entries {
+			writer.Write([]string{e.Path, e.Status, strconv.FormatInt(e.LocalSize, 10), strconv.FormatInt(e.RemoteSize, 10),
+				e.LocalHash, e.RemoteHash, e.Error})
+		}
+		writer.Flush()
+
+	default:
+		for _, e := range entries {
+			color := ColorReset
+			switch e.Status {
+			case checkDiffer:
+				color = ColorRed
+			case checkMissing, checkExtra:
+				color = ColorYellow
+			}
+			detail := ""
+			switch {
+			case e.Error != "":
+				detail = " (" + e.Error + ")"
+			case e.Status == checkDiffer && e.LocalSize != e.RemoteSize:
+				detail = fmt.Sprintf(" (%s locally, %s on the remote)", azure.FormatBytes(e.LocalSize), azure.FormatBytes(e.RemoteSize))
+			case e.Status == checkDiffer:
+				detail = " (hashes differ)"
+			}
+			fmt.Printf("%s%-8s%s %s%s\n", color, e.Status, ColorReset, e.Path, detail)
+		}
+	}
+}
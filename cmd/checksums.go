@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/global-index-source/ksau-go/azure"
+	"github.com/global-index-source/ksau-go/crypto"
+)
+
+// Checksum manifest formats of backup --checksums.
+const (
+	ChecksumSHA256   = "sha256"
+	ChecksumQuickXor = "quickxor"
+)
+
+// checksumFileNames are the names the checksum manifests are uploaded as.
+var checksumFileNames = map[string]string{
+	ChecksumSHA256:   "SHA256SUMS",
+	ChecksumQuickXor: "QUICKXORSUMS",
+}
+
+func isValidChecksumFormat(format string) bool {
+	_, ok := checksumFileNames[format]
+	return ok
+}
+
+// hashLocalFile returns the QuickXorHash of a file and, if withSHA256 is set,
+// its hex encoded SHA-256, reading the file only once.
+func hashLocalFile(filePath string, withSHA256 bool) (quickXor string, sum string, err error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+
+	quickXorHasher := crypto.New()
+	sha256Hasher := sha256.New()
+	var writer io.Writer = quickXorHasher
+	if withSHA256 {
+		writer = io.MultiWriter(quickXorHasher, sha256Hasher)
+	}
+	if _, err := io.Copy(writer, file); err != nil {
+		return "", "", err
+	}
+	if withSHA256 {
+		sum = hex.EncodeToString(sha256Hasher.Sum(nil))
+	}
+	return base64.StdEncoding.EncodeToString(quickXorHasher.Sum(nil)), sum, nil
+}
+
+// buildChecksums returns a checksum manifest of the files in the backup
+// manifest in the format of sha256sum, one "<hash>  <path>" line per file by
+// its remote path, so `sha256sum -c` can check a downloaded copy. SHA-256 sums missing from the
+// manifest, of files backed up without --checksums, are computed from the
+// local files and stored.
+func buildChecksums(manifest *backupManifest, format string) ([]byte, error) {
+	paths := make([]string, 0, len(manifest.Files))
+	for relPath := range manifest.Files {
+		paths = append(paths, relPath)
+	}
+	sort.Strings(paths)
+
+	var buffer bytes.Buffer
+	for _, relPath := range paths {
+		file := manifest.Files[relPath]
+		sum := file.Hash
+		if format == ChecksumSHA256 {
+			if file.SHA256 == "" {
+				quickXor, sha, err := hashLocalFile(filepath.Join(backupDir, filepath.FromSlash(relPath)), true)
+				if err != nil {
+					return nil, fmt.Errorf("failed to hash %s: %w", relPath, err)
+				}
+				if quickXor != file.Hash {
+					return nil, fmt.Errorf("%s changed since it was backed up", relPath)
+				}
+				file.SHA256 = sha
+				manifest.Files[relPath] = file
+			}
+			sum = file.SHA256
+		}
+		fmt.Fprintf(&buffer, "%s  %s\n", sum, file.remotePath(relPath))
+	}
+	return buffer.Bytes(), nil
+}
+
+// publishChecksums uploads a checksum manifest of the backup in the given
+// format into the backup prefix and returns its name.
+func publishChecksums(client *azure.AzureClient, httpClient *http.Client, manifest *backupManifest, format string) (string, error) {
+	data, err := buildChecksums(manifest, format)
+	if err != nil {
+		return "", err
+	}
+
+	name := checksumFileNames[format]
+	_, err = client.Upload(httpClient, azure.UploadParams{
+		Reader:           bytes.NewReader(data),
+		Size:             int64(len(data)),
+		RemoteFilePath:   path.Join(client.RemoteRootFolder, backupPrefix, name),
+		ChunkSize:        getChunkSize(int64(len(data))),
+		MaxRetries:       backupRetries,
+		Backoff:          client.Backoff,
+		ConflictBehavior: azure.ConflictReplace,
+		StallTimeout:     azure.DefaultStallTimeout,
+	})
+	return name, err
+}
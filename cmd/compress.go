@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression formats of upload --compress.
+const (
+	CompressGzip = "gzip"
+	CompressZstd = "zstd"
+)
+
+func isValidCompression(format string) bool {
+	return format == CompressGzip || format == CompressZstd
+}
+
+// compressedName appends the extension of the compression format to name.
+func compressedName(name string, format string) string {
+	switch format {
+	case CompressGzip:
+		return name + ".gz"
+	case CompressZstd:
+		return name + ".zst"
+	default:
+		return name
+	}
+}
+
+// newCompressor returns a writer compressing into w. The output only depends
+// on the input, so compressing twice yields the same size: gzip headers carry
+// no time or name and zstd runs single threaded.
+func newCompressor(w io.Writer, format string) (io.WriteCloser, error) {
+	switch format {
+	case CompressGzip:
+		return gzip.NewWriter(w), nil
+	case CompressZstd:
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	default:
+		return nil, fmt.Errorf("unknown compression format: %s", format)
+	}
+}
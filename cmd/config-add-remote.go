@@ -0,0 +1,224 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/global-index-source/ksau-go/azure"
+	"github.com/spf13/cobra"
+)
+
+// defaultClientID is rclone's OneDrive application, which allows the device
+// code flow for personal and business accounts.
+const defaultClientID = "b15665d9-eda6-4092-8539-0eec376afd59"
+
+var (
+	addRemoteClientID     string
+	addRemoteClientSecret string
+	addRemoteTenant       string
+	addRemoteRegion       string
+	addRemoteRootFolder   string
+	addRemoteBaseURL      string
+	addRemoteSite         string
+	addRemoteLibrary      string
+)
+
+var configAddRemoteCmd = &cobra.Command{
+	Use:   "add-remote <name>",
+	Short: "Log in to a OneDrive account and add it as a remote",
+	Long: `Sign in with the Microsoft device code flow, pick one of the account's
+drives and append it to the local configuration as a new remote. With --site,
+the drive is a document library of that SharePoint site instead.`,
+	Args: cobra.ExactArgs(1),
+	Run:  runConfigAddRemote,
+}
+
+func init() {
+	configCmd.AddCommand(configAddRemoteCmd)
+	addRemoteFlags(configAddRemoteCmd)
+}
+
+// addRemoteFlags registers the flags of addRemote on cmd, they are shared by
+// config add-remote and login.
+func addRemoteFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&addRemoteClientID, "client-id", defaultClientID, "Application (client) ID to log in with")
+	cmd.Flags().StringVar(&addRemoteClientSecret, "client-secret", "", "Application secret, if the application isn't a public client")
+	cmd.Flags().StringVar(&addRemoteTenant, "tenant", "", "Tenant ID or domain, required for single-tenant applications")
+	cmd.Flags().StringVar(&addRemoteRegion, "region", "", "National cloud of the account: us, dod, de or cn (default: global)")
+	cmd.Flags().StringVar(&addRemoteRootFolder, "root-folder", "", "Folder uploads of this remote go into")
+	cmd.Flags().StringVar(&addRemoteBaseURL, "base-url", "", "Base URL download links of this remote are built from")
+	cmd.Flags().StringVar(&addRemoteSite, "site", "", "SharePoint site URL to pick a document library of, e.g. https://contoso.sharepoint.com/sites/Team")
+	cmd.Flags().StringVar(&addRemoteLibrary, "library", "", "Document library of --site to use, by name (default: ask, or the only one)")
+}
+
+func runConfigAddRemote(cmd *cobra.Command, args []string) {
+	addRemote(args[0])
+}
+
+// addRemote signs in with the device code flow and saves the chosen drive as
+// a new remote called name, using the add-remote flags.
+func addRemote(name string) {
+	// A missing config is fine, the new remote is the first one then
+	configData, err := getConfigData()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Println("failed to get configuration file data:", err.Error())
+		os.Exit(1)
+	}
+	parsedConfigData, err := azure.ParseRcloneConfigData(configData)
+	if err != nil {
+		fmt.Println("failed to parse configuration file data:", err.Error())
+		os.Exit(1)
+	}
+	if slices.Contains(azure.GetAvailableRemotes(&parsedConfigData), name) {
+		fmt.Printf("remote '%s' already exists\n", name)
+		os.Exit(1)
+	}
+
+	endpoints, err := azure.EndpointsFromConfig(map[string]string{"region": addRemoteRegion})
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	if addRemoteSite != "" {
+		if err := azure.ValidateSiteURL(addRemoteSite); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	} else if addRemoteLibrary != "" {
+		fmt.Println("--library needs --site")
+		os.Exit(1)
+	}
+
+	requireNetwork("")
+
+	httpClient := sharedHTTPClient()
+	code, err := azure.RequestDeviceCode(httpClient, endpoints, addRemoteTenant, addRemoteClientID, "")
+	if err != nil {
+		fmt.Println("failed to start login:", err.Error())
+		os.Exit(1)
+	}
+	fmt.Printf("%sTo sign in, open %s and enter the code %s%s\n", ColorYellow, code.VerificationURI, code.UserCode, ColorReset)
+	fmt.Println("waiting for the login to complete...")
+
+	token, err := azure.PollDeviceCodeToken(httpClient, endpoints, addRemoteTenant, addRemoteClientID, addRemoteClientSecret, code)
+	if err != nil {
+		fmt.Println("login failed:", err.Error())
+		os.Exit(1)
+	}
+
+	client := azure.NewAzureClientFromToken(endpoints, addRemoteTenant, addRemoteClientID, addRemoteClientSecret, token)
+	var drive *azure.Drive
+	if addRemoteSite != "" {
+		drive, err = chooseSiteDrive(client, httpClient)
+	} else {
+		var drives []azure.Drive
+		drives, err = client.ListDrives(httpClient)
+		if err != nil {
+			fmt.Println("failed to list drives:", err.Error())
+			os.Exit(1)
+		}
+		drive, err = chooseDrive(drives)
+	}
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	tokenJSON, err := json.Marshal(token)
+	if err != nil {
+		fmt.Println("failed to encode token:", err.Error())
+		os.Exit(1)
+	}
+
+	values := map[string]string{
+		"type":          "onedrive",
+		"client_id":     addRemoteClientID,
+		"client_secret": addRemoteClientSecret,
+		"token":         string(tokenJSON),
+		"drive_id":      drive.ID,
+		"drive_type":    drive.DriveType,
+		"root_folder":   addRemoteRootFolder,
+		"base_url":      addRemoteBaseURL,
+	}
+	if addRemoteTenant != "" {
+		values["tenant"] = addRemoteTenant
+	}
+	if addRemoteRegion != "" {
+		values["region"] = addRemoteRegion
+	}
+	if addRemoteSite != "" {
+		// The drive_id is used, the site is kept to know where it came from
+		values["sharepoint_site"] = addRemoteSite
+		values["sharepoint_library"] = drive.Owner
+	}
+	section := azure.FormatRcloneConfigSection(name, values)
+
+	newConfig := strings.TrimRight(string(configData), "\n")
+	if newConfig != "" {
+		newConfig += "\n\n"
+	}
+	newConfig += section
+
+	if err := saveConfigData([]byte(newConfig)); err != nil {
+		fmt.Println("failed to save configuration:", err.Error())
+		os.Exit(1)
+	}
+	fmt.Printf("%sAdded remote '%s' (%s drive of %s)%s\n", ColorGreen, name, drive.DriveType, drive.Owner, ColorReset)
+}
+
+// chooseSiteDrive returns the --library of the --site, or asks the user to
+// pick one of its libraries.
+func chooseSiteDrive(client *azure.AzureClient, httpClient *http.Client) (*azure.Drive, error) {
+	siteDrives, err := client.ListSiteDrives(httpClient, addRemoteSite)
+	if err != nil {
+		return nil, err
+	}
+	if addRemoteLibrary != "" {
+		siteDrive, err := azure.FindSiteDrive(siteDrives, addRemoteLibrary)
+		if err != nil {
+			return nil, err
+		}
+		return &siteDrive.Drive, nil
+	}
+
+	drives := make([]azure.Drive, len(siteDrives))
+	for i, siteDrive := range siteDrives {
+		drives[i] = siteDrive.Drive
+	}
+	return chooseDrive(drives)
+}
+
+// chooseDrive asks the user to pick one of the drives, or returns the only one.
+func chooseDrive(drives []azure.Drive) (*azure.Drive, error) {
+	switch len(drives) {
+	case 0:
+		return nil, fmt.Errorf("the account has no drives")
+	case 1:
+		return &drives[0], nil
+	}
+
+	fmt.Println("The account has access to these drives:")
+	for i, drive := range drives {
+		fmt.Printf("  %d) %s (%s, %s)\n", i+1, drive.Owner, drive.DriveType, drive.ID)
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Printf("Select a drive [1-%d]: ", len(drives))
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("no drive selected")
+		}
+		choice, err := strconv.Atoi(strings.TrimSpace(line))
+		if err == nil && choice >= 1 && choice <= len(drives) {
+			return &drives[choice-1], nil
+		}
+	}
+}
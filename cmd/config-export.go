@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/global-index-source/ksau-go/azure"
+	"github.com/spf13/cobra"
+)
+
+var (
+	exportOutput string
+	exportYes    bool
+)
+
+var configExportCmd = &cobra.Command{
+	Use:   "export [remote...]",
+	Short: "Export remotes as a plaintext rclone config",
+	Long: `Decrypt the local configuration and print the given remotes (all of them if
+none are given) as a standard rclone config, e.g. to migrate to or debug with
+rclone. The output contains tokens and client secrets, keep it private.`,
+	Run: runConfigExport,
+}
+
+func init() {
+	configCmd.AddCommand(configExportCmd)
+
+	configExportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "Write to this file instead of stdout")
+	configExportCmd.Flags().BoolVar(&exportYes, "yes", false, "Don't ask for confirmation")
+}
+
+func runConfigExport(cmd *cobra.Command, args []string) {
+	configData, err := getConfigData()
+	if err != nil {
+		fmt.Println("failed to get configuration file data:", err.Error())
+		os.Exit(1)
+	}
+	parsedConfigData, err := azure.ParseRcloneConfigData(configData)
+	if err != nil {
+		fmt.Println("failed to parse configuration file data:", err.Error())
+		os.Exit(1)
+	}
+
+	remotes := azure.GetAvailableRemotes(&parsedConfigData)
+	if len(args) > 0 {
+		remotes, err = selectRemotes(remotes, args)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	}
+
+	if !exportYes && !confirmExport() {
+		fmt.Fprintln(os.Stderr, "aborted")
+		os.Exit(1)
+	}
+
+	var builder strings.Builder
+	for _, section := range parsedConfigData {
+		name := section["remote_name"]
+		if !slices.Contains(remotes, name) {
+			continue
+		}
+		// rclone knows nothing about token stores
+		section, err := inlineStoredToken(name, section)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		builder.WriteString(azure.FormatRcloneConfigSection(name, section))
+	}
+
+	if exportOutput == "" {
+		fmt.Print(builder.String())
+		return
+	}
+	if err := os.WriteFile(exportOutput, []byte(builder.String()), 0600); err != nil {
+		fmt.Println("failed to write export:", err.Error())
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "exported %d remote(s) to %s\n", len(remotes), exportOutput)
+}
+
+// confirmExport warns that the export contains secrets and asks the user to
+// type "yes". The prompt goes to stderr so stdout stays a clean config.
+func confirmExport() bool {
+	fmt.Fprintf(os.Stderr, "%sThe export contains access tokens and client secrets in plain text.\n", ColorRed)
+	fmt.Fprintf(os.Stderr, "Anyone who gets hold of it can read and delete everything on these drives.%s\n", ColorReset)
+	fmt.Fprint(os.Stderr, "Type 'yes' to continue: ")
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	return err == nil && strings.TrimSpace(line) == "yes"
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/global-index-source/ksau-go/azure"
+	"github.com/spf13/cobra"
+)
+
+// rcloneEncryptedHeader starts rclone configs encrypted with a password.
+const rcloneEncryptedHeader = "RCLONE_ENCRYPT_"
+
+var (
+	importRemote       string
+	importName         string
+	importClientSecret string
+	importRootFolder   string
+	importBaseURL      string
+)
+
+var configImportCmd = &cobra.Command{
+	Use:   "import <rclone.conf>",
+	Short: "Import a OneDrive remote from an existing rclone config",
+	Long: `Copy a onedrive remote, including its token, drive ID and drive type, from
+a plaintext rclone config (e.g. ~/.config/rclone/rclone.conf) into the local
+encrypted configuration.`,
+	Args: cobra.ExactArgs(1),
+	Run:  runConfigImport,
+}
+
+func init() {
+	configCmd.AddCommand(configImportCmd)
+
+	configImportCmd.Flags().StringVar(&importRemote, "remote", "", "Name of the remote in the rclone config (required)")
+	configImportCmd.Flags().StringVar(&importName, "as", "", "Name of the imported remote (default: same as --remote)")
+	configImportCmd.Flags().StringVar(&importClientSecret, "client-secret", "", "Application secret, for remotes without client_secret")
+	configImportCmd.Flags().StringVar(&importRootFolder, "root-folder", "", "Folder uploads of this remote go into")
+	configImportCmd.Flags().StringVar(&importBaseURL, "base-url", "", "Base URL download links of this remote are built from")
+	configImportCmd.MarkFlagRequired("remote")
+}
+
+func runConfigImport(cmd *cobra.Command, args []string) {
+	name := importName
+	if name == "" {
+		name = importRemote
+	}
+
+	rcloneData, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Println("failed to read rclone config:", err.Error())
+		os.Exit(1)
+	}
+	if strings.HasPrefix(strings.TrimSpace(string(rcloneData)), rcloneEncryptedHeader) {
+		fmt.Println("the rclone config is encrypted, decrypt it first with 'rclone config show > plain.conf'")
+		os.Exit(1)
+	}
+
+	section, err := importedSection(rcloneData, importRemote)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	configData, err := getConfigData()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Println("failed to get configuration file data:", err.Error())
+		os.Exit(1)
+	}
+	parsedConfigData, err := azure.ParseRcloneConfigData(configData)
+	if err != nil {
+		fmt.Println("failed to parse configuration file data:", err.Error())
+		os.Exit(1)
+	}
+	if slices.Contains(azure.GetAvailableRemotes(&parsedConfigData), name) {
+		fmt.Printf("remote '%s' already exists, pick another name with --as\n", name)
+		os.Exit(1)
+	}
+
+	newConfig := strings.TrimRight(string(configData), "\n")
+	if newConfig != "" {
+		newConfig += "\n\n"
+	}
+	newConfig += azure.FormatRcloneConfigSection(name, section)
+
+	if err := saveConfigData([]byte(newConfig)); err != nil {
+		fmt.Println("failed to save configuration:", err.Error())
+		os.Exit(1)
+	}
+	fmt.Printf("%sImported remote '%s' as '%s'%s\n", ColorGreen, importRemote, name, ColorReset)
+}
+
+// importedSection returns the settings ksau-go needs from a remote of an
+// rclone config.
+func importedSection(rcloneData []byte, remote string) (map[string]string, error) {
+	parsed, err := azure.ParseRcloneConfigData(rcloneData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse rclone config: %w", err)
+	}
+
+	index := slices.IndexFunc(parsed, func(section map[string]string) bool {
+		return section["remote_name"] == remote
+	})
+	if index < 0 {
+		return nil, fmt.Errorf("remote '%s' not found in the rclone config", remote)
+	}
+	source := parsed[index]
+
+	if source["type"] != "onedrive" {
+		return nil, fmt.Errorf("remote '%s' is of type %q, only onedrive remotes can be imported", remote, source["type"])
+	}
+	if source["token"] == "" || source["drive_id"] == "" {
+		return nil, fmt.Errorf("remote '%s' has no token or drive_id, finish 'rclone config' for it first", remote)
+	}
+
+	section := map[string]string{
+		"type":          "onedrive",
+		"client_id":     source["client_id"],
+		"client_secret": source["client_secret"],
+		"token":         source["token"],
+		"drive_id":      source["drive_id"],
+		"drive_type":    source["drive_type"],
+		"root_folder":   importRootFolder,
+		"base_url":      importBaseURL,
+	}
+	if importClientSecret != "" {
+		section["client_secret"] = importClientSecret
+	}
+
+	// rclone leaves both empty when its built-in application is used
+	if section["client_id"] == "" {
+		section["client_id"] = defaultClientID
+		if section["client_secret"] == "" {
+			fmt.Printf("%sWarning: the remote uses rclone's built-in application, pass its secret with --client-secret or token refresh will fail%s\n", ColorYellow, ColorReset)
+		}
+	}
+	return section, nil
+}
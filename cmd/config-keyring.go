@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/global-index-source/ksau-go/azure"
+	"github.com/spf13/cobra"
+)
+
+var keyringDisable bool
+
+var configKeyringCmd = &cobra.Command{
+	Use:   "keyring <remote>",
+	Short: "Keep a remote's tokens in the OS keyring",
+	Long: `Move the OAuth tokens of a remote from the encrypted config into the OS
+keyring (Keychain, Secret Service or Windows Credential Manager). The
+remote gets "token_store = keyring" and refreshed tokens are saved back
+to the keyring. --disable moves the tokens back into the config.`,
+	Args: cobra.ExactArgs(1),
+	Run:  runConfigKeyring,
+}
+
+func init() {
+	configCmd.AddCommand(configKeyringCmd)
+
+	configKeyringCmd.Flags().BoolVar(&keyringDisable, "disable", false, "Move the tokens from the keyring back into the config")
+}
+
+func runConfigKeyring(cmd *cobra.Command, args []string) {
+	name := args[0]
+
+	configData, err := getConfigData()
+	if err != nil {
+		fmt.Println("failed to get configuration file data:", err.Error())
+		os.Exit(1)
+	}
+
+	section, err := remoteSection(configData, name)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	store := azure.KeyringTokenStore{}
+	if keyringDisable {
+		if section["token_store"] != azure.TokenStoreKeyring {
+			fmt.Printf("remote '%s' doesn't keep its tokens in the keyring\n", name)
+			os.Exit(1)
+		}
+		section, err = inlineStoredToken(name, section)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	} else {
+		if section["token_store"] == azure.TokenStoreKeyring {
+			fmt.Printf("remote '%s' already keeps its tokens in the keyring\n", name)
+			return
+		}
+		var token azure.Token
+		if err := json.Unmarshal([]byte(section["token"]), &token); err != nil {
+			fmt.Println("failed to parse the token of the remote:", err.Error())
+			os.Exit(1)
+		}
+		if err := store.Save(name, &token); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		delete(section, "token")
+		section["token_store"] = azure.TokenStoreKeyring
+	}
+
+	newConfig, err := azure.ReplaceRcloneConfigSection(configData, name, section)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	if err := saveConfigData(newConfig); err != nil {
+		fmt.Println("failed to save configuration:", err.Error())
+		os.Exit(1)
+	}
+
+	// Only drop the keyring entry once the config has the tokens again
+	if keyringDisable {
+		store.Delete(name)
+		fmt.Printf("%sMoved the tokens of '%s' back into the config%s\n", ColorGreen, name, ColorReset)
+		return
+	}
+	fmt.Printf("%sMoved the tokens of '%s' into the keyring%s\n", ColorGreen, name, ColorReset)
+}
+
+// remoteSection returns a copy of the settings of a remote.
+func remoteSection(configData []byte, name string) (map[string]string, error) {
+	parsed, err := azure.ParseRcloneConfigData(configData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse configuration file data: %w", err)
+	}
+
+	index := slices.IndexFunc(parsed, func(section map[string]string) bool {
+		return section["remote_name"] == name
+	})
+	if index < 0 {
+		return nil, fmt.Errorf("remote '%s' not found in config", name)
+	}
+	return maps.Clone(parsed[index]), nil
+}
+
+// inlineStoredToken returns the settings of a remote with the tokens from its
+// token store put back into the token key, as rclone expects them.
+func inlineStoredToken(name string, section map[string]string) (map[string]string, error) {
+	store, err := azure.NewTokenStore(section["token_store"])
+	if err != nil || store == nil {
+		return section, err
+	}
+
+	token, err := store.Load(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the token of '%s': %w", name, err)
+	}
+	value, err := json.Marshal(token)
+	if err != nil {
+		return nil, err
+	}
+
+	section = maps.Clone(section)
+	section["token"] = string(value)
+	delete(section, "token_store")
+	return section, nil
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/global-index-source/ksau-go/crypto"
+	"github.com/spf13/cobra"
+)
+
+var (
+	passphraseRemove  bool
+	passphraseBackend string
+)
+
+var configPassphraseCmd = &cobra.Command{
+	Use:   "passphrase",
+	Short: "Protect the local configuration with your own passphrase",
+	Long: `Encrypt the local configuration with a passphrase you choose instead of
+the key shipped with ksau-go, so self-hosted setups don't depend on it.
+The passphrase is asked for on the terminal, or read from ` + configPassphraseEnv + `.
+Run it again to change the passphrase, --remove goes back to the shipped key.
+
+--backend picks the format: pgp (Argon2 protected OpenPGP) or age (scrypt).
+Existing configs are recognized by their header either way.`,
+	Args: cobra.NoArgs,
+	Run:  runConfigPassphrase,
+}
+
+func init() {
+	configCmd.AddCommand(configPassphraseCmd)
+
+	configPassphraseCmd.Flags().BoolVar(&passphraseRemove, "remove", false, "Encrypt the configuration with the shipped key again")
+	configPassphraseCmd.Flags().StringVar(&passphraseBackend, "backend", "", "Encryption format: "+strings.Join(crypto.BackendNames(), " or ")+" (default: the current one)")
+}
+
+func runConfigPassphrase(cmd *cobra.Command, args []string) {
+	configData, err := getConfigData()
+	if err != nil {
+		fmt.Println("failed to get configuration file data:", err.Error())
+		os.Exit(1)
+	}
+
+	backend, passphrase := loadedConfigKey()
+	if passphraseRemove {
+		if passphrase == nil {
+			fmt.Println("the configuration isn't protected by a passphrase")
+			return
+		}
+		// Only the default backend has a shipped key
+		setConfigKey(nil, nil)
+	} else {
+		if passphraseBackend != "" {
+			backend, err = crypto.BackendByName(passphraseBackend)
+			if err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+		}
+
+		// Scripts pass the new passphrase in the environment instead
+		passphrase, err = readNewPassphrase()
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		setConfigKey(backend, passphrase)
+	}
+
+	if err := saveConfigData(configData); err != nil {
+		fmt.Println("failed to save configuration:", err.Error())
+		os.Exit(1)
+	}
+
+	if passphraseRemove {
+		fmt.Printf("%sThe configuration is encrypted with the shipped key again%s\n", ColorGreen, ColorReset)
+		return
+	}
+	fmt.Printf("%sThe configuration is now protected by your passphrase%s\n", ColorGreen, ColorReset)
+	fmt.Println("keep it safe, the configuration can't be recovered without it")
+}
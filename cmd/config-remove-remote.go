@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/global-index-source/ksau-go/azure"
+	"github.com/spf13/cobra"
+)
+
+var configRemoveRemoteCmd = &cobra.Command{
+	Use:   "remove-remote <name>",
+	Short: "Remove a remote from the local configuration",
+	Args:  cobra.ExactArgs(1),
+	Run:   runConfigRemoveRemote,
+}
+
+func init() {
+	configCmd.AddCommand(configRemoveRemoteCmd)
+}
+
+func runConfigRemoveRemote(cmd *cobra.Command, args []string) {
+	configData, err := getConfigData()
+	if err != nil {
+		fmt.Println("failed to get configuration file data:", err.Error())
+		os.Exit(1)
+	}
+
+	section, err := remoteSection(configData, args[0])
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	newConfig, err := azure.RemoveRcloneConfigSection(configData, args[0])
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	if err := saveConfigData(newConfig); err != nil {
+		fmt.Println("failed to save configuration:", err.Error())
+		os.Exit(1)
+	}
+	if store, err := azure.NewTokenStore(section["token_store"]); err == nil && store != nil {
+		if err := store.Delete(args[0]); err != nil {
+			fmt.Printf("%sWarning: failed to delete the stored tokens: %v%s\n", ColorYellow, err, ColorReset)
+		}
+	}
+	fmt.Printf("%sRemoved remote '%s'%s\n", ColorGreen, args[0], ColorReset)
+}
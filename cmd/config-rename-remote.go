@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/global-index-source/ksau-go/azure"
+	"github.com/spf13/cobra"
+)
+
+var configRenameRemoteCmd = &cobra.Command{
+	Use:   "rename-remote <name> <new-name>",
+	Short: "Rename a remote in the local configuration",
+	Args:  cobra.ExactArgs(2),
+	Run:   runConfigRenameRemote,
+}
+
+func init() {
+	configCmd.AddCommand(configRenameRemoteCmd)
+}
+
+func runConfigRenameRemote(cmd *cobra.Command, args []string) {
+	oldName, newName := args[0], args[1]
+
+	configData, err := getConfigData()
+	if err != nil {
+		fmt.Println("failed to get configuration file data:", err.Error())
+		os.Exit(1)
+	}
+
+	newConfig, err := azure.RenameRcloneConfigSection(configData, oldName, newName)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	// Stored tokens are filed under the remote name, copy them first so a
+	// failure leaves the remote untouched
+	section, err := remoteSection(configData, oldName)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	store, err := azure.NewTokenStore(section["token_store"])
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	if store != nil {
+		token, err := store.Load(oldName)
+		if err == nil {
+			err = store.Save(newName, token)
+		}
+		if err != nil {
+			fmt.Println("failed to move the stored tokens:", err.Error())
+			os.Exit(1)
+		}
+	}
+
+	if err := saveConfigData(newConfig); err != nil {
+		fmt.Println("failed to save configuration:", err.Error())
+		os.Exit(1)
+	}
+
+	if store != nil {
+		store.Delete(oldName)
+	}
+
+	// Cached state is keyed by remote name and would point at the wrong remote
+	invalidateSelectionCache()
+	fmt.Printf("%sRenamed remote '%s' to '%s'%s\n", ColorGreen, oldName, newName, ColorReset)
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/global-index-source/ksau-go/crypto"
+	"github.com/spf13/cobra"
+)
+
+var (
+	rotateKeyID      string
+	rotatePassphrase bool
+	rotateBackend    string
+)
+
+var configRotateKeyCmd = &cobra.Command{
+	Use:   "rotate-key",
+	Short: "Re-encrypt the local configuration with a new key or passphrase",
+	Long: `Decrypt the local configuration with its current key or passphrase and
+re-encrypt it with a new one, so a leaked key or passphrase can be retired.
+The new file is verified and then swapped in atomically, the previous one is
+kept as rclone.conf.bak.
+
+A passphrase protected configuration gets a new passphrase, asked for on
+the terminal or read from ` + newConfigPassphraseEnv + `. Otherwise it is
+re-encrypted with the current shipped key, or the one given with --key.`,
+	Args: cobra.NoArgs,
+	Run:  runConfigRotateKey,
+}
+
+func init() {
+	configCmd.AddCommand(configRotateKeyCmd)
+
+	configRotateKeyCmd.Flags().StringVar(&rotateKeyID, "key", "", "Shipped key to encrypt with (default: the current one)")
+	configRotateKeyCmd.Flags().BoolVar(&rotatePassphrase, "passphrase", false, "Switch to a new passphrase, even if the configuration uses a shipped key")
+	configRotateKeyCmd.Flags().StringVar(&rotateBackend, "backend", "", "Encryption format for the new passphrase: "+strings.Join(crypto.BackendNames(), " or ")+" (default: the current one)")
+}
+
+func runConfigRotateKey(cmd *cobra.Command, args []string) {
+	if rotateKeyID != "" && (rotatePassphrase || rotateBackend != "") {
+		fmt.Println("--key can't be combined with --passphrase or --backend")
+		os.Exit(1)
+	}
+	if rotateKeyID != "" && !slices.Contains(crypto.KeyIDs(), rotateKeyID) {
+		fmt.Printf("unknown key %q, available: %s\n", rotateKeyID, strings.Join(crypto.KeyIDs(), ", "))
+		os.Exit(1)
+	}
+
+	configData, err := getConfigData()
+	if err != nil {
+		fmt.Println("failed to get configuration file data:", err.Error())
+		os.Exit(1)
+	}
+	oldBackend, oldPassphrase := loadedConfigKey()
+
+	keyID := rotateKeyID
+	if keyID == "" {
+		keyID = crypto.CurrentKey
+	}
+	backend := crypto.DetectBackend(nil)
+	var passphrase []byte
+	var encrypted []byte
+	if rotateKeyID == "" && (oldPassphrase != nil || rotatePassphrase || rotateBackend != "") {
+		if oldPassphrase != nil {
+			backend = oldBackend
+		}
+		if rotateBackend != "" {
+			if backend, err = crypto.BackendByName(rotateBackend); err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+		}
+
+		passphrase, err = readNewPassphrase()
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		if bytes.Equal(passphrase, oldPassphrase) && backend.Name() == oldBackend.Name() {
+			fmt.Printf("the new passphrase is the same as the old one, set %s to change it from a script\n", newConfigPassphraseEnv)
+			os.Exit(1)
+		}
+		encrypted, err = backend.Encrypt(configData, passphrase)
+	} else {
+		encrypted, err = crypto.EncryptWithKey(string(configData), keyID)
+	}
+	if err != nil {
+		fmt.Println("failed to encrypt configuration:", err.Error())
+		os.Exit(1)
+	}
+
+	// Never replace the config with something that doesn't decrypt back
+	decrypted, _, err := crypto.DetectBackend(encrypted).Decrypt(encrypted, passphrase)
+	if err != nil || !bytes.Equal(decrypted, configData) {
+		fmt.Println("the re-encrypted configuration doesn't decrypt back, leaving it untouched")
+		os.Exit(1)
+	}
+
+	if err := writeConfigFile(encrypted); err != nil {
+		fmt.Println("failed to save configuration:", err.Error())
+		os.Exit(1)
+	}
+
+	if passphrase != nil {
+		fmt.Printf("%sThe configuration is now encrypted (%s) with the new passphrase%s\n", ColorGreen, backend.Name(), ColorReset)
+		return
+	}
+	fmt.Printf("%sThe configuration is now encrypted with the shipped key %q%s\n", ColorGreen, keyID, ColorReset)
+}
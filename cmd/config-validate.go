@@ -0,0 +1,295 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/global-index-source/ksau-go/azure"
+	"github.com/spf13/cobra"
+)
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the local configuration for mistakes",
+	Long: `Parse the local configuration and check every remote for the fields
+ksau-go needs, reporting exactly which section and field is malformed.
+Remotes that name a SharePoint site instead of a drive_id get the drive_id of
+the site's library written into the configuration, unless --offline is set.`,
+	Args: cobra.NoArgs,
+	Run:  runConfigValidate,
+}
+
+func init() {
+	configCmd.AddCommand(configValidateCmd)
+}
+
+// configIssue is a problem found in one field of a remote's section.
+type configIssue struct {
+	field   string
+	message string
+	warning bool
+}
+
+func runConfigValidate(cmd *cobra.Command, args []string) {
+	configData, err := getConfigData()
+	if err != nil {
+		fmt.Println("failed to get configuration file data:", err.Error())
+		os.Exit(1)
+	}
+
+	parsedConfigData, err := azure.ParseRcloneConfigData(configData)
+	if err != nil {
+		fmt.Println("failed to parse configuration file data:", err.Error())
+		os.Exit(1)
+	}
+
+	errorCount, warningCount := 0, 0
+	seen := make(map[string]bool)
+	var siteRemotes []string
+	for _, section := range parsedConfigData {
+		name, ok := section["remote_name"]
+		if !ok {
+			// Keys before the first section header
+			if len(section) > 0 {
+				fmt.Printf("%s(no section)%s\n  %sERROR%s  settings outside of any [remote] section\n", ColorRed, ColorReset, ColorRed, ColorReset)
+				errorCount++
+			}
+			continue
+		}
+
+		issues := validateRemote(section)
+		if seen[name] {
+			issues = append(issues, configIssue{field: "[" + name + "]", message: "duplicate section, only the last one is used"})
+		}
+		seen[name] = true
+		if section["sharepoint_site"] != "" && section["drive_id"] == "" && !slices.ContainsFunc(issues, func(issue configIssue) bool { return !issue.warning }) {
+			siteRemotes = append(siteRemotes, name)
+		}
+
+		if len(issues) == 0 {
+			fmt.Printf("%s[%s] ok%s\n", ColorGreen, name, ColorReset)
+			continue
+		}
+
+		fmt.Printf("[%s]\n", name)
+		for _, issue := range issues {
+			if issue.warning {
+				warningCount++
+				fmt.Printf("  %sWARN%s   %s: %s\n", ColorYellow, ColorReset, issue.field, issue.message)
+			} else {
+				errorCount++
+				fmt.Printf("  %sERROR%s  %s: %s\n", ColorRed, ColorReset, issue.field, issue.message)
+			}
+		}
+	}
+
+	if issues := validateNotifyConfig(); len(issues) > 0 {
+		fmt.Printf("[%s]\n", notifyConfigFile)
+		for _, issue := range issues {
+			warningCount++
+			fmt.Printf("  %sWARN%s   %s: %s\n", ColorYellow, ColorReset, issue.field, issue.message)
+		}
+	}
+
+	if len(siteRemotes) > 0 && !offline {
+		warningCount += saveSiteDrives(configData, siteRemotes)
+	}
+
+	fmt.Printf("\n%d error(s), %d warning(s)\n", errorCount, warningCount)
+	if errorCount > 0 {
+		os.Exit(1)
+	}
+}
+
+// validDriveTypes are the drive types Graph reports.
+var validDriveTypes = []string{"personal", "business", "documentLibrary"}
+
+// validateRemote checks a single remote's section.
+func validateRemote(section map[string]string) []configIssue {
+	var issues []configIssue
+	missing := func(field string) {
+		issues = append(issues, configIssue{field: field, message: "missing or empty"})
+	}
+
+	if value := section["type"]; value != "onedrive" {
+		issues = append(issues, configIssue{field: "type", message: fmt.Sprintf("is %q, only onedrive remotes are supported", value)})
+	}
+	if section["client_id"] == "" {
+		missing("client_id")
+	}
+	if section["client_secret"] == "" {
+		issues = append(issues, configIssue{field: "client_secret", message: "empty, only works for public client applications", warning: true})
+	}
+	// Remotes with a sharepoint_site find their drive when they are used
+	if site := section["sharepoint_site"]; site != "" {
+		if err := azure.ValidateSiteURL(site); err != nil {
+			issues = append(issues, configIssue{field: "sharepoint_site", message: err.Error()})
+		}
+	} else if section["drive_id"] == "" {
+		missing("drive_id")
+	}
+	if section["sharepoint_library"] != "" && section["sharepoint_site"] == "" {
+		issues = append(issues, configIssue{field: "sharepoint_library", message: "ignored without sharepoint_site", warning: true})
+	}
+	if value := section["drive_type"]; value == "" {
+		if section["sharepoint_site"] == "" {
+			missing("drive_type")
+		}
+	} else if !slices.Contains(validDriveTypes, value) {
+		issues = append(issues, configIssue{field: "drive_type", message: fmt.Sprintf("unknown drive type %q", value), warning: true})
+	}
+	if value := section["conflict_behavior"]; value != "" && !azure.IsValidConflictBehavior(value) {
+		issues = append(issues, configIssue{field: "conflict_behavior", message: fmt.Sprintf("is %q, must be %s, %s or %s", value, azure.ConflictReplace, azure.ConflictRename, azure.ConflictFail)})
+	}
+
+	if _, err := azure.EndpointsFromConfig(section); err != nil {
+		issues = append(issues, configIssue{field: "endpoints", message: err.Error()})
+	}
+	if value := section["token_refresh_margin"]; value != "" {
+		if _, err := azure.ParseRefreshMargin(value); err != nil {
+			issues = append(issues, configIssue{field: "token_refresh_margin", message: fmt.Sprintf("is %q, must be a number of minutes", value)})
+		}
+	}
+	if value := section["max_transfers"]; value != "" {
+		if n, err := strconv.Atoi(value); err != nil || n < 1 {
+			issues = append(issues, configIssue{field: "max_transfers", message: fmt.Sprintf("is %q, must be a positive number", value)})
+		}
+	}
+	if section["sinks"] != "" {
+		issues = append(issues, configIssue{field: "sinks", message: "ignored, plugins only run from --sink or " + notifyConfigFile, warning: true})
+	}
+	for _, key := range []string{"webhook", "telegram_bot_token", "telegram_chat_id", "selection_strategy"} {
+		if section[key] != "" {
+			issues = append(issues, configIssue{field: key, message: "ignored, set it in " + notifyConfigFile + " instead of the shared config", warning: true})
+		}
+	}
+
+	switch value := section["token_store"]; value {
+	case "":
+		if section["token"] == "" && section["client_secret"] != "" && section["tenant"] != "" {
+			// App-only remote, tokens come from the client credentials grant
+			return issues
+		}
+		return append(issues, validateToken(section["token"])...)
+	case azure.TokenStoreKeyring:
+		if section["token"] != "" {
+			issues = append(issues, configIssue{field: "token", message: "ignored, the tokens are read from the keyring", warning: true})
+		}
+	default:
+		issues = append(issues, configIssue{field: "token_store", message: fmt.Sprintf("is %q, must be %s or empty", value, azure.TokenStoreKeyring)})
+	}
+	return issues
+}
+
+// saveSiteDrives looks up the library of the remotes that only have a
+// sharepoint_site and writes its drive_id and drive_type into the config, so
+// they don't have to look it up every time they are used. It returns the
+// number of remotes that couldn't be resolved, which keep working as before.
+func saveSiteDrives(configData []byte, names []string) int {
+	failed := 0
+	newConfig := configData
+	for _, name := range names {
+		client, err := azure.NewAzureClientFromRcloneConfigData(configData, name)
+		if err == nil {
+			err = client.EnsureTokenValid(sharedHTTPClient())
+		}
+		var section map[string]string
+		if err == nil {
+			section, err = remoteSection(newConfig, name)
+		}
+		if err == nil {
+			section["drive_id"] = client.DriveID
+			section["drive_type"] = client.DriveType
+			newConfig, err = azure.ReplaceRcloneConfigSection(newConfig, name, section)
+		}
+		if err != nil {
+			failed++
+			fmt.Printf("[%s]\n  %sWARN%s   drive_id: couldn't look up the library of sharepoint_site: %s\n", name, ColorYellow, ColorReset, err.Error())
+			continue
+		}
+		fmt.Printf("%s[%s] drive_id: saved %s from sharepoint_site%s\n", ColorGreen, name, client.DriveID, ColorReset)
+	}
+
+	if len(names) > failed {
+		if err := saveConfigData(newConfig); err != nil {
+			fmt.Println("failed to save configuration:", err.Error())
+			os.Exit(1)
+		}
+	}
+	return failed
+}
+
+// validateNotifyConfig checks the sections of notify.conf, if there is one.
+func validateNotifyConfig() []configIssue {
+	notifyPath, err := getStatePath(notifyConfigFile)
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(notifyPath)
+	if err != nil {
+		return nil
+	}
+	sections, err := azure.ParseRcloneConfigData(data)
+	if err != nil {
+		return []configIssue{{field: notifyConfigFile, message: err.Error(), warning: true}}
+	}
+
+	var issues []configIssue
+	for _, section := range sections {
+		prefix := ""
+		if name, ok := section["remote_name"]; ok {
+			prefix = "[" + name + "] "
+		}
+		if (section["telegram_bot_token"] == "") != (section["telegram_chat_id"] == "") {
+			issues = append(issues, configIssue{field: prefix + "telegram", message: "telegram_bot_token and telegram_chat_id must be set together, no messages are sent", warning: true})
+		}
+		if value := section["selection_strategy"]; value != "" {
+			if prefix != "" {
+				issues = append(issues, configIssue{field: prefix + "selection_strategy", message: "ignored, only the key at the top of the file is used", warning: true})
+			} else if _, ok := remoteSelectors[value]; !ok {
+				issues = append(issues, configIssue{field: "selection_strategy", message: fmt.Sprintf("is %q, must be one of %s", value, strings.Join(validSelectionStrategies(), ", ")), warning: true})
+			}
+		}
+		if value := section["local_path"]; value != "" {
+			if _, err := strconv.ParseBool(value); err != nil {
+				issues = append(issues, configIssue{field: prefix + "local_path", message: fmt.Sprintf("is %q, must be true or false", value), warning: true})
+			}
+		}
+	}
+	return issues
+}
+
+// validateToken checks the token JSON of a remote.
+func validateToken(value string) []configIssue {
+	if value == "" {
+		return []configIssue{{field: "token", message: "missing or empty"}}
+	}
+
+	var token struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		Expiry       string `json:"expiry"`
+	}
+	if err := json.Unmarshal([]byte(value), &token); err != nil {
+		return []configIssue{{field: "token", message: "not valid JSON: " + err.Error()}}
+	}
+
+	var issues []configIssue
+	if token.AccessToken == "" {
+		issues = append(issues, configIssue{field: "token.access_token", message: "missing or empty"})
+	}
+	if token.RefreshToken == "" {
+		issues = append(issues, configIssue{field: "token.refresh_token", message: "missing or empty, the token can't be renewed"})
+	}
+	if token.Expiry == "" {
+		issues = append(issues, configIssue{field: "token.expiry", message: "missing or empty"})
+	} else if _, err := time.Parse(time.RFC3339, token.Expiry); err != nil {
+		issues = append(issues, configIssue{field: "token.expiry", message: fmt.Sprintf("%q is not an RFC 3339 time", token.Expiry)})
+	}
+	return issues
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage the remotes in the local configuration",
+	Long: `Add and edit remotes in the local, encrypted rclone configuration.
+
+Note that 'ksau-go refresh' replaces the local configuration with the
+shipped community one, dropping any changes made with these commands.`,
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+}
+
+// configBackupSuffix is appended to the config path for the backup of the
+// previous config.
+const configBackupSuffix = ".bak"
+
+// saveConfigData encrypts the plain rclone config and replaces the local
+// config file with it, after backing up the previous one.
+func saveConfigData(configData []byte) error {
+	encrypted, err := encryptConfig(configData)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt config: %w", err)
+	}
+	return writeConfigFile(encrypted)
+}
+
+// writeConfigFile replaces the local config file with already encrypted
+// data, after backing up the previous one. The file is replaced atomically,
+// so an interrupted write never leaves a truncated config behind.
+func writeConfigFile(encrypted []byte) error {
+	configPath, err := getConfigPath()
+	if err != nil {
+		return fmt.Errorf("failed to get config path: %w", err)
+	}
+
+	if err := backupConfig(configPath); err != nil {
+		return fmt.Errorf("failed to back up config: %w", err)
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(configPath), ".rclone.conf-*")
+	if err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	defer os.Remove(temp.Name())
+
+	_, err = temp.Write(encrypted)
+	if err == nil {
+		err = temp.Sync()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(temp.Name(), 0600)
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), configPath)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
+
+// backupConfig copies the config file to configPath + configBackupSuffix. A
+// missing config file needs no backup.
+func backupConfig(configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	backupPath := configPath + configBackupSuffix
+	if err := os.WriteFile(backupPath, data, 0600); err != nil {
+		return err
+	}
+	fmt.Println("previous config backed up to", backupPath)
+	return nil
+}
@@ -0,0 +1,635 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/global-index-source/ksau-go/azure"
+	"github.com/global-index-source/ksau-go/cmd/naming"
+	"github.com/global-index-source/ksau-go/cmd/queue"
+	"github.com/spf13/cobra"
+)
+
+// daemonPollInterval is how often idle workers look for jobs that became due.
+const daemonPollInterval = 5 * time.Second
+
+// daemonRetryDelay is the delay before the first retry of a failed job, it
+// doubles with every further attempt.
+const daemonRetryDelay = 30 * time.Second
+
+var (
+	daemonSocket      string
+	daemonConcurrency int
+	daemonMaxAttempts int
+	daemonRetries     int
+	daemonKeepJobs    int
+	daemonKeepJobsFor time.Duration
+
+	daemonSubmitFolder   string
+	daemonSubmitName     string
+	daemonSubmitStrategy string
+	daemonSubmitPriority int
+)
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Run uploads from a persistent job queue",
+	Long: `Run ksau-go as a long-lived process that executes upload jobs from a
+queue, --concurrency at a time. Jobs are submitted with "daemon submit"
+through a local socket, or queued by the cron specs of the schedules file.
+Failed jobs are retried with growing delays up to --max-attempts times. The
+queue is kept next to the config, so queued and interrupted jobs continue
+after a restart. Finished jobs are dropped from it after --keep-finished-for,
+and beyond the --keep-finished most recent ones.`,
+	Run: runDaemon,
+}
+
+var daemonSubmitCmd = &cobra.Command{
+	Use:   "submit <file>...",
+	Short: "Queue files for upload by the daemon",
+	Args:  cobra.MinimumNArgs(1),
+	Run:   runDaemonSubmit,
+}
+
+var daemonStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the jobs of the daemon",
+	Args:  cobra.NoArgs,
+	Run:   runDaemonStatus,
+}
+
+func init() {
+	rootCmd.AddCommand(daemonCmd)
+	daemonCmd.AddCommand(daemonSubmitCmd)
+	daemonCmd.AddCommand(daemonStatusCmd)
+
+	daemonCmd.PersistentFlags().StringVar(&daemonSocket, "socket", "", "Socket the daemon listens on (default: daemon.sock next to the config)")
+	daemonCmd.Flags().IntVar(&daemonConcurrency, "concurrency", 2, "Number of jobs uploaded at the same time")
+	daemonCmd.Flags().IntVar(&daemonMaxAttempts, "max-attempts", 3, "Give a job up after this many failed attempts")
+	daemonCmd.Flags().IntVar(&daemonRetries, "retries", 3, "Maximum number of retries for uploading chunks")
+	daemonCmd.Flags().StringVar(&daemonSchedules, "schedules", "", "File with scheduled uploads (default: schedules.conf next to the config)")
+	daemonCmd.Flags().IntVar(&daemonKeepJobs, "keep-finished", 1000, "Number of done, failed and canceled jobs kept in the queue (0 for no limit)")
+	daemonCmd.Flags().DurationVar(&daemonKeepJobsFor, "keep-finished-for", 30*24*time.Hour, "How long done, failed and canceled jobs are kept in the queue (0 for no limit)")
+	daemonCmd.Flags().StringVar(&uploaderNick, "nick", "", "Uploader name recorded in the receipts log of shared remotes (default: your user name)")
+	daemonCmd.Flags().BoolVar(&noReceipt, "no-receipt", false, "Don't append to the remote's receipts log")
+
+	daemonSubmitCmd.Flags().StringVarP(&daemonSubmitFolder, "remote", "r", "", "Remote folder to upload into (required)")
+	daemonSubmitCmd.Flags().StringVarP(&daemonSubmitName, "remote-name", "n", "", "Remote file name, only with a single file (default: the local name)")
+	daemonSubmitCmd.Flags().StringVar(&daemonSubmitStrategy, "name-strategy", string(naming.StrategyKeep), "How to name the remote files: keep, random, hash, uuid or datetime")
+	daemonSubmitCmd.Flags().IntVar(&daemonSubmitPriority, "priority", 0, "Jobs with a higher priority are uploaded first")
+	daemonSubmitCmd.MarkFlagRequired("remote")
+}
+
+// daemonRequest is sent to the daemon's socket, one per connection.
+type daemonRequest struct {
+	Op  string     `json:"op"` // submit, list, cancel, retry or prune
+	Job *queue.Job `json:"job,omitempty"`
+	ID  string     `json:"id,omitempty"` // of the job to cancel or retry
+
+	// prune removes the finished jobs last updated before Before, or all of
+	// them if it is zero, except for the Keep most recent ones
+	Before time.Time `json:"before,omitempty"`
+	Keep   int       `json:"keep,omitempty"`
+}
+
+// daemonResponse answers a daemonRequest.
+type daemonResponse struct {
+	Error string      `json:"error,omitempty"`
+	Job   *queue.Job  `json:"job,omitempty"`
+	Jobs  []queue.Job `json:"jobs,omitempty"`
+}
+
+// daemon executes the jobs of the queue.
+type daemon struct {
+	queue *queue.Queue
+	wake  chan struct{}
+
+	mutex   sync.Mutex
+	running map[string]context.CancelFunc // stops the upload of a running job
+}
+
+func runDaemon(cmd *cobra.Command, args []string) {
+	d, listener := startDaemon()
+	d.accept(listener)
+}
+
+// startDaemon opens the queue, starts the workers and listens on the socket.
+// The process exits on an interrupt, jobs it was running are picked up again
+// by the next start.
+func startDaemon() (*daemon, net.Listener) {
+	if dryRun {
+		// Jobs submitted to it would never run, pass --dry-run to submit
+		fmt.Println("the daemon doesn't support --dry-run, use it with daemon submit to see what would be queued")
+		os.Exit(1)
+	}
+	if daemonConcurrency < 1 || daemonMaxAttempts < 1 {
+		fmt.Println("--concurrency and --max-attempts must be at least 1")
+		os.Exit(1)
+	}
+	if daemonKeepJobs < 0 || daemonKeepJobsFor < 0 {
+		fmt.Println("--keep-finished and --keep-finished-for can't be negative")
+		os.Exit(1)
+	}
+
+	queuePath, err := getStatePath("queue.json")
+	if err != nil {
+		fmt.Println("failed to locate the queue:", err.Error())
+		os.Exit(1)
+	}
+	jobQueue, err := queue.Open(queuePath)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	schedulesPath, err := daemonSchedulesPath()
+	if err != nil {
+		fmt.Println("failed to locate the schedules:", err.Error())
+		os.Exit(1)
+	}
+	schedules, err := loadSchedules(schedulesPath)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	socketPath, err := daemonSocketPath()
+	if err != nil {
+		fmt.Println("failed to locate the socket:", err.Error())
+		os.Exit(1)
+	}
+	listener, err := listenDaemonSocket(socketPath)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	// The socket file outlives the process unless it is removed
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		listener.Close()
+		fmt.Println("\nStopping, running jobs continue on the next start")
+		os.Exit(0)
+	}()
+
+	d := &daemon{queue: jobQueue, wake: make(chan struct{}, daemonConcurrency), running: make(map[string]context.CancelFunc)}
+	d.prune()
+	for worker := 0; worker < daemonConcurrency; worker++ {
+		go d.work()
+	}
+	if len(schedules) > 0 {
+		go d.runSchedules(schedules)
+	}
+	fmt.Printf("Daemon listening on %s with %d workers\n", socketPath, daemonConcurrency)
+	return d, listener
+}
+
+// accept serves the requests on the socket until it is closed.
+func (d *daemon) accept(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			slog.Warn("daemon accept failed", "error", err)
+			continue
+		}
+		go d.serve(conn)
+	}
+}
+
+// daemonSocketPath returns --socket or the default socket next to the config.
+func daemonSocketPath() (string, error) {
+	if daemonSocket != "" {
+		return daemonSocket, nil
+	}
+	return getStatePath("daemon.sock")
+}
+
+// listenDaemonSocket listens on the socket, replacing a socket file left
+// behind by a daemon that didn't shut down cleanly.
+func listenDaemonSocket(socketPath string) (net.Listener, error) {
+	if _, err := os.Stat(socketPath); err == nil {
+		if conn, err := net.Dial("unix", socketPath); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("a daemon is already listening on %s", socketPath)
+		}
+		os.Remove(socketPath)
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", socketPath, err)
+	}
+	os.Chmod(socketPath, 0600)
+	return listener, nil
+}
+
+// serve answers a single request on a socket connection.
+func (d *daemon) serve(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	var request daemonRequest
+	var response daemonResponse
+	if err := json.NewDecoder(conn).Decode(&request); err != nil {
+		response.Error = "invalid request: " + err.Error()
+	} else {
+		response = d.handle(request)
+	}
+	json.NewEncoder(conn).Encode(response)
+}
+
+func (d *daemon) handle(request daemonRequest) daemonResponse {
+	switch request.Op {
+	case "submit":
+		if request.Job == nil {
+			return daemonResponse{Error: "submit needs a job"}
+		}
+		job, err := d.submit(*request.Job)
+		if err != nil {
+			return daemonResponse{Error: err.Error()}
+		}
+		return daemonResponse{Job: &job}
+	case "list":
+		return daemonResponse{Jobs: d.queue.List()}
+	case "prune":
+		if request.Keep < 0 {
+			return daemonResponse{Error: "prune can't keep a negative number of jobs"}
+		}
+		removed, err := d.queue.Prune(request.Before, request.Keep)
+		if err != nil {
+			return daemonResponse{Error: err.Error()}
+		}
+		slog.Info("jobs pruned", "count", len(removed))
+		return daemonResponse{Jobs: removed}
+	case "cancel", "retry":
+		var job queue.Job
+		var err error
+		if request.Op == "cancel" {
+			job, err = d.cancel(request.ID)
+		} else {
+			job, err = d.retry(request.ID)
+		}
+		if err != nil {
+			return daemonResponse{Error: err.Error()}
+		}
+		return daemonResponse{Job: &job}
+	default:
+		return daemonResponse{Error: fmt.Sprintf("unknown operation %q", request.Op)}
+	}
+}
+
+// submit checks a new job and adds it to the queue.
+func (d *daemon) submit(job queue.Job) (queue.Job, error) {
+	// Only what describes the upload is taken from the request
+	return d.add(queue.Job{File: job.File, Remote: job.Remote, Folder: job.Folder, Name: job.Name, NameStrategy: job.NameStrategy, Priority: job.Priority})
+}
+
+// prune drops the finished jobs beyond --keep-finished and
+// --keep-finished-for, so the queue doesn't grow forever.
+func (d *daemon) prune() {
+	var cutoff time.Time
+	if daemonKeepJobsFor > 0 {
+		cutoff = time.Now().Add(-daemonKeepJobsFor)
+	}
+	keep := daemonKeepJobs
+	if keep == 0 {
+		keep = -1
+	}
+	removed, err := d.queue.Prune(cutoff, keep)
+	if err != nil {
+		slog.Warn("failed to prune the queue", "error", err)
+		return
+	}
+	if len(removed) > 0 {
+		slog.Info("jobs pruned", "count", len(removed))
+	}
+}
+
+// cancel cancels a queued job, or stops the upload of a running one.
+func (d *daemon) cancel(id string) (queue.Job, error) {
+	job, err := d.queue.Cancel(id)
+	if err != nil {
+		return queue.Job{}, err
+	}
+	d.mutex.Lock()
+	if stop, ok := d.running[id]; ok {
+		stop()
+	}
+	d.mutex.Unlock()
+	slog.Info("job canceled", "id", id)
+	return job, nil
+}
+
+// retry queues a failed or canceled job again.
+func (d *daemon) retry(id string) (queue.Job, error) {
+	job, err := d.queue.Retry(id)
+	if err != nil {
+		return queue.Job{}, err
+	}
+	slog.Info("job retried", "id", id)
+	d.wakeWorker()
+	return job, nil
+}
+
+// wakeWorker makes an idle worker look for due jobs right away.
+func (d *daemon) wakeWorker() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// add checks a job and adds it to the queue, waking up an idle worker.
+func (d *daemon) add(job queue.Job) (queue.Job, error) {
+	if !filepath.IsAbs(job.File) {
+		return queue.Job{}, fmt.Errorf("the file path must be absolute: %s", job.File)
+	}
+	info, err := os.Stat(job.File)
+	if err != nil {
+		return queue.Job{}, err
+	}
+	if !info.Mode().IsRegular() {
+		return queue.Job{}, fmt.Errorf("%s is not a regular file", job.File)
+	}
+	if job.Remote == "" || job.Folder == "" {
+		return queue.Job{}, fmt.Errorf("a job needs a remote and a folder")
+	}
+	if job.NameStrategy != "" && !naming.IsValid(naming.Strategy(job.NameStrategy)) {
+		return queue.Job{}, fmt.Errorf("invalid name strategy %q, must be keep, random, hash, uuid or datetime", job.NameStrategy)
+	}
+	configData, err := getConfigData()
+	if err != nil {
+		return queue.Job{}, err
+	}
+	// Only checks the remote's settings, creating a client makes no requests
+	if _, err := azure.NewAzureClientFromRcloneConfigData(configData, job.Remote); err != nil {
+		return queue.Job{}, err
+	}
+
+	job.Size = info.Size()
+	job, err = d.queue.Add(job)
+	if err != nil {
+		return queue.Job{}, err
+	}
+	slog.Info("job queued", "id", job.ID, "file", job.File, "remote", job.Remote)
+	d.wakeWorker()
+	return job, nil
+}
+
+// work runs jobs until the process ends, waiting for new ones while the
+// queue has nothing due.
+func (d *daemon) work() {
+	for {
+		job, ok := d.queue.Next()
+		if !ok {
+			select {
+			case <-d.wake:
+			case <-time.After(daemonPollInterval):
+			}
+			continue
+		}
+		d.run(job)
+		d.prune()
+	}
+}
+
+// run uploads the file of a job and records the outcome. A failed job is
+// queued again after a growing delay until it used up --max-attempts, then
+// its failure is reported to the remote's result sinks; uploads report
+// themselves.
+func (d *daemon) run(job queue.Job) {
+	fmt.Printf("job %s: uploading %s to %s:%s (attempt %d)\n", job.ID, job.File, job.Remote, job.Folder, job.Attempts)
+	start := time.Now()
+	link, err := d.upload(job)
+	if err == nil {
+		d.queue.Update(job.ID, true, func(j *queue.Job) {
+			j.Status = queue.Done
+			j.Error = ""
+			j.Link = link
+			j.Uploaded = j.Size
+		})
+		fmt.Printf("%sjob %s: done%s %s\n", ColorGreen, job.ID, ColorReset, link)
+		slog.Info("job done", "id", job.ID, "link", link)
+		return
+	}
+
+	canceled := false
+	retry := job.Attempts < daemonMaxAttempts
+	d.queue.Update(job.ID, true, func(j *queue.Job) {
+		j.Uploaded = 0
+		if j.Status == queue.Canceled {
+			canceled = true
+			return
+		}
+		j.Error = err.Error()
+		if retry {
+			j.Status = queue.Queued
+			j.NotUntil = time.Now().Add(azure.Backoff{Base: daemonRetryDelay, Cap: time.Hour, Multiplier: 2}.Delay(job.Attempts - 1))
+		} else {
+			j.Status = queue.Failed
+		}
+	})
+	if canceled {
+		fmt.Printf("%sjob %s: canceled%s\n", ColorYellow, job.ID, ColorReset)
+		return
+	}
+	if retry {
+		fmt.Printf("%sjob %s: attempt %d failed, retrying later: %v%s\n", ColorYellow, job.ID, job.Attempts, err, ColorReset)
+	} else {
+		fmt.Printf("%sjob %s: failed: %v%s\n", ColorRed, job.ID, err, ColorReset)
+		name := job.Name
+		if name == "" {
+			name = filepath.Base(job.File)
+		}
+		notifyUploadFailed(job.Remote, name, job.File, job.Size, err, time.Since(start))
+	}
+	slog.Warn("job failed", "id", job.ID, "attempt", job.Attempts, "error", err)
+}
+
+func (d *daemon) upload(job queue.Job) (string, error) {
+	// The config is read again for every job, so refreshed tokens are used
+	configData, err := getConfigData()
+	if err != nil {
+		return "", err
+	}
+	client, err := azure.NewAzureClientFromRcloneConfigData(configData, job.Remote)
+	if err != nil {
+		return "", err
+	}
+	client.Backoff = uploadBackoff(retryDelay)
+	client.MaxRetries = daemonRetries
+
+	name := job.Name
+	if name == "" {
+		name = filepath.Base(job.File)
+	}
+	// Generated on every attempt, so a random name that got taken meanwhile
+	// isn't used again
+	name, err = naming.Generate(naming.Strategy(job.NameStrategy), name, job.File)
+	if err != nil {
+		return "", err
+	}
+
+	// Canceling the job fails the requests of its upload
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	d.mutex.Lock()
+	d.running[job.ID] = stop
+	d.mutex.Unlock()
+	defer func() {
+		d.mutex.Lock()
+		delete(d.running, job.ID)
+		d.mutex.Unlock()
+	}()
+	httpClient := &http.Client{Transport: cancelTransport{base: sharedHTTPClient().Transport, ctx: ctx}}
+
+	link, _, err := uploadLocalFile(client, httpClient, job.Remote, job.File, path.Join(job.Folder, name), daemonRetries, func(uploaded int64) {
+		d.queue.Update(job.ID, false, func(j *queue.Job) { j.Uploaded = uploaded })
+	})
+	return link, err
+}
+
+// cancelTransport fails the requests made through it once ctx is canceled.
+type cancelTransport struct {
+	base http.RoundTripper
+	ctx  context.Context
+}
+
+func (t cancelTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.ctx.Err(); err != nil {
+		return nil, err
+	}
+	reqCtx, cancel := context.WithCancel(req.Context())
+	// Released when the job ends, the response body may still be read
+	// after RoundTrip returns
+	context.AfterFunc(t.ctx, cancel)
+	return t.base.RoundTrip(req.WithContext(reqCtx))
+}
+
+// callDaemon sends a request to the running daemon and returns its answer.
+func callDaemon(request daemonRequest) (daemonResponse, error) {
+	socketPath, err := daemonSocketPath()
+	if err != nil {
+		return daemonResponse{}, err
+	}
+	conn, err := net.DialTimeout("unix", socketPath, 5*time.Second)
+	if err != nil {
+		return daemonResponse{}, fmt.Errorf("cannot reach the daemon on %s, is it running? %w", socketPath, err)
+	}
+	defer conn.Close()
+
+	if err := json.NewEncoder(conn).Encode(request); err != nil {
+		return daemonResponse{}, err
+	}
+	var response daemonResponse
+	if err := json.NewDecoder(conn).Decode(&response); err != nil {
+		return daemonResponse{}, fmt.Errorf("invalid answer from the daemon: %w", err)
+	}
+	if response.Error != "" {
+		return response, errors.New(response.Error)
+	}
+	return response, nil
+}
+
+func runDaemonSubmit(cmd *cobra.Command, args []string) {
+	remoteConfig, _ := cmd.Flags().GetString("remote-config")
+	if remoteConfig == "" {
+		fmt.Println("please select a remote with --remote-config")
+		os.Exit(1)
+	}
+	if daemonSubmitName != "" && len(args) > 1 {
+		fmt.Println("--remote-name can only be used with a single file")
+		os.Exit(1)
+	}
+	if !naming.IsValid(naming.Strategy(daemonSubmitStrategy)) {
+		fmt.Printf("Invalid name strategy: %s\nValid strategies are: keep, random, hash, uuid, datetime\n", daemonSubmitStrategy)
+		os.Exit(1)
+	}
+
+	failed := false
+	for _, file := range args {
+		absPath, err := filepath.Abs(file)
+		if err != nil {
+			fmt.Printf("%s: %v\n", file, err)
+			failed = true
+			continue
+		}
+		if dryRun {
+			info, err := os.Stat(absPath)
+			if err != nil {
+				fmt.Printf("%s: %v\n", file, err)
+				failed = true
+				continue
+			}
+			name := daemonSubmitName
+			if name == "" {
+				name = filepath.Base(absPath)
+			}
+			if name, err = naming.Generate(naming.Strategy(daemonSubmitStrategy), name, absPath); err != nil {
+				fmt.Printf("%s: %v\n", file, err)
+				failed = true
+				continue
+			}
+			printDryRun("queue %s (%s) for %s:%s", file, azure.FormatBytes(info.Size()), remoteConfig, path.Join(daemonSubmitFolder, name))
+			continue
+		}
+		response, err := callDaemon(daemonRequest{Op: "submit", Job: &queue.Job{
+			File:         absPath,
+			Remote:       remoteConfig,
+			Folder:       daemonSubmitFolder,
+			Name:         daemonSubmitName,
+			NameStrategy: daemonSubmitStrategy,
+			Priority:     daemonSubmitPriority,
+		}})
+		if err != nil {
+			fmt.Printf("%sfailed to queue %s: %v%s\n", ColorRed, file, err, ColorReset)
+			failed = true
+			continue
+		}
+		fmt.Printf("queued %s as job %s\n", file, response.Job.ID)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func runDaemonStatus(cmd *cobra.Command, args []string) {
+	response, err := callDaemon(daemonRequest{Op: "list"})
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	if len(response.Jobs) == 0 {
+		fmt.Println("no jobs")
+		return
+	}
+
+	printJobTable(response.Jobs)
+}
+
+// jobProgress returns how much of a job is uploaded as a percentage.
+func jobProgress(job queue.Job) string {
+	if job.Size == 0 {
+		if job.Status == queue.Done {
+			return "100%"
+		}
+		return "0%"
+	}
+	return fmt.Sprintf("%.0f%%", float64(job.Uploaded)*100/float64(job.Size))
+}
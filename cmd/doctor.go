@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"text/tabwriter"
+	"time"
+
+	"github.com/global-index-source/ksau-go/azure"
+	"github.com/spf13/cobra"
+)
+
+// maxClockSkew is the largest difference to the Graph server clock that is
+// still considered healthy.
+const maxClockSkew = 5 * time.Minute
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Run health checks against the configured remotes",
+	Long: `Check every remote (or the one given with --remote-config) for a valid
+token, Graph reachability, drive access, root folder existence and write
+permission, and print a pass/fail table with hints on how to fix failures.`,
+	Run: runDoctor,
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
+
+// checkResult is the outcome of a single health check.
+type checkResult struct {
+	name   string
+	ok     bool
+	detail string
+	hint   string
+}
+
+func runDoctor(cmd *cobra.Command, args []string) {
+	requireNetwork("")
+
+	configData, err := getConfigData()
+	if err != nil {
+		fmt.Println("failed to get configuration file data:", err.Error())
+		fmt.Println("hint: run 'ksau-go refresh' to download the configuration")
+		os.Exit(1)
+	}
+
+	parsedConfigData, err := azure.ParseRcloneConfigData(configData)
+	if err != nil {
+		fmt.Println("failed to parse configuration file data:", err.Error())
+		os.Exit(1)
+	}
+
+	remotes := azure.GetAvailableRemotes(&parsedConfigData)
+	if remoteConfig, _ := cmd.Flags().GetString("remote-config"); remoteConfig != "" {
+		remotes = []string{remoteConfig}
+	}
+
+	httpClient := sharedHTTPClient()
+	failed := false
+
+	clock := checkClockSkew(httpClient)
+	printChecks("Microsoft Graph", []checkResult{clock})
+	failed = failed || !clock.ok
+
+	results := fanOut(remotes, func(remote string) ([]checkResult, error) {
+		return checkRemote(configData, remote, httpClient), nil
+	})
+
+	for _, result := range results {
+		printChecks(result.remote, result.value)
+		for _, check := range result.value {
+			failed = failed || !check.ok
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func checkClockSkew(httpClient *http.Client) checkResult {
+	result := checkResult{name: "clock skew"}
+
+	serverTime, err := azure.ServerTime(httpClient, azure.Endpoints{})
+	if err != nil {
+		result.detail = err.Error()
+		result.hint = "check your internet connection and proxy settings"
+		return result
+	}
+
+	skew := time.Since(serverTime).Round(time.Second)
+	result.detail = fmt.Sprintf("%s off", skew)
+	if skew.Abs() > maxClockSkew {
+		result.hint = "synchronize your system clock, tokens are checked against it"
+		return result
+	}
+
+	result.ok = true
+	return result
+}
+
+// checkRemote runs all checks for a single remote, stopping at the first check
+// that the remaining ones depend on.
+func checkRemote(configData []byte, remote string, httpClient *http.Client) []checkResult {
+	var results []checkResult
+
+	client, err := azure.NewAzureClientFromRcloneConfigData(configData, remote)
+	if err != nil {
+		return append(results, checkResult{name: "config", detail: err.Error(), hint: "run 'ksau-go refresh' to get a fresh config"})
+	}
+
+	if err := client.EnsureTokenValid(httpClient); err != nil {
+		return append(results, checkResult{name: "token", detail: err.Error(), hint: "run 'ksau-go refresh', the refresh token may have been revoked"})
+	}
+	results = append(results, checkResult{name: "token", ok: true, detail: "valid until " + client.Expiration.Local().Format("15:04:05")})
+
+	drive, err := client.GetDrive(httpClient)
+	if err != nil {
+		return append(results, checkResult{name: "drive access", detail: err.Error(), hint: "the account may have lost access to the drive"})
+	}
+	results = append(results, checkResult{name: "drive access", ok: true, detail: fmt.Sprintf("%s drive, %s free", drive.DriveType, azure.FormatBytes(drive.Quota.Remaining))})
+
+	if client.RemoteRootFolder != "" {
+		exists, err := client.ItemExists(httpClient, client.RemoteRootFolder)
+		switch {
+		case err != nil:
+			return append(results, checkResult{name: "root folder", detail: err.Error()})
+		case !exists:
+			return append(results, checkResult{name: "root folder", detail: client.RemoteRootFolder + " not found", hint: "create the folder or fix root_folder in the config"})
+		}
+		results = append(results, checkResult{name: "root folder", ok: true, detail: client.RemoteRootFolder})
+	}
+
+	probePath := path.Join(client.RemoteRootFolder, fmt.Sprintf(".ksau-doctor-%d.txt", time.Now().UnixNano()))
+	itemID, err := client.UploadSmall(httpClient, probePath, []byte("ksau-go doctor write test\n"), azure.ConflictFail)
+	if err != nil {
+		return append(results, checkResult{name: "write access", detail: err.Error(), hint: "the drive may be read-only or full"})
+	}
+	if err := client.DeleteItem(httpClient, itemID, probePath, false); err != nil {
+		return append(results, checkResult{name: "write access", detail: "created test file but could not delete it: " + err.Error(), hint: "remove " + probePath + " manually"})
+	}
+	return append(results, checkResult{name: "write access", ok: true, detail: "created and deleted a test file"})
+}
+
+func printChecks(title string, results []checkResult) {
+	fmt.Println(title)
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, result := range results {
+		status := ColorGreen + "PASS" + ColorReset
+		if !result.ok {
+			status = ColorRed + "FAIL" + ColorReset
+		}
+		fmt.Fprintf(writer, "  %s\t%s\t%s\n", status, result.name, result.detail)
+		if result.hint != "" {
+			fmt.Fprintf(writer, "  \t\thint: %s\n", result.hint)
+		}
+	}
+	writer.Flush()
+	fmt.Println()
+}
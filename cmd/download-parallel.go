@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/global-index-source/ksau-go/azure"
+	"github.com/global-index-source/ksau-go/cmd/progress"
+	"github.com/global-index-source/ksau-go/crypto"
+)
+
+const (
+	// parallelDownloadMinSize is the smallest file downloaded over several
+	// connections. Below it, opening the connections costs more than it gains.
+	parallelDownloadMinSize = 64 * 1024 * 1024
+
+	// downloadSegmentSize is the size of the ranges of a parallel download,
+	// and so of the work lost when one is interrupted.
+	downloadSegmentSize = 32 * 1024 * 1024
+)
+
+// fetchSegments downloads the file in segments of state.SegmentSize bytes,
+// --connections of them at a time, each written to its place in file. Every
+// complete segment is recorded in the state file, so a new run only
+// downloads the missing ones. A dropped connection resumes its segment right
+// away, up to --retries times in a row. The segments arrive out of order, so
+// if verify is set the file is read once more to return its QuickXorHash.
+func fetchSegments(client *azure.AzureClient, httpClient *http.Client, file *os.File, state downloadState, statePath string, verify bool) (string, error) {
+	if err := file.Truncate(state.Size); err != nil {
+		return "", err
+	}
+
+	count := int((state.Size + state.SegmentSize - 1) / state.SegmentSize)
+	done := make(map[int]bool, len(state.Done))
+	var downloaded int64
+	for _, index := range state.Done {
+		if index >= 0 && index < count && !done[index] {
+			done[index] = true
+			downloaded += min(state.SegmentSize, state.Size-int64(index)*state.SegmentSize)
+		}
+	}
+	if len(done) > 0 {
+		fmt.Printf("Resuming with %d of %d segments done\n", len(done), count)
+	}
+	if err := saveDownloadState(statePath, state); err != nil {
+		return "", err
+	}
+
+	segments := make(chan int, count)
+	for index := 0; index < count; index++ {
+		if !done[index] {
+			segments <- index
+		}
+	}
+	close(segments)
+
+	tracker := progress.NewProgressTracker(state.Size, progress.StyleModern)
+	var mutex sync.Mutex
+	var firstErr error
+	addProgress := func(n int64) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		downloaded += n
+		tracker.Update(downloaded, state.Size)
+	}
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < min(downloadConnections, count); worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range segments {
+				mutex.Lock()
+				failed := firstErr != nil
+				mutex.Unlock()
+				if failed {
+					return
+				}
+
+				offset := int64(index) * state.SegmentSize
+				size := min(state.SegmentSize, state.Size-offset)
+				err := fetchSegment(client, httpClient, file, state.ItemID, offset, size, addProgress)
+
+				mutex.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = fmt.Errorf("segment %d: %w", index, err)
+					}
+				} else {
+					state.Done = append(state.Done, index)
+					sort.Ints(state.Done)
+					if saveErr := saveDownloadState(statePath, state); saveErr != nil && firstErr == nil {
+						firstErr = saveErr
+					}
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	tracker.Finish()
+
+	if firstErr != nil {
+		if errors.Is(firstErr, azure.ErrRangeNotSupported) {
+			return "", fmt.Errorf("%w, try --connections 1", firstErr)
+		}
+		return "", fmt.Errorf("%w (run the download again to resume)", firstErr)
+	}
+
+	if !verify {
+		return "", nil
+	}
+	fmt.Println("Verifying the downloaded file...")
+	hasher := crypto.New()
+	if _, err := io.Copy(hasher, io.NewSectionReader(file, 0, state.Size)); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", file.Name(), err)
+	}
+	return encodeHash(hasher), nil
+}
+
+// fetchSegment downloads size bytes at offset of the file into the same
+// place of file, reporting the bytes written to addProgress. Bytes that
+// arrived before a dropped connection aren't downloaded again.
+func fetchSegment(client *azure.AzureClient, httpClient *http.Client, file *os.File, itemID string, offset int64, size int64, addProgress func(int64)) error {
+	backoff := azure.DefaultBackoff()
+	var written int64
+	failures := 0
+	for {
+		body, err := client.DownloadRange(httpClient, itemID, offset+written, size-written)
+		if err == nil {
+			var n int64
+			n, err = io.Copy(&progressWriter{writer: io.NewOffsetWriter(file, offset+written), add: addProgress}, io.LimitReader(body, size-written))
+			body.Close()
+			written += n
+			if n > 0 {
+				failures = 0
+			}
+			if err == nil && written < size {
+				err = io.ErrUnexpectedEOF
+			}
+		}
+		if err == nil {
+			return nil
+		}
+		if errors.Is(err, azure.ErrRangeNotSupported) || failures >= downloadRetries {
+			return err
+		}
+		failures++
+		backoff.Sleep(failures - 1)
+	}
+}
+
+// progressWriter reports the bytes written through it.
+type progressWriter struct {
+	writer io.Writer
+	add    func(int64)
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.add(int64(n))
+	return n, err
+}
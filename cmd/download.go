@@ -0,0 +1,393 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/global-index-source/ksau-go/azure"
+	"github.com/global-index-source/ksau-go/cmd/progress"
+	"github.com/global-index-source/ksau-go/crypto"
+	"github.com/spf13/cobra"
+)
+
+var (
+	downloadOutput      string
+	downloadIdentities  []string
+	downloadRaw         bool
+	downloadRetries     int
+	downloadSkipHash    bool
+	downloadConnections int
+)
+
+// exitHashMismatch is the exit status of download when the downloaded data
+// doesn't match the remote QuickXorHash, so scripts can tell corruption apart
+// from other failures.
+const exitHashMismatch = 3
+
+// errHashMismatch is returned when a downloaded file doesn't match its hash.
+var errHashMismatch = errors.New("the downloaded file doesn't match the remote QuickXorHash")
+
+var downloadCmd = &cobra.Command{
+	Use:   "download <remote-path>",
+	Short: "Download a file from a remote",
+	Long: `Download a file, given by its path relative to the remote's root folder,
+into the current directory or to --output. Files uploaded with --encrypt
+(ending in ` + encryptedSuffix + `) are decrypted once downloaded with the passphrase from
+` + encryptPassphraseEnv + ` or the age keys given with --identity. Files uploaded in
+volumes are joined again from their ` + volumeManifestSuffix + ` manifest.
+
+Interrupted downloads are resumed where they stopped when run again, as long
+as the remote file didn't change.`,
+	Args: cobra.ExactArgs(1),
+	Run:  runDownload,
+}
+
+func init() {
+	rootCmd.AddCommand(downloadCmd)
+
+	downloadCmd.Flags().StringVarP(&downloadOutput, "output", "o", "", "Local file or directory to download to (default: the file's name in the current directory)")
+	downloadCmd.Flags().StringSliceVarP(&downloadIdentities, "identity", "i", nil, "age identity file to decrypt with instead of a passphrase (repeatable)")
+	downloadCmd.Flags().IntVar(&downloadRetries, "retries", 3, "Maximum number of times a dropped connection is resumed in a row")
+	downloadCmd.Flags().IntVar(&downloadConnections, "connections", 4, "Download files of at least 64 MiB over this many connections at once")
+	downloadCmd.Flags().BoolVar(&downloadSkipHash, "skip-hash", false, "Don't verify the downloaded file against the remote QuickXorHash")
+	downloadCmd.Flags().BoolVar(&downloadRaw, "raw", false, "Keep encrypted files encrypted and download volume manifests as they are")
+}
+
+func runDownload(cmd *cobra.Command, args []string) {
+	remoteConfig, _ := cmd.Flags().GetString("remote-config")
+	if remoteConfig == "" {
+		fmt.Println("please select a remote with --remote-config")
+		os.Exit(1)
+	}
+
+	if downloadConnections < 1 {
+		fmt.Println("--connections must be at least 1")
+		os.Exit(1)
+	}
+
+	requireNetwork("")
+
+	configData, err := getConfigData()
+	if err != nil {
+		fmt.Println("failed to get configuration file data:", err.Error())
+		os.Exit(1)
+	}
+	client, err := azure.NewAzureClientFromRcloneConfigData(configData, remoteConfig)
+	if err != nil {
+		fmt.Println("failed to initialize client:", err.Error())
+		os.Exit(1)
+	}
+
+	httpClient := sharedHTTPClient()
+	remotePath := path.Join("/", client.RemoteRootFolder, args[0])
+	item, err := client.GetItem(httpClient, remotePath)
+	if errors.Is(err, azure.ErrItemNotFound) && !downloadRaw {
+		// Files split into volumes only exist as their manifest
+		if manifestItem, manifestErr := client.GetItem(httpClient, remotePath+volumeManifestSuffix); manifestErr == nil {
+			item, err = manifestItem, nil
+		}
+	}
+	if err != nil {
+		fmt.Println("failed to find the file:", err.Error())
+		printErrorHint(err)
+		os.Exit(1)
+	}
+	if item.File == nil {
+		fmt.Printf("%s is a folder\n", remotePath)
+		os.Exit(1)
+	}
+
+	if !downloadRaw && strings.HasSuffix(item.Name, volumeManifestSuffix) {
+		outputPath := downloadPath(strings.TrimSuffix(item.Name, volumeManifestSuffix))
+		if err := downloadVolumes(client, httpClient, item, path.Dir(remotePath), outputPath); err != nil {
+			exitDownloadFailed(err)
+		}
+		fmt.Printf("%sJoined the volumes of %s into %s%s\n", ColorGreen, remotePath, outputPath, ColorReset)
+		return
+	}
+
+	// Ask for the passphrase before the download starts
+	var identities []age.Identity
+	name := item.Name
+	if !downloadRaw && (strings.HasSuffix(item.Name, encryptedSuffix) || len(downloadIdentities) > 0) {
+		identities, err = parseIdentities(downloadIdentities)
+		if err != nil {
+			fmt.Println("failed to set up decryption:", err.Error())
+			os.Exit(1)
+		}
+		name = strings.TrimSuffix(name, encryptedSuffix)
+	}
+	outputPath := downloadPath(name)
+
+	if err := downloadFile(client, httpClient, item, outputPath, identities); err != nil {
+		exitDownloadFailed(err)
+	}
+	fmt.Printf("%sDownloaded %s to %s%s\n", ColorGreen, remotePath, outputPath, ColorReset)
+}
+
+// exitDownloadFailed reports a failed download and exits, with
+// exitHashMismatch if the data arrived but didn't match its hash.
+func exitDownloadFailed(err error) {
+	fmt.Println("\nFailed to download file:", err.Error())
+	if errors.Is(err, errHashMismatch) {
+		os.Exit(exitHashMismatch)
+	}
+	printErrorHint(err)
+	os.Exit(1)
+}
+
+// downloadPath returns where a file named name is saved: --output, inside it
+// if it is a directory, or the current directory.
+func downloadPath(name string) string {
+	if downloadOutput == "" {
+		return name
+	}
+	if info, err := os.Stat(downloadOutput); err == nil && info.IsDir() {
+		return filepath.Join(downloadOutput, name)
+	}
+	return downloadOutput
+}
+
+// downloadFile downloads a file to outputPath, decrypting it with identities
+// unless there are none. Only the data as stored on the remote can be
+// resumed, so encrypted files are downloaded completely before they are
+// decrypted.
+func downloadFile(client *azure.AzureClient, httpClient *http.Client, item *azure.DriveItem, outputPath string, identities []age.Identity) error {
+	if identities == nil {
+		return fetchFile(client, httpClient, item, outputPath)
+	}
+
+	encryptedPath := outputPath + encryptedSuffix
+	if err := fetchFile(client, httpClient, item, encryptedPath); err != nil {
+		return err
+	}
+	if err := decryptFile(encryptedPath, outputPath, identities); err != nil {
+		return fmt.Errorf("%w (the encrypted file is kept as %s)", err, encryptedPath)
+	}
+	return os.Remove(encryptedPath)
+}
+
+// downloadState identifies the remote file a .part file belongs to, so a
+// download is only resumed if the file didn't change in the meantime.
+type downloadState struct {
+	ItemID       string `json:"itemId"`
+	Size         int64  `json:"size"`
+	QuickXorHash string `json:"quickXorHash,omitempty"`
+
+	// Parallel downloads fill the file out of order in segments of
+	// SegmentSize bytes, Done lists the complete ones. A sequential download
+	// has no segments, its progress is the size of the .part file.
+	SegmentSize int64 `json:"segmentSize,omitempty"`
+	Done        []int `json:"done,omitempty"`
+}
+
+// sameFile reports whether two states describe the same version of a file.
+func (s downloadState) sameFile(other downloadState) bool {
+	return s.ItemID == other.ItemID && s.Size == other.Size && s.QuickXorHash == other.QuickXorHash
+}
+
+// fetchFile downloads the content of a file to outputPath. The data goes to
+// <outputPath>.part first, so an interrupted download never looks like a
+// complete one, and what it belongs to is kept in <outputPath>.part.json: run
+// again, the download continues where it stopped with Range requests. Large
+// files are downloaded over --connections connections at once.
+// The complete file is checked against the remote QuickXorHash unless
+// --skip-hash is given.
+func fetchFile(client *azure.AzureClient, httpClient *http.Client, item *azure.DriveItem, outputPath string) error {
+	partPath := outputPath + ".part"
+	statePath := partPath + ".json"
+	state := downloadState{ItemID: item.ID, Size: item.Size}
+	if item.File != nil {
+		state.QuickXorHash = item.File.Hashes.QuickXorHash
+	}
+	verify := !downloadSkipHash && state.QuickXorHash != ""
+	if !downloadSkipHash && state.QuickXorHash == "" {
+		fmt.Printf("%sWarning: the remote reports no QuickXorHash, the download can't be verified%s\n", ColorYellow, ColorReset)
+	}
+
+	// A download is resumed the way it was started
+	if saved, ok := loadDownloadState(partPath, statePath, state); ok {
+		state = saved
+	} else {
+		os.Remove(partPath)
+		if downloadConnections > 1 && item.Size >= parallelDownloadMinSize {
+			state.SegmentSize = downloadSegmentSize
+		}
+	}
+
+	file, err := os.OpenFile(partPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var hash string
+	if state.SegmentSize > 0 {
+		hash, err = fetchSegments(client, httpClient, file, state, statePath, verify)
+	} else {
+		hash, err = fetchSequential(client, httpClient, file, state, statePath, verify)
+	}
+	if err != nil {
+		return err
+	}
+
+	if verify && hash != state.QuickXorHash {
+		file.Close()
+		os.Remove(partPath)
+		os.Remove(statePath)
+		return errHashMismatch
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(partPath, outputPath); err != nil {
+		return err
+	}
+	os.Remove(statePath)
+	return nil
+}
+
+// fetchSequential downloads the file over a single connection, appending to
+// what an earlier run already wrote to file. A dropped connection is resumed
+// right away, up to --retries times in a row. If verify is set, it returns
+// the QuickXorHash of the whole file.
+func fetchSequential(client *azure.AzureClient, httpClient *http.Client, file *os.File, state downloadState, statePath string, verify bool) (string, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	offset := min(info.Size(), state.Size)
+	if err := file.Truncate(offset); err != nil {
+		return "", err
+	}
+
+	// The hash covers the whole file, including what an earlier run downloaded
+	hasher := crypto.New()
+	if offset > 0 {
+		fmt.Printf("Resuming at %s of %s\n", azure.FormatBytes(offset), azure.FormatBytes(state.Size))
+		if verify {
+			if _, err := io.CopyN(hasher, io.NewSectionReader(file, 0, offset), offset); err != nil {
+				return "", fmt.Errorf("failed to read %s: %w", file.Name(), err)
+			}
+		}
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return "", err
+	}
+	if err := saveDownloadState(statePath, state); err != nil {
+		return "", err
+	}
+
+	tracker := progress.NewProgressTracker(state.Size, progress.StyleModern)
+	defer tracker.Finish()
+	backoff := azure.DefaultBackoff()
+	failures := 0
+	for offset < state.Size {
+		body, err := client.DownloadRange(httpClient, state.ItemID, offset, -1)
+		if err == nil {
+			var written int64
+			written, err = io.Copy(io.MultiWriter(file, hasher), &progressReader{reader: body, read: offset, total: state.Size, tracker: tracker})
+			body.Close()
+			offset += written
+			if written > 0 {
+				failures = 0
+			}
+			if err == nil && offset < state.Size {
+				err = io.ErrUnexpectedEOF
+			}
+		}
+		if err == nil {
+			break
+		}
+		if errors.Is(err, azure.ErrRangeNotSupported) || failures >= downloadRetries {
+			if offset > 0 {
+				return "", fmt.Errorf("%w (run the download again to resume)", err)
+			}
+			return "", err
+		}
+		failures++
+		fmt.Printf("\n%sDownload interrupted at %s, resuming: %v%s\n", ColorYellow, azure.FormatBytes(offset), err, ColorReset)
+		backoff.Sleep(failures - 1)
+	}
+
+	if !verify {
+		return "", nil
+	}
+	return encodeHash(hasher), nil
+}
+
+// loadDownloadState returns the saved state of an earlier download of the
+// file described by state, if there is one and its .part file still exists.
+func loadDownloadState(partPath string, statePath string, state downloadState) (downloadState, bool) {
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		return state, false
+	}
+	var saved downloadState
+	if err := json.Unmarshal(data, &saved); err != nil || !saved.sameFile(state) {
+		return state, false
+	}
+	if _, err := os.Stat(partPath); err != nil {
+		return state, false
+	}
+	return saved, true
+}
+
+func saveDownloadState(statePath string, state downloadState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(statePath, data, 0644)
+}
+
+// decryptFile decrypts the age encrypted file at encryptedPath to outputPath.
+func decryptFile(encryptedPath string, outputPath string, identities []age.Identity) error {
+	source, err := os.Open(encryptedPath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	decryptor, err := newDecryptor(source, identities)
+	if err != nil {
+		return err
+	}
+	partPath := outputPath + ".part"
+	file, err := os.Create(partPath)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, decryptor)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(partPath)
+		return fmt.Errorf("failed to decrypt: %w", err)
+	}
+	return os.Rename(partPath, outputPath)
+}
+
+// progressReader reports the bytes read through it to a progress tracker.
+type progressReader struct {
+	reader  io.Reader
+	read    int64
+	total   int64
+	tracker *progress.ProgressTracker
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+	r.tracker.Update(r.read, r.total)
+	return n, err
+}
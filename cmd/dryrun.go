@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"path/filepath"
+
+	"github.com/global-index-source/ksau-go/azure"
+	"github.com/global-index-source/ksau-go/cmd/naming"
+)
+
+// dryRun makes commands print what they would upload, create or delete
+// instead of doing it. Remote data is still read, to report what would be
+// skipped.
+var dryRun bool
+
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Print what would be uploaded, created or deleted without changing anything")
+}
+
+// printDryRun prints an action a dry run leaves out, e.g.
+// printDryRun("delete %s", path) prints "[dry-run] would delete <path>".
+func printDryRun(format string, args ...any) {
+	fmt.Printf("%s[dry-run]%s would %s\n", ColorYellow, ColorReset, fmt.Sprintf(format, args...))
+}
+
+// dryRunUpload prints where runUpload would upload the file as name, and what
+// it would add next to it, skipping files identical to the remote copy like a
+// real upload does.
+func dryRunUpload(configData []byte, remoteConfig string, candidates []string, name string, fileSize int64, httpClient *http.Client) {
+	targets := []string{remoteConfig}
+	volumes := 0
+	if fileSize > splitLimit() {
+		// Split files go to a single remote
+		volumes = int((fileSize + splitLimit() - 1) / splitLimit())
+	} else if copies > 1 {
+		var err error
+		targets, err = copyTargets(configData, remoteConfig, candidates, fileSize)
+		if err != nil {
+			fmt.Println("cannot determine remotes for copies:", err.Error())
+			return
+		}
+	}
+
+	for _, target := range targets {
+		client, err := azure.NewAzureClientFromRcloneConfigData(configData, target)
+		if err != nil {
+			fmt.Printf("failed to initialize client for %s: %v\n", target, err)
+			continue
+		}
+		remotePath := path.Join(client.RemoteRootFolder, remoteFolder, name)
+
+		if volumes > 0 {
+			printDryRun("upload %s (%s) to %s:%s as %d volumes of up to %s and %s%s", filePath, azure.FormatBytes(fileSize), target,
+				remotePath, volumes, azure.FormatBytes(splitLimit()), name, volumeManifestSuffix)
+			continue
+		}
+		if !streamedUpload() && !naming.IsRandom(naming.Strategy(nameStrategy)) {
+			if item, reason := skipExisting(client, httpClient, remotePath, fileSize); item != nil {
+				printDryRun("skip %s: %s", remotePath, reason)
+				continue
+			}
+		}
+		printDryRun("upload %s (%s) to %s:%s", filePath, azure.FormatBytes(fileSize), target, remotePath)
+		if annotation != nil {
+			printDryRun("upload %s as %s%s%s", annotateFile, remotePath, annotationSuffix, filepath.Ext(annotateFile))
+		}
+		if signKey != "" {
+			printDryRun("upload a signed manifest as %s%s", remotePath, manifestSuffix)
+		}
+		if client.ReceiptsLog != "" && !noReceipt {
+			printDryRun("append a receipt to %s", client.ReceiptsLog)
+		}
+	}
+}
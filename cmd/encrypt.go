@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// encryptPassphraseEnv holds the passphrase of --encrypt and download
+// --decrypt when no age keys are given, for scripts where nobody can answer
+// the prompt.
+const encryptPassphraseEnv = "KSAU_ENCRYPT_PASSPHRASE"
+
+// encryptedSuffix is appended to the remote name of encrypted uploads.
+const encryptedSuffix = ".age"
+
+var (
+	encryptUpload     bool
+	encryptRecipients []string
+)
+
+// uploadRecipients are who --encrypt encrypts for. They are resolved once
+// before uploading, so the passphrase is only asked for once.
+var uploadRecipients []age.Recipient
+
+// parseRecipients returns the age recipients of --encrypt-to values, each
+// either a public key (age1...) or a file with one per line. Without values,
+// the content is encrypted with a passphrase instead.
+func parseRecipients(values []string) ([]age.Recipient, error) {
+	if len(values) == 0 {
+		passphrase, err := readSecret(encryptPassphraseEnv, "Encryption passphrase: ")
+		if err != nil {
+			return nil, err
+		}
+		if _, set := os.LookupEnv(encryptPassphraseEnv); !set {
+			again, err := readSecret(encryptPassphraseEnv, "Repeat passphrase: ")
+			if err != nil {
+				return nil, err
+			}
+			if !bytes.Equal(passphrase, again) {
+				return nil, fmt.Errorf("passphrases don't match")
+			}
+		}
+		if len(passphrase) == 0 {
+			return nil, fmt.Errorf("empty passphrase")
+		}
+		recipient, err := age.NewScryptRecipient(string(passphrase))
+		if err != nil {
+			return nil, err
+		}
+		return []age.Recipient{recipient}, nil
+	}
+
+	var recipients []age.Recipient
+	for _, value := range values {
+		if strings.HasPrefix(value, "age1") {
+			recipient, err := age.ParseX25519Recipient(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid recipient %s: %w", value, err)
+			}
+			recipients = append(recipients, recipient)
+			continue
+		}
+
+		data, err := os.ReadFile(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read recipients file: %w", err)
+		}
+		parsed, err := age.ParseRecipients(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipients file %s: %w", value, err)
+		}
+		recipients = append(recipients, parsed...)
+	}
+	return recipients, nil
+}
+
+// parseIdentities returns the age identities to decrypt with: the keys in
+// the given identity files or, without files, the passphrase.
+func parseIdentities(files []string) ([]age.Identity, error) {
+	if len(files) == 0 {
+		passphrase, err := readSecret(encryptPassphraseEnv, "Decryption passphrase: ")
+		if err != nil {
+			return nil, err
+		}
+		identity, err := age.NewScryptIdentity(string(passphrase))
+		if err != nil {
+			return nil, err
+		}
+		return []age.Identity{identity}, nil
+	}
+
+	var identities []age.Identity
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read identity file: %w", err)
+		}
+		parsed, err := age.ParseIdentities(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid identity file %s: %w", file, err)
+		}
+		identities = append(identities, parsed...)
+	}
+	return identities, nil
+}
+
+// newEncryptor returns a writer encrypting into w for uploadRecipients. age
+// encrypts in chunks of 64 KiB, so the size of the output only depends on
+// the size of the input.
+func newEncryptor(w io.Writer) (io.WriteCloser, error) {
+	encryptor, err := age.Encrypt(w, uploadRecipients...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start encryption: %w", err)
+	}
+	return encryptor, nil
+}
+
+// newDecryptor returns a reader decrypting the age encrypted r.
+func newDecryptor(r io.Reader, identities []age.Identity) (io.Reader, error) {
+	decryptor, err := age.Decrypt(r, identities...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt, wrong key or passphrase?: %w", err)
+	}
+	return decryptor, nil
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// envPrefix starts the environment variables that set flags, e.g.
+// KSAU_CHUNK_SIZE for --chunk-size.
+const envPrefix = "KSAU_"
+
+// Registered before the other initializers (files are initialized in name
+// order), so flags set through the environment are in place for them.
+func init() {
+	cobra.OnInitialize(applyEnvOverrides)
+}
+
+// flagEnvName returns the environment variable for a flag name.
+func flagEnvName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// applyEnvOverrides sets every flag of the command being run that wasn't
+// given on the command line from its KSAU_* environment variable, if set.
+func applyEnvOverrides() {
+	cmd, _, err := rootCmd.Find(os.Args[1:])
+	if err != nil || cmd == nil {
+		return
+	}
+
+	var failed []string
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if flag.Changed || flag.Name == "help" {
+			return
+		}
+		value, ok := os.LookupEnv(flagEnvName(flag.Name))
+		if !ok {
+			return
+		}
+		if err := cmd.Flags().Set(flag.Name, value); err != nil {
+			failed = append(failed, fmt.Sprintf("%s=%q: %v", flagEnvName(flag.Name), value, err))
+		}
+	})
+
+	if len(failed) > 0 {
+		fmt.Println("invalid environment variable(s):")
+		for _, failure := range failed {
+			fmt.Println(" ", failure)
+		}
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/global-index-source/ksau-go/azure"
+	"github.com/global-index-source/ksau-go/redact"
+	"golang.org/x/sync/errgroup"
+)
+
+// maxFanOut limits how many remotes are queried at the same time.
+const maxFanOut = 8
+
+// remoteResult is the outcome of running an operation against one remote.
+type remoteResult[T any] struct {
+	remote string
+	value  T
+	err    error
+}
+
+// fanOut runs fn for every remote concurrently and collects one result per
+// remote, in the order of remotes. A failing remote doesn't cancel the
+// others, every failure is kept in its result instead.
+func fanOut[T any](remotes []string, fn func(remote string) (T, error)) []remoteResult[T] {
+	results := make([]remoteResult[T], len(remotes))
+
+	var group errgroup.Group
+	group.SetLimit(maxFanOut)
+	for i, remote := range remotes {
+		group.Go(func() error {
+			value, err := callRecovered(fn, remote)
+			results[i] = remoteResult[T]{remote: remote, value: value, err: err}
+			return nil
+		})
+	}
+	group.Wait()
+
+	return results
+}
+
+// callRecovered calls fn, turning a panic into an error for that remote so it
+// can't take down the other remotes.
+func callRecovered[T any](fn func(remote string) (T, error), remote string) (value T, err error) {
+	defer azure.RecoverPanic(&err)
+	return fn(remote)
+}
+
+// reportFailures prints a summary of the remotes that failed and returns the
+// exit status for the command: 0 if every remote succeeded, 1 otherwise.
+func reportFailures[T any](results []remoteResult[T]) int {
+	failed := 0
+	for _, result := range results {
+		if result.err != nil {
+			failed++
+		}
+	}
+	if failed == 0 {
+		return 0
+	}
+
+	fmt.Printf("%s%d of %d remote(s) failed:%s\n", ColorRed, failed, len(results), ColorReset)
+	for _, result := range results {
+		if result.err != nil {
+			fmt.Printf("  %s: %s\n", result.remote, redact.Error(result.err))
+		}
+	}
+	return 1
+}
@@ -0,0 +1,256 @@
+package cmd
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/global-index-source/ksau-go/azure"
+	"github.com/global-index-source/ksau-go/cmd/queue"
+	"github.com/global-index-source/ksau-go/redact"
+	"github.com/global-index-source/ksau-go/rpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcWatchInterval is how often streamed jobs are checked for changes.
+const grpcWatchInterval = 500 * time.Millisecond
+
+// grpcServer implements the Ksau gRPC service on top of the daemon.
+type grpcServer struct {
+	rpc.UnimplementedKsauServer
+	daemon *daemon
+}
+
+// newGRPCServer returns a gRPC server for the daemon, rejecting calls
+// without the bearer token.
+func newGRPCServer(d *daemon, token string) *grpc.Server {
+	checkToken := func(ctx context.Context) error {
+		md, _ := metadata.FromIncomingContext(ctx)
+		for _, value := range md.Get("authorization") {
+			sent, ok := strings.CutPrefix(value, "Bearer ")
+			if ok && subtle.ConstantTimeCompare([]byte(sent), []byte(token)) == 1 {
+				return nil
+			}
+		}
+		return status.Error(codes.Unauthenticated, "missing or wrong bearer token")
+	}
+
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := checkToken(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := checkToken(stream.Context()); err != nil {
+				return err
+			}
+			return handler(srv, stream)
+		}),
+	)
+	rpc.RegisterKsauServer(server, &grpcServer{daemon: d})
+	return server
+}
+
+func (s *grpcServer) SubmitJob(ctx context.Context, req *rpc.SubmitJobRequest) (*rpc.Job, error) {
+	job, err := s.submit(req)
+	if err != nil {
+		return nil, err
+	}
+	return jobToProto(job), nil
+}
+
+func (s *grpcServer) Upload(req *rpc.SubmitJobRequest, stream grpc.ServerStreamingServer[rpc.Job]) error {
+	job, err := s.submit(req)
+	if err != nil {
+		return err
+	}
+	return s.watch(stream.Context(), job.ID, stream.Send)
+}
+
+func (s *grpcServer) WatchJob(req *rpc.GetJobRequest, stream grpc.ServerStreamingServer[rpc.Job]) error {
+	if _, ok := s.daemon.queue.Get(req.GetId()); !ok {
+		return status.Errorf(codes.NotFound, "no job %s", req.GetId())
+	}
+	return s.watch(stream.Context(), req.GetId(), stream.Send)
+}
+
+func (s *grpcServer) GetJob(ctx context.Context, req *rpc.GetJobRequest) (*rpc.Job, error) {
+	job, ok := s.daemon.queue.Get(req.GetId())
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no job %s", req.GetId())
+	}
+	return jobToProto(job), nil
+}
+
+func (s *grpcServer) ListJobs(ctx context.Context, req *rpc.ListJobsRequest) (*rpc.ListJobsResponse, error) {
+	response := &rpc.ListJobsResponse{}
+	for _, job := range s.daemon.queue.List() {
+		response.Jobs = append(response.Jobs, jobToProto(job))
+	}
+	return response, nil
+}
+
+func (s *grpcServer) CancelJob(ctx context.Context, req *rpc.GetJobRequest) (*rpc.Job, error) {
+	job, err := s.daemon.cancel(req.GetId())
+	if err != nil {
+		return nil, jobError(err)
+	}
+	return jobToProto(job), nil
+}
+
+func (s *grpcServer) RetryJob(ctx context.Context, req *rpc.GetJobRequest) (*rpc.Job, error) {
+	job, err := s.daemon.retry(req.GetId())
+	if err != nil {
+		return nil, jobError(err)
+	}
+	return jobToProto(job), nil
+}
+
+func (s *grpcServer) ListRemotes(ctx context.Context, req *rpc.ListRemotesRequest) (*rpc.ListRemotesResponse, error) {
+	configData, err := getConfigData()
+	if err != nil {
+		return nil, grpcError(codes.Internal, err)
+	}
+	parsed, err := azure.ParseRcloneConfigData(configData)
+	if err != nil {
+		return nil, grpcError(codes.Internal, err)
+	}
+	return &rpc.ListRemotesResponse{Remotes: azure.GetAvailableRemotes(&parsed)}, nil
+}
+
+func (s *grpcServer) GetQuota(ctx context.Context, req *rpc.GetQuotaRequest) (*rpc.Quota, error) {
+	client, err := grpcClient(req.GetRemote())
+	if err != nil {
+		return nil, err
+	}
+	quota, err := client.GetDriveQuota(sharedHTTPClient())
+	if err != nil {
+		return nil, grpcError(codes.Unavailable, err)
+	}
+	return &rpc.Quota{Total: quota.Total, Used: quota.Used, Remaining: quota.Remaining, Deleted: quota.Deleted}, nil
+}
+
+func (s *grpcServer) ListFolder(req *rpc.ListFolderRequest, stream grpc.ServerStreamingServer[rpc.Item]) error {
+	client, err := grpcClient(req.GetRemote())
+	if err != nil {
+		return err
+	}
+	err = client.ListChildren(sharedHTTPClient(), path.Join(client.RemoteRootFolder, req.GetFolder()), func(item azure.DriveItem) error {
+		message := &rpc.Item{
+			Name:     item.Name,
+			Size:     item.Size,
+			Folder:   item.Folder != nil,
+			Modified: timestamppb.New(item.LastModifiedDateTime),
+		}
+		if item.File != nil {
+			message.QuickXorHash = item.File.Hashes.QuickXorHash
+		}
+		return stream.Send(message)
+	})
+	if errors.Is(err, azure.ErrItemNotFound) {
+		return grpcError(codes.NotFound, err)
+	}
+	if err != nil {
+		return grpcError(codes.Unavailable, err)
+	}
+	return nil
+}
+
+func (s *grpcServer) submit(req *rpc.SubmitJobRequest) (queue.Job, error) {
+	job, err := s.daemon.submit(queue.Job{
+		File:     req.GetFile(),
+		Remote:   req.GetRemote(),
+		Folder:   req.GetFolder(),
+		Name:     req.GetName(),
+		Priority: int(req.GetPriority()),
+	})
+	if err != nil {
+		return queue.Job{}, grpcError(codes.InvalidArgument, err)
+	}
+	return job, nil
+}
+
+// watch sends the job whenever it changed until it is done, failed for good
+// or canceled, or the client goes away.
+func (s *grpcServer) watch(ctx context.Context, id string, send func(*rpc.Job) error) error {
+	ticker := time.NewTicker(grpcWatchInterval)
+	defer ticker.Stop()
+
+	var last queue.Job
+	for {
+		job, ok := s.daemon.queue.Get(id)
+		if !ok {
+			return status.Errorf(codes.NotFound, "no job %s", id)
+		}
+		if job.Updated != last.Updated || job.Status != last.Status {
+			if err := send(jobToProto(job)); err != nil {
+				return err
+			}
+			last = job
+		}
+		if job.Status == queue.Done || job.Status == queue.Failed || job.Status == queue.Canceled {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// grpcClient returns a client for a remote of the config.
+func grpcClient(remote string) (*azure.AzureClient, error) {
+	configData, err := getConfigData()
+	if err != nil {
+		return nil, grpcError(codes.Internal, err)
+	}
+	client, err := azure.NewAzureClientFromRcloneConfigData(configData, remote)
+	if err != nil {
+		return nil, grpcError(codes.NotFound, err)
+	}
+	return client, nil
+}
+
+// jobError returns the error of a job operation as a gRPC status.
+func jobError(err error) error {
+	if errors.Is(err, queue.ErrNotFound) {
+		return grpcError(codes.NotFound, err)
+	}
+	return grpcError(codes.FailedPrecondition, err)
+}
+
+// grpcError returns err as a gRPC status with secrets removed.
+func grpcError(code codes.Code, err error) error {
+	return status.Error(code, redact.Error(err))
+}
+
+func jobToProto(job queue.Job) *rpc.Job {
+	return &rpc.Job{
+		Id:       job.ID,
+		File:     job.File,
+		Remote:   job.Remote,
+		Folder:   job.Folder,
+		Name:     job.Name,
+		Status:   string(job.Status),
+		Attempts: int32(job.Attempts),
+		Error:    job.Error,
+		Link:     job.Link,
+		Size:     job.Size,
+		Uploaded: job.Uploaded,
+		Created:  timestamppb.New(job.Created),
+		Updated:  timestamppb.New(job.Updated),
+		Priority: int32(job.Priority),
+		Schedule: job.Schedule,
+	}
+}
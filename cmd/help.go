@@ -32,20 +32,147 @@ func runHelp(cmd *cobra.Command, args []string) {
 		fmt.Println("    ksau-go upload -f large.zip -r /backup -s 8388608")
 		fmt.Println("    # Upload using different remote config")
 		fmt.Println("    ksau-go upload -f file.pdf -r /shared --remote-config saurajcf")
+		fmt.Println("    # Upload to the best remote of a group")
+		fmt.Println("    ksau-go upload -f file.pdf -r /shared -c group:public")
+
+		fmt.Println("\nls - List the contents of a remote folder")
+		fmt.Println("  Examples:")
+		fmt.Println("    ksau-go ls /Builds --remote-config oned")
+
+		fmt.Println("\nrm - Delete a remote file or folder")
+		fmt.Println("  Examples:")
+		fmt.Println("    ksau-go rm /Builds/old.zip --remote-config oned")
 
 		fmt.Println("\nquota - Display OneDrive quota information")
 		fmt.Println("  Examples:")
 		fmt.Println("    # Show quota for all remotes")
 		fmt.Println("    ksau-go quota")
-		fmt.Println("    # Show quota for specific remote")
-		fmt.Println("    ksau-go quota --remote-config oned")
+		fmt.Println("    # Show quota for specific remotes")
+		fmt.Println("    ksau-go quota -c oned -c saurajcf")
+
+		fmt.Println("\nlist-remotes - List the configured remotes")
+		fmt.Println("  Examples:")
+		fmt.Println("    # Names only")
+		fmt.Println("    ksau-go list-remotes")
+		fmt.Println("    # With drive type, root folder, base URL and space")
+		fmt.Println("    ksau-go list-remotes --detail")
+		fmt.Println("    # Machine readable, e.g. for monitoring")
+		fmt.Println("    ksau-go list-remotes --detail --output json")
+
+		fmt.Println("\ndoctor - Run health checks against the remotes")
+		fmt.Println("  Examples:")
+		fmt.Println("    # Check every remote")
+		fmt.Println("    ksau-go doctor")
+		fmt.Println("    # Check a single remote")
+		fmt.Println("    ksau-go doctor --remote-config oned")
+
+		fmt.Println("\ndownload - Download a file, decrypting files uploaded with --encrypt")
+		fmt.Println("  Examples:")
+		fmt.Println("    ksau-go download /Builds/rom.zip --remote-config oned")
+		fmt.Println("    ksau-go download /Private/notes.txt.age -i ~/.age/key.txt -c oned")
+
+		fmt.Println("\nbackup - Incrementally back up a directory, uploading only new and changed files")
+		fmt.Println("  Examples:")
+		fmt.Println("    ksau-go backup -d ~/Documents -r /Backups/documents --remote-config oned")
+
+		fmt.Println("\ncheck - Compare a local directory with a remote folder by size and hash")
+		fmt.Println("  Examples:")
+		fmt.Println("    ksau-go check -d ~/Documents -r /Backups/documents --remote-config oned")
+		fmt.Println("    ksau-go check -d ./release -r /Releases/v1.2 -o json -c oned")
+
+		fmt.Println("\nwatch - Upload files automatically as they appear in a directory")
+		fmt.Println("  Examples:")
+		fmt.Println("    ksau-go watch ./outbox -r /drops --remote-config oned")
+
+		fmt.Println("\ndaemon - Run uploads from a persistent job queue")
+		fmt.Println("  Examples:")
+		fmt.Println("    ksau-go daemon --concurrency 2")
+		fmt.Println("    ksau-go daemon submit build/*.zip -r /Builds --remote-config oned")
+		fmt.Println("    ksau-go daemon status")
+
+		fmt.Println("\njobs - List, cancel, retry and prune the jobs of the daemon")
+		fmt.Println("  Examples:")
+		fmt.Println("    ksau-go jobs list --status failed")
+		fmt.Println("    ksau-go jobs cancel 3fa2c1d0")
+		fmt.Println("    ksau-go jobs retry 3fa2c1d0")
+		fmt.Println("    ksau-go jobs prune --older-than 168h")
+
+		fmt.Println("\nserve - Serve a REST API to submit uploads and query remotes")
+		fmt.Println("  Examples:")
+		fmt.Println("    ksau-go serve --listen 127.0.0.1:8090")
+		fmt.Println("    ksau-go serve --listen \"\" --grpc-listen 127.0.0.1:8091")
+
+		fmt.Println("\nselftest - Upload, verify, share and delete a tiny file on a remote")
+		fmt.Println("  Examples:")
+		fmt.Println("    ksau-go selftest --remote-config oned")
+
+		fmt.Println("\nbench - Measure the throughput of the remotes and recommend settings")
+		fmt.Println("  Examples:")
+		fmt.Println("    # Benchmark every remote with a 20 MiB test file")
+		fmt.Println("    ksau-go bench")
+		fmt.Println("    # Compare three chunk sizes on one remote")
+		fmt.Println("    ksau-go bench -c oned --size 104857600 --chunk-sizes 5242880,10485760,20971520")
+
+		fmt.Println("\nstats - Show transfer statistics from the upload history")
+		fmt.Println("  Examples:")
+		fmt.Println("    # Bytes uploaded per remote during the last week")
+		fmt.Println("    ksau-go stats --per-remote --since 7d")
+
+		fmt.Println("\nhistory - Show past uploads and their download links")
+		fmt.Println("  Examples:")
+		fmt.Println("    # Recover the link of an earlier upload")
+		fmt.Println("    ksau-go history --search report.pdf")
+
+		fmt.Println("\nrelink - Print the download link of an earlier upload again")
+		fmt.Println("  Examples:")
+		fmt.Println("    ksau-go relink /Builds/rom.zip -c oned")
+		fmt.Println("    # Newest upload from the history matching the search, with a sharing link")
+		fmt.Println("    ksau-go relink --history rom.zip --share")
+
+		fmt.Println("\nlogin - Log in to a OneDrive account and save it as a new remote")
+		fmt.Println("  Examples:")
+		fmt.Println("    ksau-go login --name myremote")
+
+		fmt.Println("\nconfig - Manage the remotes in the local configuration")
+		fmt.Println("  Examples:")
+		fmt.Println("    # Log in to your own OneDrive and add it as a remote")
+		fmt.Println("    ksau-go config add-remote mydrive --root-folder /ksau")
 
 		fmt.Println("\nversion - Show version information")
 		fmt.Println("  Example:")
 		fmt.Println("    ksau-go version")
 
 		fmt.Println("\nGlobal Flags:")
-		fmt.Println("  --remote-config  Name of the remote configuration (default: oned)")
+		fmt.Println("  --config         Path of the config file; KSAU_CONFIG sets it too. State files such as")
+		fmt.Println("                   caches are kept next to it, so separate configs don't share them")
+		fmt.Println("  --connect-timeout")
+		fmt.Println("                   Maximum time for connecting, including TLS (default: 30s)")
+		fmt.Println("  --debug          Log debug diagnostics to stderr, even more than --verbose")
+		fmt.Println("  --debug-http     Log every HTTP request with status and latency to stderr, or to")
+		fmt.Println("                   a file with --debug-http=<path>; --debug-http-headers adds the")
+		fmt.Println("                   (redacted) headers, --debug-http-unredacted turns redaction off")
+		fmt.Println("  --dry-run        Print what upload, backup, watch, rm, daemon submit and jobs would")
+		fmt.Println("                   upload, create or delete, with sizes and destinations, without")
+		fmt.Println("                   changing anything; remote data is still read")
+		fmt.Println("  --log-file       Also write the log, with timestamps and levels, to this file; it is")
+		fmt.Println("                   rotated at --log-file-max-size bytes (default: 10 MiB), keeping 3 old files")
+		fmt.Println("  --max-conns-per-host")
+		fmt.Println("                   Maximum number of connections per server (default: no limit)")
+		fmt.Println("  --no-cache       Don't use cached remote data such as folder listings")
+		fmt.Println("  --offline        Fail network commands immediately (exit status 4); this also")
+		fmt.Println("                   happens automatically when Microsoft Graph is unreachable")
+		fmt.Println("  --pprof          Serve profiling endpoints (/debug/pprof/) on this address")
+		fmt.Println("  --proxy          Proxy for all requests, http(s):// or socks5:// (default: $HTTPS_PROXY)")
+		fmt.Println("  --remote-config  Name of the remote configuration, or group:<name> (default: automatic)")
+		fmt.Println("  --response-timeout")
+		fmt.Println("                   Maximum time to wait for the server to respond (default: 2m0s)")
+		fmt.Println("  -v, --verbose    Log additional status information to stderr, e.g. upload sessions and")
+		fmt.Println("                   background quota refreshes; only warnings are logged by default")
+
+		fmt.Println("\nEnvironment:")
+		fmt.Println("  Every flag can also be set with a KSAU_ variable named after it, e.g.")
+		fmt.Println("  KSAU_REMOTE_CONFIG=oned or KSAU_CHUNK_SIZE=10485760. Flags given on the")
+		fmt.Println("  command line take precedence.")
 	} else {
 		fmt.Printf("Help for '%s' command:\n", args[0])
 		switch args[0] {
@@ -57,8 +184,40 @@ func runHelp(cmd *cobra.Command, args []string) {
 			printVersionHelp()
 		case "refresh":
 			printRefreshHelp()
-		case "list-remote":
+		case "list-remote", "list-remotes":
 			printListRemoteHelp()
+		case "stats":
+			printStatsHelp()
+		case "doctor":
+			printDoctorHelp()
+		case "config":
+			printConfigHelp()
+		case "rm":
+			printRmHelp()
+		case "login":
+			printLoginHelp()
+		case "history":
+			printHistoryHelp()
+		case "relink":
+			printRelinkHelp()
+		case "bench":
+			printBenchHelp()
+		case "selftest":
+			printSelftestHelp()
+		case "backup":
+			printBackupHelp()
+		case "download":
+			printDownloadHelp()
+		case "check":
+			printCheckHelp()
+		case "watch":
+			printWatchHelp()
+		case "daemon":
+			printDaemonHelp()
+		case "serve":
+			printServeHelp()
+		case "jobs":
+			printJobsHelp()
 		default:
 			fmt.Printf("Unknown command: %s\n", args[0])
 		}
@@ -73,6 +232,7 @@ Upload files to OneDrive with support for chunked uploads and integrity verifica
 
 Usage:
   ksau-go upload -f <file> -r <remote-path> [flags]
+  ksau-go upload --legacy-args <file> <remote-path> [flags]
 
 Required Flags:
   -f, --file          Path to the local file to upload
@@ -80,12 +240,84 @@ Required Flags:
 
 Optional Flags:
   -n, --remote-name     Custom name for the uploaded file
+      --name-strategy   Remote naming: keep, random, hash, uuid, datetime (default: keep);
+                        extensions like .tar.gz are kept whole, hash names
+                        archives and compressed uploads after the uploaded
+                        content and isn't allowed with --encrypt
+      --conflict        If the remote file exists: replace, rename or fail
+                        (default: the remote's conflict_behavior, or replace)
+      --no-skip-same    Upload even if an identical file (same size and hash)
+                        already exists at the target path
+      --if-newer        Only upload over an existing remote file if the local
+                        file was modified after its last upload
+      --archive         Upload the directory given with -f as a zip or tar
+                        archive created on the fly, without a temporary file;
+                        -n is then a name template with {name}, {date}, {time}
+                        and {ext} (default: {name}-{date}-{time}.{ext})
+      --exclude         With --archive, leave out files and directories
+                        matching this gitignore style pattern (repeatable);
+                        .ksauignore files in the directory are followed too
+      --include         With --archive, keep files matching this pattern even
+                        if .ksauignore or --exclude skip them (repeatable)
+      --min-size        With --archive, leave out files smaller than this
+      --max-size        With --archive, leave out files larger than this
+      --min-age         With --archive, leave out files modified more
+                        recently than this
+      --max-age         With --archive, leave out files modified longer ago
+                        than this
+      --compress        Compress the upload on the fly with gzip or zstd and
+                        add .gz or .zst to the remote name
+      --encrypt         Encrypt the upload on the fly with age and add .age to
+                        the remote name; the passphrase is asked for or read
+                        from KSAU_ENCRYPT_PASSPHRASE
+      --encrypt-to      Encrypt for age public keys (age1...) or recipients
+                        files instead of a passphrase (repeatable)
+      --split-size      Split files larger than this many bytes into
+                        <name>.partNNN volumes plus a <name>.parts.json
+                        manifest (default: only above the 250 GB Graph limit)
   -s, --chunk-size      Size of upload chunks in bytes (default: automatic)
+      --buffer-limit    Maximum bytes of chunk data kept in memory (default: no limit)
   -p, --parallel        Number of parallel upload chunks (default: 1)
       --retries         Maximum upload retry attempts (default: 3)
-      --retry-delay     Delay between retries (default: 5s)
+      --retry-delay     Initial delay between retries (default: 5s)
+      --retry-max-delay Maximum delay between retries (default: 1m0s)
+      --retry-multiplier
+                        Growth factor of the retry delay (default: 2)
+      --stall-timeout   Abort and retry a chunk that sent no data for this long (default: 1m0s)
+      --chunk-timeout   Abort and retry a chunk that takes longer in total (default: no limit)
+      --timeout         Total time budget for the upload (default: no limit)
+      --progress-json   Also write progress as JSON lines to a file ('-' for stderr)
+      --progress-listen Serve progress over HTTP (/progress JSON, /metrics Prometheus)
       --skip-hash       Skip file integrity verification
       --hash-retries    Maximum hash verification retries (default: 5)
+      --strategy        Remote selection: most-free, random, round-robin, fastest,
+                        auto (default: the selection_strategy key of notify.conf,
+                        or most-free)
+      --selection-cache-ttl
+                        Reuse remote quota checks for this long (default: 10m0s)
+      --copies          Upload the file to this many remotes (default: 1)
+      --sequential      Upload copies one after another instead of concurrently
+      --no-fallback     Don't switch to another remote when the selected one is full
+      --failover        Retry the whole upload on the next remote after repeated failures
+      --annotate        Upload a notes file (e.g. changelog.md) next to the file as
+                        <file>.notes.md and link it in the summary
+      --sign-key        PGP private key file; publishes <file>.manifest.json (name,
+                        size, hash, URL) and its signature <file>.manifest.json.asc
+                        next to the file (passphrase from KSAU_SIGN_PASSPHRASE)
+      --nick            Uploader name for the receipts log of shared remotes
+                        (default: your user name)
+      --no-receipt      Don't append to the remote's receipts log
+      --no-telegram     Don't send the link to the Telegram chat of notify.conf
+      --sink            Also report the result to a plugin: a path, or a name
+                        run as the ksau-sink-<name> executable from the PATH
+                        (repeatable, added to the sinks key of notify.conf); the
+                        plugin gets the --webhook JSON on stdin and the event
+                        in KSAU_EVENT, a non-zero exit status is a warning
+      --webhook         POST a JSON summary (file, size, link, hash status,
+                        duration, error) to this URL when the upload finishes
+                        or fails (default: the webhook key of notify.conf)
+      --legacy-args     Accept the old ksau "upload <file> <folder>" form
+                        (also enabled by KSAU_LEGACY_ARGS=1)
 
 Examples:
   # Basic file upload
@@ -95,7 +327,22 @@ Examples:
   ksau-go upload -f local.txt -r /Backup -n remote.txt
 
   # Upload large file with custom chunk size
-  ksau-go upload -f large.iso -r /ISOs -s 16777216 -p 4`)
+  ksau-go upload -f large.iso -r /ISOs -s 16777216 -p 4
+
+  # Snapshot a directory as project-<date>-<time>.zip
+  ksau-go upload --archive zip -f ./project -r /snapshots
+
+  # Compress a disk image while uploading it as disk.img.zst
+  ksau-go upload --compress zstd -f disk.img -r /Images
+
+  # Tell a CI pipeline about the result
+  ksau-go upload -f rom.zip -r /Builds --webhook https://ci.example.com/hooks/ksau
+
+  # Announce the link through ksau-sink-discord from the PATH
+  ksau-go upload -f rom.zip -r /Builds --sink discord
+
+  # Old ksau argument order
+  KSAU_LEGACY_ARGS=1 ksau-go upload build.zip /Builds`)
 }
 
 func printQuotaHelp() {
@@ -107,16 +354,33 @@ Display storage quota information for OneDrive remotes.
 Usage:
   ksau-go quota [flags]
 
-The quota command will display:
+Optional Flags:
+  -c, --remote-config  Only show these remotes, repeatable or comma separated
+                       (default: all remotes)
+      --warn           Highlight remotes whose usage is at or above this
+                       percentage and exit with status 3 (failures still
+                       exit with status 1)
+      --sort           Sort remotes by "free" space or by "usage", most first
+                       (default: config order)
+      --cached         Print the last stored quota instantly, without network
+                       calls, with the age of each row
+      --max-age        Refresh remotes whose stored quota is older than this
+                       (e.g. 30m, 1d), implies --cached
+
+The quota command displays one table with a row per configured remote
+(oned, saurajcf, etc.) and the columns:
 - Total space
 - Used space
-- Available space
+- Free space
+- Trashed space
 - Usage percentage
 
-For each configured remote (oned, saurajcf, etc.)
-
 Example:
-  ksau-go quota`)
+  ksau-go quota
+  ksau-go quota --warn 90
+  ksau-go quota --sort free
+  ksau-go quota -c oned,saurajcf
+  ksau-go quota --cached --max-age 1h`)
 }
 
 func printVersionHelp() {
@@ -148,10 +412,26 @@ Usage:
   
 Optional Flags:
   -u, --url     Custom URL to fetch the configuration file (must be direct).
+                Repeat it to fall back to further URLs in order.
+  --verify-key  Public key file (PGP or minisign) the configuration must be signed
+                with, instead of the built-in key
+  --sig-url     URL of the detached signature (default: the configuration URL plus
+                .minisig, or .sig for PGP keys)
+  --no-verify   Don't verify the signature
+  --force       Fetch the configuration even if the server reports it unchanged
 
 Note:
   The configuration file is encrypted and stored in common config path for your OS.
-  It is decrypted in memory, so there is no point trying to read it yourself.`)
+  It is decrypted in memory, so there is no point trying to read it yourself.
+  Without --url, the URLs listed in refresh-urls.txt next to the configuration
+  (one per line, e.g. the gist and its mirrors) are tried in order, falling
+  back to the next one whenever a source fails.
+  Unchanged configurations (same ETag or Last-Modified) aren't downloaded again.
+  The fetched configuration must decrypt and contain at least one usable remote,
+  otherwise the current one is kept. The previous configuration is saved as
+  rclone.conf.bak next to it.
+  Builds with a built-in key (and refreshes with --verify-key) refuse to write a
+  configuration whose detached signature is missing or doesn't match.`)
 }
 
 func printListRemoteHelp() {
@@ -161,9 +441,665 @@ List Remote Command
 List available remotes from the configuration file.
 
 Usage:
-  ksau-go list-remote
+  ksau-go list-remotes [flags]
+
+Optional Flags:
+      --detail   Also show drive type, root folder, base URL and total/used/free
+                 space of every remote (queried concurrently, needs network)
+  -o, --output   Output format: table, json or csv (default: table)
 
 Note:
   This command will list all available remotes from the configuration file.
   If the command fails, run refresh.`)
 }
+
+func printStatsHelp() {
+	fmt.Println(`
+Stats Command
+-------------
+Summarize the transfers recorded in the local upload history: bytes
+uploaded, failure rate and average speed.
+
+Usage:
+  ksau-go stats [flags]
+
+Optional Flags:
+      --since       Only count transfers newer than this (e.g. 12h, 7d, 2w)
+      --per-remote  Break down the totals per remote
+      --daily       Break down the totals per day
+      --json        Print the statistics, including failure rates and average
+                    speeds in bytes per second, as JSON
+
+Example:
+  ksau-go stats --per-remote --since 7d`)
+}
+
+func printDoctorHelp() {
+	fmt.Println(`
+Doctor Command
+--------------
+Run health checks against the configured remotes.
+
+Usage:
+  ksau-go doctor [--remote-config <remote>]
+
+Checks:
+- Clock skew against the Microsoft Graph servers
+- Token validity (refreshing it if needed)
+- Drive access
+- Root folder existence
+- Write permission (creates and deletes a tiny test file)
+
+Exits with status 1 if any check fails.`)
+}
+
+func printConfigHelp() {
+	fmt.Println(`
+Config Command
+--------------
+Manage the remotes in the local, encrypted configuration.
+
+Usage:
+  ksau-go config <subcommand> [flags]
+
+Subcommands:
+  add-remote <name>   Log in with the Microsoft device code flow, pick a drive
+                      and add it as a new remote
+      --client-id     Application (client) ID to log in with (default: rclone's)
+      --client-secret Application secret, for confidential clients
+      --tenant        Tenant ID or domain, required for single-tenant applications
+      --region        National cloud of the account: us, dod, de or cn
+      --root-folder   Folder uploads of this remote go into
+      --base-url      Base URL download links are built from
+      --site          SharePoint site URL to pick a document library of
+      --library       Document library of --site, by name
+  import <rclone.conf> --remote <name>
+                      Import a onedrive remote from a plaintext rclone config
+      --as            Name of the imported remote (default: same as --remote)
+      --client-secret Application secret, for remotes without client_secret
+      --root-folder   Folder uploads of this remote go into
+      --base-url      Base URL download links are built from
+  export [remote...]  Print remotes (default: all) as a plaintext rclone config,
+                      after confirming, since it contains secrets
+  -o, --output        Write to this file instead of stdout
+      --yes           Don't ask for confirmation
+  validate            Check every remote for missing or malformed fields
+                      (exits with status 1 on errors) and save the drive_id of
+                      remotes with only a sharepoint_site
+  remove-remote <name>
+                      Remove a remote
+  rename-remote <name> <new-name>
+                      Rename a remote
+  keyring <name>      Move the tokens of a remote into the OS keyring, refreshed
+                      tokens are then saved there too
+      --disable       Move the tokens back into the configuration
+  passphrase          Encrypt the configuration with your own passphrase instead
+                      of the shipped key (asked for, or from KSAU_CONFIG_PASSPHRASE)
+      --remove        Encrypt it with the shipped key again
+      --backend       Encryption format: pgp or age (default: the current one)
+  rotate-key          Re-encrypt the configuration with a new passphrase (or the
+                      current shipped key), verified and swapped in atomically
+      --key           Shipped key to encrypt with
+      --passphrase    Switch to a new passphrase
+      --backend       Encryption format for the new passphrase
+
+Every change first backs up the previous configuration to rclone.conf.bak
+next to the configuration file.
+
+Note:
+  'ksau-go refresh' replaces the local configuration with the community one,
+  dropping remotes added with these commands.
+
+Examples:
+  ksau-go config add-remote mydrive --root-folder /ksau
+  ksau-go config import ~/.config/rclone/rclone.conf --remote myod
+  ksau-go config validate
+  ksau-go config export oned -o oned.conf
+  ksau-go config rename-remote mydrive personal
+  ksau-go config keyring personal
+  ksau-go config passphrase
+  ksau-go config passphrase --backend age
+  ksau-go config rotate-key
+  ksau-go config remove-remote personal`)
+}
+
+func printRmHelp() {
+	fmt.Println(`
+Rm Command
+----------
+Delete a remote file or folder. Deleted items go to the drive's recycle bin.
+
+Usage:
+  ksau-go rm <path> --remote-config <remote> [flags]
+
+Optional Flags:
+      --allow-protected  Allow deleting paths listed in the remote's
+                         protected_paths (and folders containing them)
+
+Example:
+  ksau-go rm /Builds/old.zip -c oned`)
+}
+
+func printLoginHelp() {
+	fmt.Println(`
+Login Command
+-------------
+Log in with the Microsoft device code flow and save the account as a new
+remote. Open the shown page on any device and enter the code; if the account
+has several drives, you are asked to pick one.
+
+Usage:
+  ksau-go login --name <remote> [flags]
+
+Required Flags:
+      --name          Name of the new remote
+
+Optional Flags:
+      --client-id     Application (client) ID to log in with (default: rclone's)
+      --client-secret Application secret, for confidential clients
+      --tenant        Tenant ID or domain, required for single-tenant applications
+      --region        National cloud of the account: us, dod, de or cn
+      --root-folder   Folder uploads of this remote go into
+      --base-url      Base URL download links are built from
+      --site          SharePoint site URL, e.g.
+                      https://contoso.sharepoint.com/sites/Team; the remote is
+                      then one of its document libraries instead of a OneDrive
+      --library       Document library of --site, by name as shown in the
+                      browser (default: ask, or the only one)
+
+Remotes can also name their site in the config instead of a drive_id, with a
+sharepoint_site key and optionally a sharepoint_library key (default: the
+site's default library); the drive is looked up when the remote is used, or
+once by 'ksau-go config validate', which saves its drive_id.
+
+Example:
+  ksau-go login --name myremote --root-folder /ksau
+  ksau-go login --name team --site https://contoso.sharepoint.com/sites/Team --library Releases`)
+}
+
+func printHistoryHelp() {
+	fmt.Println(`
+History Command
+---------------
+List the uploads recorded in the local history, newest first, with their
+remote path, QuickXorHash and download link.
+
+Usage:
+  ksau-go history [flags]
+
+Optional Flags:
+  -s, --search    Only show uploads whose local path, remote path or link
+                  contains this (case-insensitive)
+      --remote    Only show uploads to this remote
+      --since     Only show uploads newer than this (e.g. 12h, 7d, 2w)
+  -l, --limit     Show at most this many uploads (default: 20, 0 for all)
+      --failed    Also show failed upload attempts
+
+Example:
+  ksau-go history --search report.pdf --since 30d`)
+}
+
+func printRelinkHelp() {
+	fmt.Println(`
+Relink Command
+--------------
+Print the index download URL of an earlier upload again, e.g. after the
+remote's base_url changed. The file is given by its path relative to the
+remote's root folder, or with --history by a search in the upload history.
+
+Usage:
+  ksau-go relink <remote-path> --remote-config <remote> [flags]
+  ksau-go relink --history <search> [flags]
+
+Optional Flags:
+      --history      Take the newest upload from the history whose local path,
+                     remote path or link contains the search
+      --share        Also create a Microsoft Graph sharing link
+      --share-scope  Who the sharing link works for: anonymous (default) or
+                     organization
+
+Examples:
+  ksau-go relink /Builds/rom.zip -c oned
+  ksau-go relink --history rom.zip --share`)
+}
+
+func printBenchHelp() {
+	fmt.Println(`
+Bench Command
+-------------
+Measure the latency and upload throughput of the remotes. A file of random
+data is uploaded once per chunk size and then several times at once, and
+deleted again after every upload. Ends with a recommended --chunk-size per
+remote and whether concurrent uploads pay off.
+
+Usage:
+  ksau-go bench [flags]
+
+Optional Flags:
+  -c, --remote-config  Only benchmark these remotes (repeatable or comma
+                       separated, default: all)
+      --size           Size of the test file in bytes (default: 20971520)
+      --chunk-sizes    Chunk sizes to compare, in bytes, each a multiple of
+                       327680 (default: 5242880,10485760)
+      --streams        Number of concurrent uploads to compare against a
+                       single one (default: 2, 1 to skip)
+
+Example:
+  ksau-go bench -c oned --chunk-sizes 5242880,10485760,20971520`)
+}
+
+func printSelftestHelp() {
+	fmt.Println(`
+Selftest Command
+----------------
+Check end to end that a remote works: each step is reported with its
+duration as soon as it finishes.
+
+Usage:
+  ksau-go selftest --remote-config <remote> [flags]
+
+Steps:
+- Token validity (refreshing it if needed)
+- Upload of a 4 KiB file of random data
+- QuickXorHash verification
+- Metadata fetch (name and size)
+- Sharing link creation
+- Deletion of the test file
+
+Optional Flags:
+      --share-scope  Who the test sharing link works for: anonymous (default)
+                     or organization
+
+Exits with status 1 if any step fails.`)
+}
+
+func printBackupHelp() {
+	fmt.Println(`
+Backup Command
+--------------
+Upload the files of a local directory below a remote folder, transferring
+only files that are new or changed since the last backup. The path, size,
+modification time and QuickXorHash of every uploaded file are kept in a
+manifest next to the config, which is also uploaded as .ksau-backup.json into
+the remote folder. Files that were only touched are hashed and skipped if
+their content is unchanged.
+
+Usage:
+  ksau-go backup -d <dir> -r <remote-folder> --remote-config <remote> [flags]
+
+Required Flags:
+  -d, --dir      Local directory to back up
+  -r, --remote   Remote folder to back up into
+
+Optional Flags:
+      --retries    Maximum upload retry attempts per file (default: 3)
+      --transfers  Number of files uploaded at the same time (default: 4)
+      --exclude    Skip files and directories matching this gitignore style
+                   pattern (repeatable)
+      --include    Don't skip files matching this pattern, even if
+                   .ksauignore or --exclude do (repeatable)
+      --min-size   Skip files smaller than this
+      --max-size   Skip files larger than this
+      --min-age    Skip files modified more recently than this
+      --max-age    Skip files modified longer ago than this
+      --checksums  Also upload a checksum manifest of all backed up files:
+                   sha256 as SHA256SUMS or quickxor as QUICKXORSUMS, one
+                   "<hash>  <path>" line per file
+  -o, --output     Output format: table, or json or csv for the change plan
+                   (default: table)
+      --name-strategy
+                   Name uploaded files like upload does: keep, random, hash,
+                   uuid, datetime (default: keep); the manifest and the
+                   checksums list the remote names
+      --nick       Uploader name for the receipts log of shared remotes
+                   (default: your user name)
+      --no-receipt Don't append to the remote's receipts log
+
+A SHA256SUMS manifest lets anyone check a downloaded copy of the folder with
+"sha256sum -c SHA256SUMS".
+
+A .ksauignore file in the directory or any subdirectory lists patterns of
+files to skip, in the syntax of .gitignore: one pattern per line, # starts a
+comment, ! includes matching files again, a trailing / only matches
+directories and ** any number of directories. Patterns with a slash are
+relative to the .ksauignore file, others match names at any depth:
+
+  node_modules/
+  *.o
+  /build
+  !important.log
+
+As with rclone, sizes are in KiB unless they have a B, K, M, G, T or P suffix
+(e.g. 500M, 1.5G), and ages are durations (90m, 12h, 7d, 2w) or dates
+(2006-01-02, 2006-01-02 15:04:05). The size and age filters only apply to
+files, never to directories.
+
+A remote's max_transfers key caps the files uploaded to it at the same time,
+whatever --transfers says.
+
+With --output json or csv, the change plan of the run is printed on stdout
+and the usual messages go to stderr: every file with its action (upload,
+skip or failed), the reason (new, changed, unchanged or same content), its
+size and remote path, plus the checksum and backup manifests it uploaded.
+With --dry-run it is the plan of what the run would do.
+
+Exits with status 1 if any file failed to upload; the manifest still records
+the files that succeeded, so running it again only uploads the rest.
+
+Example:
+  ksau-go backup -d ~/Documents -r /Backups/documents -c oned
+  ksau-go backup -d ./release -r /Releases/v1.2 --checksums sha256 -c oned
+  ksau-go backup -d ./index -r /Public -c oned --output json > changes.json`)
+}
+
+func printDownloadHelp() {
+	fmt.Println(`
+Download Command
+----------------
+Download a file, given by its path relative to the remote's root folder. The
+data is written to <file>.part first and renamed when complete, after checking
+it against the remote QuickXorHash. An interrupted download is resumed with
+Range requests when run again, unless the remote file changed in the meantime
+(<file>.part.json records which file it belongs to); dropped connections are
+resumed right away.
+
+Large files are split into ranges downloaded over several connections at once
+and written straight to their place in the file, which is much faster from
+OneDrive's CDN than a single connection.
+
+Files ending in .age (uploaded with --encrypt) are decrypted once downloaded
+and saved without the suffix, with the passphrase from KSAU_ENCRYPT_PASSPHRASE
+(asked for otherwise) or the age keys given with --identity.
+
+Files uploaded in volumes (--split-size) are joined again from their
+<file>.parts.json manifest, given directly or found next to the missing file,
+and checked against the sizes and hashes it lists.
+
+Usage:
+  ksau-go download <remote-path> --remote-config <remote> [flags]
+
+Optional Flags:
+  -o, --output     Local file or directory to save to (default: the file's
+                   name in the current directory)
+  -i, --identity   age identity file to decrypt with (repeatable)
+      --connections
+                   Download files of at least 64 MiB in 32 MiB segments over
+                   this many connections at once (default: 4)
+      --retries    Maximum times a dropped connection is resumed in a row
+                   (default: 3)
+      --skip-hash  Don't verify the download against the remote QuickXorHash
+      --raw        Keep encrypted files encrypted and download volume
+                   manifests as they are
+
+Exits with status 3 if the downloaded file doesn't match the remote
+QuickXorHash (the corrupt data is removed), and 1 on any other failure.
+
+Example:
+  ksau-go download /Private/notes.txt.age -i ~/.age/key.txt -c oned
+  ksau-go download /Images/disk.img -c oned
+  ksau-go download /ISOs/distro.iso --connections 8 -c oned`)
+}
+
+func printCheckHelp() {
+	fmt.Println(`
+Check Command
+-------------
+Compare the files below a local directory with the files below a remote
+folder, like rclone check. Files are matched by their relative path and
+compared by size, then by QuickXorHash; local files are only hashed when the
+sizes match. Nothing is uploaded or downloaded.
+
+Every file is reported as one of:
+  differ   Size or hash differ
+  missing  Only exists locally
+  extra    Only exists on the remote
+
+Usage:
+  ksau-go check -d <dir> -r <remote-folder> --remote-config <remote> [flags]
+
+Required Flags:
+  -d, --dir        Local directory to compare
+  -r, --remote     Remote folder to compare with
+
+Optional Flags:
+      --size-only  Only compare sizes, without hashing the local files
+  -o, --output     Output format: table, json or csv (default: table)
+      --all        Also list matching files (status "match")
+      --exclude    Skip files matching this gitignore style pattern, locally
+                   and on the remote (repeatable)
+      --include    Don't skip files matching this pattern (repeatable)
+      --min-size   Skip files smaller than this
+      --max-size   Skip files larger than this
+      --min-age    Skip files modified more recently than this
+      --max-age    Skip files modified longer ago than this
+
+Like backup, check follows the .ksauignore files in the directory. The size
+and age filters apply to the remote files too, whose age is the time of their
+last upload.
+
+Exits with status 1 if any file differs or exists on one side only.
+
+Example:
+  ksau-go check -d ~/Documents -r /Backups/documents -c oned
+  ksau-go check -d ./release -r /Releases/v1.2 -o csv -c oned > report.csv`)
+}
+
+func printWatchHelp() {
+	fmt.Println(`
+Watch Command
+-------------
+Watch a local directory and its subdirectories and upload every file that
+is created or modified into the remote folder, keeping its path below the
+directory. A file is uploaded once it wasn't written to for --debounce, so a
+file that is still being copied in isn't uploaded half done; files identical
+to the remote copy are skipped. Each link is printed and logged (see
+--log-file). Hidden files and directories and temporary files (.part, .tmp,
+.swp, .crdownload, ~) are ignored. Runs until interrupted with Ctrl+C.
+
+Usage:
+  ksau-go watch <dir> -r <remote-folder> --remote-config <remote> [flags]
+
+Required Flags:
+  -r, --remote    Remote folder to upload into
+
+Optional Flags:
+      --debounce  Upload a file once it wasn't written to for this long
+                  (default: 2s)
+      --existing  Also upload the files already in the directory at start
+      --retries   Maximum upload retry attempts per file (default: 3)
+      --transfers Number of files uploaded at the same time (default: 4)
+      --exclude   Skip files and directories matching this gitignore style
+                  pattern (repeatable)
+      --include   Don't skip files matching this pattern (repeatable)
+      --min-size  Skip files smaller than this
+      --max-size  Skip files larger than this
+      --min-age   Skip files modified more recently than this
+      --max-age   Skip files modified longer ago than this
+      --name-strategy
+                  Name uploaded files like upload does: keep, random, hash,
+                  uuid, datetime (default: keep)
+      --nick      Uploader name for the receipts log of shared remotes
+                  (default: your user name)
+      --no-receipt
+                  Don't append to the remote's receipts log
+
+The .ksauignore files of the directory are followed like with backup; those
+of directories created while watching are read when they appear.
+
+A remote's max_transfers key caps the files uploaded to it at the same time,
+whatever --transfers says.
+
+Uploads are reported to the webhook, Telegram chat and sinks of notify.conf,
+and recorded in the receipts log of the remote, like with upload.
+
+Example:
+  ksau-go watch ./outbox -r /drops -c oned
+  ksau-go watch ~/Screenshots -r /Screenshots --debounce 5s --log-file links.log -c oned`)
+}
+
+func printDaemonHelp() {
+	fmt.Println(`
+Daemon Command
+--------------
+Run ksau-go as a long-lived process executing upload jobs from a queue. Jobs
+are submitted through a local socket with "daemon submit" and uploaded
+--concurrency at a time; files identical to the remote copy are skipped. A
+failed job is retried after 30s, 1m, 2m, ... until it used up --max-attempts.
+The queue is saved to queue.json next to the config after every change, so
+queued jobs and jobs interrupted by a restart continue when the daemon starts
+again.
+
+Usage:
+  ksau-go daemon [flags]
+  ksau-go daemon submit <file>... -r <remote-folder> --remote-config <remote>
+  ksau-go daemon status
+
+Daemon Flags:
+      --concurrency   Number of jobs uploaded at the same time (default: 2)
+      --max-attempts  Give a job up after this many failed attempts (default: 3)
+      --retries       Maximum upload retry attempts per chunk (default: 3)
+      --socket        Socket to listen on or to reach the daemon at
+                      (default: daemon.sock next to the config)
+      --schedules     File with scheduled uploads
+                      (default: schedules.conf next to the config)
+      --keep-finished Number of done, failed and canceled jobs kept in the
+                      queue (default: 1000, 0 for no limit)
+      --keep-finished-for
+                      How long done, failed and canceled jobs are kept in the
+                      queue (default: 720h, 0 for no limit)
+      --nick          Uploader name for the receipts log of shared remotes
+                      (default: your user name)
+      --no-receipt    Don't append to the remote's receipts log
+
+Submit Flags:
+  -r, --remote        Remote folder to upload into (required)
+  -n, --remote-name   Remote file name, only with a single file
+      --name-strategy Name the remote files like upload does: keep, random,
+                      hash, uuid, datetime (default: keep)
+      --priority      Jobs with a higher priority are uploaded first (default: 0)
+
+Finished jobs are reported to the webhook, Telegram chat and sinks of
+notify.conf like uploads, failed ones once they used up --max-attempts.
+Uploaded jobs are recorded in the receipts log of their remote.
+
+Status lists every job with its status (queued, running, done, failed or
+canceled), progress, attempts and link or last error; "ksau-go jobs" also
+cancels and retries jobs.
+
+Scheduled uploads are sections of the schedules file, in the format of the
+rclone config. At the times of the cron spec (minute hour day month weekday,
+or @daily, @hourly, @every 6h, ...) every file matching the pattern is
+queued. A run is skipped while jobs of the previous run of the same schedule
+are still queued or running; failed jobs are retried like submitted ones.
+
+  [nightly-backups]
+  cron = 0 2 * * *
+  files = /var/backups/*.tar.gz
+  remote = oned
+  folder = /backups
+
+Example:
+  ksau-go daemon --concurrency 4 --log-file daemon.log
+  ksau-go daemon submit backup.tar.gz -r /Backups -c oned`)
+}
+
+func printServeHelp() {
+	fmt.Println(`
+Serve Command
+-------------
+Run the daemon (see "help daemon") and expose it over HTTP, so web frontends,
+bots and CI systems can drive ksau-go without shelling out. Jobs submitted
+over the API and with "daemon submit" share the same queue.
+
+Every request must send the token from KSAU_SERVE_TOKEN as
+"Authorization: Bearer <token>". If it isn't set, a random token is
+generated on every start and stored in serve.token next to the config, which
+is only allowed when listening on a loopback address. Requests with an
+Origin header, as browsers send them, are refused, as are POSTs whose body
+isn't "Content-Type: application/json" and, on loopback addresses, requests
+for a host other than localhost or a loopback IP.
+
+Endpoints:
+  POST /jobs                  Submit an upload of a file on this machine:
+                              {"file": "/abs/path", "remote": "oned",
+                               "folder": "/Builds", "name": "optional",
+                               "priority": 0}
+  GET  /jobs                  List all jobs
+  GET  /jobs/{id}             A job with its status, attempts, size,
+                              uploaded bytes, link or error
+  POST /jobs/{id}/cancel      Cancel a queued or running job
+  POST /jobs/{id}/retry       Queue a failed or canceled job again
+  GET  /remotes               Names of the configured remotes
+  GET  /remotes/{name}/quota  Total, used, remaining and deleted bytes
+
+Errors are answered as {"error": "..."} with a 4xx or 5xx status.
+
+With --grpc-listen the gRPC service defined in rpc/ksau.proto is served as
+well: SubmitJob, GetJob, ListJobs, CancelJob, RetryJob, ListRemotes,
+GetQuota, plus the streams Upload and WatchJob sending a job on every change
+until it is done, failed or canceled, and ListFolder sending the items of a
+folder. The token goes into
+the "authorization" metadata as "Bearer <token>".
+
+Usage:
+  ksau-go serve [flags]
+
+Optional Flags:
+      --listen        Address to serve the API on, "" for none (default: 127.0.0.1:8090)
+      --grpc-listen   Address to serve the gRPC API on (default: off)
+      --concurrency   Number of jobs uploaded at the same time (default: 2)
+      --max-attempts  Give a job up after this many failed attempts (default: 3)
+      --retries       Maximum upload retry attempts per chunk (default: 3)
+      --keep-finished, --keep-finished-for
+                      Retention of finished jobs, like with daemon
+      --nick, --no-receipt
+                      Receipts of uploaded jobs, like with daemon
+      --socket        Socket of the daemon (default: daemon.sock next to the config)
+
+Example:
+  ksau-go serve
+  curl -X POST localhost:8090/jobs -H "Authorization: Bearer $(cat ~/.config/ksau/serve.token)" \
+    -H "Content-Type: application/json" -d '{"file": "/srv/out/rom.zip", "remote": "oned", "folder": "/Builds"}'
+  curl -H "Authorization: Bearer $KSAU_SERVE_TOKEN" localhost:8090/jobs/3fa2c1d0
+  ksau-go serve --grpc-listen 127.0.0.1:8091`)
+}
+
+func printJobsHelp() {
+	fmt.Println(`
+Jobs Command
+------------
+Inspect and manage the jobs of a running daemon (see "help daemon"). Jobs
+with a higher --priority (given to "daemon submit") are uploaded first, jobs
+of the same priority in the order they were queued.
+
+Usage:
+  ksau-go jobs list [flags]
+  ksau-go jobs cancel <id>...
+  ksau-go jobs retry <id>...
+  ksau-go jobs prune [flags]
+
+List Flags:
+  -o, --output   Output format: table, json or csv (default: table)
+      --status   Only list queued, running, done, failed or canceled jobs
+
+Prune Flags:
+      --older-than  Only remove jobs that finished longer ago than this
+      --keep        Keep this many of the most recently finished jobs
+
+Optional Flags:
+      --socket   Socket of the daemon (default: daemon.sock next to the config)
+
+The table shows every job with its priority, status, progress in percent,
+attempts, file, destination and its link or a summary of the last error; the
+full error is in the json and csv output.
+
+Cancel drops queued jobs and stops the upload of running ones. Retry queues
+failed and canceled jobs again with fresh attempts. Prune removes done,
+failed and canceled jobs from the queue, all of them without flags; the
+daemon also drops them on its own after --keep-finished-for.
+
+Example:
+  ksau-go daemon submit release.zip -r /Builds -c oned --priority 10
+  ksau-go jobs list --status failed
+  ksau-go jobs retry 3fa2c1d0`)
+}
@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/global-index-source/ksau-go/azure"
+	"github.com/global-index-source/ksau-go/cmd/history"
+	"github.com/spf13/cobra"
+)
+
+var (
+	historySearch string
+	historyRemote string
+	historySince  string
+	historyLimit  int
+	historyFailed bool
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history [flags]",
+	Short: "Show past uploads and their download links",
+	Long: `List the uploads recorded in the local history, newest first, with the
+remote path and download link of each file. Use it to recover the link of a
+file uploaded earlier instead of uploading it again.`,
+	Args: cobra.NoArgs,
+	Run:  runHistory,
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+
+	historyCmd.Flags().StringVarP(&historySearch, "search", "s", "", "Only show uploads whose local path, remote path or link contains this (case-insensitive)")
+	historyCmd.Flags().StringVar(&historyRemote, "remote", "", "Only show uploads to this remote")
+	historyCmd.Flags().StringVar(&historySince, "since", "", "Only show uploads newer than this (e.g. 12h, 7d, 2w)")
+	historyCmd.Flags().IntVarP(&historyLimit, "limit", "l", 20, "Show at most this many uploads (0 for all)")
+	historyCmd.Flags().BoolVar(&historyFailed, "failed", false, "Also show failed upload attempts")
+}
+
+func runHistory(cmd *cobra.Command, args []string) {
+	age, err := parseAge(historySince)
+	if err != nil {
+		fmt.Println("invalid --since value:", err.Error())
+		os.Exit(1)
+	}
+	var since time.Time
+	if age > 0 {
+		since = time.Now().Add(-age)
+	}
+
+	store, err := openHistory()
+	if err != nil {
+		fmt.Println("failed to open upload history:", err.Error())
+		os.Exit(1)
+	}
+	entries, err := store.Load(since)
+	if err != nil {
+		fmt.Println("failed to read upload history:", err.Error())
+		os.Exit(1)
+	}
+
+	entries = slices.DeleteFunc(entries, func(entry history.Entry) bool {
+		return !matchesHistoryFilters(entry)
+	})
+	slices.Reverse(entries)
+	if historyLimit > 0 && len(entries) > historyLimit {
+		entries = entries[:historyLimit]
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("no matching uploads recorded")
+		return
+	}
+
+	for _, entry := range entries {
+		printHistoryEntry(entry)
+	}
+}
+
+// matchesHistoryFilters reports whether entry passes the history flags.
+func matchesHistoryFilters(entry history.Entry) bool {
+	if !entry.Success && !historyFailed {
+		return false
+	}
+	if historyRemote != "" && entry.Remote != historyRemote {
+		return false
+	}
+	return historySearch == "" || historyEntryContains(entry, historySearch)
+}
+
+// historyEntryContains reports whether the local path, remote path or link of
+// entry contains search, ignoring case.
+func historyEntryContains(entry history.Entry, search string) bool {
+	search = strings.ToLower(search)
+	for _, field := range []string{entry.LocalPath, entry.RemotePath, entry.Link} {
+		if strings.Contains(strings.ToLower(field), search) {
+			return true
+		}
+	}
+	return false
+}
+
+// printHistoryEntry prints an upload as a header line followed by its details.
+func printHistoryEntry(entry history.Entry) {
+	when := entry.Time.Local().Format("2006-01-02 15:04")
+	if !entry.Success {
+		fmt.Printf("%s  %s  %sfailed after %s%s\n", when, entry.Remote, ColorRed, azure.FormatBytes(entry.Bytes), ColorReset)
+		return
+	}
+	if entry.RemotePath == "" {
+		// Recorded before the details were kept
+		fmt.Printf("%s  %s  %s\n", when, entry.Remote, azure.FormatBytes(entry.Bytes))
+		return
+	}
+
+	fmt.Printf("%s  %s  %s  %s\n", when, entry.Remote, azure.FormatBytes(entry.Size), entry.RemotePath)
+	fmt.Printf("    local: %s\n", entry.LocalPath)
+	if entry.Hash != "" {
+		fmt.Printf("    hash:  %s\n", entry.Hash)
+	}
+	fmt.Printf("    link:  %s%s%s\n", ColorGreen, entry.Link, ColorReset)
+}
@@ -0,0 +1,88 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Entry is a single upload attempt recorded in the local store. The details
+// of the uploaded file are only recorded for successful uploads.
+type Entry struct {
+	Time     time.Time     `json:"time"`
+	Remote   string        `json:"remote"`
+	Bytes    int64         `json:"bytes"` // bytes actually transferred
+	Success  bool          `json:"success"`
+	Duration time.Duration `json:"duration,omitempty"` // how long the transfer took
+
+	LocalPath  string `json:"local_path,omitempty"`
+	RemotePath string `json:"remote_path,omitempty"` // including the remote's root folder
+	Size       int64  `json:"size,omitempty"`
+	Hash       string `json:"hash,omitempty"` // QuickXorHash, empty if not computed
+	Link       string `json:"link,omitempty"`
+}
+
+// Store is an append-only log of entries kept as JSON lines in a local file
+type Store struct {
+	path string
+}
+
+// Open returns the store backed by the file at path. The file is created on
+// the first Append.
+func Open(path string) *Store {
+	return &Store{path: path}
+}
+
+// Append adds an entry to the end of the store
+func (s *Store) Append(entry Entry) error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer file.Close()
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode history entry: %w", err)
+	}
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write history entry: %w", err)
+	}
+	return nil
+}
+
+// Load reads all entries recorded at or after since. Malformed lines are
+// skipped so a single corrupted write doesn't make the whole history unusable.
+func (s *Store) Load(since time.Time) ([]Entry, error) {
+	file, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if entry.Time.Before(since) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history file: %w", err)
+	}
+	return entries, nil
+}
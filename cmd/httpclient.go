@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/global-index-source/ksau-go/azure"
+)
+
+// Settings of the shared HTTP client, from the global flags.
+var (
+	connectTimeout        time.Duration
+	responseHeaderTimeout time.Duration
+	maxConnsPerHost       int
+	debugHTTP             string
+	debugHTTPHeaders      bool
+	debugHTTPUnredacted   bool
+)
+
+func init() {
+	azure.UserAgent = "ksau-go/" + Version
+
+	rootCmd.PersistentFlags().DurationVar(&connectTimeout, "connect-timeout", azure.DefaultConnectTimeout, "Maximum time for connecting to the server, including the TLS handshake")
+	rootCmd.PersistentFlags().DurationVar(&responseHeaderTimeout, "response-timeout", azure.DefaultResponseHeaderTimeout, "Maximum time to wait for the server to start responding")
+	rootCmd.PersistentFlags().IntVar(&maxConnsPerHost, "max-conns-per-host", 0, "Maximum number of connections per server (0 for no limit)")
+	rootCmd.PersistentFlags().StringVar(&debugHTTP, "debug-http", "", "Log every HTTP request with its status and latency to this file ('-' or no value for stderr)")
+	rootCmd.PersistentFlags().Lookup("debug-http").NoOptDefVal = "-"
+	rootCmd.PersistentFlags().BoolVar(&debugHTTPHeaders, "debug-http-headers", false, "Also log the request and response headers with --debug-http")
+	rootCmd.PersistentFlags().BoolVar(&debugHTTPUnredacted, "debug-http-unredacted", false, "Don't redact tokens and upload URLs in the --debug-http log")
+}
+
+var (
+	sharedClientOnce sync.Once
+	sharedClient     *http.Client
+)
+
+// sharedHTTPClient returns the HTTP client every command uses, so connections
+// are pooled and reused across requests. It has no overall timeout, which
+// would abort long chunk uploads; stalled connections are caught by the
+// transport timeouts and uploads bound their chunks on their own. With
+// --dry-run, it refuses every request that could change anything.
+func sharedHTTPClient() *http.Client {
+	sharedClientOnce.Do(func() {
+		transport := azure.NewTransport(azure.TransportOptions{
+			ConnectTimeout:        connectTimeout,
+			ResponseHeaderTimeout: responseHeaderTimeout,
+			MaxConnsPerHost:       maxConnsPerHost,
+		})
+		var roundTripper http.RoundTripper = transport
+		if debugHTTP != "" {
+			roundTripper = azure.NewDebugTransport(transport, openDebugHTTPLog(), azure.DebugOptions{
+				Headers:    debugHTTPHeaders,
+				Unredacted: debugHTTPUnredacted,
+			})
+		}
+		if dryRun {
+			roundTripper = azure.NewReadOnlyTransport(roundTripper)
+		}
+		sharedClient = &http.Client{Transport: azure.NewUserAgentTransport(roundTripper)}
+	})
+	return sharedClient
+}
+
+// openDebugHTTPLog returns where --debug-http logs go, exiting if the log
+// file can't be opened. The file is appended to and stays open until exit.
+func openDebugHTTPLog() io.Writer {
+	if debugHTTP == "-" {
+		return os.Stderr
+	}
+
+	file, err := os.OpenFile(debugHTTP, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		fmt.Println("failed to open the --debug-http log:", err.Error())
+		os.Exit(1)
+	}
+	return file
+}
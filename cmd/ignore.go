@@ -0,0 +1,339 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// ignoreFileName is the file of gitignore style patterns directory uploads
+// read in every directory they walk.
+const ignoreFileName = ".ksauignore"
+
+// ageTimeFormats are the layouts --min-age and --max-age accept besides
+// durations, for a fixed point in time.
+var ageTimeFormats = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"}
+
+var (
+	excludePatterns []string
+	includePatterns []string
+	minSizeFilter   string
+	maxSizeFilter   string
+	minAgeFilter    string
+	maxAgeFilter    string
+)
+
+// addFilterFlags registers --exclude, --include and the size and age filters
+// on cmd, they are shared by the commands uploading or comparing directories.
+func addFilterFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&excludePatterns, "exclude", nil, "Skip files and directories matching this gitignore style pattern (repeatable)")
+	cmd.Flags().StringArrayVar(&includePatterns, "include", nil, "Don't skip files matching this pattern, even if "+ignoreFileName+" or --exclude does (repeatable)")
+	cmd.Flags().StringVar(&minSizeFilter, "min-size", "", "Skip files smaller than this, in KiB or with a B, K, M, G, T or P suffix")
+	cmd.Flags().StringVar(&maxSizeFilter, "max-size", "", "Skip files larger than this, in KiB or with a B, K, M, G, T or P suffix")
+	cmd.Flags().StringVar(&minAgeFilter, "min-age", "", "Skip files modified more recently than this duration (e.g. 12h, 7d) or date (2006-01-02)")
+	cmd.Flags().StringVar(&maxAgeFilter, "max-age", "", "Skip files modified longer ago than this duration (e.g. 12h, 7d) or date (2006-01-02)")
+}
+
+// ignoreRule is a pattern of an ignore file or flag.
+type ignoreRule struct {
+	base     string   // slash separated directory the rule applies below, "" for all
+	segments []string // pattern split at slashes, "**" matches any number of them
+	negate   bool     // the pattern started with !, matching paths are included again
+	dirOnly  bool     // the pattern ended with /, only directories match
+}
+
+// fileFilter decides which files below a directory are skipped, following the
+// .ksauignore files in it and the --exclude and --include flags. Like with
+// .gitignore, the last matching rule wins, rules of deeper ignore files apply
+// after those of their parents and the files of a skipped directory are
+// skipped whatever later rules say. The flags apply after all ignore files.
+// Files outside the size and age limits are skipped as well, like with
+// rclone's filters they don't apply to directories.
+type fileFilter struct {
+	rules []ignoreRule // from ignore files, in the order they were read
+	flags []ignoreRule // from --exclude, then --include
+
+	minSize int64     // -1 for no limit
+	maxSize int64     // -1 for no limit
+	newest  time.Time // files modified after it are skipped, zero for no limit
+	oldest  time.Time // files modified before it are skipped, zero for no limit
+}
+
+// newFileFilter returns a filter with the rules of --exclude and --include
+// and the limits of the size and age flags. The ignore files are read while
+// walking with visit.
+func newFileFilter() (*fileFilter, error) {
+	filter := &fileFilter{}
+	var err error
+	if filter.minSize, err = parseSizeFilter(minSizeFilter); err != nil {
+		return nil, fmt.Errorf("invalid --min-size: %w", err)
+	}
+	if filter.maxSize, err = parseSizeFilter(maxSizeFilter); err != nil {
+		return nil, fmt.Errorf("invalid --max-size: %w", err)
+	}
+	now := time.Now()
+	if filter.newest, err = parseAgeFilter(minAgeFilter, now); err != nil {
+		return nil, fmt.Errorf("invalid --min-age: %w", err)
+	}
+	if filter.oldest, err = parseAgeFilter(maxAgeFilter, now); err != nil {
+		return nil, fmt.Errorf("invalid --max-age: %w", err)
+	}
+	for _, pattern := range excludePatterns {
+		rule, ok, err := parseIgnoreRule("", pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --exclude pattern: %w", err)
+		}
+		if ok {
+			filter.flags = append(filter.flags, rule)
+		}
+	}
+	for _, pattern := range includePatterns {
+		rule, ok, err := parseIgnoreRule("", strings.TrimPrefix(pattern, "!"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid --include pattern: %w", err)
+		}
+		if ok {
+			rule.negate = true
+			filter.flags = append(filter.flags, rule)
+		}
+	}
+	return filter, nil
+}
+
+// parseSizeFilter parses a size the way rclone does: a number of KiB, or of
+// bytes, KiB, MiB, GiB, TiB or PiB with a B, K, M, G, T or P suffix, which
+// may be followed by "i" or "iB". It returns -1 for "" and "off".
+func parseSizeFilter(value string) (int64, error) {
+	if value == "" || value == "off" {
+		return -1, nil
+	}
+
+	number, unit := value, ""
+	if i := strings.LastIndexAny(value, "0123456789."); i >= 0 {
+		number, unit = value[:i+1], strings.ToUpper(value[i+1:])
+	}
+	var multiplier float64
+	switch unit {
+	case "":
+		multiplier = 1 << 10
+	case "B":
+		multiplier = 1
+	default:
+		prefix := strings.TrimSuffix(strings.TrimSuffix(unit, "B"), "I")
+		exponent := strings.Index("KMGTP", prefix)
+		if len(prefix) != 1 || exponent < 0 {
+			return 0, fmt.Errorf("unknown unit in %q", value)
+		}
+		multiplier = float64(int64(1) << (10 * (exponent + 1)))
+	}
+
+	count, err := strconv.ParseFloat(number, 64)
+	if err != nil || count < 0 {
+		return 0, fmt.Errorf("%q is not a size", value)
+	}
+	return int64(count * multiplier), nil
+}
+
+// parseAgeFilter returns the modification time an age stands for, relative
+// to now unless it is a date. It returns the zero time for "" and "off".
+func parseAgeFilter(value string, now time.Time) (time.Time, error) {
+	if value == "" || value == "off" {
+		return time.Time{}, nil
+	}
+	for _, layout := range ageTimeFormats {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	age, err := parseAge(value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return now.Add(-age), nil
+}
+
+// parseIgnoreRule parses a line of the ignore file in the directory base. It
+// returns false for blank lines and comments.
+func parseIgnoreRule(base, line string) (ignoreRule, bool, error) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false, nil
+	}
+
+	rule := ignoreRule{base: base}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	}
+	// \# and \! start patterns matching a literal # or !
+	if strings.HasPrefix(line, `\#`) || strings.HasPrefix(line, `\!`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false, nil
+	}
+
+	// Patterns with a slash are relative to the ignore file, others match
+	// the name at any depth
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	rule.segments = strings.Split(line, "/")
+	if !anchored {
+		rule.segments = append([]string{"**"}, rule.segments...)
+	}
+	for _, segment := range rule.segments {
+		if _, err := path.Match(segment, ""); err != nil {
+			return ignoreRule{}, false, fmt.Errorf("%s: %w", line, err)
+		}
+	}
+	return rule, true, nil
+}
+
+// readIgnoreFile adds the rules of the ignore file in dir, if there is one.
+// relDir is dir relative to the walked directory, slash separated.
+func (f *fileFilter) readIgnoreFile(dir, relDir string) error {
+	file, err := os.Open(filepath.Join(dir, ignoreFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		rule, ok, err := parseIgnoreRule(relDir, scanner.Text())
+		if err != nil {
+			return fmt.Errorf("%s line %d: %w", filepath.Join(dir, ignoreFileName), line, err)
+		}
+		if ok {
+			f.rules = append(f.rules, rule)
+		}
+	}
+	return scanner.Err()
+}
+
+// visit is called by filepath.WalkDir callbacks walking dir before looking at
+// filePath. It reports whether filePath is skipped, by its path or, for
+// regular files, its size and age, with filepath.SkipDir as error for skipped
+// directories. It reads the ignore files of the directories that are entered.
+func (f *fileFilter) visit(dir, filePath string, entry fs.DirEntry) (bool, error) {
+	relPath, err := filepath.Rel(dir, filePath)
+	if err != nil {
+		return true, err
+	}
+	relPath = filepath.ToSlash(relPath)
+	if relPath == "." {
+		return false, f.readIgnoreFile(filePath, "")
+	}
+
+	if f.matches(relPath, entry.IsDir()) {
+		if entry.IsDir() {
+			return true, filepath.SkipDir
+		}
+		return true, nil
+	}
+	if entry.IsDir() {
+		return false, f.readIgnoreFile(filePath, relPath)
+	}
+	if entry.Type().IsRegular() {
+		info, err := entry.Info()
+		if err != nil {
+			return true, err
+		}
+		return f.outside(info.Size(), info.ModTime()), nil
+	}
+	return false, nil
+}
+
+// outside reports whether a file's size or modification time is outside the
+// limits of --min-size, --max-size, --min-age and --max-age.
+func (f *fileFilter) outside(size int64, modTime time.Time) bool {
+	switch {
+	case f.minSize >= 0 && size < f.minSize:
+		return true
+	case f.maxSize >= 0 && size > f.maxSize:
+		return true
+	case !f.newest.IsZero() && modTime.After(f.newest):
+		return true
+	case !f.oldest.IsZero() && modTime.Before(f.oldest):
+		return true
+	}
+	return false
+}
+
+// excluded reports whether the file or directory at the slash separated
+// relPath is skipped, either itself or because a directory above it is.
+func (f *fileFilter) excluded(relPath string, isDir bool) bool {
+	parts := strings.Split(relPath, "/")
+	for i := 1; i < len(parts); i++ {
+		if f.matches(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return f.matches(relPath, isDir)
+}
+
+// matches applies the rules to relPath alone, the last matching rule wins.
+func (f *fileFilter) matches(relPath string, isDir bool) bool {
+	skip := false
+	for _, rules := range [][]ignoreRule{f.rules, f.flags} {
+		for _, rule := range rules {
+			if rule.match(relPath, isDir) {
+				skip = !rule.negate
+			}
+		}
+	}
+	return skip
+}
+
+func (r ignoreRule) match(relPath string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.base != "" {
+		var ok bool
+		relPath, ok = strings.CutPrefix(relPath, r.base+"/")
+		if !ok {
+			return false
+		}
+	}
+	return matchSegments(r.segments, strings.Split(relPath, "/"))
+}
+
+// matchSegments matches path segments against pattern segments, where "**"
+// stands for any number of segments.
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], segments[1:])
+}
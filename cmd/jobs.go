@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/global-index-source/ksau-go/cmd/queue"
+	"github.com/spf13/cobra"
+)
+
+// jobErrorWidth is how much of a job's error the table shows.
+const jobErrorWidth = 60
+
+var (
+	jobsOutput    string
+	jobsStatus    string
+	jobsOlderThan time.Duration
+	jobsKeep      int
+)
+
+var jobsCmd = &cobra.Command{
+	Use:   "jobs",
+	Short: "List, cancel, retry and prune the jobs of the daemon",
+	Long: `Inspect and manage the upload jobs of a running daemon (see "ksau-go daemon"):
+list them with their status and progress, cancel queued or running jobs,
+queue failed or canceled ones again and remove finished ones from the queue.`,
+}
+
+var jobsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the jobs with status, progress and errors",
+	Args:  cobra.NoArgs,
+	Run:   runJobsList,
+}
+
+var jobsCancelCmd = &cobra.Command{
+	Use:   "cancel <id>...",
+	Short: "Cancel queued or running jobs",
+	Args:  cobra.MinimumNArgs(1),
+	Run:   runJobsChange,
+}
+
+var jobsRetryCmd = &cobra.Command{
+	Use:   "retry <id>...",
+	Short: "Queue failed or canceled jobs again",
+	Args:  cobra.MinimumNArgs(1),
+	Run:   runJobsChange,
+}
+
+var jobsPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove done, failed and canceled jobs from the queue",
+	Args:  cobra.NoArgs,
+	Run:   runJobsPrune,
+}
+
+func init() {
+	rootCmd.AddCommand(jobsCmd)
+	jobsCmd.AddCommand(jobsListCmd)
+	jobsCmd.AddCommand(jobsCancelCmd)
+	jobsCmd.AddCommand(jobsRetryCmd)
+	jobsCmd.AddCommand(jobsPruneCmd)
+
+	jobsCmd.PersistentFlags().StringVar(&daemonSocket, "socket", "", "Socket the daemon listens on (default: daemon.sock next to the config)")
+	jobsListCmd.Flags().StringVarP(&jobsOutput, "output", "o", outputTable, "Output format: table, json or csv")
+	jobsListCmd.Flags().StringVar(&jobsStatus, "status", "", "Only list jobs with this status: queued, running, done, failed or canceled")
+	jobsPruneCmd.Flags().DurationVar(&jobsOlderThan, "older-than", 0, "Only remove jobs that finished longer ago than this")
+	jobsPruneCmd.Flags().IntVar(&jobsKeep, "keep", 0, "Keep this many of the most recently finished jobs")
+}
+
+func runJobsList(cmd *cobra.Command, args []string) {
+	if jobsOutput != outputTable && jobsOutput != outputJSON && jobsOutput != outputCSV {
+		fmt.Printf("invalid --output value %q, must be %s, %s or %s\n", jobsOutput, outputTable, outputJSON, outputCSV)
+		os.Exit(1)
+	}
+	switch queue.Status(jobsStatus) {
+	case "", queue.Queued, queue.Running, queue.Done, queue.Failed, queue.Canceled:
+	default:
+		fmt.Printf("invalid --status value %q, must be queued, running, done, failed or canceled\n", jobsStatus)
+		os.Exit(1)
+	}
+
+	response, err := callDaemon(daemonRequest{Op: "list"})
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	jobs := []queue.Job{}
+	for _, job := range response.Jobs {
+		if jobsStatus == "" || string(job.Status) == jobsStatus {
+			jobs = append(jobs, job)
+		}
+	}
+
+	switch jobsOutput {
+	case outputJSON:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(jobs)
+
+	case outputCSV:
+		writer := csv.NewWriter(os.Stdout)
+		writer.Write([]string{"id", "priority", "status", "progress", "attempts", "file", "remote", "folder", "size", "uploaded", "link", "error"})
+		for _, job := range jobs {
+			writer.Write([]string{job.ID, strconv.Itoa(job.Priority), string(job.Status), jobProgress(job), strconv.Itoa(job.Attempts),
+				job.File, job.Remote, job.Folder, strconv.FormatInt(job.Size, 10), strconv.FormatInt(job.Uploaded, 10), job.Link, job.Error})
+		}
+		writer.Flush()
+
+	default:
+		if len(jobs) == 0 {
+			fmt.Println("no jobs")
+			return
+		}
+		printJobTable(jobs)
+	}
+}
+
+// runJobsChange cancels or retries the jobs given as arguments.
+func runJobsChange(cmd *cobra.Command, args []string) {
+	failed := false
+	for _, id := range args {
+		if dryRun {
+			printDryRun("%s job %s", cmd.Name(), id)
+			continue
+		}
+		response, err := callDaemon(daemonRequest{Op: cmd.Name(), ID: id})
+		if err != nil {
+			fmt.Printf("%sfailed to %s job %s: %v%s\n", ColorRed, cmd.Name(), id, err, ColorReset)
+			failed = true
+			continue
+		}
+		fmt.Printf("job %s is %s\n", id, response.Job.Status)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// runJobsPrune removes finished jobs from the daemon's queue.
+func runJobsPrune(cmd *cobra.Command, args []string) {
+	if jobsOlderThan < 0 || jobsKeep < 0 {
+		fmt.Println("--older-than and --keep can't be negative")
+		os.Exit(1)
+	}
+	request := daemonRequest{Op: "prune", Before: time.Now(), Keep: jobsKeep}
+	if jobsOlderThan > 0 {
+		request.Before = request.Before.Add(-jobsOlderThan)
+	}
+	if dryRun {
+		printDryRun("prune the jobs that finished before %s, keeping the %d most recent", request.Before.Format(time.DateTime), jobsKeep)
+		return
+	}
+
+	response, err := callDaemon(request)
+	if err != nil {
+		fmt.Printf("%sfailed to prune jobs: %v%s\n", ColorRed, err, ColorReset)
+		os.Exit(1)
+	}
+	for _, job := range response.Jobs {
+		fmt.Printf("removed job %s (%s, %s)\n", job.ID, job.Status, job.File)
+	}
+	fmt.Printf("%d job(s) removed\n", len(response.Jobs))
+}
+
+// printJobTable prints jobs as a table, with the link of done jobs and a
+// summary of the last error of the others.
+func printJobTable(jobs []queue.Job) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "ID\tPriority\tStatus\tProgress\tAttempts\tFile\tDestination\tLink / Error")
+	for _, job := range jobs {
+		detail := job.Link
+		if job.Status != queue.Done {
+			detail = summarizeJobError(job.Error)
+		}
+		fmt.Fprintf(writer, "%s\t%d\t%s\t%s\t%d\t%s\t%s:%s\t%s\n", job.ID, job.Priority, job.Status, jobProgress(job), job.Attempts,
+			job.File, job.Remote, job.Folder, orDash(detail))
+	}
+	writer.Flush()
+}
+
+// summarizeJobError shortens an error to its first line and jobErrorWidth
+// characters, the full text is in the JSON output.
+func summarizeJobError(message string) string {
+	message, _, _ = strings.Cut(message, "\n")
+	if runes := []rune(message); len(runes) > jobErrorWidth {
+		message = string(runes[:jobErrorWidth-3]) + "..."
+	}
+	return message
+}
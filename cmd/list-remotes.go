@@ -1,13 +1,30 @@
 package cmd
 
 import (
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
+	"text/tabwriter"
 
 	"github.com/global-index-source/ksau-go/azure"
+	"github.com/global-index-source/ksau-go/redact"
 	"github.com/spf13/cobra"
 )
 
+// Values accepted by --output
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputCSV   = "csv"
+)
+
+var (
+	listRemotesDetail bool
+	listRemotesOutput string
+)
+
 var listRemotes = &cobra.Command{
 	Use:   "list-remotes",
 	Short: "List available remotes from the configuration file.",
@@ -17,10 +34,32 @@ var listRemotes = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(listRemotes)
+
+	listRemotes.Flags().BoolVar(&listRemotesDetail, "detail", false, "Show drive type, root folder, base URL and space of every remote")
+	listRemotes.Flags().StringVarP(&listRemotesOutput, "output", "o", outputTable, "Output format: table, json or csv")
+}
+
+// remoteDetail is what list-remotes shows about a remote. Everything but the
+// name is only filled in with --detail.
+type remoteDetail struct {
+	Name       string `json:"name"`
+	DriveType  string `json:"driveType,omitempty"`
+	RootFolder string `json:"rootFolder,omitempty"`
+	BaseURL    string `json:"baseUrl,omitempty"`
+	Total      int64  `json:"total,omitempty"`
+	Used       int64  `json:"used,omitempty"`
+	Free       int64  `json:"free,omitempty"`
+	Error      string `json:"error,omitempty"`
 }
 
 func runListRemotes(cmd *cobra.Command, args []string) {
-	fmt.Println("reading configuration file...")
+	if listRemotesOutput != outputTable && listRemotesOutput != outputJSON && listRemotesOutput != outputCSV {
+		fmt.Printf("invalid --output value %q, must be %s, %s or %s\n", listRemotesOutput, outputTable, outputJSON, outputCSV)
+		os.Exit(1)
+	}
+	if listRemotesOutput == outputTable {
+		fmt.Println("reading configuration file...")
+	}
 
 	configData, err := getConfigData()
 	if err != nil {
@@ -35,5 +74,110 @@ func runListRemotes(cmd *cobra.Command, args []string) {
 	}
 
 	availableRemotes := azure.GetAvailableRemotes(&parsedConfigData)
-	fmt.Println("available remotes:", availableRemotes)
+	if !listRemotesDetail {
+		if listRemotesOutput == outputTable {
+			fmt.Println("available remotes:", availableRemotes)
+			return
+		}
+		details := make([]remoteDetail, len(availableRemotes))
+		for i, remote := range availableRemotes {
+			details[i] = remoteDetail{Name: remote}
+		}
+		printRemoteDetails(details, false)
+		return
+	}
+
+	requireNetwork("")
+
+	httpClient := sharedHTTPClient()
+	results := fanOut(availableRemotes, func(remote string) (*remoteDetail, error) {
+		client, err := azure.NewAzureClientFromRcloneConfigData(configData, remote)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize client: %w", err)
+		}
+
+		drive, err := client.GetDrive(httpClient)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch drive information: %w", err)
+		}
+
+		return &remoteDetail{
+			Name:       remote,
+			DriveType:  drive.DriveType,
+			RootFolder: client.RemoteRootFolder,
+			BaseURL:    client.RemoteBaseUrl,
+			Total:      drive.Quota.Total,
+			Used:       drive.Quota.Used,
+			Free:       drive.Quota.Remaining,
+		}, nil
+	})
+
+	details := make([]remoteDetail, len(results))
+	failed := false
+	for i, result := range results {
+		if result.err != nil {
+			details[i] = remoteDetail{Name: result.remote, Error: redact.Error(result.err)}
+			failed = true
+			continue
+		}
+		details[i] = *result.value
+	}
+	printRemoteDetails(details, true)
+
+	// The failures are part of the JSON and CSV output already
+	if listRemotesOutput == outputTable {
+		os.Exit(reportFailures(results))
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// printRemoteDetails prints the remotes in the --output format, with all
+// detail columns if detail is set and just the names otherwise.
+func printRemoteDetails(details []remoteDetail, detail bool) {
+	switch listRemotesOutput {
+	case outputJSON:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(details)
+
+	case outputCSV:
+		writer := csv.NewWriter(os.Stdout)
+		if !detail {
+			writer.Write([]string{"name"})
+			for _, d := range details {
+				writer.Write([]string{d.Name})
+			}
+		} else {
+			writer.Write([]string{"name", "drive_type", "root_folder", "base_url", "total", "used", "free", "error"})
+			for _, d := range details {
+				writer.Write([]string{d.Name, d.DriveType, d.RootFolder, d.BaseURL,
+					strconv.FormatInt(d.Total, 10), strconv.FormatInt(d.Used, 10), strconv.FormatInt(d.Free, 10), d.Error})
+			}
+		}
+		writer.Flush()
+
+	default:
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "Remote\tType\tRoot folder\tBase URL\tTotal\tUsed\tFree")
+		for _, d := range details {
+			if d.Error != "" {
+				fmt.Fprintf(writer, "%s\t-\t-\t-\t-\t-\t-\n", d.Name)
+				continue
+			}
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", d.Name, d.DriveType,
+				orDash(d.RootFolder), orDash(d.BaseURL), azure.FormatBytes(d.Total),
+				azure.FormatBytes(d.Used), azure.FormatBytes(d.Free))
+		}
+		writer.Flush()
+	}
+}
+
+// orDash returns value, or "-" for an empty value so table cells aren't blank.
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
 }
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/global-index-source/ksau-go/azure"
+)
+
+const (
+	// listCacheTTL is how long a cached listing is used without asking Graph
+	// whether the folder changed.
+	listCacheTTL = time.Minute
+
+	// listCacheMaxItems keeps huge folders out of the cache, since caching them
+	// would mean holding the whole listing in memory.
+	listCacheMaxItems = 10000
+)
+
+// listCacheEntry is a cached folder listing together with the folder's eTag
+// at the time it was listed.
+type listCacheEntry struct {
+	Time  time.Time         `json:"time"`
+	ETag  string            `json:"etag"`
+	Items []azure.DriveItem `json:"items"`
+}
+
+// listChildrenCached lists a remote folder like AzureClient.ListChildren, but
+// reuses a cached listing if it is younger than listCacheTTL or if the
+// folder's eTag shows that it didn't change since. --no-cache bypasses the cache.
+func listChildrenCached(client *azure.AzureClient, httpClient *http.Client, remote string, folder string, fn func(azure.DriveItem) error) error {
+	cachePath, err := listCachePath(remote, folder)
+	if noCache || err != nil {
+		return client.ListChildren(httpClient, folder, fn)
+	}
+
+	var entry listCacheEntry
+	cached := false
+	if data, err := os.ReadFile(cachePath); err == nil && json.Unmarshal(data, &entry) == nil {
+		cached = true
+	}
+
+	// Ask for the folder's eTag if the cache is too old to be trusted blindly
+	var etag string
+	if !cached || time.Since(entry.Time) >= listCacheTTL {
+		if folderItem, err := client.GetItem(httpClient, folder); err == nil {
+			etag = folderItem.ETag
+		}
+		if cached && (etag == "" || etag != entry.ETag) {
+			cached = false
+		}
+	}
+
+	if cached {
+		if etag != "" {
+			// Still current, restart the TTL window
+			entry.Time = time.Now()
+			writeListCache(cachePath, entry)
+		}
+		for _, item := range entry.Items {
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	entry = listCacheEntry{Time: time.Now(), ETag: etag}
+	tooBig := false
+	err = client.ListChildren(httpClient, folder, func(item azure.DriveItem) error {
+		if !tooBig && len(entry.Items) < listCacheMaxItems {
+			entry.Items = append(entry.Items, item)
+		} else {
+			tooBig = true
+			entry.Items = nil
+		}
+		return fn(item)
+	})
+	if err != nil {
+		return err
+	}
+
+	if etag != "" && !tooBig {
+		writeListCache(cachePath, entry)
+	}
+	return nil
+}
+
+// invalidateListCache removes the cached listing of a folder, e.g. after
+// something was uploaded into it.
+func invalidateListCache(remote string, folder string) {
+	if cachePath, err := listCachePath(remote, folder); err == nil {
+		os.Remove(cachePath)
+	}
+}
+
+func listCachePath(remote string, folder string) (string, error) {
+	cacheDir, err := getStatePath("cache")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return "", err
+	}
+
+	folder = strings.Trim(filepath.ToSlash(folder), "/")
+	sum := sha256.Sum256([]byte(remote + ":" + folder))
+	return filepath.Join(cacheDir, "list-"+hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+func writeListCache(cachePath string, entry listCacheEntry) {
+	if data, err := json.Marshal(entry); err == nil {
+		os.WriteFile(cachePath, data, 0644)
+	}
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/global-index-source/ksau-go/azure"
+	"github.com/spf13/cobra"
+)
+
+// defaultLogFileMaxSize is the size at which --log-file is rotated.
+const defaultLogFileMaxSize = 10 * 1024 * 1024
+
+var (
+	// debugLog enables debug diagnostics, implies verbose.
+	debugLog bool
+
+	// logFile mirrors the log into a file, with timestamps.
+	logFile        string
+	logFileMaxSize int64
+)
+
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&debugLog, "debug", false, "Print debug diagnostics, even more than --verbose")
+	rootCmd.PersistentFlags().StringVar(&logFile, "log-file", "", "Also write the log, with timestamps, to this file")
+	rootCmd.PersistentFlags().Int64Var(&logFileMaxSize, "log-file-max-size", defaultLogFileMaxSize, "Rotate the --log-file once it grows past this many bytes (0 to never)")
+	cobra.OnInitialize(setupLogging)
+}
+
+// logLevel returns the least severe level that is logged: warnings by
+// default, status information with --verbose and everything with --debug.
+func logLevel() slog.Level {
+	switch {
+	case debugLog:
+		return slog.LevelDebug
+	case verbose:
+		return slog.LevelInfo
+	default:
+		return slog.LevelWarn
+	}
+}
+
+// setupLogging sends the log of ksau-go and of the azure package to stderr,
+// keeping stdout for command output.
+func setupLogging() {
+	if debugLog {
+		verbose = true
+	}
+
+	var handler slog.Handler = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: logLevel(),
+		// Timestamps are noise on a terminal
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if len(groups) == 0 && attr.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return attr
+		},
+	})
+
+	// The file is for finding out afterwards what happened, e.g. during an
+	// overnight batch, so it gets status information even without --verbose
+	if logFile != "" {
+		file, err := openRotatingFile(logFile, logFileMaxSize)
+		if err != nil {
+			fmt.Println("failed to open the log file:", err.Error())
+			os.Exit(1)
+		}
+		fileHandler := slog.NewTextHandler(file, &slog.HandlerOptions{Level: min(logLevel(), slog.LevelInfo)})
+		handler = multiHandler{handler, fileHandler}
+	}
+
+	slog.SetDefault(slog.New(handler))
+	azure.DefaultLogger = azure.NewSlogLogger(slog.Default())
+}
+
+// multiHandler passes every record on to all of its handlers.
+type multiHandler []slog.Handler
+
+func (m multiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range m {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m multiHandler) Handle(ctx context.Context, record slog.Record) error {
+	var errs []error
+	for _, handler := range m {
+		if handler.Enabled(ctx, record.Level) {
+			errs = append(errs, handler.Handle(ctx, record.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(multiHandler, len(m))
+	for i, handler := range m {
+		handlers[i] = handler.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (m multiHandler) WithGroup(name string) slog.Handler {
+	handlers := make(multiHandler, len(m))
+	for i, handler := range m {
+		handlers[i] = handler.WithGroup(name)
+	}
+	return handlers
+}
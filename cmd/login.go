@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var loginName string
+
+var loginCmd = &cobra.Command{
+	Use:   "login --name <remote>",
+	Short: "Log in to a OneDrive account and save it as a new remote",
+	Long: `Sign in with the Microsoft device code flow: open the shown page on any
+device, enter the code and approve the login. The issued tokens are saved as a
+new remote, the same as 'config add-remote' does.`,
+	Args: cobra.NoArgs,
+	Run:  runLogin,
+}
+
+func init() {
+	rootCmd.AddCommand(loginCmd)
+
+	loginCmd.Flags().StringVar(&loginName, "name", "", "Name of the new remote")
+	loginCmd.MarkFlagRequired("name")
+	addRemoteFlags(loginCmd)
+}
+
+func runLogin(cmd *cobra.Command, args []string) {
+	addRemote(loginName)
+}
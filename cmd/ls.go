@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/global-index-source/ksau-go/azure"
+	"github.com/spf13/cobra"
+)
+
+var lsCmd = &cobra.Command{
+	Use:   "ls [folder]",
+	Short: "List the contents of a remote folder",
+	Long: `List the files and folders in a remote folder, relative to the remote's
+root folder. Items are printed as they arrive, so even folders with tens of
+thousands of items start showing output immediately.`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  runLs,
+}
+
+func init() {
+	rootCmd.AddCommand(lsCmd)
+}
+
+func runLs(cmd *cobra.Command, args []string) {
+	remoteConfig, _ := cmd.Flags().GetString("remote-config")
+	if remoteConfig == "" {
+		fmt.Println("please select a remote with --remote-config")
+		os.Exit(1)
+	}
+
+	requireNetwork("")
+
+	folder := ""
+	if len(args) > 0 {
+		folder = args[0]
+	}
+
+	configData, err := getConfigData()
+	if err != nil {
+		fmt.Println("failed to get configuration file data:", err.Error())
+		os.Exit(1)
+	}
+
+	client, err := azure.NewAzureClientFromRcloneConfigData(configData, remoteConfig)
+	if err != nil {
+		fmt.Println("failed to initialize client:", err.Error())
+		os.Exit(1)
+	}
+
+	httpClient := sharedHTTPClient()
+	count := 0
+	err = listChildrenCached(client, httpClient, remoteConfig, path.Join(client.RemoteRootFolder, folder), func(item azure.DriveItem) error {
+		count++
+		if item.Folder != nil {
+			fmt.Printf("%12s  %s  %s/\n", "-", item.LastModifiedDateTime.Local().Format("2006-01-02 15:04"), item.Name)
+			return nil
+		}
+		fmt.Printf("%12s  %s  %s\n", azure.FormatBytes(item.Size), item.LastModifiedDateTime.Local().Format("2006-01-02 15:04"), item.Name)
+		return nil
+	})
+	if err != nil {
+		fmt.Println("failed to list folder:", err.Error())
+		printErrorHint(err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%d item(s)\n", count)
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/global-index-source/ksau-go/azure"
+	"github.com/global-index-source/ksau-go/crypto"
+)
+
+const (
+	// signPassphraseEnv holds the passphrase of the --sign-key private key.
+	signPassphraseEnv = "KSAU_SIGN_PASSPHRASE"
+
+	manifestSuffix  = ".manifest.json"
+	signatureSuffix = ".asc"
+)
+
+// uploadManifest describes an uploaded file, so downstream users can verify
+// that what they downloaded is what the maintainer uploaded.
+type uploadManifest struct {
+	File         string    `json:"file"`
+	Size         int64     `json:"size"`
+	QuickXorHash string    `json:"quickXorHash"`
+	URL          string    `json:"url"`
+	Remote       string    `json:"remote"`
+	Time         time.Time `json:"time"`
+}
+
+// publishManifest uploads a manifest of the uploaded file and its detached
+// signature made with --sign-key next to the file. Failures only produce a
+// warning, the upload itself already succeeded.
+func publishManifest(result *uploadResult, fileSize int64, httpClient *http.Client) {
+	if signKey == "" {
+		return
+	}
+
+	if err := uploadSignedManifest(result, fileSize, httpClient); err != nil {
+		fmt.Printf("%sWarning: could not publish signed manifest: %v%s\n", ColorYellow, err, ColorReset)
+		return
+	}
+	fmt.Printf("%sManifest:%s %s%s\n", ColorGreen, ColorReset, result.downloadURL, manifestSuffix)
+	fmt.Printf("%sSignature:%s %s%s%s\n", ColorGreen, ColorReset, result.downloadURL, manifestSuffix, signatureSuffix)
+}
+
+func uploadSignedManifest(result *uploadResult, fileSize int64, httpClient *http.Client) error {
+	armoredKey, err := os.ReadFile(signKey)
+	if err != nil {
+		return fmt.Errorf("failed to read signing key: %w", err)
+	}
+	var passphrase []byte
+	if value := os.Getenv(signPassphraseEnv); value != "" {
+		passphrase = []byte(value)
+	}
+
+	hash, err := result.contentHash()
+	if err != nil {
+		return fmt.Errorf("failed to hash %s: %w", filePath, err)
+	}
+
+	manifest := uploadManifest{
+		File:         filepath.Base(result.remotePath),
+		Size:         fileSize,
+		QuickXorHash: hash,
+		URL:          result.downloadURL,
+		Remote:       result.remote,
+		Time:         time.Now().UTC(),
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	signature, err := crypto.SignDetached(data, string(armoredKey), passphrase)
+	if err != nil {
+		return err
+	}
+
+	manifestPath := result.remotePath + manifestSuffix
+	if _, err := result.client.UploadSmall(httpClient, manifestPath, data, azure.ConflictReplace); err != nil {
+		return fmt.Errorf("failed to upload manifest: %w", err)
+	}
+	if _, err := result.client.UploadSmall(httpClient, manifestPath+signatureSuffix, signature, azure.ConflictReplace); err != nil {
+		return fmt.Errorf("failed to upload signature: %w", err)
+	}
+	return nil
+}
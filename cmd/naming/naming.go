@@ -0,0 +1,159 @@
+package naming
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Strategy represents different ways of naming an uploaded file
+type Strategy string
+
+const (
+	StrategyKeep     Strategy = "keep"     // archive.zip
+	StrategyRandom   Strategy = "random"   // archive-3f9a1c.zip
+	StrategyHash     Strategy = "hash"     // 9f86d081884c7d65.zip
+	StrategyUUID     Strategy = "uuid"     // 1b4e28ba-2fa1-41d2-883f-0016d3cca427.zip
+	StrategyDateTime Strategy = "datetime" // archive-20250102-150405.zip
+)
+
+// ValidStrategies returns a list of valid naming strategies
+func ValidStrategies() []Strategy {
+	return []Strategy{
+		StrategyKeep,
+		StrategyRandom,
+		StrategyHash,
+		StrategyUUID,
+		StrategyDateTime,
+	}
+}
+
+// IsValid reports whether s is one of the known strategies
+func IsValid(s Strategy) bool {
+	for _, valid := range ValidStrategies() {
+		if s == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// IsRandom reports whether the strategy produces a different name on every call
+func IsRandom(s Strategy) bool {
+	return s == StrategyRandom || s == StrategyUUID
+}
+
+// Generate returns the remote name for a file according to the strategy.
+// name is the name the file would get without any strategy applied (usually
+// the local file name), localPath is used to read the content for the hash
+// strategy. The extension of name is always preserved.
+func Generate(strategy Strategy, name string, localPath string) (string, error) {
+	return GenerateFromContent(strategy, name, func(w io.Writer) error {
+		file, err := os.Open(localPath)
+		if err != nil {
+			return fmt.Errorf("failed to open file for hashing: %w", err)
+		}
+		defer file.Close()
+		_, err = io.Copy(w, file)
+		return err
+	})
+}
+
+// GenerateFromContent is Generate for content that isn't a single local file,
+// e.g. an archive of a directory. write writes the content that is uploaded
+// and is only called by the hash strategy.
+func GenerateFromContent(strategy Strategy, name string, write func(io.Writer) error) (string, error) {
+	ext := Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	switch strategy {
+	case StrategyKeep, "":
+		return name, nil
+	case StrategyRandom:
+		suffix, err := randomHex(3)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s-%s%s", base, suffix, ext), nil
+	case StrategyHash:
+		sum, err := contentHash(write)
+		if err != nil {
+			return "", err
+		}
+		return sum[:16] + ext, nil
+	case StrategyUUID:
+		id, err := newUUID()
+		if err != nil {
+			return "", err
+		}
+		return id + ext, nil
+	case StrategyDateTime:
+		return fmt.Sprintf("%s-%s%s", base, time.Now().Format("20060102-150405"), ext), nil
+	default:
+		return "", fmt.Errorf("unknown naming strategy: %s", strategy)
+	}
+}
+
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate random name: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// newUUID generates a random (version 4) UUID
+func newUUID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate uuid: %w", err)
+	}
+	buf[6] = (buf[6] & 0x0f) | 0x40 // version 4
+	buf[8] = (buf[8] & 0x3f) | 0x80 // RFC 4122 variant
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", buf[0:4], buf[4:6], buf[6:8], buf[8:10], buf[10:16]), nil
+}
+
+// layerExts are extensions of compressed or encrypted files, which are part of
+// a longer extension with the one of the file inside, e.g. ".tar.gz".
+var layerExts = []string{".gz", ".zst", ".xz", ".bz2", ".lz4", ".age", ".gpg"}
+
+// Ext returns the extension of name, including the extensions of the formats
+// wrapped in compression or encryption, e.g. ".tar.gz" or ".zip.age". Unlike
+// filepath.Ext, stripping it leaves no part of the extension behind.
+func Ext(name string) string {
+	base := filepath.Base(name)
+	ext := ""
+	for {
+		next := filepath.Ext(strings.TrimSuffix(base, ext))
+		if next == "" || len(next) == len(base)-len(ext) || (ext != "" && !isExt(next)) {
+			return ext
+		}
+		ext = next + ext
+		if !slices.Contains(layerExts, strings.ToLower(next)) {
+			return ext
+		}
+	}
+}
+
+// isExt reports whether an extension inside a layer extension looks like a
+// file type and not like part of a version, e.g. ".2" of "release-1.2.gz".
+func isExt(ext string) bool {
+	return len(ext) <= 6 && strings.IndexFunc(ext[1:], unicode.IsLetter) >= 0
+}
+
+func contentHash(write func(io.Writer) error) (string, error) {
+	hasher := sha256.New()
+	if err := write(hasher); err != nil {
+		return "", fmt.Errorf("failed to hash file: %w", err)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
@@ -0,0 +1,87 @@
+package naming
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestExt(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"archive.zip", ".zip"},
+		{"backup.tar.gz", ".tar.gz"},
+		{"backup.TAR.GZ", ".TAR.GZ"},
+		{"backup.tar.zst", ".tar.zst"},
+		{"photos.zip.age", ".zip.age"},
+		{"site.tar.zst.age", ".tar.zst.age"},
+		{"notes.txt.gz", ".txt.gz"},
+		{"dump.gz", ".gz"},
+		{"release-1.2.gz", ".gz"},
+		{"release-1.2", ".2"},
+		{"README", ""},
+		{".bashrc", ""},
+		{".tar.gz", ".gz"},
+		{"dir.d/file", ""},
+		{"dir/backup.tar.gz", ".tar.gz"},
+	}
+	for _, tc := range tests {
+		if got := Ext(tc.name); got != tc.want {
+			t.Errorf("Ext(%q) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestGenerateKeepsExtension(t *testing.T) {
+	localPath := filepath.Join(t.TempDir(), "content")
+	if err := os.WriteFile(localPath, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	patterns := map[Strategy]string{
+		StrategyKeep:     `^backup\.tar\.gz$`,
+		StrategyRandom:   `^backup-[0-9a-f]{6}\.tar\.gz$`,
+		StrategyHash:     `^2cf24dba5fb0a30e\.tar\.gz$`,
+		StrategyUUID:     `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}\.tar\.gz$`,
+		StrategyDateTime: `^backup-\d{8}-\d{6}\.tar\.gz$`,
+	}
+	for strategy, pattern := range patterns {
+		got, err := Generate(strategy, "backup.tar.gz", localPath)
+		if err != nil {
+			t.Errorf("Generate(%s) failed: %v", strategy, err)
+			continue
+		}
+		if !regexp.MustCompile(pattern).MatchString(got) {
+			t.Errorf("Generate(%s) = %q, want a match of %s", strategy, got, pattern)
+		}
+	}
+}
+
+func TestGenerateFromContentHashesTheContent(t *testing.T) {
+	got, err := GenerateFromContent(StrategyHash, "photos.zip", func(w io.Writer) error {
+		_, err := io.Copy(w, strings.NewReader("hello"))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "2cf24dba5fb0a30e.zip"; got != want {
+		t.Errorf("GenerateFromContent = %q, want %q", got, want)
+	}
+
+	called := false
+	if _, err := GenerateFromContent(StrategyRandom, "photos.zip", func(io.Writer) error {
+		called = true
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if called {
+		t.Error("the content was read for a strategy that doesn't need it")
+	}
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/global-index-source/ksau-go/azure"
+)
+
+const (
+	// exitOffline is the exit status of commands that need the network when
+	// there is none, so scripts can tell it apart from other failures.
+	exitOffline = 4
+
+	// graphHost is probed to detect whether the network is reachable, unless
+	// the remotes use the Graph endpoint of another cloud.
+	graphHost = "graph.microsoft.com:443"
+
+	// offlineProbeTimeout bounds the reachability probe, so an unplugged
+	// machine fails in seconds instead of waiting for the HTTP timeouts.
+	offlineProbeTimeout = 3 * time.Second
+)
+
+// errOffline is returned for network operations in offline mode.
+var errOffline = errors.New("offline")
+
+// offline is set by --offline and skips every network operation.
+var offline bool
+
+// checkOnline returns errOffline if --offline is set or address (host:port)
+// can't be reached. Behind a proxy, the proxy is probed instead.
+func checkOnline(address string) error {
+	if offline {
+		return fmt.Errorf("%w: --offline is set", errOffline)
+	}
+	address = proxyAddress(address)
+
+	conn, err := net.DialTimeout("tcp", address, offlineProbeTimeout)
+	if err != nil {
+		return fmt.Errorf("%w: cannot reach %s: %v", errOffline, address, err)
+	}
+	conn.Close()
+	return nil
+}
+
+// requireNetwork exits with exitOffline unless address is reachable. An empty
+// address probes Microsoft Graph, and if that fails the Graph endpoints of the
+// remotes in the config, e.g. on national clouds or networks only allowing
+// those.
+func requireNetwork(address string) {
+	var err error
+	if address != "" {
+		err = checkOnline(address)
+	} else if err = checkOnline(graphHost); err != nil && !offline {
+		for _, remoteAddress := range remoteGraphAddresses() {
+			if remoteAddress != graphHost && checkOnline(remoteAddress) == nil {
+				err = nil
+				break
+			}
+		}
+	}
+	if err != nil {
+		fmt.Printf("%sThis command needs network access (%v)%s\n", ColorRed, err, ColorReset)
+		fmt.Println("hint: local commands like stats, list-remotes and version work offline")
+		os.Exit(exitOffline)
+	}
+}
+
+// remoteGraphAddresses returns the host:port of the Graph endpoint of the
+// remote selected with --remote-config, or of every remote if none is.
+func remoteGraphAddresses() []string {
+	configData, err := getConfigData()
+	if err != nil {
+		return nil
+	}
+	parsed, err := azure.ParseRcloneConfigData(configData)
+	if err != nil {
+		return nil
+	}
+	selected, _ := rootCmd.PersistentFlags().GetString("remote-config")
+
+	var addresses []string
+	for _, section := range parsed {
+		name, ok := section["remote_name"]
+		if !ok || (selected != "" && !strings.HasPrefix(selected, groupPrefix) && name != selected) {
+			continue
+		}
+		endpoints, err := azure.EndpointsFromConfig(section)
+		if err != nil {
+			continue
+		}
+		if address := urlAddress(endpoints.GraphURL("")); address != "" && !slices.Contains(addresses, address) {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
+
+// urlAddress returns the host:port of rawURL for requireNetwork.
+func urlAddress(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return ""
+	}
+	if parsed.Port() != "" {
+		return parsed.Host
+	}
+	if parsed.Scheme == "http" {
+		return net.JoinHostPort(parsed.Hostname(), "80")
+	}
+	return net.JoinHostPort(parsed.Hostname(), "443")
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/global-index-source/ksau-go/crypto"
+	"golang.org/x/term"
+)
+
+// configPassphraseEnv holds the passphrase of a passphrase protected config,
+// for scripts and CI where nobody can answer the prompt.
+const configPassphraseEnv = "KSAU_CONFIG_PASSPHRASE"
+
+// newConfigPassphraseEnv holds the new passphrase when changing it from a
+// script, KSAU_CONFIG_PASSPHRASE then holds the old one.
+const newConfigPassphraseEnv = "KSAU_NEW_CONFIG_PASSPHRASE"
+
+// configPassphrase is the passphrase the local config was decrypted with, nil
+// if it is encrypted with the embedded key. configBackend is the format it was
+// in. Saving the config keeps both. configKeyMu guards them, serve and the
+// daemon load the config concurrently.
+var (
+	configKeyMu      sync.Mutex
+	configPassphrase []byte
+	configBackend    crypto.Backend
+)
+
+// loadedConfigKey returns the backend and passphrase of the local config.
+func loadedConfigKey() (crypto.Backend, []byte) {
+	configKeyMu.Lock()
+	defer configKeyMu.Unlock()
+	return configBackend, configPassphrase
+}
+
+// setConfigKey sets the backend and passphrase the local config is saved
+// with.
+func setConfigKey(backend crypto.Backend, passphrase []byte) {
+	configKeyMu.Lock()
+	defer configKeyMu.Unlock()
+	configBackend, configPassphrase = backend, passphrase
+}
+
+// decryptConfig decrypts a config with the backend its header names, trying
+// the passphrase of the local config or asking for one if it is passphrase
+// protected. It returns the backend and passphrase that decrypted it, which
+// only the caller loading the local config keeps.
+func decryptConfig(data []byte) ([]byte, crypto.Backend, []byte, error) {
+	backend := crypto.DetectBackend(data)
+
+	var passphrase []byte
+	if backend.NeedsPassphrase(data) {
+		_, passphrase = loadedConfigKey()
+		if passphrase == nil {
+			var err error
+			passphrase, err = readPassphrase("Config passphrase: ")
+			if err != nil {
+				return nil, nil, nil, err
+			}
+		}
+	}
+
+	decrypted, keyID, err := backend.Decrypt(data, passphrase)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if keyID != "" && crypto.IsDeprecatedKey(keyID) {
+		fmt.Fprintf(os.Stderr, "%swarning: the config is encrypted with the deprecated key %q, run 'ksau-go refresh' to get a current one%s\n", ColorYellow, keyID, ColorReset)
+	}
+	return decrypted, backend, passphrase, nil
+}
+
+// encryptConfig encrypts the config the way it was read: in the same format,
+// with the same passphrase or the embedded key.
+func encryptConfig(plain []byte) ([]byte, error) {
+	backend, passphrase := loadedConfigKey()
+	if backend == nil {
+		backend = crypto.DetectBackend(nil)
+	}
+	return backend.Encrypt(plain, passphrase)
+}
+
+// readPassphrase returns the passphrase from KSAU_CONFIG_PASSPHRASE, or asks
+// for it on the terminal without echoing it.
+func readPassphrase(prompt string) ([]byte, error) {
+	return readSecret(configPassphraseEnv, prompt)
+}
+
+// readSecret returns the value of the environment variable env, or asks for
+// it on the terminal without echoing it.
+func readSecret(env string, prompt string) ([]byte, error) {
+	if value, ok := os.LookupEnv(env); ok {
+		return []byte(value), nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("%w, set %s", crypto.ErrPassphraseRequired, env)
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("empty passphrase")
+	}
+	return passphrase, nil
+}
+
+// readNewPassphrase asks for a new passphrase twice, unless it comes from
+// KSAU_NEW_CONFIG_PASSPHRASE or KSAU_CONFIG_PASSPHRASE.
+func readNewPassphrase() ([]byte, error) {
+	for _, env := range []string{newConfigPassphraseEnv, configPassphraseEnv} {
+		if value, ok := os.LookupEnv(env); ok {
+			if value == "" {
+				return nil, fmt.Errorf("empty passphrase")
+			}
+			return []byte(value), nil
+		}
+	}
+
+	passphrase, err := readPassphrase("New passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	again, err := readPassphrase("Repeat passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(passphrase, again) {
+		return nil, fmt.Errorf("passphrases don't match")
+	}
+	return passphrase, nil
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// pprofListen is the address the profiling endpoints are served on, empty to
+// not serve them at all.
+var pprofListen string
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&pprofListen, "pprof", "", "Serve net/http/pprof profiling endpoints on this address (e.g. localhost:6060)")
+	cobra.OnInitialize(startPprof)
+}
+
+// startPprof serves the profiling endpoints under /debug/pprof/ in the
+// background. Uploads annotate their chunk phases, so they show up as tasks
+// and regions in traces taken from /debug/pprof/trace.
+func startPprof() {
+	if pprofListen == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	go func() {
+		if err := http.ListenAndServe(pprofListen, mux); err != nil {
+			fmt.Fprintf(os.Stderr, "%sWarning: pprof server stopped: %v%s\n", ColorYellow, err, ColorReset)
+		}
+	}()
+}
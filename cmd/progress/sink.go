@@ -0,0 +1,147 @@
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Sink receives progress updates. Implementations must be safe for use by
+// multiple goroutines.
+type Sink interface {
+	Update(uploaded, total int64)
+	Finish()
+}
+
+// Fanout forwards every update to all of its sinks
+type Fanout []Sink
+
+// Update forwards the update to all sinks
+func (f Fanout) Update(uploaded, total int64) {
+	for _, sink := range f {
+		sink.Update(uploaded, total)
+	}
+}
+
+// Finish finishes all sinks
+func (f Fanout) Finish() {
+	for _, sink := range f {
+		sink.Finish()
+	}
+}
+
+// Update implements Sink for the terminal renderer
+func (p *ProgressTracker) Update(uploaded, total int64) {
+	p.TotalSize = total
+	p.UpdateProgress(uploaded)
+}
+
+// Snapshot is the state of a transfer at one point in time
+type Snapshot struct {
+	Time     time.Time `json:"time"`
+	Uploaded int64     `json:"uploaded"`
+	Total    int64     `json:"total"`
+	Percent  float64   `json:"percent"`
+	Done     bool      `json:"done"`
+}
+
+func newSnapshot(uploaded, total int64, done bool) Snapshot {
+	percent := 0.0
+	if total > 0 {
+		percent = float64(uploaded) * 100 / float64(total)
+	}
+	return Snapshot{Time: time.Now(), Uploaded: uploaded, Total: total, Percent: percent, Done: done}
+}
+
+// JSONSink writes every update as a JSON line, e.g. for other programs
+// following the progress through a pipe
+type JSONSink struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+	last    Snapshot
+}
+
+// NewJSONSink creates a sink writing JSON lines to w
+func NewJSONSink(w io.Writer) *JSONSink {
+	return &JSONSink{encoder: json.NewEncoder(w)}
+}
+
+// Update writes the update as a JSON line
+func (s *JSONSink) Update(uploaded, total int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last = newSnapshot(uploaded, total, false)
+	s.encoder.Encode(s.last)
+}
+
+// Finish writes a final line marked as done
+func (s *JSONSink) Finish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last.Time = time.Now()
+	s.last.Done = true
+	s.encoder.Encode(s.last)
+}
+
+// StatusSink keeps the latest state in memory and serves it over HTTP, both
+// as JSON (for REST clients) and in the Prometheus text format
+type StatusSink struct {
+	mu   sync.Mutex
+	last Snapshot
+}
+
+// NewStatusSink creates an empty status sink
+func NewStatusSink() *StatusSink {
+	return &StatusSink{}
+}
+
+// Update stores the latest state
+func (s *StatusSink) Update(uploaded, total int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last = newSnapshot(uploaded, total, false)
+}
+
+// Finish marks the transfer as done
+func (s *StatusSink) Finish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last.Done = true
+}
+
+// Snapshot returns the latest state
+func (s *StatusSink) Snapshot() Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
+
+// Handler returns an http.Handler serving /progress (JSON) and /metrics (Prometheus)
+func (s *StatusSink) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/progress", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.Snapshot())
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		snapshot := s.Snapshot()
+		done := 0
+		if snapshot.Done {
+			done = 1
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprintln(w, "# HELP ksau_upload_uploaded_bytes Bytes uploaded so far.")
+		fmt.Fprintln(w, "# TYPE ksau_upload_uploaded_bytes gauge")
+		fmt.Fprintf(w, "ksau_upload_uploaded_bytes %d\n", snapshot.Uploaded)
+		fmt.Fprintln(w, "# HELP ksau_upload_total_bytes Size of the file being uploaded.")
+		fmt.Fprintln(w, "# TYPE ksau_upload_total_bytes gauge")
+		fmt.Fprintf(w, "ksau_upload_total_bytes %d\n", snapshot.Total)
+		fmt.Fprintln(w, "# HELP ksau_upload_done Whether the upload has finished.")
+		fmt.Fprintln(w, "# TYPE ksau_upload_done gauge")
+		fmt.Fprintf(w, "ksau_upload_done %d\n", done)
+	})
+	return mux
+}
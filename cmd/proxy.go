@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+
+	"github.com/spf13/cobra"
+)
+
+// proxyURL is the proxy given with --proxy. Without it the standard
+// HTTPS_PROXY, HTTP_PROXY and NO_PROXY variables are honored.
+var proxyURL string
+
+// proxySchemes are the proxy URL schemes net/http can talk to.
+var proxySchemes = []string{"http", "https", "socks5", "socks5h"}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&proxyURL, "proxy", "", "Proxy for all requests, e.g. http://proxy:3128 or socks5://localhost:1080 (default: $HTTPS_PROXY)")
+	cobra.OnInitialize(configureProxy)
+}
+
+// configureProxy points the default transport, which every HTTP client of
+// ksau-go is built from, at the --proxy URL.
+func configureProxy() {
+	if proxyURL == "" {
+		return
+	}
+
+	parsed, err := parseProxyURL(proxyURL)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+	http.DefaultTransport.(*http.Transport).Proxy = http.ProxyURL(parsed)
+}
+
+// parseProxyURL parses and checks a --proxy value.
+func parseProxyURL(rawURL string) (*url.URL, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL %s: %w", rawURL, err)
+	}
+	if !slices.Contains(proxySchemes, parsed.Scheme) || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %s, must be like http://host:port or socks5://host:port", rawURL)
+	}
+	return parsed, nil
+}
+
+// proxyAddress returns the host:port requests to address actually connect
+// to: the proxy if one is configured for it, address itself otherwise.
+func proxyAddress(address string) string {
+	proxy := http.DefaultTransport.(*http.Transport).Proxy
+	if proxy == nil {
+		return address
+	}
+
+	req, err := http.NewRequest("GET", "https://"+address, nil)
+	if err != nil {
+		return address
+	}
+	proxied, err := proxy(req)
+	if err != nil || proxied == nil {
+		return address
+	}
+
+	if proxied.Port() != "" {
+		return proxied.Host
+	}
+	switch proxied.Scheme {
+	case "socks5", "socks5h":
+		return net.JoinHostPort(proxied.Hostname(), "1080")
+	case "https":
+		return net.JoinHostPort(proxied.Hostname(), "443")
+	default:
+		return net.JoinHostPort(proxied.Hostname(), "80")
+	}
+}
@@ -0,0 +1,284 @@
+package queue
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Status is the state of a job in the queue.
+type Status string
+
+const (
+	Queued   Status = "queued"
+	Running  Status = "running"
+	Done     Status = "done"
+	Failed   Status = "failed"
+	Canceled Status = "canceled"
+)
+
+// ErrNotFound is returned for IDs of jobs that aren't in the queue.
+var ErrNotFound = errors.New("no such job")
+
+// Job is an upload of a local file into a remote folder.
+type Job struct {
+	ID     string `json:"id"`
+	File   string `json:"file"`   // absolute local path
+	Remote string `json:"remote"` // name of the remote in the config
+	Folder string `json:"folder"` // remote folder, relative to the remote's root folder
+	Name   string `json:"name,omitempty"`
+
+	NameStrategy string `json:"nameStrategy,omitempty"` // applied to Name, keep if empty
+
+	Schedule string `json:"schedule,omitempty"` // that queued the job, empty if submitted
+	Priority int    `json:"priority,omitempty"` // higher runs first
+
+	Status   Status    `json:"status"`
+	Attempts int       `json:"attempts"`
+	NotUntil time.Time `json:"notUntil,omitempty"` // earliest time of the next attempt
+	Error    string    `json:"error,omitempty"`    // of the last failed attempt
+	Link     string    `json:"link,omitempty"`
+
+	Size     int64 `json:"size,omitempty"`
+	Uploaded int64 `json:"uploaded,omitempty"`
+
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+// Queue is a list of jobs persisted as a JSON file, rewritten on every
+// change so it survives restarts. It is safe for concurrent use.
+type Queue struct {
+	path string
+
+	mutex sync.Mutex
+	jobs  []*Job
+}
+
+// Open loads the queue stored at path, an empty one if the file doesn't
+// exist yet. Jobs that were running when the previous process stopped are
+// queued again.
+func Open(path string) (*Queue, error) {
+	q := &Queue{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read queue: %w", err)
+	}
+	if err := json.Unmarshal(data, &q.jobs); err != nil {
+		return nil, fmt.Errorf("failed to parse queue %s: %w", path, err)
+	}
+	for _, job := range q.jobs {
+		if job.Status == Running {
+			job.Status = Queued
+			job.Uploaded = 0
+		}
+	}
+	return q, nil
+}
+
+// Add appends a job with a new ID and returns a copy of it.
+func (q *Queue) Add(job Job) (Job, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return Job{}, err
+	}
+	job.ID = hex.EncodeToString(id)
+	job.Status = Queued
+	job.Created = time.Now()
+	job.Updated = job.Created
+	q.jobs = append(q.jobs, &job)
+	return job, q.save()
+}
+
+// Next marks the queued job that is due with the highest priority, the
+// oldest of them, as running and returns a copy of it, or false if there is
+// none.
+func (q *Queue) Next() (Job, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	now := time.Now()
+	var next *Job
+	for _, job := range q.jobs {
+		if job.Status != Queued || job.NotUntil.After(now) {
+			continue
+		}
+		if next == nil || job.Priority > next.Priority {
+			next = job
+		}
+	}
+	if next == nil {
+		return Job{}, false
+	}
+	next.Status = Running
+	next.Attempts++
+	next.Updated = now
+	q.save()
+	return *next, true
+}
+
+// Cancel marks a queued or running job as canceled and returns a copy of it.
+// Stopping a running upload is up to the caller.
+func (q *Queue) Cancel(id string) (Job, error) {
+	return q.transition(id, func(job *Job) error {
+		if job.Status != Queued && job.Status != Running {
+			return fmt.Errorf("job %s is already %s", id, job.Status)
+		}
+		job.Status = Canceled
+		return nil
+	})
+}
+
+// Retry queues a failed or canceled job again with fresh attempts and returns
+// a copy of it.
+func (q *Queue) Retry(id string) (Job, error) {
+	return q.transition(id, func(job *Job) error {
+		if job.Status != Failed && job.Status != Canceled {
+			return fmt.Errorf("job %s is %s, only failed and canceled jobs can be retried", id, job.Status)
+		}
+		job.Status = Queued
+		job.Attempts = 0
+		job.NotUntil = time.Time{}
+		job.Error = ""
+		job.Uploaded = 0
+		return nil
+	})
+}
+
+// Finished reports whether the job ended and is only kept for the record.
+func (job Job) Finished() bool {
+	return job.Status == Done || job.Status == Failed || job.Status == Canceled
+}
+
+// Prune removes the finished jobs last updated before cutoff, then the oldest
+// finished jobs beyond the keep most recent ones, and returns copies of the
+// removed jobs. A zero cutoff or a negative keep doesn't limit by that.
+func (q *Queue) Prune(cutoff time.Time, keep int) ([]Job, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	// Most recently updated first, so the kept ones come first
+	finished := make([]*Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		if job.Finished() {
+			finished = append(finished, job)
+		}
+	}
+	sort.SliceStable(finished, func(i, j int) bool { return finished[i].Updated.After(finished[j].Updated) })
+
+	remove := make(map[*Job]bool)
+	for i, job := range finished {
+		if (!cutoff.IsZero() && job.Updated.Before(cutoff)) || (keep >= 0 && i >= keep) {
+			remove[job] = true
+		}
+	}
+	if len(remove) == 0 {
+		return nil, nil
+	}
+
+	var removed []Job
+	kept := q.jobs[:0]
+	for _, job := range q.jobs {
+		if remove[job] {
+			removed = append(removed, *job)
+		} else {
+			kept = append(kept, job)
+		}
+	}
+	q.jobs = kept
+	return removed, q.save()
+}
+
+// transition applies fn to the job with the given ID unless it refuses, and
+// saves the queue.
+func (q *Queue) transition(id string, fn func(*Job) error) (Job, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for _, job := range q.jobs {
+		if job.ID != id {
+			continue
+		}
+		if err := fn(job); err != nil {
+			return Job{}, err
+		}
+		job.Updated = time.Now()
+		return *job, q.save()
+	}
+	return Job{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+}
+
+// Update applies fn to the job with the given ID and saves the queue. Pass
+// persist false for frequent changes like progress, which aren't worth a
+// write each.
+func (q *Queue) Update(id string, persist bool, fn func(*Job)) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for _, job := range q.jobs {
+		if job.ID == id {
+			fn(job)
+			job.Updated = time.Now()
+			if !persist {
+				return nil
+			}
+			return q.save()
+		}
+	}
+	return fmt.Errorf("no job %s", id)
+}
+
+// Get returns a copy of the job with the given ID.
+func (q *Queue) Get(id string) (Job, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for _, job := range q.jobs {
+		if job.ID == id {
+			return *job, true
+		}
+	}
+	return Job{}, false
+}
+
+// List returns copies of all jobs, oldest first.
+func (q *Queue) List() []Job {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	jobs := make([]Job, len(q.jobs))
+	for i, job := range q.jobs {
+		jobs[i] = *job
+	}
+	sort.SliceStable(jobs, func(i, j int) bool { return jobs[i].Created.Before(jobs[j].Created) })
+	return jobs
+}
+
+// save writes the queue to a temporary file and renames it into place, so a
+// crash never leaves a truncated queue behind. The caller holds the mutex.
+func (q *Queue) save() error {
+	data, err := json.MarshalIndent(q.jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := q.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to save queue: %w", err)
+	}
+	if err := os.Rename(tmpPath, q.path); err != nil {
+		return fmt.Errorf("failed to save queue: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package queue
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// openWith returns a queue in a temporary directory holding jobs with the
+// given statuses, job i last updated i hours ago.
+func openWith(t *testing.T, statuses ...Status) *Queue {
+	t.Helper()
+	q, err := Open(filepath.Join(t.TempDir(), "queue.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i, status := range statuses {
+		job, err := q.Add(Job{File: "/tmp/file", Remote: "oned", Folder: "/"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		q.Update(job.ID, true, func(j *Job) { j.Status = status })
+		q.jobs[i].Updated = now.Add(-time.Duration(i) * time.Hour)
+	}
+	return q
+}
+
+func statuses(jobs []Job) []Status {
+	var result []Status
+	for _, job := range jobs {
+		result = append(result, job.Status)
+	}
+	return result
+}
+
+func TestPrune(t *testing.T) {
+	tests := []struct {
+		name    string
+		cutoff  time.Duration // ago, 0 for none
+		keep    int
+		removed int
+	}{
+		{"everything", 0, 0, 3},
+		{"no limits", 0, -1, 0},
+		{"by age", 90 * time.Minute, -1, 2},
+		{"by count", 0, 2, 1},
+		{"by age and count", 150 * time.Minute, 1, 2},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// Updated 0h, 1h, ... ago
+			q := openWith(t, Done, Queued, Failed, Running, Canceled)
+			var cutoff time.Time
+			if tc.cutoff > 0 {
+				cutoff = time.Now().Add(-tc.cutoff)
+			}
+			removed, err := q.Prune(cutoff, tc.keep)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(removed) != tc.removed {
+				t.Fatalf("removed %v, want %d jobs", statuses(removed), tc.removed)
+			}
+			left := statuses(q.List())
+			if !slices.Contains(left, Queued) || !slices.Contains(left, Running) {
+				t.Errorf("unfinished jobs were removed, left %v", left)
+			}
+			if len(left) != 5-tc.removed {
+				t.Errorf("left %v, want %d jobs", left, 5-tc.removed)
+			}
+		})
+	}
+}
+
+func TestPruneRemovesTheOldest(t *testing.T) {
+	q := openWith(t, Done, Failed, Canceled)
+	removed, err := q.Prune(time.Time{}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := statuses(removed); !slices.Equal(got, []Status{Failed, Canceled}) {
+		t.Errorf("removed %v, want the older failed and canceled jobs", got)
+	}
+
+	reopened, err := Open(q.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := statuses(reopened.List()); !slices.Equal(got, []Status{Done}) {
+		t.Errorf("saved queue has %v, want only the done job", got)
+	}
+}
@@ -1,15 +1,37 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
-	"net/http"
-	"sync"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/global-index-source/ksau-go/azure"
 	"github.com/spf13/cobra"
 )
 
+// exitQuotaWarning is the exit status used when a remote is above the --warn
+// threshold, so cron jobs can tell it apart from plain failures.
+const exitQuotaWarning = 3
+
+// Values accepted by --sort
+const (
+	quotaSortFree  = "free"
+	quotaSortUsage = "usage"
+)
+
+var (
+	quotaWarn    float64
+	quotaSort    string
+	quotaRemotes []string
+	quotaCached  bool
+	quotaMaxAge  string
+)
+
 var quotaCmd = &cobra.Command{
 	Use:   "quota",
 	Short: "Display OneDrive quota information",
@@ -19,46 +41,211 @@ var quotaCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(quotaCmd)
+
+	quotaCmd.Flags().Float64Var(&quotaWarn, "warn", 0, "Highlight remotes whose usage is at or above this percentage and exit with status 3")
+	quotaCmd.Flags().StringVar(&quotaSort, "sort", "", "Sort remotes by free space (free) or by usage (usage), most first")
+	quotaCmd.Flags().BoolVar(&quotaCached, "cached", false, "Print the last stored quota without network calls")
+	quotaCmd.Flags().StringVar(&quotaMaxAge, "max-age", "", "Use stored quota, but refresh remotes whose stored quota is older than this (e.g. 30m, 1d)")
+	// Shadows the persistent --remote-config so it can be repeated or given a comma list
+	quotaCmd.Flags().StringSliceVarP(&quotaRemotes, "remote-config", "c", nil, "Only show these remotes (repeatable or comma separated)")
+}
+
+// usagePercent returns how much of the quota is used, in percent.
+func usagePercent(quota *azure.DriveQuota) float64 {
+	if quota.Total <= 0 {
+		return 0
+	}
+	return float64(quota.Used) * 100 / float64(quota.Total)
 }
 
 func runQuota(cmd *cobra.Command, args []string) {
+	if quotaSort != "" && quotaSort != quotaSortFree && quotaSort != quotaSortUsage {
+		fmt.Printf("invalid --sort value %q, must be %s or %s\n", quotaSort, quotaSortFree, quotaSortUsage)
+		os.Exit(1)
+	}
+
+	maxAge, err := parseAge(quotaMaxAge)
+	if err != nil {
+		fmt.Println("invalid --max-age value:", err.Error())
+		os.Exit(1)
+	}
+
 	// Read the rclone config file
 	configData, err := getConfigData()
 	if err != nil {
 		fmt.Println("Failed to read config file:", err.Error())
-		return
+		os.Exit(1)
 	}
 
 	rcloneConfigFile, err := azure.ParseRcloneConfigData(configData)
 	if err != nil {
 		fmt.Println("Failed to parse rclone config file:", err.Error())
+		os.Exit(1)
 	}
 
-	httpClient := &http.Client{Timeout: 10 * time.Second}
+	httpClient := sharedHTTPClient()
 
 	availRemotes := azure.GetAvailableRemotes(&rcloneConfigFile)
+	if len(quotaRemotes) > 0 {
+		availRemotes, err = selectRemotes(availRemotes, quotaRemotes)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	}
 
-	var wg = new(sync.WaitGroup)
+	// Use stored snapshots where allowed and only query the rest
+	var results []remoteResult[*azure.DriveQuota]
+	var ages map[string]time.Duration
+	fetch := availRemotes
+	if quotaCached || maxAge > 0 {
+		results, ages, fetch = cachedQuotas(availRemotes, maxAge)
+	}
 
-	for _, remoteName := range availRemotes {
-		wg.Add(1)
-		go func(rName string) {
-			client, err := azure.NewAzureClientFromRcloneConfigData(configData, rName)
-			if err != nil {
-				fmt.Printf("Failed to initialize client for remote '%s': %v\n", rName, err)
-				return
-			}
+	if len(fetch) > 0 {
+		requireNetwork("")
+	}
 
-			quota, err := client.GetDriveQuota(httpClient)
-			if err != nil {
-				fmt.Printf("Failed to fetch quota information for remote '%s': %v\n", rName, err)
-				return
-			}
+	fetched := fanOut(fetch, func(rName string) (*azure.DriveQuota, error) {
+		client, err := azure.NewAzureClientFromRcloneConfigData(configData, rName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize client: %w", err)
+		}
+
+		quota, err := client.GetDriveQuota(httpClient)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch quota information: %w", err)
+		}
+		return quota, nil
+	})
+	saveQuotaSnapshots(fetched)
+	results = append(results, fetched...)
+	sort.SliceStable(results, func(i, j int) bool {
+		return slices.Index(availRemotes, results[i].remote) < slices.Index(availRemotes, results[j].remote)
+	})
+
+	var quotas []remoteResult[*azure.DriveQuota]
+	for _, result := range results {
+		if result.err == nil {
+			quotas = append(quotas, result)
+		}
+	}
+	sortQuotas(quotas, quotaSort)
 
-			azure.DisplayQuotaInfo(remoteName, quota)
-			wg.Done()
-		}(remoteName)
+	var warnings []string
+	for _, result := range quotas {
+		if usage := usagePercent(result.value); quotaWarn > 0 && usage >= quotaWarn {
+			warnings = append(warnings, fmt.Sprintf("remote '%s' is %.1f%% full (threshold %.1f%%)", result.remote, usage, quotaWarn))
+		}
 	}
+	printQuotaTable(quotas, ages)
 
-	wg.Wait()
+	for _, warning := range warnings {
+		fmt.Printf("%sWarning: %s%s\n", ColorRed, warning, ColorReset)
+	}
+
+	status := reportFailures(results)
+	if status == 0 && len(warnings) > 0 {
+		status = exitQuotaWarning
+	}
+	os.Exit(status)
+}
+
+// cachedQuotas splits remotes into those with a stored snapshot younger than
+// maxAge (any age if maxAge is 0), returned as results together with their
+// age, and those that have to be fetched.
+func cachedQuotas(remotes []string, maxAge time.Duration) ([]remoteResult[*azure.DriveQuota], map[string]time.Duration, []string) {
+	snapshots := loadQuotaSnapshots()
+
+	var results []remoteResult[*azure.DriveQuota]
+	ages := make(map[string]time.Duration)
+	var fetch []string
+	for _, remote := range remotes {
+		snapshot, ok := snapshots[remote]
+		age := time.Since(snapshot.Time)
+		if !ok || (maxAge > 0 && age > maxAge) {
+			fetch = append(fetch, remote)
+			continue
+		}
+		results = append(results, remoteResult[*azure.DriveQuota]{remote: remote, value: &snapshot.Quota})
+		ages[remote] = age
+	}
+	return results, ages, fetch
+}
+
+// selectRemotes returns the requested remotes in the order given, failing on
+// any remote that isn't configured.
+func selectRemotes(available []string, requested []string) ([]string, error) {
+	var selected []string
+	seen := make(map[string]bool)
+	for _, remote := range requested {
+		remote = strings.TrimSpace(remote)
+		if remote == "" || seen[remote] {
+			continue
+		}
+		if !slices.Contains(available, remote) {
+			return nil, fmt.Errorf("remote '%s' not found in config, available: %s", remote, strings.Join(available, ", "))
+		}
+		seen[remote] = true
+		selected = append(selected, remote)
+	}
+	return selected, nil
+}
+
+// sortQuotas orders the quotas for display, keeping the config order if by is empty.
+func sortQuotas(quotas []remoteResult[*azure.DriveQuota], by string) {
+	switch by {
+	case quotaSortFree:
+		sort.SliceStable(quotas, func(i, j int) bool {
+			return quotas[i].value.Remaining > quotas[j].value.Remaining
+		})
+	case quotaSortUsage:
+		sort.SliceStable(quotas, func(i, j int) bool {
+			return usagePercent(quotas[i].value) > usagePercent(quotas[j].value)
+		})
+	}
+}
+
+// printQuotaTable prints all quotas as one aligned table. Rows at or above the
+// --warn threshold are highlighted. If ages is given, an Age column shows how
+// old each row is, with fresh rows shown as "now".
+func printQuotaTable(quotas []remoteResult[*azure.DriveQuota], ages map[string]time.Duration) {
+	if len(quotas) == 0 {
+		return
+	}
+
+	// Render without colors first, escape codes would throw off the alignment
+	var table bytes.Buffer
+	writer := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	header := "Remote\tTotal\tUsed\tFree\tTrashed\tUse%"
+	if ages != nil {
+		header += "\tAge"
+	}
+	fmt.Fprintln(writer, header)
+	for _, result := range quotas {
+		quota := result.value
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%.1f%%", result.remote,
+			azure.FormatBytes(quota.Total), azure.FormatBytes(quota.Used),
+			azure.FormatBytes(quota.Remaining), azure.FormatBytes(quota.Deleted), usagePercent(quota))
+		if ages != nil {
+			age, ok := ages[result.remote]
+			if ok {
+				fmt.Fprintf(writer, "\t%s", age.Round(time.Second))
+			} else {
+				fmt.Fprint(writer, "\tnow")
+			}
+		}
+		fmt.Fprintln(writer)
+	}
+	writer.Flush()
+
+	lines := strings.Split(strings.TrimSuffix(table.String(), "\n"), "\n")
+	fmt.Println(lines[0])
+	for i, line := range lines[1:] {
+		if usage := usagePercent(quotas[i].value); quotaWarn > 0 && usage >= quotaWarn {
+			line = ColorRed + line + ColorReset
+		}
+		fmt.Println(line)
+	}
+	fmt.Println()
 }
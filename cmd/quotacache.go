@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/global-index-source/ksau-go/azure"
+)
+
+// quotaSnapshot is the last known quota of a remote.
+type quotaSnapshot struct {
+	Time  time.Time        `json:"time"`
+	Quota azure.DriveQuota `json:"quota"`
+}
+
+// loadQuotaSnapshots returns the stored quota snapshots by remote. A missing or
+// broken snapshot file just means nothing is cached.
+func loadQuotaSnapshots() map[string]quotaSnapshot {
+	snapshots := make(map[string]quotaSnapshot)
+	if snapshotPath, err := getStatePath("quota.json"); err == nil {
+		if data, err := os.ReadFile(snapshotPath); err == nil {
+			json.Unmarshal(data, &snapshots)
+		}
+	}
+	return snapshots
+}
+
+// saveQuotaSnapshots stores the successful results, keeping the snapshots of
+// remotes that weren't queried this time.
+func saveQuotaSnapshots(results []remoteResult[*azure.DriveQuota]) {
+	snapshotPath, err := getStatePath("quota.json")
+	if err != nil {
+		return
+	}
+
+	snapshots := loadQuotaSnapshots()
+	now := time.Now()
+	for _, result := range results {
+		if result.err == nil {
+			snapshots[result.remote] = quotaSnapshot{Time: now, Quota: *result.value}
+		}
+	}
+
+	if data, err := json.Marshal(snapshots); err == nil {
+		os.WriteFile(snapshotPath, data, 0644)
+	}
+}
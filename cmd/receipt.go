@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/global-index-source/ksau-go/crypto"
+)
+
+// uploadReceipt is one line of a remote's receipts log, recording who uploaded
+// what. Sig is the base64 encoded detached signature of the line without Sig,
+// made with --sign-key.
+type uploadReceipt struct {
+	Time         time.Time `json:"time"`
+	Nick         string    `json:"nick"`
+	Path         string    `json:"path"`
+	QuickXorHash string    `json:"quickXorHash"`
+	Size         int64     `json:"size"`
+	Sig          string    `json:"sig,omitempty"`
+}
+
+// defaultNick is the uploader nick used when --nick isn't given.
+func defaultNick() string {
+	if current, err := user.Current(); err == nil && current.Username != "" {
+		return current.Username
+	}
+	return "anonymous"
+}
+
+// appendReceipt appends a receipt for the upload of localPath to the remote's
+// receipts log, if the remote has one, and reports it to out. Failures only
+// produce a warning, the upload itself already succeeded.
+func appendReceipt(out io.Writer, result *uploadResult, localPath string, fileSize int64, httpClient *http.Client) {
+	if result.client.ReceiptsLog == "" || noReceipt {
+		return
+	}
+
+	line, err := receiptLine(result, localPath, fileSize)
+	if err == nil {
+		err = result.client.AppendToFile(httpClient, result.client.ReceiptsLog, line)
+	}
+	if err != nil {
+		fmt.Fprintf(out, "%sWarning: could not write upload receipt: %v%s\n", ColorYellow, err, ColorReset)
+		return
+	}
+	fmt.Fprintln(out, "Receipt added to", result.client.ReceiptsLog)
+}
+
+// receiptLine returns the receipts log line of the upload of localPath, which
+// is only read if the result doesn't know the hash of the content yet.
+func receiptLine(result *uploadResult, localPath string, fileSize int64) ([]byte, error) {
+	hash := result.hash
+	if hash == "" {
+		var err error
+		if hash, err = localQuickXorHash(localPath); err != nil {
+			return nil, fmt.Errorf("failed to hash %s: %w", localPath, err)
+		}
+	}
+
+	nick := uploaderNick
+	if nick == "" {
+		nick = defaultNick()
+	}
+
+	receipt := uploadReceipt{
+		Time:         time.Now().UTC(),
+		Nick:         nick,
+		Path:         result.remotePath,
+		QuickXorHash: hash,
+		Size:         fileSize,
+	}
+
+	if signKey != "" {
+		unsigned, err := json.Marshal(receipt)
+		if err != nil {
+			return nil, err
+		}
+		armoredKey, err := os.ReadFile(signKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read signing key: %w", err)
+		}
+		var passphrase []byte
+		if value := os.Getenv(signPassphraseEnv); value != "" {
+			passphrase = []byte(value)
+		}
+		signature, err := crypto.SignDetachedBinary(unsigned, string(armoredKey), passphrase)
+		if err != nil {
+			return nil, err
+		}
+		receipt.Sig = base64.StdEncoding.EncodeToString(signature)
+	}
+
+	line, err := json.Marshal(receipt)
+	if err != nil {
+		return nil, err
+	}
+	return append(line, '\n'), nil
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReceiptLine(t *testing.T) {
+	localPath := filepath.Join(t.TempDir(), "rom.zip")
+	if err := os.WriteFile(localPath, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fileHash, err := localQuickXorHash(localPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		result *uploadResult
+		want   string
+	}{
+		{"file", &uploadResult{remotePath: "/Builds/rom.zip"}, fileHash},
+		{"known hash", &uploadResult{remotePath: "/Builds/rom.zip", hash: "streamed"}, "streamed"},
+	}
+	for _, tc := range tests {
+		line, err := receiptLine(tc.result, localPath, 5)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		var receipt uploadReceipt
+		if err := json.Unmarshal(line, &receipt); err != nil {
+			t.Errorf("%s: receipt isn't JSON: %v", tc.name, err)
+			continue
+		}
+		if receipt.QuickXorHash != tc.want || receipt.Path != "/Builds/rom.zip" || receipt.Size != 5 {
+			t.Errorf("%s: receipt = %+v, want hash %s of /Builds/rom.zip", tc.name, receipt, tc.want)
+		}
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing.zip")
+	if _, err := receiptLine(&uploadResult{}, missing, 5); err == nil || !strings.Contains(err.Error(), missing) {
+		t.Errorf("receipt of a missing file failed with %v, want an error naming it", err)
+	}
+}
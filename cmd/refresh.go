@@ -1,17 +1,37 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"strings"
 
+	"github.com/global-index-source/ksau-go/azure"
+	"github.com/global-index-source/ksau-go/crypto"
 	"github.com/spf13/cobra"
 )
 
 const DEFAULT_URL string = "https://gist.githubusercontent.com/hakimifr/34c579f9a35c9da400e4df1ac73cf795/raw/rclone.conf.asc"
 
-var customUrl string
+// refreshSourcesFile lists config sources (gist, mirrors, IPFS gateways...)
+// one URL per line, tried in order. It lives next to the config.
+const refreshSourcesFile = "refresh-urls.txt"
+
+var (
+	customUrls       []string
+	refreshVerifyKey string
+	refreshSigURL    string
+	refreshNoVerify  bool
+	refreshForce     bool
+)
+
+// RefreshPublicKey is the minisign public key the community config is signed
+// with. Release builds set it with
+// -ldflags "-X github.com/global-index-source/ksau-go/cmd.RefreshPublicKey=<key>",
+// refresh then refuses configs without a valid signature.
+var RefreshPublicKey = ""
 
 var refreshCmd = &cobra.Command{
 	Use:   "refresh",
@@ -24,39 +44,207 @@ when using this tool, as this possibly fetches renewed tokens.`,
 func init() {
 	rootCmd.AddCommand(refreshCmd)
 
-	refreshCmd.Flags().StringVarP(&customUrl, "url", "u", "", "Sets a custom url (must be direct.)")
+	refreshCmd.Flags().StringArrayVarP(&customUrls, "url", "u", nil, "Custom url (must be direct), repeat it to fall back to further urls in order")
+	refreshCmd.Flags().StringVar(&refreshVerifyKey, "verify-key", "", "Public key file (PGP or minisign) the config must be signed with (default: the built-in key)")
+	refreshCmd.Flags().StringVar(&refreshSigURL, "sig-url", "", "URL of the detached signature (default: the config URL plus .minisig, or .sig for PGP keys)")
+	refreshCmd.Flags().BoolVar(&refreshForce, "force", false, "Fetch and write the config even if it didn't change since the last refresh")
+	refreshCmd.Flags().BoolVar(&refreshNoVerify, "no-verify", false, "Don't verify the signature of the config, even with a built-in key")
 }
 
 func runRefresh(cmd *cobra.Command, args []string) {
-	var targetUrl string
-	if customUrl != "" {
-		targetUrl = customUrl
-	} else {
-		targetUrl = DEFAULT_URL
+	urls, err := refreshURLs()
+	if err != nil {
+		fmt.Println("failed to read the config sources:", err.Error())
+		os.Exit(1)
+	}
+
+	// With mirrors, one unreachable host is no reason to give up
+	if len(urls) == 1 {
+		requireNetwork(urlAddress(urls[0]))
+	} else if offline {
+		requireNetwork("")
+	}
+
+	for i, url := range urls {
+		err := refreshFrom(url)
+		if err == nil {
+			return
+		}
+		fmt.Printf("%s%s%s\n", ColorRed, err.Error(), ColorReset)
+		if i < len(urls)-1 {
+			fmt.Println("trying the next config source...")
+		}
+	}
+
+	if len(urls) > 1 {
+		fmt.Printf("all %d config sources failed, keeping the current config\n", len(urls))
+	}
+	os.Exit(1)
+}
+
+// refreshURLs returns the config sources to try in order: --url if given,
+// otherwise those listed in refresh-urls.txt next to the config, otherwise
+// the default one.
+func refreshURLs() ([]string, error) {
+	if len(customUrls) > 0 {
+		return customUrls, nil
 	}
 
+	sourcesPath, err := getStatePath(refreshSourcesFile)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(sourcesPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return []string{DEFAULT_URL}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var urls []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			urls = append(urls, line)
+		}
+	}
+	if len(urls) == 0 {
+		return []string{DEFAULT_URL}, nil
+	}
+	return urls, nil
+}
+
+// refreshFrom fetches the config from targetUrl and, if it verifies and
+// validates, replaces the local config with it.
+func refreshFrom(targetUrl string) error {
 	fmt.Println("fetching rclone config from", targetUrl)
-	resp, err := http.Get(targetUrl)
+	req, err := http.NewRequest(http.MethodGet, targetUrl, nil)
 	if err != nil {
-		fmt.Println("failed to fetch config file:", err.Error())
-		os.Exit(1)
+		return fmt.Errorf("failed to fetch config file: %w", err)
+	}
+	if !refreshForce {
+		setConditionalHeaders(req, targetUrl)
+	}
+
+	resp, err := sharedHTTPClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch config file: %w", err)
 	}
 
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		fmt.Printf("%sthe config is already current%s\n", ColorGreen, ColorReset)
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch config file: %s", resp.Status)
+	}
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		fmt.Println("something is wrong with the response:", err.Error())
-		os.Exit(1)
+		return fmt.Errorf("something is wrong with the response: %w", err)
+	}
+
+	if err := verifyRefreshSignature(targetUrl, body); err != nil {
+		return fmt.Errorf("refusing to write the fetched config: %w", err)
+	}
+
+	// Never replace a working config with an error page or a broken config
+	remotes, err := validateFetchedConfig(body)
+	if err != nil {
+		return fmt.Errorf("refusing to write the fetched config: %w", err)
 	}
+	fmt.Printf("fetched config has %d usable remote(s): %s\n", len(remotes), strings.Join(remotes, ", "))
 
 	userConfigFilePath, err := getConfigPath()
 	if err != nil {
-		fmt.Println("cannot get your rclone config file path:", err.Error())
+		return fmt.Errorf("cannot get your rclone config file path: %w", err)
 	}
 
 	fmt.Println("writing config file to", userConfigFilePath)
-	err = os.WriteFile(userConfigFilePath, body, 0644)
+	if err := writeConfigFile(body); err != nil {
+		return fmt.Errorf("cannot write to your config file: %w", err)
+	}
+	saveRefreshState(targetUrl, resp)
+	fmt.Printf("to roll back, replace it with %s%s\n", userConfigFilePath, configBackupSuffix)
+	return nil
+}
+
+// validateFetchedConfig decrypts and parses a fetched config and returns the
+// remotes that have everything ksau-go needs. It fails if there are none.
+func validateFetchedConfig(body []byte) ([]string, error) {
+	plain, _, _, err := decryptConfig(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt it: %w", err)
+	}
+
+	parsed, err := azure.ParseRcloneConfigData(plain)
 	if err != nil {
-		fmt.Println("cannot write to your config file:", err.Error())
+		return nil, fmt.Errorf("failed to parse it: %w", err)
+	}
+
+	var remotes []string
+	for _, section := range parsed {
+		name, ok := section["remote_name"]
+		if !ok {
+			continue
+		}
+		usable := true
+		for _, issue := range validateRemote(section) {
+			usable = usable && issue.warning
+		}
+		if usable {
+			remotes = append(remotes, name)
+		}
+	}
+
+	if len(remotes) == 0 {
+		return nil, fmt.Errorf("it contains no usable remote")
+	}
+	return remotes, nil
+}
+
+// verifyRefreshSignature checks the detached signature of a fetched config
+// against --verify-key or the built-in RefreshPublicKey. Without either key,
+// or with --no-verify, nothing is checked.
+func verifyRefreshSignature(configURL string, body []byte) error {
+	publicKey := RefreshPublicKey
+	if refreshVerifyKey != "" {
+		data, err := os.ReadFile(refreshVerifyKey)
+		if err != nil {
+			return fmt.Errorf("failed to read public key: %w", err)
+		}
+		publicKey = string(data)
+	}
+	if publicKey == "" || refreshNoVerify {
+		return nil
+	}
+
+	sigURL := refreshSigURL
+	if sigURL == "" {
+		sigURL = configURL + ".minisig"
+		if crypto.SignatureFormat(publicKey) == crypto.SignatureFormatPGP {
+			sigURL = configURL + ".sig"
+		}
+	}
+
+	fmt.Println("fetching signature from", sigURL)
+	resp, err := sharedHTTPClient().Get(sigURL)
+	if err != nil {
+		return fmt.Errorf("failed to fetch signature: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch signature: %s", resp.Status)
+	}
+	signature, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to fetch signature: %w", err)
+	}
+
+	if err := crypto.VerifyDetached(body, signature, publicKey); err != nil {
+		return err
 	}
+	fmt.Printf("%ssignature verified%s\n", ColorGreen, ColorReset)
+	return nil
 }
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/global-index-source/ksau-go/crypto"
+)
+
+// TestValidateFetchedConfigKeepsTheLocalKey checks that decrypting a fetched
+// config protected by another passphrase doesn't change the passphrase the
+// local config is saved with.
+func TestValidateFetchedConfigKeepsTheLocalKey(t *testing.T) {
+	t.Cleanup(func() { setConfigKey(nil, nil) })
+	setConfigKey(nil, nil)
+	t.Setenv(configPassphraseEnv, "fetched")
+
+	backend, err := crypto.BackendByName("age")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := backend.Encrypt([]byte("[oned]\ntype = onedrive\nclient_id = id\nclient_secret = secret\ntenant = tenant\ndrive_id = drive\ndrive_type = business\n"), []byte("fetched"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remotes, err := validateFetchedConfig(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(remotes, []string{"oned"}) {
+		t.Errorf("usable remotes = %v, want [oned]", remotes)
+	}
+	if backend, passphrase := loadedConfigKey(); backend != nil || passphrase != nil {
+		t.Errorf("the local config is now saved with %v and passphrase %q, want the embedded key", backend, passphrase)
+	}
+}
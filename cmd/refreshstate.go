@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+)
+
+// refreshState is what refresh remembers about the last config it wrote, so
+// the next refresh can ask the server whether it changed.
+type refreshState struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+// loadRefreshState returns the stored state, empty if there is none.
+func loadRefreshState() refreshState {
+	var state refreshState
+	if statePath, err := getStatePath("refresh.json"); err == nil {
+		if data, err := os.ReadFile(statePath); err == nil {
+			json.Unmarshal(data, &state)
+		}
+	}
+	return state
+}
+
+// saveRefreshState remembers the validators of the response a config was
+// written from. Without any there is nothing to remember.
+func saveRefreshState(url string, resp *http.Response) {
+	statePath, err := getStatePath("refresh.json")
+	if err != nil {
+		return
+	}
+
+	state := refreshState{URL: url, ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+	if state.ETag == "" && state.LastModified == "" {
+		os.Remove(statePath)
+		return
+	}
+	if data, err := json.Marshal(state); err == nil {
+		os.WriteFile(statePath, data, 0644)
+	}
+}
+
+// setConditionalHeaders makes req conditional on the config at url having
+// changed since the last refresh, if the local config still exists.
+func setConditionalHeaders(req *http.Request, url string) {
+	state := loadRefreshState()
+	if state.URL != url {
+		return
+	}
+	configPath, err := getConfigPath()
+	if err != nil {
+		return
+	}
+	if _, err := os.Stat(configPath); err != nil {
+		return
+	}
+
+	if state.ETag != "" {
+		req.Header.Set("If-None-Match", state.ETag)
+	}
+	if state.LastModified != "" {
+		req.Header.Set("If-Modified-Since", state.LastModified)
+	}
+}
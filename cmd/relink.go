@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/global-index-source/ksau-go/azure"
+	"github.com/global-index-source/ksau-go/cmd/history"
+	"github.com/spf13/cobra"
+)
+
+var (
+	relinkHistory    bool
+	relinkShare      bool
+	relinkShareScope string
+)
+
+var relinkCmd = &cobra.Command{
+	Use:   "relink <remote-path | search>",
+	Short: "Print the download link of an earlier upload again",
+	Long: `Rebuild the index download URL of a file from its path on the remote
+(relative to the remote's root folder), or with --history from the newest
+upload in the local history matching the search. --share additionally creates
+a fresh sharing link through Microsoft Graph.`,
+	Args: cobra.ExactArgs(1),
+	Run:  runRelink,
+}
+
+func init() {
+	rootCmd.AddCommand(relinkCmd)
+
+	relinkCmd.Flags().BoolVar(&relinkHistory, "history", false, "Look the file up in the upload history instead of taking a remote path")
+	relinkCmd.Flags().BoolVar(&relinkShare, "share", false, "Also create a Microsoft Graph sharing link for the file")
+	relinkCmd.Flags().StringVar(&relinkShareScope, "share-scope", azure.LinkScopeAnonymous, "Who the sharing link works for: anonymous or organization")
+}
+
+func runRelink(cmd *cobra.Command, args []string) {
+	if relinkShareScope != azure.LinkScopeAnonymous && relinkShareScope != azure.LinkScopeOrganization {
+		fmt.Printf("invalid --share-scope %q, must be %s or %s\n", relinkShareScope, azure.LinkScopeAnonymous, azure.LinkScopeOrganization)
+		os.Exit(1)
+	}
+
+	remoteConfig, _ := cmd.Flags().GetString("remote-config")
+	remotePath := args[0]
+	fromHistory := false
+	if relinkHistory {
+		entry, err := findHistoryEntry(args[0], remoteConfig)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		remoteConfig = entry.Remote
+		remotePath = entry.RemotePath
+		fromHistory = true
+	}
+	if remoteConfig == "" {
+		fmt.Println("please select a remote with --remote-config")
+		os.Exit(1)
+	}
+
+	configData, err := getConfigData()
+	if err != nil {
+		fmt.Println("failed to get configuration file data:", err.Error())
+		os.Exit(1)
+	}
+	client, err := azure.NewAzureClientFromRcloneConfigData(configData, remoteConfig)
+	if err != nil {
+		fmt.Println("failed to initialize client:", err.Error())
+		os.Exit(1)
+	}
+
+	// History entries include the root folder, paths given by the user don't
+	fullRemotePath := path.Join("/", client.RemoteRootFolder, remotePath)
+	if fromHistory {
+		fullRemotePath = path.Join("/", remotePath)
+		remotePath = strings.TrimPrefix(fullRemotePath, path.Join("/", client.RemoteRootFolder))
+	}
+
+	fmt.Printf("[%s] %s\n", remoteConfig, fullRemotePath)
+	fmt.Printf("%sDownload URL:%s %s%s%s\n", ColorGreen, ColorReset, ColorGreen, indexURL(client, remotePath), ColorReset)
+
+	if !relinkShare {
+		return
+	}
+
+	requireNetwork("")
+	httpClient := sharedHTTPClient()
+	item, err := client.GetItem(httpClient, fullRemotePath)
+	if err != nil {
+		fmt.Println("failed to find the file:", err.Error())
+		printErrorHint(err)
+		os.Exit(1)
+	}
+	link, err := client.CreateShareLink(httpClient, item.ID, azure.LinkView, relinkShareScope)
+	if err != nil {
+		fmt.Println(err.Error())
+		printErrorHint(err)
+		os.Exit(1)
+	}
+	fmt.Printf("%sSharing link:%s %s%s%s\n", ColorGreen, ColorReset, ColorGreen, link, ColorReset)
+}
+
+// findHistoryEntry returns the newest successful upload whose local path,
+// remote path or link contains search, restricted to remote if it is set.
+func findHistoryEntry(search string, remote string) (*history.Entry, error) {
+	store, err := openHistory()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload history: %w", err)
+	}
+	entries, err := store.Load(time.Time{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload history: %w", err)
+	}
+
+	for _, entry := range slices.Backward(entries) {
+		if !entry.Success || entry.RemotePath == "" || (remote != "" && entry.Remote != remote) {
+			continue
+		}
+		if historyEntryContains(entry, search) {
+			return &entry, nil
+		}
+	}
+	return nil, fmt.Errorf("no upload matching %q in the history", search)
+}
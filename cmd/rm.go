@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/global-index-source/ksau-go/azure"
+	"github.com/spf13/cobra"
+)
+
+var allowProtected bool
+
+var rmCmd = &cobra.Command{
+	Use:   "rm <path>",
+	Short: "Delete a remote file or folder",
+	Long: `Delete a file or folder, relative to the remote's root folder. Deleted items
+go to the drive's recycle bin.
+
+Paths listed in the remote's protected_paths config key (and the folders
+containing them) are refused unless --allow-protected is given.`,
+	Args: cobra.ExactArgs(1),
+	Run:  runRm,
+}
+
+func init() {
+	rootCmd.AddCommand(rmCmd)
+
+	rmCmd.Flags().BoolVar(&allowProtected, "allow-protected", false, "Allow deleting protected paths")
+}
+
+func runRm(cmd *cobra.Command, args []string) {
+	remoteConfig, _ := cmd.Flags().GetString("remote-config")
+	if remoteConfig == "" {
+		fmt.Println("please select a remote with --remote-config")
+		os.Exit(1)
+	}
+
+	configData, err := getConfigData()
+	if err != nil {
+		fmt.Println("failed to get configuration file data:", err.Error())
+		os.Exit(1)
+	}
+
+	client, err := azure.NewAzureClientFromRcloneConfigData(configData, remoteConfig)
+	if err != nil {
+		fmt.Println("failed to initialize client:", err.Error())
+		os.Exit(1)
+	}
+
+	target := path.Join(client.RemoteRootFolder, args[0])
+	if err := client.CheckDeletable(target, allowProtected); err != nil {
+		fmt.Printf("%s%s%s\n", ColorRed, err.Error(), ColorReset)
+		fmt.Println("hint: pass --allow-protected if you really mean it")
+		os.Exit(1)
+	}
+
+	requireNetwork("")
+
+	httpClient := sharedHTTPClient()
+	item, err := client.GetItem(httpClient, target)
+	if err != nil {
+		if errors.Is(err, azure.ErrItemNotFound) {
+			fmt.Printf("%s not found\n", target)
+		} else {
+			fmt.Println("failed to look up item:", err.Error())
+		}
+		os.Exit(1)
+	}
+
+	if dryRun {
+		if item.Folder != nil {
+			printDryRun("delete the folder %s (%s in %d items)", target, azure.FormatBytes(item.Size), item.Folder.ChildCount)
+		} else {
+			printDryRun("delete %s (%s)", target, azure.FormatBytes(item.Size))
+		}
+		return
+	}
+
+	if err := client.DeleteItem(httpClient, item.ID, target, allowProtected); err != nil {
+		fmt.Println("failed to delete item:", err.Error())
+		printErrorHint(err)
+		os.Exit(1)
+	}
+	parent := path.Dir(target)
+	if parent == "." {
+		parent = ""
+	}
+	invalidateListCache(remoteConfig, parent)
+
+	fmt.Printf("%sDeleted %s%s\n", ColorGreen, target, ColorReset)
+}
@@ -15,6 +15,12 @@ like uploading files and checking quota information across multiple
 OneDrive configurations.`,
 }
 
+// verbose logs additional status information to stderr.
+var verbose bool
+
+// noCache disables the local caches of remote data, like folder listings.
+var noCache bool
+
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
@@ -23,5 +29,9 @@ func Execute() {
 }
 
 func init() {
-	rootCmd.PersistentFlags().StringP("remote-config", "c", "", "Name of the remote configuration section in rclone.conf")
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "Path of the config file (default: per-OS location, or $"+configEnv+")")
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Print additional status information")
+	rootCmd.PersistentFlags().BoolVar(&noCache, "no-cache", false, "Don't use cached remote data such as folder listings")
+	rootCmd.PersistentFlags().BoolVar(&offline, "offline", false, "Fail network commands immediately instead of waiting for timeouts")
+	rootCmd.PersistentFlags().StringP("remote-config", "c", "", "Name of the remote configuration section in rclone.conf, or group:<name> to pick from a group")
 }
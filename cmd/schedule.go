@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/global-index-source/ksau-go/azure"
+	"github.com/global-index-source/ksau-go/cmd/queue"
+	"github.com/robfig/cron/v3"
+)
+
+var daemonSchedules string
+
+// uploadSchedule uploads the files matching a pattern at the times of a cron
+// spec. Schedules are sections of the schedules file, in the same format as
+// the rclone config:
+//
+//	[nightly-backups]
+//	cron = 0 2 * * *
+//	files = /var/backups/*.tar.gz
+//	remote = oned
+//	folder = /backups
+type uploadSchedule struct {
+	name   string
+	spec   string
+	files  string // glob pattern of absolute paths
+	remote string
+	folder string
+
+	schedule cron.Schedule
+	next     time.Time
+}
+
+// daemonSchedulesPath returns --schedules or the default schedules file next
+// to the config.
+func daemonSchedulesPath() (string, error) {
+	if daemonSchedules != "" {
+		return daemonSchedules, nil
+	}
+	return getStatePath("schedules.conf")
+}
+
+// loadSchedules reads the schedules file, none if it doesn't exist.
+func loadSchedules(schedulesPath string) ([]*uploadSchedule, error) {
+	data, err := os.ReadFile(schedulesPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schedules: %w", err)
+	}
+	sections, err := azure.ParseRcloneConfigData(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse schedules %s: %w", schedulesPath, err)
+	}
+
+	var schedules []*uploadSchedule
+	for _, section := range sections {
+		if section["remote_name"] == "" {
+			// Keys before the first section, or an empty file
+			continue
+		}
+		schedule := &uploadSchedule{
+			name:   section["remote_name"],
+			spec:   section["cron"],
+			files:  section["files"],
+			remote: section["remote"],
+			folder: section["folder"],
+		}
+		if schedule.spec == "" || schedule.files == "" || schedule.remote == "" || schedule.folder == "" {
+			return nil, fmt.Errorf("schedule %s needs cron, files, remote and folder", schedule.name)
+		}
+		if !filepath.IsAbs(schedule.files) {
+			return nil, fmt.Errorf("schedule %s: files must be an absolute path or pattern", schedule.name)
+		}
+		if _, err := filepath.Match(schedule.files, ""); err != nil {
+			return nil, fmt.Errorf("schedule %s: invalid files pattern: %w", schedule.name, err)
+		}
+		schedule.schedule, err = cron.ParseStandard(schedule.spec)
+		if err != nil {
+			return nil, fmt.Errorf("schedule %s: invalid cron spec %q: %w", schedule.name, schedule.spec, err)
+		}
+		if schedule.schedule.Next(time.Now()).IsZero() {
+			return nil, fmt.Errorf("schedule %s: cron spec %q never matches", schedule.name, schedule.spec)
+		}
+		schedules = append(schedules, schedule)
+	}
+	return schedules, nil
+}
+
+// runSchedules queues the files of every schedule when it is due, until the
+// process ends.
+func (d *daemon) runSchedules(schedules []*uploadSchedule) {
+	now := time.Now()
+	for _, schedule := range schedules {
+		schedule.next = schedule.schedule.Next(now)
+		fmt.Printf("schedule %s: next run %s\n", schedule.name, schedule.next.Format("2006-01-02 15:04"))
+	}
+
+	for {
+		sort.Slice(schedules, func(i, j int) bool { return schedules[i].next.Before(schedules[j].next) })
+		due := schedules[0]
+		time.Sleep(time.Until(due.next))
+
+		d.trigger(due)
+		// Runs missed while the machine was suspended are skipped, not
+		// caught up one after another
+		due.next = due.schedule.Next(time.Now())
+	}
+}
+
+// trigger queues a job for every file matching the schedule. A run is skipped
+// while jobs of the previous one are still queued or running, so a slow
+// upload can't pile up copies of the same files.
+func (d *daemon) trigger(schedule *uploadSchedule) {
+	for _, job := range d.queue.List() {
+		if job.Schedule == schedule.name && (job.Status == queue.Queued || job.Status == queue.Running) {
+			fmt.Printf("%sschedule %s: skipped, the previous run is still in progress%s\n", ColorYellow, schedule.name, ColorReset)
+			slog.Warn("schedule skipped", "schedule", schedule.name, "reason", "previous run in progress")
+			return
+		}
+	}
+
+	// The pattern was checked when loading
+	files, _ := filepath.Glob(schedule.files)
+	queued := 0
+	for _, file := range files {
+		if info, err := os.Stat(file); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		job, err := d.add(queue.Job{File: file, Remote: schedule.remote, Folder: schedule.folder, Schedule: schedule.name})
+		if err != nil {
+			fmt.Printf("%sschedule %s: failed to queue %s: %v%s\n", ColorRed, schedule.name, file, err, ColorReset)
+			slog.Warn("schedule failed to queue", "schedule", schedule.name, "file", file, "error", err)
+			continue
+		}
+		fmt.Printf("schedule %s: queued %s as job %s\n", schedule.name, file, job.ID)
+		queued++
+	}
+	if len(files) == 0 {
+		fmt.Printf("%sschedule %s: no files match %s%s\n", ColorYellow, schedule.name, schedule.files, ColorReset)
+	}
+	slog.Info("schedule run", "schedule", schedule.name, "queued", queued)
+}
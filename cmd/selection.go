@@ -0,0 +1,379 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/global-index-source/ksau-go/azure"
+	"github.com/global-index-source/ksau-go/cmd/progress"
+)
+
+// Remote selection strategies accepted by --strategy
+const (
+	StrategyMostFree   = "most-free"
+	StrategyRandom     = "random"
+	StrategyRoundRobin = "round-robin"
+	StrategyFastest    = "fastest"
+	StrategyAuto       = "auto" // old ksau behavior
+)
+
+// groupPrefix marks a --remote-config value as a group of remotes, e.g. "group:public".
+const groupPrefix = "group:"
+
+// autoRandomThreshold is the file size below which the auto strategy picks a
+// random remote, like the old ksau did. Larger files go to the most free one.
+const autoRandomThreshold = 1024 * 1024 * 1024 // 1GiB
+
+// remoteSelector orders the available remotes for an upload, best first.
+type remoteSelector func(configData []byte, remotes []string, fileSize int64) ([]string, error)
+
+var remoteSelectors = map[string]remoteSelector{
+	StrategyMostFree:   selectMostFree,
+	StrategyRandom:     selectRandom,
+	StrategyRoundRobin: selectRoundRobin,
+	StrategyFastest:    selectFastest,
+	StrategyAuto:       selectAuto,
+}
+
+// validSelectionStrategies returns the names of all remote selection strategies
+func validSelectionStrategies() []string {
+	return []string{StrategyMostFree, StrategyRandom, StrategyRoundRobin, StrategyFastest, StrategyAuto}
+}
+
+// defaultSelectionStrategy returns the strategy set by the selection_strategy
+// key at the top of notifyConfigFile, used when --strategy isn't given, or
+// most-free without one.
+func defaultSelectionStrategy() (string, error) {
+	settings, err := notifySettings("")
+	if err != nil {
+		slog.Warn("failed to read the default selection strategy", "error", err)
+	}
+	strategy := settings["selection_strategy"]
+	if strategy == "" {
+		return StrategyMostFree, nil
+	}
+	if _, ok := remoteSelectors[strategy]; !ok {
+		return "", fmt.Errorf("invalid selection_strategy in %s: %s\nValid strategies are: %s",
+			notifyConfigFile, strategy, strings.Join(validSelectionStrategies(), ", "))
+	}
+	return strategy, nil
+}
+
+// rankRemotes returns the configured remotes ordered by the given strategy,
+// best candidate first. If group is not empty only the remotes of that group
+// are considered.
+func rankRemotes(strategy string, configData []byte, fileSize int64, group string) ([]string, error) {
+	selector, ok := remoteSelectors[strategy]
+	if !ok {
+		return nil, fmt.Errorf("unknown remote selection strategy: %s (valid: %s)",
+			strategy, strings.Join(validSelectionStrategies(), ", "))
+	}
+
+	remotes, err := selectableRemotes(configData, group)
+	if err != nil {
+		return nil, err
+	}
+	return selector(configData, remotes, fileSize)
+}
+
+// selectableRemotes returns the remotes automatic selection picks from: all
+// of them, or only those of group if it isn't empty.
+func selectableRemotes(configData []byte, group string) ([]string, error) {
+	parsedConfigData, err := azure.ParseRcloneConfigData(configData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select remote: %w", err)
+	}
+
+	remotes := azure.GetAvailableRemotes(&parsedConfigData)
+	if group != "" {
+		remotes = azure.GetRemotesInGroup(&parsedConfigData, group)
+		if len(remotes) == 0 {
+			return nil, fmt.Errorf("no remotes in group %s", group)
+		}
+	}
+	if len(remotes) == 0 {
+		return nil, fmt.Errorf("no remotes configured")
+	}
+	return remotes, nil
+}
+
+// remoteProbe is the result of querying a remote's quota.
+type remoteProbe struct {
+	Free    int64         `json:"free"`
+	Latency time.Duration `json:"latency"`
+}
+
+// selectionCache is the on-disk cache of the last remote probes, so repeated
+// uploads don't query the quota of every remote each time.
+type selectionCache struct {
+	Time    time.Time              `json:"time"`
+	Remotes []string               `json:"remotes"`
+	Probes  map[string]remoteProbe `json:"probes"`
+}
+
+// selectionCacheTTL is how long probe results are reused, 0 disables the cache.
+var selectionCacheTTL time.Duration
+
+// selectionProbeDeadline bounds how long probing the remotes may take, remotes
+// that didn't answer by then are left out.
+const selectionProbeDeadline = 15 * time.Second
+
+// backgroundProbe is a refresh of the selection cache running in the background.
+type backgroundProbe struct {
+	remotes []string
+	done    chan struct{}
+	probes  map[string]remoteProbe
+}
+
+// selectionRefresh is the refresh started by startSelectionRefresh, if any.
+var selectionRefresh *backgroundProbe
+
+// startSelectionRefresh refreshes a stale selection cache in the background,
+// so it is ready by the time a remote has to be picked (or a fallback remote
+// is needed). It is only started by commands that select remotes, so it never
+// slows down unrelated commands.
+func startSelectionRefresh(configData []byte, group string) {
+	if selectionCacheTTL <= 0 || offline {
+		return
+	}
+	remotes, err := selectableRemotes(configData, group)
+	if err != nil {
+		return
+	}
+	if _, ok := readSelectionCache(remotes); ok {
+		return
+	}
+
+	refresh := &backgroundProbe{remotes: remotes, done: make(chan struct{})}
+	selectionRefresh = refresh
+	slog.Info("refreshing remote quotas in the background", "remotes", len(remotes))
+
+	go func() {
+		defer close(refresh.done)
+		start := time.Now()
+		refresh.probes = probeRemotes(configData, remotes, false)
+		writeSelectionCache(remotes, refresh.probes)
+		slog.Info("refreshed remote quotas", "reachable", len(refresh.probes), "remotes", len(remotes), "took", time.Since(start).Round(time.Millisecond))
+	}()
+}
+
+// cachedProbeRemotes returns the cached probes if they are fresh and cover the
+// same remotes, otherwise it waits for a running background refresh or probes
+// the remotes itself and refreshes the cache.
+func cachedProbeRemotes(configData []byte, remotes []string) map[string]remoteProbe {
+	if selectionCacheTTL <= 0 {
+		return probeRemotes(configData, remotes, true)
+	}
+	if probes, ok := readSelectionCache(remotes); ok {
+		return probes
+	}
+
+	if refresh := selectionRefresh; refresh != nil && slices.Equal(refresh.remotes, remotes) {
+		<-refresh.done
+		if len(refresh.probes) > 0 {
+			return refresh.probes
+		}
+	}
+
+	probes := probeRemotes(configData, remotes, true)
+	writeSelectionCache(remotes, probes)
+	return probes
+}
+
+// readSelectionCache returns the cached probes if they are fresh and cover the
+// same remotes.
+func readSelectionCache(remotes []string) (map[string]remoteProbe, bool) {
+	cachePath, err := getStatePath("selection.json")
+	if err != nil {
+		return nil, false
+	}
+
+	var cache selectionCache
+	if data, err := os.ReadFile(cachePath); err == nil && json.Unmarshal(data, &cache) == nil {
+		if time.Since(cache.Time) < selectionCacheTTL && slices.Equal(cache.Remotes, remotes) && len(cache.Probes) > 0 {
+			return cache.Probes, true
+		}
+	}
+	return nil, false
+}
+
+func writeSelectionCache(remotes []string, probes map[string]remoteProbe) {
+	cachePath, err := getStatePath("selection.json")
+	if err != nil || len(probes) == 0 {
+		return
+	}
+
+	cache := selectionCache{Time: time.Now(), Remotes: remotes, Probes: probes}
+	if data, err := json.Marshal(cache); err == nil {
+		os.WriteFile(cachePath, data, 0644)
+	}
+}
+
+// invalidateSelectionCache drops the cached probes, e.g. after a remote
+// turned out to be full.
+func invalidateSelectionCache() {
+	if cachePath, err := getStatePath("selection.json"); err == nil {
+		os.Remove(cachePath)
+	}
+}
+
+// probeRemotes queries the quota of every remote concurrently, giving up
+// after selectionProbeDeadline. Remotes that cannot be reached in time are
+// left out of the result, and their probes, which keep running in the
+// background, neither record anything nor draw afterwards. The progress bar is
+// only drawn if showProgress is set.
+func probeRemotes(configData []byte, remotes []string, showProgress bool) map[string]remoteProbe {
+	probes := make(map[string]remoteProbe, len(remotes))
+	var wg = new(sync.WaitGroup)
+	var httpClient *http.Client = sharedHTTPClient()
+
+	var progressTracker *progress.ProgressTracker
+	if showProgress {
+		fmt.Print("Checking free spaces for each remote...")
+		progressTracker = progress.NewProgressTracker(int64(len(remotes)), progress.ProgressStyle(progressStyle))
+	}
+	var done int = 0
+	var expired bool // set at the deadline, guarded by mu
+	var mu sync.Mutex
+
+	for _, remote := range remotes {
+		wg.Add(1)
+		go func(r string) {
+			defer wg.Done()
+			client, err := azure.NewAzureClientFromRcloneConfigData(configData, r)
+			if err != nil {
+				return // ignore that remote
+			}
+
+			if err := client.EnsureTokenValid(httpClient); err != nil {
+				return // ignore that remote
+			}
+
+			start := time.Now()
+			remoteQuota, err := client.GetDriveQuota(httpClient)
+			if err != nil {
+				return // ignore that remote
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if expired {
+				return
+			}
+			probes[r] = remoteProbe{Free: remoteQuota.Remaining, Latency: time.Since(start)}
+			done++
+			if progressTracker != nil {
+				progressTracker.UpdateProgress(int64(done))
+			}
+		}(remote)
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(selectionProbeDeadline):
+	}
+
+	mu.Lock()
+	expired = true
+	result := maps.Clone(probes)
+	mu.Unlock()
+	if showProgress {
+		fmt.Print("\033[2K\r")
+	}
+	return result
+}
+
+// sortProbes returns the probed remotes sorted with less.
+func sortProbes(probes map[string]remoteProbe, less func(a, b remoteProbe) bool) []string {
+	ranked := make([]string, 0, len(probes))
+	for remote := range probes {
+		ranked = append(ranked, remote)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		return less(probes[ranked[i]], probes[ranked[j]])
+	})
+	return ranked
+}
+
+func selectMostFree(configData []byte, remotes []string, fileSize int64) ([]string, error) {
+	probes := cachedProbeRemotes(configData, remotes)
+	if len(probes) == 0 {
+		return nil, fmt.Errorf("cannot get remote with the most free space: all remote were not available")
+	}
+
+	return sortProbes(probes, func(a, b remoteProbe) bool { return a.Free > b.Free }), nil
+}
+
+func selectFastest(configData []byte, remotes []string, fileSize int64) ([]string, error) {
+	probes := cachedProbeRemotes(configData, remotes)
+	if len(probes) == 0 {
+		return nil, fmt.Errorf("cannot get the fastest remote: all remote were not available")
+	}
+
+	return sortProbes(probes, func(a, b remoteProbe) bool { return a.Latency < b.Latency }), nil
+}
+
+func selectRandom(configData []byte, remotes []string, fileSize int64) ([]string, error) {
+	ranked := append([]string(nil), remotes...)
+	rand.Shuffle(len(ranked), func(i, j int) {
+		ranked[i], ranked[j] = ranked[j], ranked[i]
+	})
+	return ranked, nil
+}
+
+// selectRoundRobin rotates through the remotes, remembering the position of
+// the last pick in a small state file next to the config.
+func selectRoundRobin(configData []byte, remotes []string, fileSize int64) ([]string, error) {
+	statePath, err := getStatePath("roundrobin")
+	if err != nil {
+		return nil, err
+	}
+
+	next := 0
+	if data, err := os.ReadFile(statePath); err == nil {
+		if last, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
+			next = (last + 1) % len(remotes)
+		}
+	}
+
+	if err := os.WriteFile(statePath, []byte(strconv.Itoa(next)), 0644); err != nil {
+		fmt.Printf("%sWarning: cannot save round-robin state: %v%s\n", ColorYellow, err, ColorReset)
+	}
+
+	return append(append([]string(nil), remotes[next:]...), remotes[:next]...), nil
+}
+
+// selectAuto mimics the old ksau: small files go to a random remote and large
+// ones to the remote with the most free space.
+func selectAuto(configData []byte, remotes []string, fileSize int64) ([]string, error) {
+	if fileSize < autoRandomThreshold {
+		return selectRandom(configData, remotes, fileSize)
+	}
+	return selectMostFree(configData, remotes, fileSize)
+}
+
+// getStatePath returns the path of a small state file kept next to the config.
+func getStatePath(name string) (string, error) {
+	configPath, err := getConfigPath()
+	if err != nil {
+		return "", fmt.Errorf("failed to get config path: %w", err)
+	}
+	return filepath.Join(filepath.Dir(configPath), name), nil
+}
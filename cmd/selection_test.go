@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// useTempConfigDir points the config, and the state files next to it, to a
+// temporary directory.
+func useTempConfigDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	saved := configFile
+	t.Cleanup(func() { configFile = saved })
+	configFile = filepath.Join(dir, "rclone.conf")
+	return dir
+}
+
+func TestRankRemotes(t *testing.T) {
+	dir := useTempConfigDir(t)
+	configData := []byte("[a]\ntype = onedrive\n\n[b]\ntype = onedrive\n\n[c]\ntype = onedrive\n")
+	remotes := []string{"a", "b", "c"}
+
+	// Fresh probes in the cache, so nothing is queried
+	savedTTL := selectionCacheTTL
+	t.Cleanup(func() { selectionCacheTTL = savedTTL })
+	selectionCacheTTL = time.Hour
+	cache, err := json.Marshal(selectionCache{Time: time.Now(), Remotes: remotes, Probes: map[string]remoteProbe{
+		"a": {Free: 10, Latency: 10 * time.Millisecond},
+		"b": {Free: 30, Latency: 30 * time.Millisecond},
+		"c": {Free: 20, Latency: 20 * time.Millisecond},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "selection.json"), cache, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rank := func(strategy string, fileSize int64) []string {
+		t.Helper()
+		ranked, err := rankRemotes(strategy, configData, fileSize, "")
+		if err != nil {
+			t.Fatalf("rankRemotes(%s, %d) failed: %v", strategy, fileSize, err)
+		}
+		return ranked
+	}
+	mostFree := []string{"b", "c", "a"}
+
+	tests := []struct {
+		strategy string
+		fileSize int64
+		want     []string
+	}{
+		{StrategyMostFree, 1, mostFree},
+		{StrategyFastest, 1, []string{"a", "c", "b"}},
+		{StrategyAuto, autoRandomThreshold, mostFree},
+		{StrategyAuto, 4 * autoRandomThreshold, mostFree},
+	}
+	for _, tc := range tests {
+		if got := rank(tc.strategy, tc.fileSize); !slices.Equal(got, tc.want) {
+			t.Errorf("rankRemotes(%s, %d) = %v, want %v", tc.strategy, tc.fileSize, got, tc.want)
+		}
+	}
+
+	// Each order of three remotes comes up by chance once in six, so 50
+	// rankings all in the most-free order mean they weren't random
+	for _, tc := range []struct {
+		strategy string
+		fileSize int64
+	}{
+		{StrategyRandom, 4 * autoRandomThreshold},
+		{StrategyAuto, autoRandomThreshold - 1},
+	} {
+		shuffled := false
+		for range 50 {
+			got := rank(tc.strategy, tc.fileSize)
+			sorted := slices.Sorted(slices.Values(got))
+			if !slices.Equal(sorted, remotes) {
+				t.Fatalf("rankRemotes(%s, %d) = %v, want a permutation of %v", tc.strategy, tc.fileSize, got, remotes)
+			}
+			shuffled = shuffled || !slices.Equal(got, mostFree)
+		}
+		if !shuffled {
+			t.Errorf("rankRemotes(%s, %d) always returned %v, want a random order", tc.strategy, tc.fileSize, mostFree)
+		}
+	}
+
+	for _, want := range [][]string{{"a", "b", "c"}, {"b", "c", "a"}, {"c", "a", "b"}, {"a", "b", "c"}} {
+		if got := rank(StrategyRoundRobin, 1); !slices.Equal(got, want) {
+			t.Errorf("rankRemotes(%s) = %v, want %v", StrategyRoundRobin, got, want)
+		}
+	}
+
+	if _, err := rankRemotes("bogus", configData, 1, ""); err == nil {
+		t.Error("rankRemotes of an unknown strategy succeeded")
+	}
+}
+
+func TestDefaultSelectionStrategy(t *testing.T) {
+	dir := useTempConfigDir(t)
+	tests := []struct {
+		notifyConf string // "" for no notify.conf
+		want       string
+		fails      bool
+	}{
+		{"", StrategyMostFree, false},
+		{"webhook = https://example.com/hook\n", StrategyMostFree, false},
+		{"selection_strategy = auto\n", StrategyAuto, false},
+		{"selection_strategy = round-robin\n\n[oned]\nselection_strategy = fastest\n", StrategyRoundRobin, false},
+		{"[oned]\nselection_strategy = fastest\n", StrategyMostFree, false},
+		{"selection_strategy = bogus\n", "", true},
+	}
+	notifyPath := filepath.Join(dir, notifyConfigFile)
+	for _, tc := range tests {
+		os.Remove(notifyPath)
+		if tc.notifyConf != "" {
+			if err := os.WriteFile(notifyPath, []byte(tc.notifyConf), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := defaultSelectionStrategy()
+		if tc.fails {
+			if err == nil {
+				t.Errorf("defaultSelectionStrategy() with %q = %s, want an error", tc.notifyConf, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("defaultSelectionStrategy() with %q = %s, %v, want %s", tc.notifyConf, got, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"github.com/global-index-source/ksau-go/azure"
+	"github.com/global-index-source/ksau-go/crypto"
+	"github.com/spf13/cobra"
+)
+
+// selftestSize is the size of the file uploaded by selftest.
+const selftestSize = 4096
+
+var selftestShareScope string
+
+var selftestCmd = &cobra.Command{
+	Use:   "selftest",
+	Short: "Run an end-to-end test against a remote",
+	Long: `Upload a tiny file to the remote given with --remote-config, verify its
+QuickXorHash, fetch its metadata, create a sharing link for it and delete it
+again, reporting each step. Exits with status 1 if any step fails.`,
+	Run: runSelftest,
+}
+
+func init() {
+	rootCmd.AddCommand(selftestCmd)
+
+	selftestCmd.Flags().StringVar(&selftestShareScope, "share-scope", azure.LinkScopeAnonymous, "Who the test sharing link works for: anonymous or organization")
+}
+
+func runSelftest(cmd *cobra.Command, args []string) {
+	if selftestShareScope != azure.LinkScopeAnonymous && selftestShareScope != azure.LinkScopeOrganization {
+		fmt.Printf("invalid --share-scope %q, must be %s or %s\n", selftestShareScope, azure.LinkScopeAnonymous, azure.LinkScopeOrganization)
+		os.Exit(1)
+	}
+
+	remoteConfig, _ := cmd.Flags().GetString("remote-config")
+	if remoteConfig == "" {
+		fmt.Println("please select a remote with --remote-config")
+		os.Exit(1)
+	}
+
+	requireNetwork("")
+
+	configData, err := getConfigData()
+	if err != nil {
+		fmt.Println("failed to get configuration file data:", err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Printf("Self-test of %s\n", remoteConfig)
+	if !selftestRemote(configData, remoteConfig, sharedHTTPClient()) {
+		fmt.Printf("%sSelf-test failed%s\n", ColorRed, ColorReset)
+		os.Exit(1)
+	}
+	fmt.Printf("%sSelf-test passed%s\n", ColorGreen, ColorReset)
+}
+
+// selftestRemote runs the self-test steps against a remote, printing each
+// result as soon as it is known, and reports whether all of them passed. Once
+// the test file exists it is always deleted, even if a step in between fails.
+func selftestRemote(configData []byte, remote string, httpClient *http.Client) bool {
+	ok := true
+	step := func(name string, start time.Time, err error, detail string) bool {
+		result := checkResult{name: name, ok: err == nil, detail: detail}
+		if err != nil {
+			result.detail = err.Error()
+			ok = false
+		}
+		printSelftestStep(result, time.Since(start))
+		return err == nil
+	}
+
+	start := time.Now()
+	client, err := azure.NewAzureClientFromRcloneConfigData(configData, remote)
+	if err == nil {
+		client.Logger = azure.NopLogger
+		err = client.EnsureTokenValid(httpClient)
+	}
+	if !step("token", start, err, "valid") {
+		return false
+	}
+
+	data := make([]byte, selftestSize)
+	rand.Read(data)
+	hasher := crypto.New()
+	hasher.Write(data)
+	localHash := base64.StdEncoding.EncodeToString(hasher.Sum(nil))
+
+	remotePath := path.Join(client.RemoteRootFolder, fmt.Sprintf(".ksau-selftest-%d.bin", time.Now().UnixNano()))
+	start = time.Now()
+	itemID, err := client.UploadSmall(httpClient, remotePath, data, azure.ConflictFail)
+	if !step("upload", start, err, fmt.Sprintf("%s to %s", azure.FormatBytes(selftestSize), remotePath)) {
+		return false
+	}
+
+	start = time.Now()
+	remoteHash, err := client.GetQuickXorHash(httpClient, itemID)
+	if err == nil && remoteHash != localHash {
+		err = fmt.Errorf("hash mismatch: local %s, remote %s", localHash, remoteHash)
+	}
+	step("hash", start, err, "QuickXorHash "+localHash)
+
+	start = time.Now()
+	item, err := client.GetItemByID(httpClient, itemID)
+	var detail string
+	if err == nil {
+		detail = fmt.Sprintf("%s, %d bytes", item.Name, item.Size)
+		if item.Size != selftestSize || item.Name != path.Base(remotePath) {
+			err = fmt.Errorf("unexpected metadata: %s", detail)
+		}
+	}
+	step("metadata", start, err, detail)
+
+	start = time.Now()
+	link, err := client.CreateShareLink(httpClient, itemID, azure.LinkView, selftestShareScope)
+	step("share link", start, err, link)
+
+	start = time.Now()
+	err = client.DeleteItem(httpClient, itemID, remotePath, false)
+	if err == nil {
+		var exists bool
+		exists, err = client.ItemExists(httpClient, remotePath)
+		if err == nil && exists {
+			err = fmt.Errorf("%s still exists after deleting it", remotePath)
+		}
+	} else {
+		err = fmt.Errorf("%w, remove %s manually", err, remotePath)
+	}
+	step("delete", start, err, "removed the test file")
+
+	return ok
+}
+
+// printSelftestStep prints the outcome of one self-test step and how long it took.
+func printSelftestStep(result checkResult, elapsed time.Duration) {
+	status := ColorGreen + "PASS" + ColorReset
+	if !result.ok {
+		status = ColorRed + "FAIL" + ColorReset
+	}
+	fmt.Printf("  %s  %-10s  %6s  %s\n", status, result.name, elapsed.Round(time.Millisecond), result.detail)
+}
@@ -0,0 +1,309 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/global-index-source/ksau-go/azure"
+	"github.com/global-index-source/ksau-go/cmd/queue"
+	"github.com/global-index-source/ksau-go/redact"
+	"github.com/spf13/cobra"
+)
+
+// serveTokenEnv holds the bearer token clients of the REST API must send.
+const serveTokenEnv = "KSAU_SERVE_TOKEN"
+
+// serveTokenFile is where a generated token is stored, next to the config,
+// for local clients to read when serveTokenEnv isn't set.
+const serveTokenFile = "serve.token"
+
+var (
+	serveListen     string
+	serveGRPCListen string
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve a REST API to submit uploads and query remotes",
+	Long: `Run the daemon and expose it over HTTP, so web frontends, bots and CI
+systems can submit uploads, follow their progress, list remotes and read
+their quota without shelling out. Requests must carry the token from
+` + serveTokenEnv + ` as "Authorization: Bearer <token>". Without it a random
+token is generated and stored in ` + serveTokenFile + ` next to the config, which is
+only allowed when listening on a loopback address. Requests from browsers,
+with an Origin header, are refused.
+
+With --grpc-listen the same is offered as a gRPC service (rpc/ksau.proto),
+whose streams follow an upload's progress without polling. It takes the same
+token as "authorization: Bearer <token>" metadata. Pass --listen "" to serve
+gRPC only.`,
+	Args: cobra.NoArgs,
+	Run:  runServe,
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().StringVar(&serveListen, "listen", "127.0.0.1:8090", "Address to serve the API on")
+	serveCmd.Flags().StringVar(&serveGRPCListen, "grpc-listen", "", "Address to serve the gRPC API on (default: off)")
+	serveCmd.Flags().StringVar(&daemonSocket, "socket", "", "Socket the daemon listens on (default: daemon.sock next to the config)")
+	serveCmd.Flags().IntVar(&daemonConcurrency, "concurrency", 2, "Number of jobs uploaded at the same time")
+	serveCmd.Flags().IntVar(&daemonMaxAttempts, "max-attempts", 3, "Give a job up after this many failed attempts")
+	serveCmd.Flags().IntVar(&daemonRetries, "retries", 3, "Maximum number of retries for uploading chunks")
+	serveCmd.Flags().IntVar(&daemonKeepJobs, "keep-finished", 1000, "Number of done, failed and canceled jobs kept in the queue (0 for no limit)")
+	serveCmd.Flags().DurationVar(&daemonKeepJobsFor, "keep-finished-for", 30*24*time.Hour, "How long done, failed and canceled jobs are kept in the queue (0 for no limit)")
+	serveCmd.Flags().StringVar(&daemonSchedules, "schedules", "", "File with scheduled uploads (default: schedules.conf next to the config)")
+	serveCmd.Flags().StringVar(&uploaderNick, "nick", "", "Uploader name recorded in the receipts log of shared remotes (default: your user name)")
+	serveCmd.Flags().BoolVar(&noReceipt, "no-receipt", false, "Don't append to the remote's receipts log")
+}
+
+func runServe(cmd *cobra.Command, args []string) {
+	if serveListen == "" && serveGRPCListen == "" {
+		fmt.Println("nothing to serve, pass --listen or --grpc-listen")
+		os.Exit(1)
+	}
+	token := os.Getenv(serveTokenEnv)
+	for _, address := range []string{serveListen, serveGRPCListen} {
+		if address != "" && token == "" && !isLoopbackAddress(address) {
+			fmt.Printf("set %s to serve on %s, anyone reaching it could upload otherwise\n", serveTokenEnv, address)
+			os.Exit(1)
+		}
+	}
+	if token == "" {
+		var tokenPath string
+		var err error
+		token, tokenPath, err = generateServeToken()
+		if err != nil {
+			fmt.Println("failed to generate an API token:", err.Error())
+			os.Exit(1)
+		}
+		fmt.Printf("Generated an API token, clients find it in %s\n", tokenPath)
+	}
+
+	d, listener := startDaemon()
+	go d.accept(listener)
+
+	errs := make(chan error, 2)
+	if serveGRPCListen != "" {
+		grpcListener, err := net.Listen("tcp", serveGRPCListen)
+		if err != nil {
+			fmt.Println("failed to serve the gRPC API:", err.Error())
+			os.Exit(1)
+		}
+		fmt.Printf("Serving the gRPC API on %s\n", serveGRPCListen)
+		go func() {
+			if err := newGRPCServer(d, token).Serve(grpcListener); err != nil {
+				errs <- fmt.Errorf("failed to serve the gRPC API: %w", err)
+			}
+		}()
+	}
+	if serveListen != "" {
+		server := &http.Server{
+			Addr:              serveListen,
+			Handler:           guardAPI(token, isLoopbackAddress(serveListen), d.apiHandler()),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		fmt.Printf("Serving the API on http://%s\n", serveListen)
+		go func() {
+			errs <- fmt.Errorf("failed to serve the API: %w", server.ListenAndServe())
+		}()
+	}
+
+	err := <-errs
+	fmt.Println(err.Error())
+	os.Exit(1)
+}
+
+// isLoopbackAddress reports whether a listen address only accepts local
+// connections.
+func isLoopbackAddress(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// generateServeToken returns a new random token and the path of
+// serveTokenFile it was stored in, readable only by the user.
+func generateServeToken() (string, string, error) {
+	tokenPath, err := getStatePath(serveTokenFile)
+	if err != nil {
+		return "", "", err
+	}
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", "", err
+	}
+	token := hex.EncodeToString(random)
+	if err := os.WriteFile(tokenPath, []byte(token), 0600); err != nil {
+		return "", "", err
+	}
+	// WriteFile keeps the mode of an existing file
+	return token, tokenPath, os.Chmod(tokenPath, 0600)
+}
+
+// isLoopbackHost reports whether the Host header of a request names this
+// machine, so pages of other sites resolving their name to 127.0.0.1 (DNS
+// rebinding) are refused.
+func isLoopbackHost(hostHeader string) bool {
+	host := hostHeader
+	if h, _, err := net.SplitHostPort(hostHeader); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// guardAPI rejects requests without the bearer token and those web pages can
+// make: requests with an Origin header, with a Host other than a loopback
+// name when serving on one, and POSTs whose body isn't JSON.
+func guardAPI(token string, loopback bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Origin") != "" {
+			writeAPIError(w, http.StatusForbidden, errors.New("requests from browsers are not allowed"))
+			return
+		}
+		if loopback && !isLoopbackHost(r.Host) {
+			writeAPIError(w, http.StatusMisdirectedRequest, fmt.Errorf("unexpected host %q", r.Host))
+			return
+		}
+		sent, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+			writeAPIError(w, http.StatusUnauthorized, errors.New("missing or wrong bearer token"))
+			return
+		}
+		if r.Method == http.MethodPost && r.ContentLength != 0 {
+			mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if mediaType != "application/json" {
+				writeAPIError(w, http.StatusUnsupportedMediaType, errors.New("the body must be application/json"))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// apiHandler returns the routes of the REST API:
+//
+//	POST /jobs                   submit an upload, body {"file", "remote", "folder", "name", "priority"}
+//	GET  /jobs                   list all jobs
+//	GET  /jobs/{id}              a job with its progress
+//	POST /jobs/{id}/cancel       cancel a queued or running job
+//	POST /jobs/{id}/retry        queue a failed or canceled job again
+//	GET  /remotes                the names of the configured remotes
+//	GET  /remotes/{name}/quota   the quota of a remote
+func (d *daemon) apiHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /jobs", func(w http.ResponseWriter, r *http.Request) {
+		var job queue.Job
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&job); err != nil {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid job: %w", err))
+			return
+		}
+		job, err := d.submit(job)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeAPIJSON(w, http.StatusCreated, job)
+	})
+	mux.HandleFunc("GET /jobs", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIJSON(w, http.StatusOK, d.queue.List())
+	})
+	mux.HandleFunc("GET /jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		job, ok := d.queue.Get(r.PathValue("id"))
+		if !ok {
+			writeAPIError(w, http.StatusNotFound, fmt.Errorf("no job %s", r.PathValue("id")))
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, job)
+	})
+	mux.HandleFunc("POST /jobs/{id}/cancel", func(w http.ResponseWriter, r *http.Request) {
+		job, err := d.cancel(r.PathValue("id"))
+		if errors.Is(err, queue.ErrNotFound) {
+			writeAPIError(w, http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			writeAPIError(w, http.StatusConflict, err)
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, job)
+	})
+	mux.HandleFunc("POST /jobs/{id}/retry", func(w http.ResponseWriter, r *http.Request) {
+		job, err := d.retry(r.PathValue("id"))
+		if errors.Is(err, queue.ErrNotFound) {
+			writeAPIError(w, http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			writeAPIError(w, http.StatusConflict, err)
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, job)
+	})
+	mux.HandleFunc("GET /remotes", func(w http.ResponseWriter, r *http.Request) {
+		configData, err := getConfigData()
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err)
+			return
+		}
+		parsed, err := azure.ParseRcloneConfigData(configData)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, azure.GetAvailableRemotes(&parsed))
+	})
+	mux.HandleFunc("GET /remotes/{name}/quota", func(w http.ResponseWriter, r *http.Request) {
+		configData, err := getConfigData()
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err)
+			return
+		}
+		client, err := azure.NewAzureClientFromRcloneConfigData(configData, r.PathValue("name"))
+		if err != nil {
+			writeAPIError(w, http.StatusNotFound, err)
+			return
+		}
+		quota, err := client.GetDriveQuota(sharedHTTPClient())
+		if err != nil {
+			writeAPIError(w, http.StatusBadGateway, err)
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, quota)
+	})
+	return mux
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// writeAPIError answers with {"error": "..."}, with secrets removed.
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	slog.Info("api request failed", "status", status, "error", redact.Error(err))
+	writeAPIJSON(w, status, map[string]string{"error": redact.Error(err)})
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIsLoopbackHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"localhost", true},
+		{"localhost:8080", true},
+		{"127.0.0.1", true},
+		{"127.0.0.1:8080", true},
+		{"127.1.2.3:8080", true},
+		{"[::1]:8080", true},
+		{"[::1]", true},
+		{"::1", true},
+		{"", false},
+		{"example.com", false},
+		{"localhost.example.com:8080", false},
+		{"127.0.0.1.nip.io:8080", false},
+		{"192.168.1.10:8080", false},
+		{"0.0.0.0:8080", false},
+		{"[::]:8080", false},
+	}
+	for _, tc := range tests {
+		if got := isLoopbackHost(tc.host); got != tc.want {
+			t.Errorf("isLoopbackHost(%q) = %v, want %v", tc.host, got, tc.want)
+		}
+	}
+}
+
+func TestGuardAPI(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	tests := []struct {
+		name     string
+		loopback bool
+		method   string
+		host     string
+		headers  map[string]string
+		body     string
+		want     int
+	}{
+		{"allowed", true, http.MethodGet, "localhost:8080", map[string]string{"Authorization": "Bearer secret"}, "", http.StatusTeapot},
+		{"allowed JSON post", true, http.MethodPost, "127.0.0.1:8080", map[string]string{"Authorization": "Bearer secret", "Content-Type": "application/json; charset=utf-8"}, "{}", http.StatusTeapot},
+		{"empty post", true, http.MethodPost, "127.0.0.1:8080", map[string]string{"Authorization": "Bearer secret"}, "", http.StatusTeapot},
+		{"any host off loopback", false, http.MethodGet, "ksau.lan:8080", map[string]string{"Authorization": "Bearer secret"}, "", http.StatusTeapot},
+		{"no token", true, http.MethodGet, "localhost:8080", nil, "", http.StatusUnauthorized},
+		{"wrong token", true, http.MethodGet, "localhost:8080", map[string]string{"Authorization": "Bearer secreT"}, "", http.StatusUnauthorized},
+		{"token prefix", true, http.MethodGet, "localhost:8080", map[string]string{"Authorization": "Bearer secre"}, "", http.StatusUnauthorized},
+		{"not a bearer token", true, http.MethodGet, "localhost:8080", map[string]string{"Authorization": "Basic secret"}, "", http.StatusUnauthorized},
+		{"browser", true, http.MethodGet, "localhost:8080", map[string]string{"Authorization": "Bearer secret", "Origin": "https://evil.example"}, "", http.StatusForbidden},
+		{"browser off loopback", false, http.MethodGet, "ksau.lan:8080", map[string]string{"Authorization": "Bearer secret", "Origin": "null"}, "", http.StatusForbidden},
+		{"rebound host", true, http.MethodGet, "evil.example:8080", map[string]string{"Authorization": "Bearer secret"}, "", http.StatusMisdirectedRequest},
+		{"form post", true, http.MethodPost, "localhost:8080", map[string]string{"Authorization": "Bearer secret", "Content-Type": "application/x-www-form-urlencoded"}, "file=x", http.StatusUnsupportedMediaType},
+		{"text post", true, http.MethodPost, "localhost:8080", map[string]string{"Authorization": "Bearer secret", "Content-Type": "text/plain"}, "{}", http.StatusUnsupportedMediaType},
+		{"untyped post", true, http.MethodPost, "localhost:8080", map[string]string{"Authorization": "Bearer secret"}, "{}", http.StatusUnsupportedMediaType},
+	}
+	for _, tc := range tests {
+		r := httptest.NewRequest(tc.method, "/jobs", strings.NewReader(tc.body))
+		r.Host = tc.host
+		for key, value := range tc.headers {
+			r.Header.Set(key, value)
+		}
+		w := httptest.NewRecorder()
+		guardAPI("secret", tc.loopback, next).ServeHTTP(w, r)
+		if w.Code != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.name, w.Code, tc.want)
+		}
+	}
+}
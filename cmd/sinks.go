@@ -0,0 +1,248 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/global-index-source/ksau-go/azure"
+	"github.com/global-index-source/ksau-go/redact"
+)
+
+// Events reported to result sinks.
+const (
+	eventUploadFinished = "upload.finished"
+	eventUploadFailed   = "upload.failed"
+)
+
+// Outcomes of the integrity check reported to result sinks.
+const (
+	hashVerified   = "verified"
+	hashMismatch   = "mismatch"
+	hashUnverified = "unverified" // the hashes could not be obtained
+	hashSkipped    = "skipped"
+)
+
+// sinkPluginPrefix starts the names of executables implementing a result
+// sink, e.g. ksau-sink-discord for --sink discord.
+const sinkPluginPrefix = "ksau-sink-"
+
+// sinkPluginTimeout bounds a run of a sink plugin.
+const sinkPluginTimeout = 30 * time.Second
+
+// notifyConfigFile holds the user's own result sink settings, next to the
+// config. Unlike the remotes' sections, which refresh replaces with the
+// community config, only the user writes it, so it may name programs to run.
+// Keys before the first section apply to every remote, those of a [remote]
+// section to that remote only.
+const notifyConfigFile = "notify.conf"
+
+var sinkPlugins []string
+
+// uploadEvent is the outcome of an upload as reported to result sinks, which
+// get it as JSON.
+type uploadEvent struct {
+	Event      string    `json:"event"`
+	File       string    `json:"file"`
+	LocalPath  string    `json:"localPath,omitempty"` // only with local_path = true in notify.conf
+	Remote     string    `json:"remote"`
+	RemotePath string    `json:"remotePath,omitempty"`
+	Size       int64     `json:"size"`
+	Link       string    `json:"link,omitempty"`
+	HashStatus string    `json:"hashStatus,omitempty"`
+	Skipped    string    `json:"skipped,omitempty"` // why nothing was transferred
+	Duration   float64   `json:"durationSeconds"`
+	Error      string    `json:"error,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+// resultSink receives the outcome of uploads, e.g. to announce the link or
+// record it elsewhere.
+type resultSink interface {
+	// Name identifies the sink in warnings and logs
+	Name() string
+	// Send delivers the event, sinks not interested in it return nil
+	Send(event uploadEvent) error
+}
+
+// notifySettings returns the settings of notifyConfigFile for a remote, those
+// of its section over the ones for every remote. A missing file has none.
+func notifySettings(remote string) (map[string]string, error) {
+	settings := make(map[string]string)
+	notifyPath, err := getStatePath(notifyConfigFile)
+	if err != nil {
+		return settings, err
+	}
+	data, err := os.ReadFile(notifyPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return settings, nil
+	}
+	if err != nil {
+		return settings, err
+	}
+	sections, err := azure.ParseRcloneConfigData(data)
+	if err != nil {
+		return settings, fmt.Errorf("%s: %w", notifyPath, err)
+	}
+	// The keys before the first section come first
+	for _, section := range sections {
+		if _, ok := section["remote_name"]; !ok {
+			maps.Copy(settings, section)
+		}
+	}
+	for _, section := range sections {
+		if section["remote_name"] == remote {
+			maps.Copy(settings, section)
+		}
+	}
+	delete(settings, "remote_name")
+	return settings, nil
+}
+
+// remoteSinks returns the sinks uploads to a remote are reported to: the
+// webhook, the Telegram chat and the plugins given with --webhook and --sink
+// or set up in notify.conf, and whether the events include the local path.
+func remoteSinks(remote string) ([]resultSink, bool) {
+	settings, err := notifySettings(remote)
+	if err != nil {
+		slog.Warn("failed to read the notification settings", "error", err)
+	}
+
+	var sinks []resultSink
+	url := webhookURL
+	if url == "" {
+		url = settings["webhook"]
+	}
+	if url != "" {
+		sinks = append(sinks, webhookSink{url: url})
+	}
+	if settings["telegram_bot_token"] != "" && settings["telegram_chat_id"] != "" && !noTelegram {
+		sinks = append(sinks, telegramSink{token: settings["telegram_bot_token"], chatID: settings["telegram_chat_id"]})
+	}
+
+	plugins := append([]string{}, sinkPlugins...)
+	for _, plugin := range strings.Split(settings["sinks"], ",") {
+		plugins = append(plugins, strings.TrimSpace(plugin))
+	}
+	seen := make(map[string]bool)
+	for _, plugin := range plugins {
+		if plugin == "" || seen[plugin] {
+			continue
+		}
+		seen[plugin] = true
+		sinks = append(sinks, execSink{plugin: plugin})
+	}
+	includeLocalPath, _ := strconv.ParseBool(settings["local_path"])
+	return sinks, includeLocalPath
+}
+
+// notifyUploadFinished reports a finished upload of the file at localPath to
+// the remote's sinks.
+func notifyUploadFinished(result *uploadResult, name string, localPath string, fileSize int64, hashStatus string, elapsed time.Duration) {
+	publishEvent(result.remote, uploadEvent{
+		Event:      eventUploadFinished,
+		File:       name,
+		LocalPath:  localPath,
+		Remote:     result.remote,
+		RemotePath: result.remotePath,
+		Size:       fileSize,
+		Link:       result.downloadURL,
+		HashStatus: hashStatus,
+		Skipped:    result.skipped,
+		Duration:   elapsed.Seconds(),
+	})
+}
+
+// notifyUploadFailed reports a failed upload of the file at localPath to the
+// remote's sinks.
+func notifyUploadFailed(remote string, name string, localPath string, fileSize int64, uploadErr error, elapsed time.Duration) {
+	publishEvent(remote, uploadEvent{
+		Event:     eventUploadFailed,
+		File:      name,
+		LocalPath: localPath,
+		Remote:    remote,
+		Size:      fileSize,
+		Duration:  elapsed.Seconds(),
+		Error:     redact.Error(uploadErr),
+	})
+}
+
+// publishEvent sends the event to every sink of the remote. Failures only
+// produce a warning, the upload itself is already decided. The local path of
+// the event is only sent if notify.conf opts in.
+func publishEvent(remote string, event uploadEvent) {
+	sinks, includeLocalPath := remoteSinks(remote)
+	if len(sinks) == 0 {
+		return
+	}
+	if !includeLocalPath {
+		event.LocalPath = ""
+	} else if absPath, err := filepath.Abs(event.LocalPath); err == nil && event.LocalPath != "" {
+		event.LocalPath = absPath
+	}
+	event.Time = time.Now().UTC()
+
+	for _, sink := range sinks {
+		if err := sink.Send(event); err != nil {
+			fmt.Printf("%sWarning: could not notify %s: %s%s\n", ColorYellow, sink.Name(), redact.Error(err), ColorReset)
+			slog.Warn("result sink failed", "sink", sink.Name(), "event", event.Event, "error", redact.Error(err))
+			continue
+		}
+		slog.Info("result sink notified", "sink", sink.Name(), "event", event.Event, "file", event.File)
+	}
+}
+
+// execSink runs a plugin executable for every event, passing the event as
+// JSON on stdin and its type in KSAU_EVENT; what it prints is shown to the
+// user. The plugin is either a path or the name of a ksau-sink-<name>
+// executable in the PATH. A non-zero exit status fails the notification, with
+// the plugin's stderr as the reason.
+type execSink struct {
+	plugin string
+}
+
+func (s execSink) Name() string {
+	return "sink " + s.plugin
+}
+
+func (s execSink) Send(event uploadEvent) error {
+	executable := s.plugin
+	if !strings.ContainsRune(executable, os.PathSeparator) {
+		var err error
+		executable, err = exec.LookPath(sinkPluginPrefix + s.plugin)
+		if err != nil {
+			return fmt.Errorf("no %s%s executable in the PATH", sinkPluginPrefix, s.plugin)
+		}
+	}
+
+	input, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sinkPluginTimeout)
+	defer cancel()
+	command := exec.CommandContext(ctx, executable)
+	command.Stdin = bytes.NewReader(input)
+	command.Env = append(os.Environ(), "KSAU_EVENT="+event.Event)
+	command.Stdout = os.Stdout
+	var stderr bytes.Buffer
+	command.Stderr = &stderr
+	if err := command.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return fmt.Errorf("%w: %s", err, message)
+		}
+		return err
+	}
+	return nil
+}
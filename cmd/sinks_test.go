@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNotifySettings(t *testing.T) {
+	dir := useTempConfigDir(t)
+	const notifyConf = `# every remote
+webhook = https://example.com/all
+sinks = discord
+local_path = true
+
+[oned]
+webhook = https://example.com/oned
+telegram_chat_id = 42
+
+[other]
+webhook = https://example.com/other
+sinks = matrix
+
+[oned]
+telegram_bot_token = bot
+telegram_chat_id = 43
+`
+	tests := []struct {
+		notifyConf string // "" for no notify.conf
+		remote     string
+		want       map[string]string
+	}{
+		{"", "oned", map[string]string{}},
+		{notifyConf, "oned", map[string]string{
+			"webhook":            "https://example.com/oned",
+			"sinks":              "discord",
+			"local_path":         "true",
+			"telegram_bot_token": "bot",
+			"telegram_chat_id":   "43",
+		}},
+		{notifyConf, "other", map[string]string{
+			"webhook":    "https://example.com/other",
+			"sinks":      "matrix",
+			"local_path": "true",
+		}},
+		{notifyConf, "unknown", map[string]string{
+			"webhook":    "https://example.com/all",
+			"sinks":      "discord",
+			"local_path": "true",
+		}},
+		{notifyConf, "", map[string]string{
+			"webhook":    "https://example.com/all",
+			"sinks":      "discord",
+			"local_path": "true",
+		}},
+		{"[oned]\nwebhook = https://example.com/oned\n", "other", map[string]string{}},
+		{"[oned]\nwebhook = https://example.com/oned\n", "oned", map[string]string{"webhook": "https://example.com/oned"}},
+	}
+	notifyPath := filepath.Join(dir, notifyConfigFile)
+	for _, tc := range tests {
+		os.Remove(notifyPath)
+		if tc.notifyConf != "" {
+			if err := os.WriteFile(notifyPath, []byte(tc.notifyConf), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := notifySettings(tc.remote)
+		if err != nil {
+			t.Errorf("notifySettings(%q) failed: %v", tc.remote, err)
+			continue
+		}
+		if !maps.Equal(got, tc.want) {
+			t.Errorf("notifySettings(%q) = %v, want %v", tc.remote, got, tc.want)
+		}
+	}
+}
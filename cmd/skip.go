@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/global-index-source/ksau-go/azure"
+)
+
+// skipExisting looks at the file already at remotePath and decides whether
+// uploading again is unnecessary: when it has the size and QuickXorHash of the
+// local file (unless --no-skip-same) or, with --if-newer, when the local file
+// wasn't modified after it. It returns the remote file and the reason to skip,
+// or nil if the file should be uploaded. Lookup failures are only logged, the
+// file is uploaded in that case.
+func skipExisting(client *azure.AzureClient, httpClient *http.Client, remotePath string, fileSize int64) (*azure.DriveItem, string) {
+	if noSkipSame && !ifNewer {
+		return nil, ""
+	}
+
+	item, err := client.GetItem(httpClient, remotePath)
+	if err != nil {
+		if !errors.Is(err, azure.ErrItemNotFound) {
+			slog.Info("cannot check the existing remote file", "path", remotePath, "error", err)
+		}
+		return nil, ""
+	}
+	if item.File == nil {
+		return nil, ""
+	}
+
+	if !noSkipSame && isIdentical(item, fileSize) {
+		return item, "an identical file already exists on the remote"
+	}
+
+	if ifNewer {
+		fileInfo, err := os.Stat(filePath)
+		if err != nil {
+			slog.Info("cannot stat the local file", "error", err)
+			return nil, ""
+		}
+		// Graph sets the modification time to the time of the last upload
+		if !fileInfo.ModTime().After(item.LastModifiedDateTime) {
+			return item, "the local file is not newer than the remote one (" + item.LastModifiedDateTime.Local().Format("2006-01-02 15:04:05") + ")"
+		}
+	}
+	return nil, ""
+}
+
+// isIdentical reports whether a remote file has the size and QuickXorHash of
+// the file being uploaded.
+func isIdentical(item *azure.DriveItem, fileSize int64) bool {
+	// Some drives don't report a QuickXorHash, the file can't be compared then
+	if item.Size != fileSize || item.File.Hashes.QuickXorHash == "" {
+		return false
+	}
+
+	localHash, err := uploadedFileHash()
+	if err != nil {
+		slog.Info("cannot hash the local file", "error", err)
+		return false
+	}
+	return item.File.Hashes.QuickXorHash == localHash
+}
@@ -0,0 +1,253 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/global-index-source/ksau-go/azure"
+	"github.com/global-index-source/ksau-go/cmd/history"
+	"github.com/global-index-source/ksau-go/cmd/progress"
+	"github.com/global-index-source/ksau-go/crypto"
+)
+
+// volumeManifestSuffix is appended to the name of a split file for the
+// manifest listing its volumes.
+const volumeManifestSuffix = ".parts.json"
+
+var splitSize int64
+
+// volumeManifest describes a file uploaded in volumes, in the order they
+// have to be joined.
+type volumeManifest struct {
+	File         string               `json:"file"`
+	Size         int64                `json:"size"`
+	QuickXorHash string               `json:"quickXorHash"`
+	Parts        []volumeManifestPart `json:"parts"`
+}
+
+type volumeManifestPart struct {
+	Name         string `json:"name"`
+	Size         int64  `json:"size"`
+	QuickXorHash string `json:"quickXorHash"`
+}
+
+// splitLimit returns the size above which uploads are split into volumes:
+// --split-size, or the largest file Graph accepts.
+func splitLimit() int64 {
+	if splitSize > 0 && splitSize < azure.MaxFileSize {
+		return splitSize
+	}
+	return azure.MaxFileSize
+}
+
+// volumeName returns the name of the volume with the given zero based index,
+// numbered from 1 with at least three digits so they sort in order.
+func volumeName(name string, index int, count int) string {
+	width := max(3, len(strconv.Itoa(count)))
+	return fmt.Sprintf("%s.part%0*d", name, width, index+1)
+}
+
+// uploadVolumes uploads the file in volumes of at most splitLimit bytes
+// named <name>.partNNN into the remote folder, followed by a manifest listing
+// them with their hashes, and prints the links. The file is read only once,
+// the hashes of the volumes and of the whole file are computed on the way.
+func uploadVolumes(configData []byte, remoteConfig string, name string, fileSize int64, httpClient *http.Client) error {
+	client, err := azure.NewAzureClientFromRcloneConfigData(configData, remoteConfig)
+	if err != nil {
+		return fmt.Errorf("failed to initialize client: %w", err)
+	}
+	client.Backoff = uploadBackoff(retryDelay)
+	client.MaxRetries = maxRetries
+	if err := client.SyncClock(httpClient); err != nil {
+		slog.Info("cannot determine the server time", "error", err)
+	}
+
+	conflictBehavior := conflict
+	if conflictBehavior == "" {
+		conflictBehavior = client.ConflictBehavior
+	}
+	if conflictBehavior == "" || conflictBehavior == azure.ConflictRename {
+		// Renamed volumes would no longer match the manifest
+		conflictBehavior = azure.ConflictReplace
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	limit := splitLimit()
+	count := int((fileSize + limit - 1) / limit)
+	remoteDir := filepath.Join(client.RemoteRootFolder, remoteFolder)
+	fmt.Printf("Splitting %s into %d volumes of up to %s\n", name, count, azure.FormatBytes(limit))
+
+	tracker := progress.NewProgressTracker(fileSize, progress.ProgressStyle(progressStyle))
+	tracker.CustomEmoji = customEmoji
+	sinks := append(progress.Fanout{tracker}, progressSinks...)
+
+	manifest := volumeManifest{File: name, Size: fileSize}
+	fileHasher := crypto.New()
+	hashStatus := hashVerified
+	if skipHash {
+		hashStatus = hashSkipped
+	}
+	start := time.Now()
+	for index := 0; index < count; index++ {
+		offset := int64(index) * limit
+		size := min(limit, fileSize-offset)
+		part := volumeManifestPart{Name: volumeName(name, index, count), Size: size}
+
+		partHasher := crypto.New()
+		var progressMutex sync.Mutex
+		fileID, err := client.Upload(httpClient, azure.UploadParams{
+			Reader:         io.TeeReader(io.NewSectionReader(file, offset, size), io.MultiWriter(partHasher, fileHasher)),
+			Size:           size,
+			RemoteFilePath: filepath.Join(remoteDir, part.Name),
+			ChunkSize:      chunkSize,
+			MaxRetries:     maxRetries,
+			Backoff:        uploadBackoff(retryDelay),
+			ProgressCallback: func(uploaded int64) {
+				progressMutex.Lock()
+				defer progressMutex.Unlock()
+				sinks.Update(offset+uploaded, fileSize)
+			},
+			ConflictBehavior: conflictBehavior,
+			ChunkTimeout:     chunkTimeout,
+			StallTimeout:     stallTimeout,
+			Timeout:          uploadTimeout,
+		})
+		if err != nil {
+			sinks.Finish()
+			recordTransfer(history.Entry{Remote: remoteConfig, Bytes: offset, Duration: time.Since(start)})
+			return fmt.Errorf("failed to upload volume %s: %w", part.Name, err)
+		}
+		part.QuickXorHash = encodeHash(partHasher)
+
+		if !skipHash {
+			remoteHash, err := client.GetQuickXorHash(httpClient, fileID)
+			if err != nil {
+				fmt.Printf("\n%sWarning: could not verify volume %s: %v%s\n", ColorYellow, part.Name, err, ColorReset)
+				hashStatus = hashUnverified
+			} else if remoteHash != part.QuickXorHash {
+				sinks.Finish()
+				return fmt.Errorf("volume %s is corrupted on the remote, hashes do not match", part.Name)
+			}
+		}
+		manifest.Parts = append(manifest.Parts, part)
+	}
+	sinks.Finish()
+	elapsed := time.Since(start)
+	manifest.QuickXorHash = encodeHash(fileHasher)
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	manifestName := name + volumeManifestSuffix
+	if _, err := client.UploadSmall(httpClient, filepath.Join(remoteDir, manifestName), data, azure.ConflictReplace); err != nil {
+		return fmt.Errorf("failed to upload the volume manifest: %w", err)
+	}
+	invalidateListCache(remoteConfig, remoteDir)
+
+	manifestURL := indexURL(client, filepath.Join(remoteFolder, manifestName))
+	entry := history.Entry{
+		Remote:     remoteConfig,
+		Bytes:      fileSize,
+		Success:    true,
+		Duration:   elapsed,
+		LocalPath:  filePath,
+		RemotePath: filepath.Join(remoteDir, manifestName),
+		Size:       fileSize,
+		Hash:       manifest.QuickXorHash,
+		Link:       manifestURL,
+	}
+	if absPath, err := filepath.Abs(filePath); err == nil {
+		entry.LocalPath = absPath
+	}
+	recordTransfer(entry)
+
+	fmt.Printf("\nFile uploaded successfully in %d volumes.\n", count)
+	for _, part := range manifest.Parts {
+		fmt.Printf("  %s\n", indexURL(client, filepath.Join(remoteFolder, part.Name)))
+	}
+	fmt.Printf("%sManifest:%s %s%s%s\n", ColorGreen, ColorReset, ColorGreen, manifestURL, ColorReset)
+	fmt.Printf("Reassemble with: ksau-go download %s -c %s\n", path.Join("/", filepath.ToSlash(remoteFolder), manifestName), remoteConfig)
+
+	result := &uploadResult{remote: remoteConfig, client: client, remotePath: entry.RemotePath, downloadURL: manifestURL}
+	notifyUploadFinished(result, name, filePath, fileSize, hashStatus, elapsed)
+	return nil
+}
+
+// downloadVolumes downloads the volumes listed in the manifest item from the
+// folder remoteDir, joins them into outputPath and checks the result against
+// the sizes and hashes in the manifest.
+func downloadVolumes(client *azure.AzureClient, httpClient *http.Client, manifestItem *azure.DriveItem, remoteDir string, outputPath string) error {
+	body, err := client.Download(httpClient, manifestItem.ID)
+	if err != nil {
+		return err
+	}
+	var manifest volumeManifest
+	err = json.NewDecoder(body).Decode(&manifest)
+	body.Close()
+	if err != nil {
+		return fmt.Errorf("failed to parse the volume manifest: %w", err)
+	}
+
+	partPath := outputPath + ".part"
+	file, err := os.Create(partPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(partPath)
+	defer file.Close()
+
+	tracker := progress.NewProgressTracker(manifest.Size, progress.StyleModern)
+	hasher := crypto.New()
+	var offset int64
+	for _, part := range manifest.Parts {
+		item, err := client.GetItem(httpClient, path.Join(remoteDir, part.Name))
+		if err != nil {
+			return fmt.Errorf("volume %s: %w", part.Name, err)
+		}
+		body, err := client.Download(httpClient, item.ID)
+		if err != nil {
+			return fmt.Errorf("volume %s: %w", part.Name, err)
+		}
+		source := &progressReader{reader: body, read: offset, total: manifest.Size, tracker: tracker}
+		written, err := io.Copy(io.MultiWriter(file, hasher), source)
+		body.Close()
+		if err != nil {
+			return fmt.Errorf("volume %s: %w", part.Name, err)
+		}
+		if written != part.Size {
+			return fmt.Errorf("volume %s has %d bytes, expected %d", part.Name, written, part.Size)
+		}
+		offset += written
+	}
+	tracker.Finish()
+
+	if !downloadSkipHash && manifest.QuickXorHash != "" && encodeHash(hasher) != manifest.QuickXorHash {
+		return fmt.Errorf("joined volumes: %w", errHashMismatch)
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(partPath, outputPath)
+}
+
+// encodeHash returns a QuickXorHash in the Base64 form Graph reports it in.
+func encodeHash(hasher hash.Hash) string {
+	return base64.StdEncoding.EncodeToString(hasher.Sum(nil))
+}
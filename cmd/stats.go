@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/global-index-source/ksau-go/azure"
+	"github.com/spf13/cobra"
+)
+
+var (
+	statsSince     string
+	statsPerRemote bool
+	statsDaily     bool
+	statsJSON      bool
+)
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show transfer statistics from the local upload history",
+	Long: `Summarize the bytes uploaded by this machine, failure rate and average
+speed, optionally per remote and per day. Useful on metered connections and for balancing load across remotes.`,
+	Run: runStats,
+}
+
+func init() {
+	rootCmd.AddCommand(statsCmd)
+
+	statsCmd.Flags().StringVar(&statsSince, "since", "", "Only count transfers newer than this (e.g. 12h, 7d, 2w)")
+	statsCmd.Flags().BoolVar(&statsPerRemote, "per-remote", false, "Break down the totals per remote")
+	statsCmd.Flags().BoolVar(&statsDaily, "daily", false, "Break down the totals per day")
+	statsCmd.Flags().BoolVar(&statsJSON, "json", false, "Print the statistics as JSON")
+}
+
+// transferTotals accumulates the transfers of one row in the stats output.
+type transferTotals struct {
+	uploads int
+	failed  int
+	bytes   int64
+
+	// Bytes and time of the transfers whose duration was recorded
+	timedBytes int64
+	elapsed    time.Duration
+}
+
+// failureRate returns the share of failed uploads in percent.
+func (t *transferTotals) failureRate() float64 {
+	if t.uploads == 0 {
+		return 0
+	}
+	return float64(t.failed) * 100 / float64(t.uploads)
+}
+
+// averageSpeed returns the average transfer speed in bytes per second, 0 if
+// no durations were recorded.
+func (t *transferTotals) averageSpeed() float64 {
+	if t.elapsed <= 0 {
+		return 0
+	}
+	return float64(t.timedBytes) / t.elapsed.Seconds()
+}
+
+// statsRow is a row of the --json output.
+type statsRow struct {
+	Day          string  `json:"day,omitempty"`
+	Remote       string  `json:"remote,omitempty"`
+	Uploads      int     `json:"uploads"`
+	Failed       int     `json:"failed"`
+	FailureRate  float64 `json:"failure_rate"`
+	Bytes        int64   `json:"bytes"`
+	AverageSpeed float64 `json:"average_speed"` // bytes per second
+}
+
+func newStatsRow(day string, remote string, totals *transferTotals) statsRow {
+	return statsRow{
+		Day:          day,
+		Remote:       remote,
+		Uploads:      totals.uploads,
+		Failed:       totals.failed,
+		FailureRate:  totals.failureRate(),
+		Bytes:        totals.bytes,
+		AverageSpeed: totals.averageSpeed(),
+	}
+}
+
+func runStats(cmd *cobra.Command, args []string) {
+	age, err := parseAge(statsSince)
+	if err != nil {
+		fmt.Println("invalid --since value:", err.Error())
+		os.Exit(1)
+	}
+
+	var since time.Time
+	if age > 0 {
+		since = time.Now().Add(-age)
+	}
+
+	store, err := openHistory()
+	if err != nil {
+		fmt.Println("failed to open upload history:", err.Error())
+		os.Exit(1)
+	}
+
+	entries, err := store.Load(since)
+	if err != nil {
+		fmt.Println("failed to read upload history:", err.Error())
+		os.Exit(1)
+	}
+
+	if len(entries) == 0 && !statsJSON {
+		fmt.Println("no transfers recorded")
+		return
+	}
+
+	type rowKey struct{ day, remote string }
+	rows := make(map[rowKey]*transferTotals)
+	var total transferTotals
+	for _, entry := range entries {
+		var key rowKey
+		if statsDaily {
+			key.day = entry.Time.Local().Format("2006-01-02")
+		}
+		if statsPerRemote {
+			key.remote = entry.Remote
+		}
+
+		row, ok := rows[key]
+		if !ok {
+			row = &transferTotals{}
+			rows[key] = row
+		}
+
+		for _, t := range []*transferTotals{row, &total} {
+			t.uploads++
+			t.bytes += entry.Bytes
+			if !entry.Success {
+				t.failed++
+			}
+			if entry.Duration > 0 {
+				t.timedBytes += entry.Bytes
+				t.elapsed += entry.Duration
+			}
+		}
+	}
+
+	keys := make([]rowKey, 0, len(rows))
+	for key := range rows {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].day != keys[j].day {
+			return keys[i].day < keys[j].day
+		}
+		return keys[i].remote < keys[j].remote
+	})
+
+	if statsJSON {
+		output := struct {
+			Since *time.Time `json:"since,omitempty"`
+			Rows  []statsRow `json:"rows,omitempty"`
+			Total statsRow   `json:"total"`
+		}{Total: newStatsRow("", "", &total)}
+		if !since.IsZero() {
+			output.Since = &since
+		}
+		if statsDaily || statsPerRemote {
+			for _, key := range keys {
+				output.Rows = append(output.Rows, newStatsRow(key.day, key.remote, rows[key]))
+			}
+		}
+
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(output)
+		return
+	}
+
+	if since.IsZero() {
+		fmt.Println("Transfers recorded:")
+	} else {
+		fmt.Printf("Transfers since %s:\n", since.Format("2006-01-02 15:04"))
+	}
+
+	if statsDaily || statsPerRemote {
+		for _, key := range keys {
+			row := rows[key]
+			label := strings.TrimSpace(key.day + "  " + key.remote)
+			fmt.Printf("%-30s %5d uploads (%d failed, %.1f%%)  %s  %s\n", label, row.uploads, row.failed, row.failureRate(), azure.FormatBytes(row.bytes), formatSpeed(row))
+		}
+		fmt.Println()
+	}
+
+	fmt.Printf("Total: %d uploads (%d failed, %.1f%%), %s transferred", total.uploads, total.failed, total.failureRate(), azure.FormatBytes(total.bytes))
+	if total.elapsed > 0 {
+		fmt.Printf(", %s on average", formatSpeed(&total))
+	}
+	fmt.Println()
+}
+
+// formatSpeed renders the average speed of t, or a dash if it is unknown.
+func formatSpeed(t *transferTotals) string {
+	if t.elapsed <= 0 {
+		return "-"
+	}
+	return azure.FormatBytes(int64(t.averageSpeed())) + "/s"
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+)
+
+// streamedUpload reports whether the upload content is produced on the fly
+// (--archive, --compress, --encrypt) instead of being read from the file as it is.
+func streamedUpload() bool {
+	return archiveFormat != "" || compressFormat != "" || encryptUpload
+}
+
+// writeUploadContent writes the content of a streamed upload to w: the
+// archive of the directory or the file, compressed and then encrypted if
+// requested. Without content, zeros take the place of the file data, which is
+// only possible if the result isn't compressed.
+func writeUploadContent(w io.Writer, content bool) error {
+	if !encryptUpload {
+		return writeCompressedContent(w, content)
+	}
+
+	encryptor, err := newEncryptor(w)
+	if err != nil {
+		return err
+	}
+	if err := writeCompressedContent(encryptor, content); err != nil {
+		return err
+	}
+	return encryptor.Close()
+}
+
+func writeCompressedContent(w io.Writer, content bool) error {
+	if compressFormat == "" {
+		return writeUploadSource(w, content)
+	}
+
+	compressor, err := newCompressor(w, compressFormat)
+	if err != nil {
+		return err
+	}
+	if err := writeUploadSource(compressor, true); err != nil {
+		compressor.Close()
+		return err
+	}
+	return compressor.Close()
+}
+
+func writeUploadSource(w io.Writer, content bool) error {
+	if archiveFormat != "" {
+		return writeArchive(w, archiveFormat, filePath, archiveFiles, content)
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	return copyFileContent(w, filePath, info.Size(), content)
+}
+
+// streamSize returns the exact size of a streamed upload. Graph needs the size
+// before the upload starts, so the content is produced once just to count it.
+// Uncompressed content doesn't even need to be read for that, encryption
+// only depends on its size.
+func streamSize() (int64, error) {
+	counter := &countingWriter{}
+	if err := writeUploadContent(counter, compressFormat != ""); err != nil {
+		return 0, err
+	}
+	return counter.n, nil
+}
+
+// uploadStream writes the upload content into a pipe while it is uploaded and
+// returns the reading end. The QuickXorHash of the content is computed along
+// the way. wait closes the reading end, so a writer that is still going gets
+// an error instead of blocking, and returns the writer's error and the hash.
+func uploadStream(hasher hash.Hash) (reader io.Reader, wait func() (string, error)) {
+	pipeReader, pipeWriter := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := writeUploadContent(pipeWriter, true)
+		pipeWriter.CloseWithError(err)
+		done <- err
+	}()
+
+	wait = func() (string, error) {
+		pipeReader.Close()
+		if err := <-done; err != nil {
+			if errors.Is(err, io.ErrClosedPipe) {
+				err = fmt.Errorf("files grew while they were read")
+			}
+			return "", fmt.Errorf("failed to stream %s: %w", filePath, err)
+		}
+		return base64.StdEncoding.EncodeToString(hasher.Sum(nil)), nil
+	}
+	return io.TeeReader(pipeReader, hasher), wait
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
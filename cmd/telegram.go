@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+
+	"github.com/global-index-source/ksau-go/azure"
+)
+
+// telegramAPI is the base URL of the Telegram Bot API.
+const telegramAPI = "https://api.telegram.org"
+
+var noTelegram bool
+
+// telegramSink posts the download link and details of finished uploads to the
+// chat in the telegram_chat_id key of notify.conf, using the bot in its
+// telegram_bot_token key.
+type telegramSink struct {
+	token  string
+	chatID string
+}
+
+func (s telegramSink) Name() string {
+	return "Telegram"
+}
+
+func (s telegramSink) Send(event uploadEvent) error {
+	if event.Event != eventUploadFinished {
+		return nil
+	}
+	return postTelegramMessage(s.token, s.chatID, telegramMessage(event))
+}
+
+// telegramMessage formats an upload for Telegram's HTML parse mode.
+func telegramMessage(event uploadEvent) string {
+	var message strings.Builder
+	fmt.Fprintf(&message, "<b>%s</b>\n", html.EscapeString(event.File))
+	fmt.Fprintf(&message, "Size: %s\n", azure.FormatBytes(event.Size))
+	if event.HashStatus == hashVerified {
+		message.WriteString("Integrity: verified\n")
+	}
+	fmt.Fprintf(&message, "\n<a href=\"%s\">Download</a>", html.EscapeString(event.Link))
+	return message.String()
+}
+
+func postTelegramMessage(token, chatID, text string) error {
+	body, err := json.Marshal(map[string]any{
+		"chat_id":                  chatID,
+		"text":                     text,
+		"parse_mode":               "HTML",
+		"disable_web_page_preview": true,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	url := fmt.Sprintf("%s/bot%s/sendMessage", telegramAPI, token)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := sharedHTTPClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var answer struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return fmt.Errorf("unexpected answer from Telegram (%s): %w", resp.Status, err)
+	}
+	if !answer.OK {
+		return fmt.Errorf("telegram refused the message: %s", answer.Description)
+	}
+	return nil
+}
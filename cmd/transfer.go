@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/global-index-source/ksau-go/azure"
+	"github.com/global-index-source/ksau-go/cmd/history"
+)
+
+// uploadLocalFile uploads a local file to remoteFilePath, relative to the
+// remote's root folder, replacing what is there, records it in the history
+// and the remote's receipts log and reports it to the remote's result sinks. A file identical to the remote
+// copy isn't uploaded again and is reported as skipped. progress, unless nil,
+// receives the bytes uploaded so far. Failures aren't reported to the sinks,
+// callers that retry only know when the upload failed for good.
+func uploadLocalFile(client *azure.AzureClient, httpClient *http.Client, remote string, localPath string, remoteFilePath string, retries int, progress func(int64)) (link string, skipped bool, err error) {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return "", false, err
+	}
+	remotePath := path.Join(client.RemoteRootFolder, remoteFilePath)
+	link = indexURL(client, remoteFilePath)
+	result := &uploadResult{remote: remote, client: client, remotePath: remotePath, downloadURL: link}
+
+	start := time.Now()
+	hash, err := localQuickXorHash(localPath)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to hash file: %w", err)
+	}
+	result.hash = hash
+	if item, err := client.GetItem(httpClient, remotePath); err == nil && item.File != nil &&
+		item.Size == info.Size() && item.File.Hashes.QuickXorHash == hash {
+		result.skipped = "an identical file already exists on the remote"
+		notifyUploadFinished(result, path.Base(remoteFilePath), localPath, info.Size(), hashVerified, time.Since(start))
+		return link, true, nil
+	}
+
+	release := remoteSlots.acquire(client)
+	start = time.Now()
+	_, err = client.Upload(httpClient, azure.UploadParams{
+		FilePath:         localPath,
+		RemoteFilePath:   remotePath,
+		ChunkSize:        getChunkSize(info.Size()),
+		MaxRetries:       retries,
+		Backoff:          client.Backoff,
+		ProgressCallback: progress,
+		ConflictBehavior: azure.ConflictReplace,
+		StallTimeout:     azure.DefaultStallTimeout,
+	})
+	elapsed := time.Since(start)
+	release()
+	if err != nil {
+		recordTransfer(history.Entry{Remote: remote, Duration: elapsed})
+		return "", false, err
+	}
+	invalidateListCache(remote, path.Dir(remotePath))
+
+	absPath, _ := filepath.Abs(localPath)
+	recordTransfer(history.Entry{
+		Remote:     remote,
+		Bytes:      info.Size(),
+		Success:    true,
+		Duration:   elapsed,
+		LocalPath:  absPath,
+		RemotePath: remotePath,
+		Size:       info.Size(),
+		Hash:       hash,
+		Link:       link,
+	})
+	appendReceipt(os.Stdout, result, localPath, info.Size(), httpClient)
+	notifyUploadFinished(result, path.Base(remoteFilePath), localPath, info.Size(), hashSkipped, elapsed)
+	return link, false, nil
+}
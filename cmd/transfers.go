@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"sync"
+
+	"github.com/global-index-source/ksau-go/azure"
+)
+
+// defaultTransfers is how many files commands uploading several files
+// transfer at the same time unless --transfers says otherwise.
+const defaultTransfers = 4
+
+var transfers int
+
+// remoteSlots caps the concurrent file uploads per remote at the remote's
+// max_transfers, across all commands and workers of the process.
+var remoteSlots = &transferLimiter{slots: make(map[string]chan struct{})}
+
+// transferLimiter hands out upload slots per remote.
+type transferLimiter struct {
+	mutex sync.Mutex
+	slots map[string]chan struct{} // by remote name
+}
+
+// acquire waits for a free upload slot on the client's remote and returns
+// the function releasing it. Remotes without max_transfers don't wait.
+func (l *transferLimiter) acquire(client *azure.AzureClient) func() {
+	if client.MaxTransfers < 1 {
+		return func() {}
+	}
+
+	l.mutex.Lock()
+	slots, ok := l.slots[client.RemoteName]
+	if !ok {
+		slots = make(chan struct{}, client.MaxTransfers)
+		l.slots[client.RemoteName] = slots
+	}
+	l.mutex.Unlock()
+
+	slots <- struct{}{}
+	return func() { <-slots }
+}
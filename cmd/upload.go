@@ -1,39 +1,89 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/global-index-source/ksau-go/azure"
+	"github.com/global-index-source/ksau-go/cmd/history"
+	"github.com/global-index-source/ksau-go/cmd/naming"
 	"github.com/global-index-source/ksau-go/cmd/progress"
+	"github.com/global-index-source/ksau-go/crypto"
+	"github.com/global-index-source/ksau-go/redact"
 	"github.com/spf13/cobra"
 )
 
 var (
-	filePath       string
-	remoteFolder   string
-	remoteFileName string
-	chunkSize      int64
-	maxRetries     int
-	retryDelay     time.Duration
-	skipHash       bool
-	hashRetries    int
-	hashRetryDelay time.Duration
-	progressStyle  string
-	customEmoji    string
+	filePath          string
+	remoteFolder      string
+	remoteFileName    string
+	chunkSize         int64
+	maxRetries        int
+	retryDelay        time.Duration
+	retryMaxDelay     time.Duration
+	retryFactor       float64
+	skipHash          bool
+	hashRetries       int
+	hashRetryDelay    time.Duration
+	progressStyle     string
+	customEmoji       string
+	legacyArgs        bool
+	noFallback        bool
+	failover          bool
+	nameStrategy      string
+	copies            int
+	sequential        bool
+	selectionStrategy string
+	progressJSON      string
+	progressListen    string
+	bufferLimit       int64
+	chunkTimeout      time.Duration
+	stallTimeout      time.Duration
+	uploadTimeout     time.Duration
+	signKey           string
+	annotateFile      string
+	conflict          string
+	uploaderNick      string
+	noReceipt         bool
+	noSkipSame        bool
+	ifNewer           bool
+	archiveFormat     string
+	compressFormat    string
+	faultInject       string
 )
 
+// archiveFiles are the files of the directory uploaded with --archive.
+var archiveFiles []archiveFile
+
+// progressSinks receive progress updates of every upload in addition to the
+// terminal progress bar.
+var progressSinks progress.Fanout
+
+// legacyArgsEnv enables the old ksau positional argument order when set to a
+// non-empty value, so existing scripts only need an environment change.
+const legacyArgsEnv = "KSAU_LEGACY_ARGS"
+
 var uploadCmd = &cobra.Command{
-	Use:   "upload",
+	Use:   "upload [file folder]",
 	Short: "Upload a file to OneDrive",
 	Long: `Upload a file to OneDrive with support for chunked uploads,
-parallel processing, and integrity verification.`,
-	Run: runUpload,
+parallel processing, and integrity verification.
+
+Scripts written for the old ksau tool can keep using the positional
+"upload <file> <folder>" form by passing --legacy-args or setting
+` + legacyArgsEnv + `=1.`,
+	Args: cobra.MaximumNArgs(2),
+	Run:  runUpload,
 }
 
 func init() {
@@ -43,11 +93,17 @@ func init() {
 	uploadCmd.Flags().StringVarP(&remoteFolder, "remote", "r", "", "Remote folder on OneDrive to upload the file (required)")
 	uploadCmd.Flags().StringVarP(&remoteFileName, "remote-name", "n", "", "Optional: Remote filename (defaults to local filename)")
 	uploadCmd.Flags().Int64VarP(&chunkSize, "chunk-size", "s", 0, "Chunk size for uploads in bytes (0 for automatic selection)")
+	uploadCmd.Flags().Int64Var(&bufferLimit, "buffer-limit", 0, "Maximum bytes of chunk data kept in memory per upload, larger chunks are streamed from disk (0 for no limit)")
+	uploadCmd.Flags().DurationVar(&chunkTimeout, "chunk-timeout", 0, "Abort and retry a chunk that takes longer than this to send, even if data is flowing (0 for no limit)")
+	uploadCmd.Flags().DurationVar(&stallTimeout, "stall-timeout", azure.DefaultStallTimeout, "Abort and retry a chunk that sent no data for this long (0 to never)")
+	uploadCmd.Flags().DurationVar(&uploadTimeout, "timeout", 0, "Total time budget for the upload including retries (0 for no limit)")
 	uploadCmd.Flags().IntVar(&maxRetries, "retries", 3, "Maximum number of retries for uploading chunks")
-	uploadCmd.Flags().DurationVar(&retryDelay, "retry-delay", 5*time.Second, "Delay between retries")
+	uploadCmd.Flags().DurationVar(&retryDelay, "retry-delay", 5*time.Second, "Initial delay between retries (grows exponentially)")
+	uploadCmd.Flags().DurationVar(&retryMaxDelay, "retry-max-delay", azure.DefaultBackoffCap, "Maximum delay between retries")
+	uploadCmd.Flags().Float64Var(&retryFactor, "retry-multiplier", azure.DefaultBackoffMultiplier, "Factor the retry delay grows by after each attempt")
 	uploadCmd.Flags().BoolVar(&skipHash, "skip-hash", false, "Skip QuickXorHash verification")
 	uploadCmd.Flags().IntVar(&hashRetries, "hash-retries", 5, "Maximum number of retries for fetching QuickXorHash")
-	uploadCmd.Flags().DurationVar(&hashRetryDelay, "hash-retry-delay", 10*time.Second, "Delay between QuickXorHash retries")
+	uploadCmd.Flags().DurationVar(&hashRetryDelay, "hash-retry-delay", 10*time.Second, "Initial delay between QuickXorHash retries (grows exponentially)")
 	// Add progress style flag with detailed help
 	uploadCmd.Flags().StringVar(&progressStyle, "progress", "modern",
 		`Progress bar style for upload visualization:
@@ -57,14 +113,80 @@ func init() {
 	emoji:   🟦🟦🟦⬜⬜ 45% | 5.2MB/s
 	minimal: 45% | 5.2MB/s | 42MB/100MB | ETA: 2m30s`)
 
+	uploadCmd.Flags().StringVar(&progressJSON, "progress-json", "", "Also write progress as JSON lines to this file ('-' for stderr)")
+	uploadCmd.Flags().StringVar(&progressListen, "progress-listen", "", "Serve progress on this address at /progress (JSON) and /metrics (Prometheus)")
+
 	// Add custom emoji flag with examples
 	uploadCmd.Flags().StringVar(&customEmoji, "emoji", "🟦",
 		`Custom emoji for emoji progress style. Examples:
 	🟦 (blue square), 🟩 (green square), 🌟 (star),
 	⭐ (yellow star), 🚀 (rocket), 📦 (package)`)
 
-	uploadCmd.MarkFlagRequired("file")
-	uploadCmd.MarkFlagRequired("remote")
+	uploadCmd.Flags().StringVar(&nameStrategy, "name-strategy", string(naming.StrategyKeep),
+		`How to name the remote file:
+	keep:     archive.zip (or the --remote-name)
+	random:   archive-3f9a1c.zip
+	hash:     9f86d081884c7d65.zip (content based)
+	uuid:     1b4e28ba-2fa1-41d2-883f-0016d3cca427.zip
+	datetime: archive-20250102-150405.zip`)
+	uploadCmd.Flags().StringVar(&conflict, "conflict", "", "What to do if the remote file exists: replace, rename or fail (default: the remote's conflict_behavior, or replace)")
+	uploadCmd.Flags().StringVar(&selectionStrategy, "strategy", StrategyMostFree,
+		`How to pick a remote when --remote-config is not given:
+	most-free:   the remote with the most free space
+	random:      a random remote
+	round-robin: rotate through the remotes on every upload
+	fastest:     the remote that answers the quickest
+	auto:        random for files under 1GiB, most-free otherwise (old ksau)
+The selection_strategy key of notify.conf changes the default.`)
+	uploadCmd.Flags().DurationVar(&selectionCacheTTL, "selection-cache-ttl", 10*time.Minute, "How long remote quota checks for automatic selection are reused (0 to disable)")
+	uploadCmd.Flags().IntVar(&copies, "copies", 1, "Number of remotes to upload the file to for redundancy")
+	uploadCmd.Flags().BoolVar(&sequential, "sequential", false, "Upload copies one after another instead of concurrently")
+	uploadCmd.Flags().BoolVar(&noFallback, "no-fallback", false, "Do not retry on another remote when the selected one runs out of space")
+	uploadCmd.Flags().BoolVar(&failover, "failover", false, "Retry the whole upload on the next remote after the chunk retries are exhausted")
+	uploadCmd.Flags().StringVar(&signKey, "sign-key", "", "Armored PGP private key to sign a manifest published next to the file (passphrase from "+signPassphraseEnv+")")
+	uploadCmd.Flags().StringVar(&annotateFile, "annotate", "", "Upload this file (e.g. changelog.md) as <file>.notes.<ext> next to the upload")
+	uploadCmd.Flags().StringVar(&uploaderNick, "nick", "", "Uploader name recorded in the receipts log of shared remotes (default: your user name)")
+	uploadCmd.Flags().BoolVar(&noReceipt, "no-receipt", false, "Don't append to the remote's receipts log")
+	uploadCmd.Flags().BoolVar(&noTelegram, "no-telegram", false, "Don't send the link to the Telegram chat of notify.conf")
+	uploadCmd.Flags().StringSliceVar(&sinkPlugins, "sink", nil, "Also report the result to this plugin, a path or the name of a "+sinkPluginPrefix+"<name> executable (repeatable)")
+	uploadCmd.Flags().BoolVar(&noSkipSame, "no-skip-same", false, "Upload even if an identical file (same size and QuickXorHash) already exists at the target path")
+	uploadCmd.Flags().StringVar(&archiveFormat, "archive", "", "Upload the directory given with --file as a zip or tar archive, created on the fly; --remote-name is then a template with {name}, {date}, {time} and {ext} (default: "+defaultArchiveName+")")
+	addFilterFlags(uploadCmd)
+	uploadCmd.Flags().BoolVar(&encryptUpload, "encrypt", false, "Encrypt the upload on the fly with age, adding .age to the remote name (passphrase from "+encryptPassphraseEnv+" unless --encrypt-to is given)")
+	uploadCmd.Flags().StringSliceVar(&encryptRecipients, "encrypt-to", nil, "Encrypt for these age public keys (age1...) or recipients files instead of a passphrase (repeatable)")
+	uploadCmd.Flags().StringVar(&compressFormat, "compress", "", "Compress the upload on the fly with gzip or zstd, adding .gz or .zst to the remote name")
+	uploadCmd.Flags().Int64Var(&splitSize, "split-size", 0, "Split files larger than this many bytes into <name>.partNNN volumes with a "+volumeManifestSuffix+" manifest (files above the 250 GB Graph limit are always split)")
+	uploadCmd.Flags().BoolVar(&ifNewer, "if-newer", false, "Only upload over an existing remote file if the local file was modified after it")
+	uploadCmd.Flags().StringVar(&webhookURL, "webhook", "", "POST a JSON summary to this URL when the upload finishes or fails (default: the webhook key of notify.conf)")
+	// Testing aid, deliberately left out of the help
+	uploadCmd.Flags().StringVar(&faultInject, "fault-inject", "", "Randomly fail requests, e.g. p=0.05,types=429,503,timeout,reset")
+	uploadCmd.Flags().MarkHidden("fault-inject")
+	uploadCmd.Flags().BoolVar(&legacyArgs, "legacy-args", false, "Accept old ksau style positional arguments: upload <file> <folder>")
+}
+
+// resolveUploadArgs fills filePath and remoteFolder from positional arguments
+// when the legacy ksau argument order is enabled, and checks that both are set.
+func resolveUploadArgs(args []string) error {
+	if len(args) > 0 {
+		if !legacyArgs && os.Getenv(legacyArgsEnv) == "" {
+			return fmt.Errorf("positional arguments are only accepted with --legacy-args or %s=1", legacyArgsEnv)
+		}
+		if len(args) != 2 {
+			return fmt.Errorf("legacy usage: ksau-go upload <file> <folder>")
+		}
+		if filePath != "" || remoteFolder != "" {
+			return fmt.Errorf("cannot mix positional arguments with --file/--remote")
+		}
+		filePath, remoteFolder = args[0], args[1]
+	}
+
+	if filePath == "" {
+		return fmt.Errorf(`required flag(s) "file" not set`)
+	}
+	if remoteFolder == "" {
+		return fmt.Errorf(`required flag(s) "remote" not set`)
+	}
+	return nil
 }
 
 func isValidProgressStyle(style string) bool {
@@ -78,11 +200,61 @@ func isValidProgressStyle(style string) bool {
 }
 
 func runUpload(cmd *cobra.Command, args []string) {
+	if err := resolveUploadArgs(args); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
 	// Validate progress style
 	if !isValidProgressStyle(progressStyle) {
 		fmt.Printf("Invalid progress style: %s\nValid styles are: basic, blocks, modern, emoji, minimal\n", progressStyle)
 		return
 	}
+	if !naming.IsValid(naming.Strategy(nameStrategy)) {
+		fmt.Printf("Invalid name strategy: %s\nValid strategies are: keep, random, hash, uuid, datetime\n", nameStrategy)
+		return
+	}
+	if !cmd.Flags().Changed("strategy") {
+		strategy, err := defaultSelectionStrategy()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		selectionStrategy = strategy
+	}
+	if _, ok := remoteSelectors[selectionStrategy]; !ok {
+		fmt.Printf("Invalid remote selection strategy: %s\nValid strategies are: %s\n", selectionStrategy, strings.Join(validSelectionStrategies(), ", "))
+		return
+	}
+	if conflict != "" && !azure.IsValidConflictBehavior(conflict) {
+		fmt.Printf("Invalid conflict behavior: %s\nValid behaviors are: %s, %s, %s\n", conflict, azure.ConflictReplace, azure.ConflictRename, azure.ConflictFail)
+		return
+	}
+	if copies < 1 {
+		fmt.Println("--copies must be at least 1")
+		return
+	}
+	if archiveFormat != "" && !isValidArchiveFormat(archiveFormat) {
+		fmt.Printf("Invalid archive format: %s\nValid formats are: %s, %s\n", archiveFormat, ArchiveZip, ArchiveTar)
+		return
+	}
+	if compressFormat != "" && !isValidCompression(compressFormat) {
+		fmt.Printf("Invalid compression format: %s\nValid formats are: %s, %s\n", compressFormat, CompressGzip, CompressZstd)
+		return
+	}
+	if splitSize < 0 {
+		fmt.Println("--split-size can't be negative")
+		return
+	}
+	var faults *azure.FaultConfig
+	if faultInject != "" {
+		spec, err := azure.ParseFaultSpec(faultInject)
+		if err != nil {
+			fmt.Println("Invalid --fault-inject:", err)
+			return
+		}
+		faults = spec
+	}
 	// Get file info
 	fileInfo, err := os.Stat(filePath)
 	if err != nil {
@@ -90,15 +262,104 @@ func runUpload(cmd *cobra.Command, args []string) {
 		return
 	}
 	fileSize := fileInfo.Size()
+	if archiveFormat != "" {
+		if !fileInfo.IsDir() {
+			fmt.Printf("--archive needs a directory, %s is a file\n", filePath)
+			return
+		}
+		filter, err := newFileFilter()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		archiveFiles, err = listArchiveFiles(filePath, filter)
+		if err != nil {
+			fmt.Println("Failed to list the directory:", err)
+			return
+		}
+		fmt.Printf("Archiving %d entries of %s as %s\n", len(archiveFiles), filePath, archiveFormat)
+	} else if fileInfo.IsDir() {
+		fmt.Printf("%s is a directory, upload it with --archive %s or --archive %s\n", filePath, ArchiveZip, ArchiveTar)
+		return
+	}
+	if len(encryptRecipients) > 0 {
+		encryptUpload = true
+	}
+	if encryptUpload && naming.Strategy(nameStrategy) == naming.StrategyHash {
+		// The hash of the plaintext would tell anyone what the file contains
+		fmt.Println("--name-strategy hash can't be used with --encrypt, the name would reveal the content")
+		return
+	}
+	if encryptUpload {
+		uploadRecipients, err = parseRecipients(encryptRecipients)
+		if err != nil {
+			fmt.Println("Failed to set up encryption:", err)
+			return
+		}
+	}
+	if streamedUpload() {
+		if compressFormat != "" {
+			fmt.Printf("Compressing with %s to determine the upload size...\n", compressFormat)
+		}
+		fileSize, err = streamSize()
+		if err != nil {
+			fmt.Println("Failed to prepare the upload:", err)
+			return
+		}
+		fmt.Printf("Upload size: %d bytes\n", fileSize)
+	}
+	if fileSize > splitLimit() && (streamedUpload() || copies > 1) {
+		fmt.Printf("%s needs to be split into volumes, which works neither with --archive, --compress or --encrypt nor with --copies\n", filePath)
+		return
+	}
+
+	annotation, err = readAnnotation()
+	if err != nil {
+		fmt.Println("Failed to read annotation:", err)
+		return
+	}
+
+	requireNetwork("")
+
+	closeSinks, err := setupProgressSinks()
+	if err != nil {
+		fmt.Println("Failed to set up progress output:", err)
+		return
+	}
+	defer closeSinks()
+
+	// Read the rclone config file
+	configData, err := getConfigData()
+	if err != nil {
+		fmt.Println("Failed to read config file:", err)
+		return
+	}
 
 	// Get the remote config from persistent flags
 	remoteConfig, _ := cmd.Flags().GetString("remote-config")
+	var group string
+	if strings.HasPrefix(remoteConfig, groupPrefix) {
+		group = strings.TrimPrefix(remoteConfig, groupPrefix)
+		remoteConfig = ""
+	}
+	// Remote quotas are needed for automatic selection, for picking the
+	// remotes of further copies and for falling back to another remote, start
+	// refreshing them while the upload gets going. An explicit remote that
+	// can't fall back doesn't need them.
+	needsRanking := remoteConfig == "" || !noFallback || copies > 1
+	if needsRanking && (selectionStrategy == StrategyMostFree || selectionStrategy == StrategyFastest || selectionStrategy == StrategyAuto) {
+		startSelectionRefresh(configData, group)
+	}
+
+	var candidates []string
 	if remoteConfig == "" {
-		remoteConfig, err = selectRemoteAutomatically(fileSize, progressStyle)
+		candidates, err = rankRemotes(selectionStrategy, configData, fileSize, group)
 		if err != nil {
 			fmt.Println("cannot automatically determine remote to be used:", err.Error())
 			os.Exit(1)
 		}
+		remoteConfig = candidates[0]
+		fmt.Printf("Using remote selected by %s strategy: %s\n", selectionStrategy, remoteConfig)
 	}
 
 	// Dynamically select chunk size if not specified
@@ -116,59 +377,268 @@ func runUpload(cmd *cobra.Command, args []string) {
 		}
 	}
 
-	// Determine remote filename and path
-	localFileName := filepath.Base(filePath)
-	remoteFilePath := filepath.Join(remoteFolder, localFileName)
-	if remoteFileName != "" {
-		remoteFilePath = filepath.Join(remoteFolder, remoteFileName)
+	// Determine remote filename
+	targetName, err := generateUploadName()
+	if err != nil {
+		fmt.Println("Failed to generate remote file name:", err)
+		return
 	}
 
-	// Read the rclone config file
-	configData, err := getConfigData()
-	if err != nil {
-		fmt.Println("Failed to read config file:", err)
+	// No overall client timeout, chunks are bounded by --stall-timeout and
+	// the whole upload by --timeout instead
+	httpClient := sharedHTTPClient()
+	if faults != nil {
+		faults.OnFault = func(req *http.Request, kind string) {
+			fmt.Fprintf(os.Stderr, "%sinjected fault %s: %s %s%s\n", ColorYellow, kind, req.Method, redact.String(req.URL.String()), ColorReset)
+		}
+		httpClient = &http.Client{Transport: azure.NewFaultTransport(httpClient.Transport, *faults)}
+	}
+
+	if dryRun {
+		dryRunUpload(configData, remoteConfig, candidates, targetName, fileSize, httpClient)
 		return
 	}
 
+	start := time.Now()
+	if fileSize > splitLimit() {
+		if err := uploadVolumes(configData, remoteConfig, targetName, fileSize, httpClient); err != nil {
+			fmt.Printf("\nFailed to upload file: %s\n", redact.Error(err))
+			printErrorHint(err)
+			notifyUploadFailed(remoteConfig, targetName, filePath, fileSize, err, time.Since(start))
+		}
+		return
+	}
+
+	if copies > 1 {
+		uploadCopies(configData, remoteConfig, candidates, targetName, fileSize, httpClient)
+		return
+	}
+
+	tried := []string{}
+	for {
+		tried = append(tried, remoteConfig)
+		result, err := uploadToRemote(configData, remoteConfig, targetName, fileSize, true, httpClient)
+		if err == nil {
+			hashStatus := reportUpload(result, fileSize, httpClient)
+			notifyUploadFinished(result, targetName, filePath, fileSize, hashStatus, time.Since(start))
+			return
+		}
+
+		fmt.Printf("\nFailed to upload file: %s\n", redact.Error(err))
+		uploadErr := err
+		outOfSpace := errors.Is(err, azure.ErrQuotaExceeded)
+		if !shouldFallBack(err) {
+			printErrorHint(err)
+			notifyUploadFailed(remoteConfig, targetName, filePath, fileSize, err, time.Since(start))
+			return
+		}
+
+		// Move on to the next best remote with a fresh upload session
+		if outOfSpace {
+			invalidateSelectionCache()
+		}
+		if candidates == nil {
+			candidates, err = rankRemotes(selectionStrategy, configData, fileSize, "")
+			if err != nil {
+				fmt.Println("cannot determine a fallback remote:", err.Error())
+				notifyUploadFailed(tried[len(tried)-1], targetName, filePath, fileSize, uploadErr, time.Since(start))
+				return
+			}
+		}
+		remoteConfig = nextCandidate(candidates, tried)
+		if remoteConfig == "" {
+			fmt.Println("No other remote left to fall back to.")
+			notifyUploadFailed(tried[len(tried)-1], targetName, filePath, fileSize, uploadErr, time.Since(start))
+			return
+		}
+		reason := "failed"
+		if outOfSpace {
+			reason = "is out of space"
+		}
+		fmt.Printf("%sRemote '%s' %s, retrying with '%s'%s\n", ColorYellow, tried[len(tried)-1], reason, remoteConfig, ColorReset)
+	}
+}
+
+// shouldFallBack reports whether a failed upload should be retried on another
+// remote: always when the remote ran out of space (unless --no-fallback), and
+// for any other remote side failure when --failover is set. Problems with the
+// local file would fail on every remote, so they never trigger a retry.
+func shouldFallBack(err error) bool {
+	if noFallback {
+		return false
+	}
+	if errors.Is(err, azure.ErrQuotaExceeded) {
+		return true
+	}
+
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return false
+	}
+	return failover
+}
+
+// setupProgressSinks creates the extra progress sinks requested by flags and
+// returns a function releasing their resources.
+func setupProgressSinks() (func(), error) {
+	var closers []func()
+	closeAll := func() {
+		for _, closer := range closers {
+			closer()
+		}
+	}
+
+	switch progressJSON {
+	case "":
+	case "-":
+		progressSinks = append(progressSinks, progress.NewJSONSink(os.Stderr))
+	default:
+		file, err := os.Create(progressJSON)
+		if err != nil {
+			return nil, err
+		}
+		closers = append(closers, func() { file.Close() })
+		progressSinks = append(progressSinks, progress.NewJSONSink(file))
+	}
+
+	if progressListen != "" {
+		status := progress.NewStatusSink()
+		server := &http.Server{Addr: progressListen, Handler: status.Handler()}
+		go func() {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fmt.Printf("%sWarning: progress server failed: %v%s\n", ColorYellow, err, ColorReset)
+			}
+		}()
+		closers = append(closers, func() { server.Close() })
+		progressSinks = append(progressSinks, status)
+	}
+
+	return closeAll, nil
+}
+
+// uploadResult describes a file that was successfully uploaded to a remote.
+type uploadResult struct {
+	remote      string
+	client      *azure.AzureClient
+	fileID      string
+	remotePath  string
+	downloadURL string
+	skipped     string // why nothing was uploaded, empty if the file was
+	hash        string // QuickXorHash of the uploaded content if known, streamed copies have their own
+}
+
+// contentHash returns the QuickXorHash of what was uploaded: the content
+// streamed to this remote, or else the file itself.
+func (r *uploadResult) contentHash() (string, error) {
+	if r.hash != "" {
+		return r.hash, nil
+	}
+	return uploadedFileHash()
+}
+
+// nextCandidate returns the first remote in candidates that is not in tried,
+// or an empty string if every candidate has been tried already.
+func nextCandidate(candidates []string, tried []string) string {
+	for _, candidate := range candidates {
+		if !slices.Contains(tried, candidate) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// uploadToRemote uploads filePath as name into remoteFolder of the given remote
+// and returns where it ended up. The progress bar is only drawn if showProgress
+// is set, since concurrent uploads would fight over the terminal line.
+func uploadToRemote(configData []byte, remoteConfig string, name string, fileSize int64, showProgress bool, httpClient *http.Client) (result *uploadResult, err error) {
+	// Fail just this remote on a panic, parallel copies keep going
+	defer azure.RecoverPanic(&err)
+
 	client, err := azure.NewAzureClientFromRcloneConfigData(configData, remoteConfig)
 	if err != nil {
-		fmt.Println("Failed to initialize client:", err)
-		return
+		return nil, fmt.Errorf("failed to initialize client: %w", err)
+	}
+	client.Backoff = uploadBackoff(retryDelay)
+	client.MaxRetries = maxRetries
+
+	// A wrong local clock would make an expired token look valid. Without the
+	// server time the refresh margin still covers small offsets.
+	if err := client.SyncClock(httpClient); err != nil {
+		slog.Info("cannot determine the server time", "error", err)
 	}
 
+	// --conflict wins over the remote's default. Random names must not
+	// silently replace (or be renamed next to) an existing file.
+	conflictBehavior := conflict
+	if conflictBehavior == "" {
+		conflictBehavior = client.ConflictBehavior
+	}
+	if naming.IsRandom(naming.Strategy(nameStrategy)) {
+		name, err = ensureUniqueName(client, httpClient, name)
+		if err != nil {
+			return nil, err
+		}
+		if conflict == "" {
+			conflictBehavior = azure.ConflictFail
+		}
+	}
+	if conflictBehavior == "" {
+		conflictBehavior = azure.ConflictReplace
+	}
+	remoteFilePath := filepath.Join(remoteFolder, name)
+
 	// Add root folder for the selected remote configuration
-	// rootFolder := getRootFolder(remoteConfig)
 	rootFolder := client.RemoteRootFolder
 	fullRemotePath := filepath.Join(rootFolder, remoteFilePath)
 	fmt.Printf("Full remote path: %s\n", fullRemotePath)
 
+	// Repeated uploads of the same release don't need to transfer anything.
+	// Random names never exist yet, so there is nothing to compare.
+	if !streamedUpload() && !naming.IsRandom(naming.Strategy(nameStrategy)) {
+		if item, reason := skipExisting(client, httpClient, fullRemotePath, fileSize); item != nil {
+			return &uploadResult{
+				remote:      remoteConfig,
+				client:      client,
+				fileID:      item.ID,
+				remotePath:  fullRemotePath,
+				downloadURL: indexURL(client, remoteFilePath),
+				skipped:     reason,
+			}, nil
+		}
+	}
+
 	// Set up progress tracking
-	var progressCallback azure.ProgressCallback
-	tracker := progress.NewProgressTracker(fileSize, progress.ProgressStyle(progressStyle))
-	if tracker == nil {
-		fmt.Println("Warning: Progress tracking not available")
-	} else {
-		tracker.CustomEmoji = customEmoji
+	sinks := append(progress.Fanout{}, progressSinks...)
+	if showProgress {
+		tracker := progress.NewProgressTracker(fileSize, progress.ProgressStyle(progressStyle))
+		if tracker == nil {
+			fmt.Println("Warning: Progress tracking not available")
+		} else {
+			tracker.CustomEmoji = customEmoji
+			sinks = append(sinks, tracker)
+		}
+	}
 
-		// Create the progress callback
-		var progressMutex sync.Mutex
-		progressCallback = func(uploadedBytes int64) {
-			if tracker == nil {
-				return
-			}
+	// Create the progress callback, which also counts the transferred bytes
+	var uploaded int64
+	var progressMutex sync.Mutex
+	progressCallback := func(uploadedBytes int64) {
+		progressMutex.Lock()
+		defer progressMutex.Unlock()
+		uploaded = uploadedBytes
 
-			progressMutex.Lock()
-			defer progressMutex.Unlock()
+		if sinks == nil {
+			return
+		}
 
-			defer func() {
-				if r := recover(); r != nil {
-					fmt.Printf("\nWarning: Progress update failed: %v\n", r)
-					tracker = nil // Disable progress display on error
-				}
-			}()
+		defer func() {
+			if r := recover(); r != nil {
+				fmt.Printf("\nWarning: Progress update failed: %v\n", r)
+				sinks = nil // Disable progress display on error
+			}
+		}()
 
-			tracker.UpdateProgress(uploadedBytes)
-		}
+		sinks.Update(uploadedBytes, fileSize)
 	}
 
 	// Prepare upload parameters
@@ -177,49 +647,259 @@ func runUpload(cmd *cobra.Command, args []string) {
 		RemoteFilePath:   fullRemotePath,
 		ChunkSize:        chunkSize,
 		MaxRetries:       maxRetries,
-		RetryDelay:       retryDelay,
-		AccessToken:      client.AccessToken,
+		Backoff:          uploadBackoff(retryDelay),
 		ProgressCallback: progressCallback,
+		ConflictBehavior: conflictBehavior,
+		BufferLimit:      bufferLimit,
+		ChunkTimeout:     chunkTimeout,
+		StallTimeout:     stallTimeout,
+		Timeout:          uploadTimeout,
 	}
 
-	// Use a longer timeout for large file uploads
-	httpClient := &http.Client{Timeout: 120 * time.Second}
+	// Archives and compressed files are written straight into the upload,
+	// every copy gets its own stream
+	var waitStream func() (string, error)
+	var streamHash string
+	if streamedUpload() {
+		params.Reader, waitStream = uploadStream(crypto.New())
+		params.Size = fileSize
+	}
+
+	start := time.Now()
 	fileID, err := client.Upload(httpClient, params)
+	elapsed := time.Since(start)
+	if waitStream != nil {
+		// A failed upload stops reading, the stream error is a consequence
+		var streamErr error
+		streamHash, streamErr = waitStream()
+		if err == nil && streamErr != nil {
+			// The uploaded content is cut off, don't leave it behind
+			if deleteErr := client.DeleteItem(httpClient, fileID, fullRemotePath, false); deleteErr != nil {
+				fmt.Printf("%sWarning: failed to remove the incomplete upload %s: %v%s\n", ColorYellow, fullRemotePath, deleteErr, ColorReset)
+			}
+			err = streamErr
+		}
+	}
+	progressMutex.Lock()
+	transferred := uploaded
+	progressMutex.Unlock()
 	if err != nil {
-		if tracker != nil {
-			tracker.Finish()
+		recordTransfer(history.Entry{Remote: remoteConfig, Bytes: transferred, Duration: elapsed})
+	}
+	if sinks != nil {
+		if err == nil {
+			// Report 100% progress on success
+			sinks.Update(fileSize, fileSize)
 		}
-		fmt.Printf("\nFailed to upload file: %v\n", err)
-		return
+		sinks.Finish()
 	}
+	if err != nil {
+		return nil, err
+	}
+	if fileID == "" {
+		return nil, fmt.Errorf("upload returned no file ID")
+	}
+	invalidateListCache(remoteConfig, filepath.Join(rootFolder, remoteFolder))
 
-	if fileID != "" {
-		// Report 100% progress on success
-		if tracker != nil {
-			tracker.UpdateProgress(fileSize)
-			tracker.Finish()
+	// Graph picks a new name if the file existed, the links must use that one
+	if conflictBehavior == azure.ConflictRename {
+		if item, err := client.GetItemByID(httpClient, fileID); err == nil && item.Name != name {
+			fmt.Printf("%sA file named %s already existed, uploaded as %s%s\n", ColorYellow, name, item.Name, ColorReset)
+			remoteFilePath = filepath.Join(remoteFolder, item.Name)
+			fullRemotePath = filepath.Join(rootFolder, remoteFilePath)
 		}
-		fmt.Println("\nFile uploaded successfully.")
+	}
+
+	downloadURL := indexURL(client, remoteFilePath)
+
+	entry := history.Entry{
+		Remote:     remoteConfig,
+		Bytes:      transferred,
+		Success:    true,
+		Duration:   elapsed,
+		LocalPath:  filePath,
+		RemotePath: fullRemotePath,
+		Size:       fileSize,
+		Link:       downloadURL,
+	}
+	if absPath, err := filepath.Abs(filePath); err == nil {
+		entry.LocalPath = absPath
+	}
+	result = &uploadResult{
+		remote:      remoteConfig,
+		client:      client,
+		fileID:      fileID,
+		remotePath:  fullRemotePath,
+		downloadURL: downloadURL,
+		hash:        streamHash,
+	}
+	// The hash is computed for the integrity check anyway
+	if !skipHash {
+		entry.Hash, _ = result.contentHash()
+		result.hash = entry.Hash
+	}
+	recordTransfer(entry)
+	return result, nil
+}
 
-		// Generate download URL
-		baseURL := client.RemoteBaseUrl
-		urlPath := strings.ReplaceAll(filepath.Join(remoteFolder, localFileName), "\\", "/")
-		if remoteFileName != "" {
-			urlPath = filepath.Join(remoteFolder, remoteFileName)
+// maxNameAttempts is how many random names are tried before giving up.
+const maxNameAttempts = 5
+
+// uploadBaseName returns the remote file name before any naming strategy is applied.
+func uploadBaseName() string {
+	name := filepath.Base(filePath)
+	if archiveFormat != "" {
+		name = archiveName(remoteFileName, filePath, archiveFormat)
+	} else if remoteFileName != "" {
+		name = remoteFileName
+	}
+	name = compressedName(name, compressFormat)
+	if encryptUpload {
+		name += encryptedSuffix
+	}
+	return name
+}
+
+// generateUploadName applies --name-strategy to the name of the upload.
+// Archives, compressed and encrypted uploads are named after the content that
+// is uploaded, not the file or directory it is made of.
+func generateUploadName() (string, error) {
+	if !streamedUpload() {
+		return naming.Generate(naming.Strategy(nameStrategy), uploadBaseName(), filePath)
+	}
+	return naming.GenerateFromContent(naming.Strategy(nameStrategy), uploadBaseName(), func(w io.Writer) error {
+		return writeUploadContent(w, true)
+	})
+}
+
+// ensureUniqueName checks that name is still free in remoteFolder of the
+// client's remote and generates a new random name if it isn't.
+func ensureUniqueName(client *azure.AzureClient, httpClient *http.Client, name string) (string, error) {
+	for attempt := 0; attempt < maxNameAttempts; attempt++ {
+		exists, err := client.ItemExists(httpClient, filepath.Join(client.RemoteRootFolder, remoteFolder, name))
+		if err != nil {
+			return "", fmt.Errorf("failed to check if %s exists: %w", name, err)
+		}
+		if !exists {
+			return name, nil
 		}
 
-		urlPath = strings.ReplaceAll(urlPath, " ", "%20")
-		downloadURL := fmt.Sprintf("%s/%s", baseURL, urlPath)
-		fmt.Printf("%sDownload URL:%s %s%s%s\n", ColorGreen, ColorReset, ColorGreen, downloadURL, ColorReset)
+		fmt.Printf("Name %s is already taken, generating a new one\n", name)
+		name, err = generateUploadName()
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("could not find a free name after %d attempts", maxNameAttempts)
+}
 
-		if !skipHash {
-			verifyFileIntegrity(filePath, fileID, client, httpClient)
+// copyTargets returns the up to copies distinct remotes copies of the file go
+// to, remoteConfig first and then in the order of the selection strategy.
+func copyTargets(configData []byte, remoteConfig string, candidates []string, fileSize int64) ([]string, error) {
+	if candidates == nil {
+		var err error
+		candidates, err = rankRemotes(selectionStrategy, configData, fileSize, "")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	targets := []string{remoteConfig}
+	for len(targets) < copies {
+		next := nextCandidate(candidates, targets)
+		if next == "" {
+			break
+		}
+		targets = append(targets, next)
+	}
+	return targets, nil
+}
+
+// uploadCopies uploads the file to up to copies distinct remotes, starting with
+// remoteConfig and continuing in the order of the selection strategy, then
+// prints one download URL per remote and verifies each copy.
+func uploadCopies(configData []byte, remoteConfig string, candidates []string, name string, fileSize int64, httpClient *http.Client) {
+	targets, err := copyTargets(configData, remoteConfig, candidates, fileSize)
+	if err != nil {
+		fmt.Println("cannot determine remotes for copies:", err.Error())
+		return
+	}
+	if len(targets) < copies {
+		fmt.Printf("%sWarning: only %d remote(s) available, uploading %d copies%s\n", ColorYellow, len(targets), len(targets), ColorReset)
+	}
+	fmt.Println("Uploading copies to:", strings.Join(targets, ", "))
+
+	results := make([]*uploadResult, len(targets))
+	errs := make([]error, len(targets))
+	start := time.Now()
+	if sequential {
+		for i, target := range targets {
+			results[i], errs[i] = uploadToRemote(configData, target, name, fileSize, true, httpClient)
 		}
 	} else {
-		// Clear progress bar on failure
-		if tracker != nil {
-			tracker.Finish()
+		var wg sync.WaitGroup
+		for i, target := range targets {
+			wg.Add(1)
+			go func(i int, target string) {
+				defer wg.Done()
+				results[i], errs[i] = uploadToRemote(configData, target, name, fileSize, false, httpClient)
+			}(i, target)
+		}
+		wg.Wait()
+	}
+
+	elapsed := time.Since(start)
+
+	fmt.Println()
+	for i, target := range targets {
+		if errs[i] != nil {
+			fmt.Printf("%s[%s] Failed to upload file: %s%s\n", ColorRed, target, redact.Error(errs[i]), ColorReset)
+			printErrorHint(errs[i])
+			notifyUploadFailed(target, name, filePath, fileSize, errs[i], elapsed)
+			continue
+		}
+		if results[i].skipped != "" {
+			fmt.Printf("[%s] Skipped the upload, %s\n", target, results[i].skipped)
+		}
+		fmt.Printf("[%s] %sDownload URL:%s %s%s%s\n", target, ColorGreen, ColorReset, ColorGreen, results[i].downloadURL, ColorReset)
+		if results[i].skipped != "" {
+			continue
+		}
+		publishAnnotation(results[i], httpClient)
+		publishManifest(results[i], fileSize, httpClient)
+		appendReceipt(os.Stdout, results[i], filePath, fileSize, httpClient)
+	}
+
+	for _, result := range results {
+		if result == nil {
+			continue
 		}
-		fmt.Println("\nFile upload failed.")
+		hashStatus := hashSkipped
+		if !skipHash && result.skipped == "" {
+			fmt.Printf("[%s] ", result.remote)
+			hashStatus = verifyFileIntegrity(result, httpClient)
+		}
+		notifyUploadFinished(result, name, filePath, fileSize, hashStatus, elapsed)
+	}
+}
+
+// reportUpload prints the download URL of a finished upload, publishes the
+// annotation, signed manifest and receipt if requested, verifies its integrity
+// and returns the outcome of the check.
+func reportUpload(result *uploadResult, fileSize int64, httpClient *http.Client) string {
+	if result.skipped != "" {
+		fmt.Printf("\n%sSkipped the upload, %s.%s\n", ColorGreen, result.skipped, ColorReset)
+		fmt.Printf("%sDownload URL:%s %s%s%s\n", ColorGreen, ColorReset, ColorGreen, result.downloadURL, ColorReset)
+		return hashSkipped
+	}
+	fmt.Println("\nFile uploaded successfully.")
+	fmt.Printf("%sDownload URL:%s %s%s%s\n", ColorGreen, ColorReset, ColorGreen, result.downloadURL, ColorReset)
+	publishAnnotation(result, httpClient)
+	publishManifest(result, fileSize, httpClient)
+	appendReceipt(os.Stdout, result, filePath, fileSize, httpClient)
+
+	if skipHash {
+		return hashSkipped
 	}
+	return verifyFileIntegrity(result, httpClient)
 }
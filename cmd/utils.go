@@ -2,19 +2,21 @@ package cmd
 
 import (
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
-	// "math/rand"
 	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
 	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/global-index-source/ksau-go/azure"
-	"github.com/global-index-source/ksau-go/cmd/progress"
+	"github.com/global-index-source/ksau-go/cmd/history"
 	"github.com/global-index-source/ksau-go/crypto"
 )
 
@@ -26,14 +28,43 @@ const (
 	ColorYellow = "\033[33m"
 )
 
+// configEnv names the environment variable that overrides the config path,
+// --config takes precedence over it.
+const configEnv = "KSAU_CONFIG"
+
+// configFile is the config path given with --config.
+var configFile string
+
+// getConfigPath returns the path of the encrypted rclone config: --config or
+// $KSAU_CONFIG if set, the per-OS default otherwise.
 func getConfigPath() (string, error) {
+	explicit := configFile
+	if explicit == "" {
+		explicit = os.Getenv(configEnv)
+	}
+	if explicit != "" {
+		configPath, err := filepath.Abs(explicit)
+		if err != nil {
+			return "", fmt.Errorf("invalid config path %s: %w", explicit, err)
+		}
+		if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+			return "", fmt.Errorf("failed to create config directory: %w", err)
+		}
+		return configPath, nil
+	}
+
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return "", fmt.Errorf("failed to get user home dir: %w", err)
 	}
 
 	var configDir string
-	if slices.Contains([]string{"android", "linux", "unix"}, runtime.GOOS) {
+	if slices.Contains([]string{"linux", "unix"}, runtime.GOOS) {
+		configDir, err = xdgConfigDir(home)
+		if err != nil {
+			return "", err
+		}
+	} else if runtime.GOOS == "android" {
 		configDir = filepath.Join(home, ".ksau", ".conf")
 	} else if runtime.GOOS == "windows" {
 		configDir = filepath.Join(home, "AppData", "Roaming", "ksau", ".conf")
@@ -50,6 +81,69 @@ func getConfigPath() (string, error) {
 	return configPath, nil
 }
 
+// xdgConfigDir returns $XDG_CONFIG_HOME/ksau (~/.config/ksau by default). A
+// config in the old ~/.ksau/.conf location is moved there, together with the
+// state files next to it. If moving fails, the old location keeps being used.
+func xdgConfigDir(home string) (string, error) {
+	base := os.Getenv("XDG_CONFIG_HOME")
+	if base == "" || !filepath.IsAbs(base) {
+		base = filepath.Join(home, ".config")
+	}
+	configDir := filepath.Join(base, "ksau")
+	legacyDir := filepath.Join(home, ".ksau", ".conf")
+
+	if _, err := os.Stat(filepath.Join(configDir, "rclone.conf")); err == nil {
+		return configDir, nil
+	}
+	if _, err := os.Stat(filepath.Join(legacyDir, "rclone.conf")); err != nil {
+		return configDir, nil
+	}
+
+	if err := migrateConfigDir(legacyDir, configDir); err != nil {
+		fmt.Fprintf(os.Stderr, "%swarning: failed to move the config from %s to %s, still using the old location: %v%s\n", ColorYellow, legacyDir, configDir, err, ColorReset)
+		return legacyDir, nil
+	}
+	fmt.Fprintf(os.Stderr, "moved the config from %s to %s\n", legacyDir, configDir)
+	return configDir, nil
+}
+
+// migrateConfigDir moves every entry of legacyDir that doesn't exist in
+// configDir yet into it, moving rclone.conf last so an interrupted migration
+// is simply repeated. The emptied legacy directories are removed.
+func migrateConfigDir(legacyDir string, configDir string) error {
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(legacyDir)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Name() != "rclone.conf" {
+			names = append(names, entry.Name())
+		}
+	}
+	names = append(names, "rclone.conf")
+
+	for _, name := range names {
+		target := filepath.Join(configDir, name)
+		if _, err := os.Lstat(target); err == nil {
+			continue
+		}
+		if err := os.Rename(filepath.Join(legacyDir, name), target); err != nil {
+			return err
+		}
+	}
+
+	// Only succeeds if nothing was left behind
+	if os.Remove(legacyDir) == nil {
+		os.Remove(filepath.Dir(legacyDir))
+	}
+	return nil
+}
+
 func getConfigData() ([]byte, error) {
 	configPath, err := getConfigPath()
 	if err != nil {
@@ -61,10 +155,11 @@ func getConfigData() ([]byte, error) {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	decryptedConfig, err := crypto.Decrypt(data)
+	decryptedConfig, backend, passphrase, err := decryptConfig(data)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decrypt user's config file: %w", err)
 	}
+	setConfigKey(backend, passphrase)
 	return decryptedConfig, nil
 
 }
@@ -88,7 +183,47 @@ func getChunkSize(fileSize int64) int64 {
 	}
 }
 
-func verifyFileIntegrity(filePath string, fileID string, client *azure.AzureClient, httpClient *http.Client) {
+// uploadBackoff builds the retry policy for upload related requests from the
+// upload flags, starting at the given base delay.
+func uploadBackoff(base time.Duration) azure.Backoff {
+	return azure.Backoff{
+		Base:       base,
+		Cap:        retryMaxDelay,
+		Multiplier: retryFactor,
+	}
+}
+
+// indexURL returns the download URL of a file on the remote's index, given
+// its path relative to the remote's root folder. Every segment of the path is
+// escaped, so names with #, ?, % or + don't end up as fragments, queries or
+// other files.
+func indexURL(client *azure.AzureClient, remoteFilePath string) string {
+	urlPath := strings.Trim(strings.ReplaceAll(remoteFilePath, "\\", "/"), "/")
+	return fmt.Sprintf("%s/%s", strings.TrimRight(client.RemoteBaseUrl, "/"), azure.EscapePath(urlPath))
+}
+
+// printErrorHint prints a suggestion for well-known Graph error kinds.
+func printErrorHint(err error) {
+	switch {
+	case errors.Is(err, azure.ErrQuotaExceeded):
+		fmt.Printf("%sHint: the remote is out of space, pick another one with --remote-config%s\n", ColorYellow, ColorReset)
+	case errors.Is(err, azure.ErrAccessDenied):
+		fmt.Printf("%sHint: access was denied, try running 'ksau-go refresh'%s\n", ColorYellow, ColorReset)
+	case errors.Is(err, azure.ErrReadOnly):
+		fmt.Printf("%sHint: nothing was changed because of --dry-run%s\n", ColorYellow, ColorReset)
+	case errors.Is(err, azure.ErrThrottled):
+		fmt.Printf("%sHint: the remote is throttling requests, try again later%s\n", ColorYellow, ColorReset)
+	case errors.Is(err, azure.ErrPanic):
+		var panicErr *azure.PanicError
+		if verbose && errors.As(err, &panicErr) {
+			fmt.Fprintf(os.Stderr, "%s\n", panicErr.Stack)
+		} else {
+			fmt.Printf("%sHint: this is a bug, please report it with the output of --verbose%s\n", ColorYellow, ColorReset)
+		}
+	}
+}
+
+func verifyFileIntegrity(result *uploadResult, httpClient *http.Client) string {
 	fmt.Println("Verifying file integrity...")
 
 	var fileHash string
@@ -96,122 +231,111 @@ func verifyFileIntegrity(filePath string, fileID string, client *azure.AzureClie
 
 	// Retry getting the file hash
 	for i := 0; i < hashRetries; i++ {
-		fileHash, err = client.GetQuickXorHash(httpClient, fileID)
+		fileHash, err = result.client.GetQuickXorHash(httpClient, result.fileID)
 		if err == nil {
 			break
 		}
 		fmt.Printf("Attempt %d/%d: Failed to get file hash: %v\n", i+1, hashRetries, err)
 		if i < hashRetries-1 {
-			time.Sleep(hashRetryDelay)
+			uploadBackoff(hashRetryDelay).Sleep(i)
 		}
 	}
 
 	if err != nil {
 		fmt.Printf("%sWarning: Could not verify file integrity: %v%s\n", ColorYellow, err, ColorReset)
-		return
+		return hashUnverified
 	}
 
 	// Calculate local file hash
-	file, err := os.Open(filePath)
+	localHash, err := result.contentHash()
 	if err != nil {
-		fmt.Printf("%sWarning: Could not open local file for verification: %v%s\n", ColorYellow, err, ColorReset)
-		return
-	}
-	defer file.Close()
-
-	// Create new quickXorHash instance
-	hasher := crypto.New()
-
-	// Copy the file content into the hash
-	if _, err := io.Copy(hasher, file); err != nil {
 		fmt.Printf("%sWarning: Could not calculate file hash: %v%s\n", ColorYellow, err, ColorReset)
-		return
+		return hashUnverified
 	}
 
-	// Get the hash as a Base64-encoded string
-	hashBytes := hasher.Sum(nil)
-	localHash := base64.StdEncoding.EncodeToString(hashBytes)
-
 	// fmt.Printf("Local file hash: %s\n", localHash)
 	// fmt.Printf("Remote file hash: %s\n", fileHash)
 
-	if localHash == fileHash {
-		fmt.Printf("%sFile integrity verified successfully%s\n", ColorGreen, ColorReset)
-	} else {
+	if localHash != fileHash {
 		fmt.Printf("%sWarning: File integrity check failed - hashes do not match%s\n", ColorRed, ColorReset)
+		return hashMismatch
 	}
+	fmt.Printf("%sFile integrity verified successfully%s\n", ColorGreen, ColorReset)
+	return hashVerified
 }
 
-func selectRemoteAutomatically(fileSize int64, progressStyle string) (string, error) {
-	var selectedRemote string
-	rcloneConfigData, err := getConfigData()
+// localQuickXorHash returns the Base64 encoded QuickXorHash of a local file,
+// in the same form Graph reports it.
+func localQuickXorHash(filePath string) (string, error) {
+	file, err := os.Open(filePath)
 	if err != nil {
-		return "", fmt.Errorf("failed to select random remote: %w", err)
+		return "", err
 	}
+	defer file.Close()
 
-	parsedRcloneConfigData, err := azure.ParseRcloneConfigData(rcloneConfigData)
-	if err != nil {
-		return "", fmt.Errorf("failed to select random remote: %w", err)
+	hasher := crypto.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
 	}
+	return base64.StdEncoding.EncodeToString(hasher.Sum(nil)), nil
+}
 
-	availRemotes := azure.GetAvailableRemotes(&parsedRcloneConfigData)
-
-	// // if fileSize is < 1GiB, we choose a random remote
-	// if fileSize/1024/1024/1024 < 1 {
-	// 	selectedRemote = availRemotes[rand.Intn(len(availRemotes))]
-	// 	fmt.Println("Using randomly selected remote:", selectedRemote)
-	// 	return selectedRemote, nil
-	// }
-
-	// otherwise we use the one that is free the most
-	remoteAndSpace := make(map[string]float64, len(availRemotes))
-	var wg = new(sync.WaitGroup)
-	var httpClient *http.Client = &http.Client{Timeout: 10 * time.Second}
-	fmt.Print("Checking free spaces for each remote...")
-
-	var progressTracker *progress.ProgressTracker = progress.NewProgressTracker(int64(len(availRemotes)), progress.ProgressStyle(progressStyle))
-	var done int = 0
-	var mu sync.Mutex
-
-	for _, remote := range availRemotes {
-		wg.Add(1)
-		go func(r string) {
-			defer wg.Done()
-			client, err := azure.NewAzureClientFromRcloneConfigData(rcloneConfigData, r)
-			if err != nil {
-				return // ignore that remote
-			}
-
-			remoteQuota, err := client.GetDriveQuota(httpClient)
-			if err != nil {
-				return // ignore that remote
-			}
+var (
+	uploadHashOnce sync.Once
+	uploadHash     string
+	uploadHashErr  error
+)
 
-			remoteAndSpace[r] = float64(remoteQuota.Remaining) // in bytes
+// uploadedFileHash returns the QuickXorHash of the file being uploaded,
+// computing it only once for the manifest, the receipt and other users.
+func uploadedFileHash() (string, error) {
+	uploadHashOnce.Do(func() {
+		uploadHash, uploadHashErr = localQuickXorHash(filePath)
+	})
+	return uploadHash, uploadHashErr
+}
 
-			mu.Lock()
-			defer mu.Unlock()
-			done++
-			progressTracker.UpdateProgress(int64(done))
-		}(remote)
+// openHistory returns the local upload history store.
+func openHistory() (*history.Store, error) {
+	historyPath, err := getStatePath("history.jsonl")
+	if err != nil {
+		return nil, err
 	}
+	return history.Open(historyPath), nil
+}
 
-	wg.Wait()
-	fmt.Print("\033[2K\r")
+// recordTransfer adds an upload attempt to the local history. Failures to
+// record are only warned about, they must never fail the upload itself.
+func recordTransfer(entry history.Entry) {
+	entry.Time = time.Now()
+	store, err := openHistory()
+	if err == nil {
+		err = store.Append(entry)
+	}
+	if err != nil {
+		fmt.Printf("%sWarning: cannot record upload history: %v%s\n", ColorYellow, err, ColorReset)
+	}
+}
 
-	if len(remoteAndSpace) == 0 {
-		return "", fmt.Errorf("cannot get remote with the most free space: all remote were not available")
+// parseAge parses a duration like time.ParseDuration does, additionally
+// accepting day ("7d") and week ("2w") units.
+func parseAge(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
 	}
 
-	maxSpace := 0.0
-	selectedRemote = availRemotes[0] // default to first remote
-	for remote, space := range remoteAndSpace {
-		if space > maxSpace {
-			maxSpace = space
-			selectedRemote = remote
+	unit := value[len(value)-1]
+	if unit == 'd' || unit == 'w' {
+		count, err := strconv.ParseFloat(value[:len(value)-1], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration: %s", value)
+		}
+		day := 24 * time.Hour
+		if unit == 'w' {
+			day *= 7
 		}
+		return time.Duration(count * float64(day)), nil
 	}
 
-	fmt.Println("Using remote with the most free space:", selectedRemote)
-	return selectedRemote, nil
+	return time.ParseDuration(value)
 }
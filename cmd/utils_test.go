@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/global-index-source/ksau-go/azure"
+)
+
+func TestIndexURL(t *testing.T) {
+	tests := []struct {
+		baseURL string
+		path    string
+		want    string
+	}{
+		{"https://index.example.com", "/Builds/rom.zip", "https://index.example.com/Builds/rom.zip"},
+		{"https://index.example.com/", "Builds/rom.zip", "https://index.example.com/Builds/rom.zip"},
+		{"https://index.example.com/0:", "/Builds/rom.zip", "https://index.example.com/0:/Builds/rom.zip"},
+		{"https://index.example.com", "/Music/#1 hits.mp3", "https://index.example.com/Music/%231%20hits.mp3"},
+		{"https://index.example.com", "/Docs/what?.txt", "https://index.example.com/Docs/what%3F.txt"},
+		{"https://index.example.com", "/Docs/100%.txt", "https://index.example.com/Docs/100%25.txt"},
+		{"https://index.example.com", "/Docs/100%20.txt", "https://index.example.com/Docs/100%2520.txt"},
+		{"https://index.example.com", "/Music/AC+DC/Back in Black.flac", "https://index.example.com/Music/AC%2BDC/Back%20in%20Black.flac"},
+		{"https://index.example.com", `\Builds\Windows\setup.exe`, "https://index.example.com/Builds/Windows/setup.exe"},
+		{"https://index.example.com", "/日本語/ファイル.zip", "https://index.example.com/%E6%97%A5%E6%9C%AC%E8%AA%9E/%E3%83%95%E3%82%A1%E3%82%A4%E3%83%AB.zip"},
+		{"https://index.example.com", "/Docs/caf\u00e9.txt", "https://index.example.com/Docs/caf%C3%A9.txt"},
+		{"https://index.example.com", "/Docs/cafe\u0301.txt", "https://index.example.com/Docs/cafe%CC%81.txt"},
+		{"https://index.example.com", "/Docs/a&b=c.txt", "https://index.example.com/Docs/a&b=c.txt"},
+	}
+	for _, tc := range tests {
+		client := &azure.AzureClient{RemoteBaseUrl: tc.baseURL}
+		if got := indexURL(client, tc.path); got != tc.want {
+			t.Errorf("indexURL(%q, %q) = %q, want %q", tc.baseURL, tc.path, got, tc.want)
+		}
+	}
+}
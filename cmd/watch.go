@@ -0,0 +1,328 @@
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/global-index-source/ksau-go/azure"
+	"github.com/global-index-source/ksau-go/cmd/naming"
+	"github.com/spf13/cobra"
+)
+
+var (
+	watchFolder   string
+	watchDebounce time.Duration
+	watchExisting bool
+	watchRetries  int
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch <dir>",
+	Short: "Upload files as they appear in a directory",
+	Long: `Watch a local directory and its subdirectories and upload every new or
+modified file into the remote folder, keeping its path below the directory.
+A file is uploaded once it wasn't written to for --debounce, so files still
+being copied in aren't uploaded half done. Up to --transfers files are
+uploaded at the same time. Files matching the .ksauignore files of the
+directory or --exclude are skipped. Hidden and temporary files
+(.part, .tmp, .swp, ~) are ignored. With --name-strategy, files are renamed
+like with upload, keeping their folder. Runs until interrupted.`,
+	Args: cobra.ExactArgs(1),
+	Run:  runWatch,
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+
+	watchCmd.Flags().StringVarP(&watchFolder, "remote", "r", "", "Remote folder to upload into (required)")
+	watchCmd.Flags().DurationVar(&watchDebounce, "debounce", 2*time.Second, "Upload a file once it wasn't written to for this long")
+	watchCmd.Flags().BoolVar(&watchExisting, "existing", false, "Also upload the files already in the directory at start")
+	watchCmd.Flags().IntVar(&watchRetries, "retries", 3, "Maximum number of retries for uploading chunks")
+	watchCmd.Flags().IntVar(&transfers, "transfers", defaultTransfers, "Number of files uploaded at the same time")
+	watchCmd.Flags().StringVar(&nameStrategy, "name-strategy", string(naming.StrategyKeep), "How to name the remote files: keep, random, hash, uuid or datetime")
+	watchCmd.Flags().StringVar(&uploaderNick, "nick", "", "Uploader name recorded in the receipts log of shared remotes (default: your user name)")
+	watchCmd.Flags().BoolVar(&noReceipt, "no-receipt", false, "Don't append to the remote's receipts log")
+	addFilterFlags(watchCmd)
+	watchCmd.MarkFlagRequired("remote")
+}
+
+// watcher uploads the files of a directory once they settled.
+type watcher struct {
+	dir        string
+	remote     string
+	client     *azure.AzureClient
+	httpClient *http.Client
+	fsWatcher  *fsnotify.Watcher
+	filter     *fileFilter
+
+	mutex     sync.Mutex
+	pending   map[string]*time.Timer // debounce timers by local path
+	uploading map[string]bool        // local paths being uploaded
+	uploads   chan string
+}
+
+func runWatch(cmd *cobra.Command, args []string) {
+	remoteConfig, _ := cmd.Flags().GetString("remote-config")
+	if remoteConfig == "" {
+		fmt.Println("please select a remote with --remote-config")
+		os.Exit(1)
+	}
+	if transfers < 1 {
+		fmt.Println("--transfers must be at least 1")
+		os.Exit(1)
+	}
+	if !naming.IsValid(naming.Strategy(nameStrategy)) {
+		fmt.Printf("Invalid name strategy: %s\nValid strategies are: keep, random, hash, uuid, datetime\n", nameStrategy)
+		os.Exit(1)
+	}
+	dir := filepath.Clean(args[0])
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		fmt.Printf("%s is not a directory\n", dir)
+		os.Exit(1)
+	}
+
+	filter, err := newFileFilter()
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	requireNetwork("")
+
+	configData, err := getConfigData()
+	if err != nil {
+		fmt.Println("failed to get configuration file data:", err.Error())
+		os.Exit(1)
+	}
+	client, err := azure.NewAzureClientFromRcloneConfigData(configData, remoteConfig)
+	if err != nil {
+		fmt.Println("failed to initialize client:", err.Error())
+		os.Exit(1)
+	}
+	client.Backoff = uploadBackoff(retryDelay)
+	client.MaxRetries = watchRetries
+
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		fmt.Println("failed to start watching:", err.Error())
+		os.Exit(1)
+	}
+	defer fsWatcher.Close()
+
+	w := &watcher{
+		dir:        dir,
+		remote:     remoteConfig,
+		client:     client,
+		httpClient: sharedHTTPClient(),
+		fsWatcher:  fsWatcher,
+		filter:     filter,
+		pending:    make(map[string]*time.Timer),
+		uploading:  make(map[string]bool),
+		uploads:    make(chan string, 64),
+	}
+	if err := w.addTree(dir, watchExisting); err != nil {
+		fmt.Println("failed to watch the directory:", err.Error())
+		os.Exit(1)
+	}
+	// Files are uploaded in the order they settled, --transfers at a time
+	for range transfers {
+		go w.uploadLoop()
+	}
+
+	fmt.Printf("Watching %s, uploading to %s on %s (Ctrl+C to stop)\n", dir, watchFolder, remoteConfig)
+	for {
+		select {
+		case event, ok := <-fsWatcher.Events:
+			if !ok {
+				return
+			}
+			w.handle(event)
+		case err, ok := <-fsWatcher.Errors:
+			if !ok {
+				return
+			}
+			fmt.Printf("%swatch error: %v%s\n", ColorYellow, err, ColorReset)
+			slog.Warn("watch error", "error", err)
+		}
+	}
+}
+
+// addTree watches dir and its subdirectories. With upload set, the files
+// already in them are queued as well, as are those of directories that
+// appear while watching, since they were created before the watch started.
+// The ignore files of the directories are read as they are added.
+func (w *watcher) addTree(dir string, upload bool) error {
+	return filepath.WalkDir(dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if skip, err := w.filter.visit(w.dir, filePath, entry); skip || err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if filePath != w.dir && ignoredWatchName(entry.Name()) {
+				return filepath.SkipDir
+			}
+			return w.fsWatcher.Add(filePath)
+		}
+		if upload && entry.Type().IsRegular() && !ignoredWatchName(entry.Name()) {
+			w.schedule(filePath)
+		}
+		return nil
+	})
+}
+
+// handle reacts to a change in a watched directory.
+func (w *watcher) handle(event fsnotify.Event) {
+	if ignoredWatchName(filepath.Base(event.Name)) {
+		return
+	}
+	if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+		return
+	}
+
+	info, err := os.Stat(event.Name)
+	if err != nil {
+		return
+	}
+	if info.IsDir() {
+		if event.Has(fsnotify.Create) {
+			if err := w.addTree(event.Name, true); err != nil {
+				fmt.Printf("%sfailed to watch %s: %v%s\n", ColorYellow, event.Name, err, ColorReset)
+			}
+		}
+		return
+	}
+	if info.Mode().IsRegular() && !w.skipped(event.Name) {
+		w.schedule(event.Name)
+	}
+}
+
+// skipped reports whether the filter skips a file of the watched directory.
+func (w *watcher) skipped(filePath string) bool {
+	relPath, err := filepath.Rel(w.dir, filePath)
+	if err != nil {
+		return false
+	}
+	return w.filter.excluded(filepath.ToSlash(relPath), false)
+}
+
+// schedule queues a file for upload once it wasn't written to for
+// --debounce, restarting the wait if it is still being written.
+func (w *watcher) schedule(filePath string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if timer, ok := w.pending[filePath]; ok {
+		timer.Reset(watchDebounce)
+		return
+	}
+	w.pending[filePath] = time.AfterFunc(watchDebounce, func() {
+		w.mutex.Lock()
+		delete(w.pending, filePath)
+		w.mutex.Unlock()
+		w.uploads <- filePath
+	})
+}
+
+func (w *watcher) uploadLoop() {
+	for filePath := range w.uploads {
+		if !w.claim(filePath) {
+			// Written again while its previous version is uploading, upload
+			// it once that is done rather than twice at the same time
+			w.schedule(filePath)
+			continue
+		}
+		link, err := w.upload(filePath)
+		w.release(filePath)
+		if err != nil {
+			fmt.Printf("%sfailed  %s: %s%s\n", ColorRed, filePath, err, ColorReset)
+			slog.Warn("watch upload failed", "file", filePath, "error", err)
+			printErrorHint(err)
+			continue
+		}
+		if link == "" {
+			continue
+		}
+		fmt.Printf("%suploaded%s %s %s\n", ColorGreen, ColorReset, filePath, link)
+		slog.Info("watch upload", "file", filePath, "link", link)
+	}
+}
+
+// claim marks a file as uploading, false if another worker already is.
+func (w *watcher) claim(filePath string) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.uploading[filePath] {
+		return false
+	}
+	w.uploading[filePath] = true
+	return true
+}
+
+func (w *watcher) release(filePath string) {
+	w.mutex.Lock()
+	delete(w.uploading, filePath)
+	w.mutex.Unlock()
+}
+
+// upload uploads a settled file to its place below the remote folder and
+// returns its link, or no link if the size and age filters skip it, an
+// identical file is already there or --dry-run only prints the upload.
+func (w *watcher) upload(filePath string) (string, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		// Deleted or renamed before it settled
+		return "", nil
+	}
+	if w.filter.outside(info.Size(), info.ModTime()) {
+		return "", nil
+	}
+	relPath, err := filepath.Rel(w.dir, filePath)
+	if err != nil {
+		return "", err
+	}
+
+	name, err := naming.Generate(naming.Strategy(nameStrategy), filepath.Base(filePath), filePath)
+	if err != nil {
+		return "", err
+	}
+	remoteFilePath := path.Join(watchFolder, path.Dir(filepath.ToSlash(relPath)), name)
+	if dryRun {
+		printDryRun("upload %s (%s) to %s:%s", filePath, azure.FormatBytes(info.Size()), w.remote, path.Join(w.client.RemoteRootFolder, remoteFilePath))
+		return "", nil
+	}
+
+	start := time.Now()
+	link, skipped, err := uploadLocalFile(w.client, w.httpClient, w.remote, filePath, remoteFilePath, watchRetries, nil)
+	if err != nil {
+		notifyUploadFailed(w.remote, name, filePath, info.Size(), err, time.Since(start))
+	}
+	if skipped {
+		return "", err
+	}
+	return link, err
+}
+
+// ignoredWatchName reports whether a file or directory is hidden or
+// temporary, e.g. written by an editor or a download in progress.
+func ignoredWatchName(name string) bool {
+	if strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~") {
+		return true
+	}
+	for _, suffix := range []string{".part", ".tmp", ".swp", ".crdownload"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
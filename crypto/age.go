@@ -0,0 +1,83 @@
+package crypto
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// ageHeader starts binary age files, armored ones start with armor.Header.
+const ageHeader = "age-encryption.org/v1"
+
+// ageBackend encrypts configs with age. age has no embedded key here, it is
+// only used with a passphrase, from which scrypt derives the file key.
+type ageBackend struct{}
+
+func (ageBackend) Name() string { return "age" }
+
+func (ageBackend) Detect(data []byte) bool {
+	text := strings.TrimSpace(string(data))
+	return strings.HasPrefix(text, armor.Header) || strings.HasPrefix(text, ageHeader)
+}
+
+func (ageBackend) NeedsPassphrase(data []byte) bool {
+	return true
+}
+
+func (ageBackend) Encrypt(plain []byte, passphrase []byte) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("the age backend needs a passphrase")
+	}
+
+	recipient, err := age.NewScryptRecipient(string(passphrase))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create age recipient: %w", err)
+	}
+
+	var encrypted bytes.Buffer
+	armorWriter := armor.NewWriter(&encrypted)
+	writer, err := age.Encrypt(armorWriter, recipient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create age encryptor: %w", err)
+	}
+	if _, err := writer.Write(plain); err != nil {
+		return nil, fmt.Errorf("failed to encrypt text: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encrypt text: %w", err)
+	}
+	if err := armorWriter.Close(); err != nil {
+		return nil, fmt.Errorf("failed to armor bytes: %w", err)
+	}
+	return encrypted.Bytes(), nil
+}
+
+func (ageBackend) Decrypt(data []byte, passphrase []byte) ([]byte, string, error) {
+	if passphrase == nil {
+		return nil, "", ErrPassphraseRequired
+	}
+
+	identity, err := age.NewScryptIdentity(string(passphrase))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create age identity: %w", err)
+	}
+
+	var src io.Reader = bytes.NewReader(data)
+	if strings.HasPrefix(strings.TrimSpace(string(data)), armor.Header) {
+		src = armor.NewReader(bytes.NewReader(bytes.TrimSpace(data)))
+	}
+
+	reader, err := age.Decrypt(src, identity)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decrypt data, wrong passphrase?: %w", err)
+	}
+	decrypted, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decrypt data: %w", err)
+	}
+	return decrypted, "", nil
+}
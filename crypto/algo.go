@@ -1,24 +1,108 @@
 package crypto
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
 
 	"github.com/ProtonMail/gopenpgp/v3/crypto"
+	"github.com/ProtonMail/gopenpgp/v3/profile"
 )
 
+// DefaultKeyID is the ID of the key embedded as privkey.pem.
+const DefaultKeyID = "default"
+
+// keyHeaderPrefix starts the armor Comment header naming the key a config was
+// encrypted with.
+const keyHeaderPrefix = "ksau-key: "
+
+// CurrentKey is the key new configs are encrypted with. Configs encrypted with
+// any other embedded key still decrypt, but are reported as deprecated so
+// maintainers can rotate the keypair without breaking older clients at once.
+// It can be changed at build time with
+// -ldflags "-X github.com/global-index-source/ksau-go/crypto.CurrentKey=<id>".
+var CurrentKey = DefaultKeyID
+
+// PassphraseKeyID is the key ID in the armor header of configs encrypted with
+// a user supplied passphrase instead of an embedded key.
+const PassphraseKeyID = "passphrase"
+
+// ErrPassphraseRequired is returned when decrypting a passphrase protected
+// config without a passphrase.
+var ErrPassphraseRequired = errors.New("config is protected by a passphrase")
+
 var pgp *crypto.PGPHandle = crypto.PGP()
 
-func getPrivateKey() *crypto.Key {
-	key, err := crypto.NewPrivateKeyFromArmored(privkey, []byte(passphrase))
+// passphrasePGP derives the key from a passphrase with Argon2 (RFC 9580),
+// rather than the iterated and salted S2K of older OpenPGP profiles.
+var passphrasePGP *crypto.PGPHandle = crypto.PGPWithProfile(profile.RFC9580())
+
+// KeyIDs returns the IDs of all embedded keys.
+func KeyIDs() []string {
+	names, _ := fs.Glob(keyFiles, "privkey*.pem")
+	ids := make([]string, 0, len(names))
+	for _, name := range names {
+		ids = append(ids, keyID(name))
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// IsDeprecatedKey reports whether id is an embedded key other than CurrentKey.
+func IsDeprecatedKey(id string) bool {
+	return id != CurrentKey
+}
+
+func keyID(fileName string) string {
+	id := strings.TrimSuffix(strings.TrimPrefix(fileName, "privkey"), ".pem")
+	if id == "" {
+		return DefaultKeyID
+	}
+	return strings.TrimPrefix(id, "-")
+}
+
+func keyFileNames(id string) (string, string) {
+	if id == DefaultKeyID {
+		return "privkey.pem", "passphrase.txt"
+	}
+	return "privkey-" + id + ".pem", "passphrase-" + id + ".txt"
+}
+
+func getPrivateKey(id string) (*crypto.Key, error) {
+	keyName, passphraseName := keyFileNames(id)
+	privkey, err := keyFiles.ReadFile(keyName)
+	if err != nil {
+		return nil, fmt.Errorf("unknown key %q", id)
+	}
+	passphrase, err := keyFiles.ReadFile(passphraseName)
 	if err != nil {
-		panic("Failed to create private key")
+		return nil, fmt.Errorf("missing passphrase for key %q", id)
 	}
 
-	return key
+	key, err := crypto.NewPrivateKeyFromArmored(string(privkey), passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create private key %q: %w", id, err)
+	}
+	return key, nil
 }
 
 func Encrypt(text string) ([]byte, error) {
-	encryptionHandler, err := pgp.Encryption().Recipient(getPrivateKey()).New()
+	return EncryptWithKey(text, CurrentKey)
+}
+
+// EncryptWithKey encrypts a config with the embedded key id, e.g. to rotate a
+// config to a key other than CurrentKey.
+func EncryptWithKey(text string, id string) ([]byte, error) {
+	key, err := getPrivateKey(id)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptionHandler, err := pgp.Encryption().Recipient(key).New()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create encryption handler: %w", err)
 	}
@@ -28,22 +112,159 @@ func Encrypt(text string) ([]byte, error) {
 		return nil, fmt.Errorf("failed to encrypt text: %w", err)
 	}
 
-	armorbytes, err := encrypted.ArmorBytes()
+	armored, err := encrypted.ArmorWithCustomHeaders(keyHeaderPrefix+id, "")
 	if err != nil {
 		return nil, fmt.Errorf("failed to armor bytes: %w", err)
 	}
-	return armorbytes, nil
+	return []byte(armored), nil
 }
 
 func Decrypt(data []byte) ([]byte, error) {
-	decryptionHandler, err := pgp.Decryption().DecryptionKey(getPrivateKey()).New()
+	decrypted, _, err := DecryptWithKey(data)
+	return decrypted, err
+}
+
+// DecryptWithKey decrypts an armored config and also returns the ID of the key
+// that decrypted it. The key named in the armor header is tried first; configs
+// without the header (made before key rotation existed) are tried against
+// every embedded key.
+func DecryptWithKey(data []byte) ([]byte, string, error) {
+	ids := KeyIDs()
+	headerID := armorKeyID(data)
+	if headerID == PassphraseKeyID {
+		return nil, "", ErrPassphraseRequired
+	}
+	if headerID != "" {
+		known := false
+		for i, id := range ids {
+			if id == headerID {
+				ids[0], ids[i] = ids[i], ids[0]
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, "", fmt.Errorf("config was encrypted with key %q which this build doesn't know, please update ksau-go", headerID)
+		}
+	}
+
+	var lastErr error
+	for _, id := range ids {
+		key, err := getPrivateKey(id)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		decryptionHandler, err := pgp.Decryption().DecryptionKey(key).New()
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to create decryption handler: %w", err)
+		}
+
+		decrypted, err := decryptionHandler.Decrypt(data, crypto.Armor)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return decrypted.Bytes(), id, nil
+	}
+	return nil, "", fmt.Errorf("failed to decrypt data: %w", lastErr)
+}
+
+// IsPassphraseProtected reports whether data was encrypted with
+// EncryptWithPassphrase.
+func IsPassphraseProtected(data []byte) bool {
+	return armorKeyID(data) == PassphraseKeyID
+}
+
+// EncryptWithPassphrase encrypts a config with a user supplied passphrase, so
+// it doesn't depend on the embedded keys. The encryption key is derived from
+// the passphrase with Argon2.
+func EncryptWithPassphrase(text string, passphrase []byte) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("empty passphrase")
+	}
+
+	encryptionHandler, err := passphrasePGP.Encryption().Password(passphrase).New()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create encryption handler: %w", err)
+	}
+
+	encrypted, err := encryptionHandler.Encrypt([]byte(text))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt text: %w", err)
+	}
+
+	armored, err := encrypted.ArmorWithCustomHeaders(keyHeaderPrefix+PassphraseKeyID, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to armor bytes: %w", err)
+	}
+	return []byte(armored), nil
+}
+
+// DecryptWithPassphrase decrypts a config encrypted with EncryptWithPassphrase.
+func DecryptWithPassphrase(data []byte, passphrase []byte) ([]byte, error) {
+	decryptionHandler, err := passphrasePGP.Decryption().Password(passphrase).New()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create decryption handler: %w", err)
 	}
 
 	decrypted, err := decryptionHandler.Decrypt(data, crypto.Armor)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt data: %w", err)
+		return nil, fmt.Errorf("failed to decrypt data, wrong passphrase?: %w", err)
 	}
 	return decrypted.Bytes(), nil
 }
+
+// armorKeyID returns the key ID from the armor Comment header of data, or an
+// empty string if there is none.
+func armorKeyID(data []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	inHeader := false
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "-----BEGIN "):
+			inHeader = true
+		case !inHeader:
+			continue
+		case line == "":
+			return ""
+		case strings.HasPrefix(line, "Comment: "+keyHeaderPrefix):
+			return strings.TrimSpace(strings.TrimPrefix(line, "Comment: "+keyHeaderPrefix))
+		}
+	}
+	return ""
+}
+
+// SignDetached creates an armored detached PGP signature of data with the
+// given armored private key, e.g. a maintainer's key for signing upload
+// manifests. passphrase may be empty for unprotected keys.
+func SignDetached(data []byte, armoredKey string, passphrase []byte) ([]byte, error) {
+	return signDetached(data, armoredKey, passphrase, crypto.Armor)
+}
+
+// SignDetachedBinary is like SignDetached, but returns the unarmored
+// signature, e.g. to embed it base64 encoded in a single log line.
+func SignDetachedBinary(data []byte, armoredKey string, passphrase []byte) ([]byte, error) {
+	return signDetached(data, armoredKey, passphrase, crypto.Bytes)
+}
+
+func signDetached(data []byte, armoredKey string, passphrase []byte, encoding int8) ([]byte, error) {
+	key, err := crypto.NewPrivateKeyFromArmored(armoredKey, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+	defer key.ClearPrivateParams()
+
+	signer, err := pgp.Sign().SigningKey(key).Detached().New()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create signing handler: %w", err)
+	}
+
+	signature, err := signer.Sign(data, encoding)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign data: %w", err)
+	}
+	return signature, nil
+}
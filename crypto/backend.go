@@ -0,0 +1,88 @@
+package crypto
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Backend is an encryption format for configs. The format of an existing
+// config is detected from its header, so backends can be mixed freely.
+type Backend interface {
+	// Name identifies the backend, e.g. "pgp" or "age".
+	Name() string
+	// Detect reports whether data is in this backend's format.
+	Detect(data []byte) bool
+	// NeedsPassphrase reports whether data can only be decrypted with a
+	// user supplied passphrase.
+	NeedsPassphrase(data []byte) bool
+	// Encrypt encrypts plain with passphrase, or with the backend's embedded
+	// key if passphrase is nil.
+	Encrypt(plain []byte, passphrase []byte) ([]byte, error)
+	// Decrypt decrypts data and returns the ID of the embedded key that
+	// decrypted it, empty if a passphrase was used.
+	Decrypt(data []byte, passphrase []byte) ([]byte, string, error)
+}
+
+// backends are the available backends, the first one is the default.
+var backends = []Backend{pgpBackend{}, ageBackend{}}
+
+// BackendNames returns the names of all backends.
+func BackendNames() []string {
+	names := make([]string, len(backends))
+	for i, backend := range backends {
+		names[i] = backend.Name()
+	}
+	return names
+}
+
+// BackendByName returns the backend with the given name.
+func BackendByName(name string) (Backend, error) {
+	for _, backend := range backends {
+		if backend.Name() == name {
+			return backend, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown encryption backend %q, must be one of: %s", name, strings.Join(BackendNames(), ", "))
+}
+
+// DetectBackend returns the backend data was encrypted with, falling back to
+// the default backend for data no backend recognizes.
+func DetectBackend(data []byte) Backend {
+	for _, backend := range backends {
+		if backend.Detect(data) {
+			return backend
+		}
+	}
+	return backends[0]
+}
+
+// pgpBackend is the armored OpenPGP format of Encrypt and EncryptWithPassphrase.
+type pgpBackend struct{}
+
+func (pgpBackend) Name() string { return "pgp" }
+
+func (pgpBackend) Detect(data []byte) bool {
+	return strings.HasPrefix(strings.TrimSpace(string(data)), "-----BEGIN PGP MESSAGE-----")
+}
+
+func (pgpBackend) NeedsPassphrase(data []byte) bool {
+	return IsPassphraseProtected(data)
+}
+
+func (pgpBackend) Encrypt(plain []byte, passphrase []byte) ([]byte, error) {
+	if passphrase != nil {
+		return EncryptWithPassphrase(string(plain), passphrase)
+	}
+	return Encrypt(string(plain))
+}
+
+func (pgpBackend) Decrypt(data []byte, passphrase []byte) ([]byte, string, error) {
+	if IsPassphraseProtected(data) {
+		if passphrase == nil {
+			return nil, "", ErrPassphraseRequired
+		}
+		decrypted, err := DecryptWithPassphrase(data, passphrase)
+		return decrypted, "", err
+	}
+	return DecryptWithKey(data)
+}
@@ -1,9 +1,10 @@
 package crypto
 
-import _ "embed"
+import "embed"
 
-//go:embed passphrase.txt
-var passphrase string
-
-//go:embed privkey.pem
-var privkey string
+// keyFiles holds the embedded keypairs. privkey.pem and passphrase.txt are the
+// "default" key, further keys are shipped as privkey-<id>.pem together with
+// passphrase-<id>.txt.
+//
+//go:embed privkey*.pem passphrase*.txt
+var keyFiles embed.FS
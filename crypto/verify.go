@@ -0,0 +1,69 @@
+package crypto
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"aead.dev/minisign"
+	"github.com/ProtonMail/gopenpgp/v3/crypto"
+)
+
+// Signature formats VerifyDetached accepts, told apart by the public key.
+const (
+	SignatureFormatPGP      = "pgp"
+	SignatureFormatMinisign = "minisign"
+)
+
+// SignatureFormat returns the format of signatures made with publicKey: PGP
+// for an armored PGP public key, minisign otherwise.
+func SignatureFormat(publicKey string) string {
+	if strings.Contains(publicKey, "-----BEGIN PGP PUBLIC KEY BLOCK-----") {
+		return SignatureFormatPGP
+	}
+	return SignatureFormatMinisign
+}
+
+// VerifyDetached checks a detached signature over data against a trusted
+// public key, e.g. the signature published next to the community config.
+// publicKey is either an armored PGP public key, with an armored or binary
+// signature, or a minisign public key (with or without its comment line).
+func VerifyDetached(data []byte, signature []byte, publicKey string) error {
+	if SignatureFormat(publicKey) == SignatureFormatPGP {
+		return verifyPGP(data, signature, publicKey)
+	}
+
+	var key minisign.PublicKey
+	if err := key.UnmarshalText([]byte(strings.TrimSpace(publicKey))); err != nil {
+		return fmt.Errorf("invalid minisign public key: %w", err)
+	}
+	if !minisign.Verify(key, data, signature) {
+		return fmt.Errorf("minisign signature doesn't match the data or key")
+	}
+	return nil
+}
+
+func verifyPGP(data []byte, signature []byte, publicKey string) error {
+	key, err := crypto.NewKeyFromArmored(publicKey)
+	if err != nil {
+		return fmt.Errorf("invalid PGP public key: %w", err)
+	}
+
+	verifier, err := pgp.Verify().VerificationKey(key).New()
+	if err != nil {
+		return fmt.Errorf("failed to create verification handler: %w", err)
+	}
+
+	encoding := crypto.Bytes
+	if bytes.Contains(signature, []byte("-----BEGIN PGP SIGNATURE-----")) {
+		encoding = crypto.Armor
+	}
+	result, err := verifier.VerifyDetached(data, signature, encoding)
+	if err != nil {
+		return fmt.Errorf("failed to read PGP signature: %w", err)
+	}
+	if err := result.SignatureError(); err != nil {
+		return fmt.Errorf("PGP signature doesn't match the data or key: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+// Package redact removes secrets and personal data from text before it is
+// printed, logged or bundled for a bug report, so users can safely share
+// ksau-go output in the public issue tracker.
+//
+// It knows about the secrets ksau-go handles: OAuth access and refresh tokens,
+// client secrets, pre-authenticated upload and download URLs, sharing links,
+// Telegram bot tokens and the e-mail addresses of drive owners.
+package redact
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Placeholder replaces every redacted value.
+const Placeholder = "[REDACTED]"
+
+// rule is a single redaction: every match of pattern is replaced with replacement.
+type rule struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+var rules = []rule{
+	// Authorization headers
+	{regexp.MustCompile(`(?i)\b(bearer)\s+[A-Za-z0-9\-._~+/]+=*`), "$1 " + Placeholder},
+	// JSON encoded secrets, e.g. the token blob of an rclone config
+	{regexp.MustCompile(`(?i)("(?:access_token|refresh_token|id_token|client_secret|password)"\s*:\s*)"[^"]*"`), `$1"` + Placeholder + `"`},
+	// rclone config lines
+	{regexp.MustCompile(`(?im)^(\s*(?:client_secret|token|telegram_bot_token|password)\s*=\s*).+$`), "$1" + Placeholder},
+	// Form and query parameters, including pre-authenticated upload session URLs
+	{regexp.MustCompile(`(?i)\b(access_token|refresh_token|client_secret|tempauth|code|sig|token|e)=[^&\s"']+`), "$1=" + Placeholder},
+	// Sharing links, whose path is the secret
+	{regexp.MustCompile(`(?i)(https?://1drv\.ms/)[^\s"']+`), "$1" + Placeholder},
+	{regexp.MustCompile(`(?i)(https?://[^\s/"']+\.sharepoint\.com/:[a-z]:/)[^\s"']+`), "$1" + Placeholder},
+	// Telegram bot tokens in Bot API URLs
+	{regexp.MustCompile(`(/bot)\d+:[A-Za-z0-9_-]+`), "$1" + Placeholder},
+	// Bare JWTs, which is what Graph access tokens usually are
+	{regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`), Placeholder},
+}
+
+// emailPattern matches e-mail addresses, which are replaced with "[EMAIL]".
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+// imageDensityPattern matches the pixel density suffix of image names like
+// icon@2x.png, which look like e-mail addresses but are kept.
+var imageDensityPattern = regexp.MustCompile(`@\d+(\.\d+)?x\.[A-Za-z0-9]+$`)
+
+// sensitiveHeaders are redacted entirely by Header.
+var sensitiveHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "Proxy-Authorization"}
+
+// String returns s with all known secrets and personal data replaced.
+func String(s string) string {
+	for _, r := range rules {
+		s = r.pattern.ReplaceAllString(s, r.replacement)
+	}
+	return emailPattern.ReplaceAllStringFunc(s, func(match string) string {
+		if imageDensityPattern.MatchString(match) {
+			return match
+		}
+		return "[EMAIL]"
+	})
+}
+
+// Error returns the redacted message of err, or an empty string for nil.
+func Error(err error) string {
+	if err == nil {
+		return ""
+	}
+	return String(err.Error())
+}
+
+// Header returns a redacted copy of the HTTP headers h.
+func Header(h http.Header) http.Header {
+	redacted := make(http.Header, len(h))
+	for name, values := range h {
+		for _, value := range values {
+			if isSensitiveHeader(name) {
+				value = Placeholder
+			} else {
+				value = String(value)
+			}
+			redacted.Add(name, value)
+		}
+	}
+	return redacted
+}
+
+func isSensitiveHeader(name string) bool {
+	for _, sensitive := range sensitiveHeaders {
+		if strings.EqualFold(name, sensitive) {
+			return true
+		}
+	}
+	return false
+}
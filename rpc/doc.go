@@ -0,0 +1,6 @@
+// Package rpc holds the gRPC service of the ksau-go daemon, generated from
+// ksau.proto. Clients in other languages can generate their stubs from the
+// same file.
+package rpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative ksau.proto
@@ -0,0 +1,497 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.2
+// source: ksau.proto
+
+package rpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Ksau_SubmitJob_FullMethodName   = "/ksau.v1.Ksau/SubmitJob"
+	Ksau_Upload_FullMethodName      = "/ksau.v1.Ksau/Upload"
+	Ksau_WatchJob_FullMethodName    = "/ksau.v1.Ksau/WatchJob"
+	Ksau_GetJob_FullMethodName      = "/ksau.v1.Ksau/GetJob"
+	Ksau_ListJobs_FullMethodName    = "/ksau.v1.Ksau/ListJobs"
+	Ksau_CancelJob_FullMethodName   = "/ksau.v1.Ksau/CancelJob"
+	Ksau_RetryJob_FullMethodName    = "/ksau.v1.Ksau/RetryJob"
+	Ksau_ListRemotes_FullMethodName = "/ksau.v1.Ksau/ListRemotes"
+	Ksau_GetQuota_FullMethodName    = "/ksau.v1.Ksau/GetQuota"
+	Ksau_ListFolder_FullMethodName  = "/ksau.v1.Ksau/ListFolder"
+)
+
+// KsauClient is the client API for Ksau service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Ksau controls the upload daemon of ksau-go (ksau-go serve --grpc-listen).
+// If KSAU_SERVE_TOKEN is set, calls must send it as the "authorization"
+// metadata "Bearer <token>".
+type KsauClient interface {
+	// Queues an upload of a file on the daemon's machine.
+	SubmitJob(ctx context.Context, in *SubmitJobRequest, opts ...grpc.CallOption) (*Job, error)
+	// Queues an upload and streams its job whenever it changes, until it is
+	// done, failed for good or canceled.
+	Upload(ctx context.Context, in *SubmitJobRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Job], error)
+	// Streams a job whenever it changes, until it is done, failed for good or
+	// canceled.
+	WatchJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Job], error)
+	GetJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error)
+	ListJobs(ctx context.Context, in *ListJobsRequest, opts ...grpc.CallOption) (*ListJobsResponse, error)
+	// Cancels a queued job or stops the upload of a running one.
+	CancelJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error)
+	// Queues a failed or canceled job again.
+	RetryJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error)
+	ListRemotes(ctx context.Context, in *ListRemotesRequest, opts ...grpc.CallOption) (*ListRemotesResponse, error)
+	GetQuota(ctx context.Context, in *GetQuotaRequest, opts ...grpc.CallOption) (*Quota, error)
+	// Streams the items of a remote folder as their pages arrive.
+	ListFolder(ctx context.Context, in *ListFolderRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Item], error)
+}
+
+type ksauClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewKsauClient(cc grpc.ClientConnInterface) KsauClient {
+	return &ksauClient{cc}
+}
+
+func (c *ksauClient) SubmitJob(ctx context.Context, in *SubmitJobRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, Ksau_SubmitJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ksauClient) Upload(ctx context.Context, in *SubmitJobRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Job], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Ksau_ServiceDesc.Streams[0], Ksau_Upload_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SubmitJobRequest, Job]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Ksau_UploadClient = grpc.ServerStreamingClient[Job]
+
+func (c *ksauClient) WatchJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Job], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Ksau_ServiceDesc.Streams[1], Ksau_WatchJob_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[GetJobRequest, Job]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Ksau_WatchJobClient = grpc.ServerStreamingClient[Job]
+
+func (c *ksauClient) GetJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, Ksau_GetJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ksauClient) ListJobs(ctx context.Context, in *ListJobsRequest, opts ...grpc.CallOption) (*ListJobsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListJobsResponse)
+	err := c.cc.Invoke(ctx, Ksau_ListJobs_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ksauClient) CancelJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, Ksau_CancelJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ksauClient) RetryJob(ctx context.Context, in *GetJobRequest, opts ...grpc.CallOption) (*Job, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Job)
+	err := c.cc.Invoke(ctx, Ksau_RetryJob_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ksauClient) ListRemotes(ctx context.Context, in *ListRemotesRequest, opts ...grpc.CallOption) (*ListRemotesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListRemotesResponse)
+	err := c.cc.Invoke(ctx, Ksau_ListRemotes_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ksauClient) GetQuota(ctx context.Context, in *GetQuotaRequest, opts ...grpc.CallOption) (*Quota, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Quota)
+	err := c.cc.Invoke(ctx, Ksau_GetQuota_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ksauClient) ListFolder(ctx context.Context, in *ListFolderRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Item], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Ksau_ServiceDesc.Streams[2], Ksau_ListFolder_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ListFolderRequest, Item]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Ksau_ListFolderClient = grpc.ServerStreamingClient[Item]
+
+// KsauServer is the server API for Ksau service.
+// All implementations must embed UnimplementedKsauServer
+// for forward compatibility.
+//
+// Ksau controls the upload daemon of ksau-go (ksau-go serve --grpc-listen).
+// If KSAU_SERVE_TOKEN is set, calls must send it as the "authorization"
+// metadata "Bearer <token>".
+type KsauServer interface {
+	// Queues an upload of a file on the daemon's machine.
+	SubmitJob(context.Context, *SubmitJobRequest) (*Job, error)
+	// Queues an upload and streams its job whenever it changes, until it is
+	// done, failed for good or canceled.
+	Upload(*SubmitJobRequest, grpc.ServerStreamingServer[Job]) error
+	// Streams a job whenever it changes, until it is done, failed for good or
+	// canceled.
+	WatchJob(*GetJobRequest, grpc.ServerStreamingServer[Job]) error
+	GetJob(context.Context, *GetJobRequest) (*Job, error)
+	ListJobs(context.Context, *ListJobsRequest) (*ListJobsResponse, error)
+	// Cancels a queued job or stops the upload of a running one.
+	CancelJob(context.Context, *GetJobRequest) (*Job, error)
+	// Queues a failed or canceled job again.
+	RetryJob(context.Context, *GetJobRequest) (*Job, error)
+	ListRemotes(context.Context, *ListRemotesRequest) (*ListRemotesResponse, error)
+	GetQuota(context.Context, *GetQuotaRequest) (*Quota, error)
+	// Streams the items of a remote folder as their pages arrive.
+	ListFolder(*ListFolderRequest, grpc.ServerStreamingServer[Item]) error
+	mustEmbedUnimplementedKsauServer()
+}
+
+// UnimplementedKsauServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedKsauServer struct{}
+
+func (UnimplementedKsauServer) SubmitJob(context.Context, *SubmitJobRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SubmitJob not implemented")
+}
+func (UnimplementedKsauServer) Upload(*SubmitJobRequest, grpc.ServerStreamingServer[Job]) error {
+	return status.Errorf(codes.Unimplemented, "method Upload not implemented")
+}
+func (UnimplementedKsauServer) WatchJob(*GetJobRequest, grpc.ServerStreamingServer[Job]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchJob not implemented")
+}
+func (UnimplementedKsauServer) GetJob(context.Context, *GetJobRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetJob not implemented")
+}
+func (UnimplementedKsauServer) ListJobs(context.Context, *ListJobsRequest) (*ListJobsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListJobs not implemented")
+}
+func (UnimplementedKsauServer) CancelJob(context.Context, *GetJobRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CancelJob not implemented")
+}
+func (UnimplementedKsauServer) RetryJob(context.Context, *GetJobRequest) (*Job, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RetryJob not implemented")
+}
+func (UnimplementedKsauServer) ListRemotes(context.Context, *ListRemotesRequest) (*ListRemotesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListRemotes not implemented")
+}
+func (UnimplementedKsauServer) GetQuota(context.Context, *GetQuotaRequest) (*Quota, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetQuota not implemented")
+}
+func (UnimplementedKsauServer) ListFolder(*ListFolderRequest, grpc.ServerStreamingServer[Item]) error {
+	return status.Errorf(codes.Unimplemented, "method ListFolder not implemented")
+}
+func (UnimplementedKsauServer) mustEmbedUnimplementedKsauServer() {}
+func (UnimplementedKsauServer) testEmbeddedByValue()              {}
+
+// UnsafeKsauServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to KsauServer will
+// result in compilation errors.
+type UnsafeKsauServer interface {
+	mustEmbedUnimplementedKsauServer()
+}
+
+func RegisterKsauServer(s grpc.ServiceRegistrar, srv KsauServer) {
+	// If the following call pancis, it indicates UnimplementedKsauServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Ksau_ServiceDesc, srv)
+}
+
+func _Ksau_SubmitJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SubmitJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KsauServer).SubmitJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Ksau_SubmitJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KsauServer).SubmitJob(ctx, req.(*SubmitJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Ksau_Upload_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubmitJobRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(KsauServer).Upload(m, &grpc.GenericServerStream[SubmitJobRequest, Job]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Ksau_UploadServer = grpc.ServerStreamingServer[Job]
+
+func _Ksau_WatchJob_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetJobRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(KsauServer).WatchJob(m, &grpc.GenericServerStream[GetJobRequest, Job]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Ksau_WatchJobServer = grpc.ServerStreamingServer[Job]
+
+func _Ksau_GetJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KsauServer).GetJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Ksau_GetJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KsauServer).GetJob(ctx, req.(*GetJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Ksau_ListJobs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListJobsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KsauServer).ListJobs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Ksau_ListJobs_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KsauServer).ListJobs(ctx, req.(*ListJobsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Ksau_CancelJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KsauServer).CancelJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Ksau_CancelJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KsauServer).CancelJob(ctx, req.(*GetJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Ksau_RetryJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KsauServer).RetryJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Ksau_RetryJob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KsauServer).RetryJob(ctx, req.(*GetJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Ksau_ListRemotes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRemotesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KsauServer).ListRemotes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Ksau_ListRemotes_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KsauServer).ListRemotes(ctx, req.(*ListRemotesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Ksau_GetQuota_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetQuotaRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KsauServer).GetQuota(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Ksau_GetQuota_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KsauServer).GetQuota(ctx, req.(*GetQuotaRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Ksau_ListFolder_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListFolderRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(KsauServer).ListFolder(m, &grpc.GenericServerStream[ListFolderRequest, Item]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Ksau_ListFolderServer = grpc.ServerStreamingServer[Item]
+
+// Ksau_ServiceDesc is the grpc.ServiceDesc for Ksau service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Ksau_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ksau.v1.Ksau",
+	HandlerType: (*KsauServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SubmitJob",
+			Handler:    _Ksau_SubmitJob_Handler,
+		},
+		{
+			MethodName: "GetJob",
+			Handler:    _Ksau_GetJob_Handler,
+		},
+		{
+			MethodName: "ListJobs",
+			Handler:    _Ksau_ListJobs_Handler,
+		},
+		{
+			MethodName: "CancelJob",
+			Handler:    _Ksau_CancelJob_Handler,
+		},
+		{
+			MethodName: "RetryJob",
+			Handler:    _Ksau_RetryJob_Handler,
+		},
+		{
+			MethodName: "ListRemotes",
+			Handler:    _Ksau_ListRemotes_Handler,
+		},
+		{
+			MethodName: "GetQuota",
+			Handler:    _Ksau_GetQuota_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Upload",
+			Handler:       _Ksau_Upload_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchJob",
+			Handler:       _Ksau_WatchJob_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ListFolder",
+			Handler:       _Ksau_ListFolder_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "ksau.proto",
+}
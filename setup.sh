@@ -63,7 +63,9 @@ curl -L "$DOWNLOAD_URL" -o "${TMP_DIR}/ksau-go" || error_exit "Failed to downloa
 chmod +x "${TMP_DIR}/ksau-go" || error_exit "Failed to make binary executable"
 
 # Create configuration directory
-if [ "$OS" = "linux" ] || [ "$OS" = "darwin" ]; then
+if [ "$OS" = "linux" ]; then
+    CONFIG_DIR="${XDG_CONFIG_HOME:-$HOME/.config}/ksau"
+elif [ "$OS" = "darwin" ]; then
     CONFIG_DIR="$HOME/.ksau/.conf"
 else
     CONFIG_DIR="$HOME/AppData/Roaming/ksau/.conf"